@@ -0,0 +1,106 @@
+package access
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/config"
+	"github.com/rohanchavan1918/kse-common/logging"
+)
+
+// Roles a token can grant
+const (
+	RoleAdmin      = "admin"
+	RoleCompliance = "compliance"
+)
+
+const staffContextKey = "access.staff"
+
+var (
+	mu     sync.RWMutex
+	tokens []config.AccessToken
+)
+
+// Configure sets the accepted tokens, it runs on startup and again on every
+// config reload
+func Configure(cfg *config.Access) {
+	mu.Lock()
+	defer mu.Unlock()
+	tokens = cfg.Tokens
+}
+
+// Lookup returns the configured token the request carries as bearer token
+func Lookup(r *http.Request) (config.AccessToken, bool) {
+	header := r.Header.Get("Authorization")
+	presented := strings.TrimPrefix(header, "Bearer ")
+	if presented == "" || presented == header {
+		return config.AccessToken{}, false
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, token := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Token), []byte(presented)) == 1 {
+			return token, true
+		}
+	}
+	return config.AccessToken{}, false
+}
+
+// Grants reports whether token has one of roles, admins have all of them
+func Grants(token config.AccessToken, roles ...string) bool {
+	for _, granted := range token.Roles {
+		if granted == RoleAdmin {
+			return true
+		}
+		for _, role := range roles {
+			if granted == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Allowed reports whether the request carries a token with one of roles
+func Allowed(c *gin.Context, roles ...string) bool {
+	token, ok := Lookup(c.Request)
+	if !ok || !Grants(token, roles...) {
+		return false
+	}
+	c.Set(staffContextKey, token.Name)
+	return true
+}
+
+// Require rejects requests without a token granting one of roles. Without
+// any tokens configured every request is rejected.
+func Require(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := Lookup(c.Request)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Missing or invalid access token",
+			})
+			return
+		}
+		if !Grants(token, roles...) {
+			logging.FromContext(c.Request.Context()).WithField("staff", token.Name).
+				Warnf("Access token without the %s role used on %s %s", strings.Join(roles, " or "), c.Request.Method, c.FullPath())
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Access token does not allow this",
+			})
+			return
+		}
+		c.Set(staffContextKey, token.Name)
+		c.Next()
+	}
+}
+
+// Staff returns the name of the token the request was let in with, empty
+// when it was not let in by a token
+func Staff(c *gin.Context) string {
+	return c.GetString(staffContextKey)
+}
@@ -0,0 +1,68 @@
+package access
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/config"
+)
+
+func TestRequire(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Configure(&config.Access{Tokens: []config.AccessToken{
+		{Name: "ops", Token: "admin-token-admin-token-admin-token", Roles: []string{RoleAdmin}},
+		{Name: "review", Token: "compliance-token-compliance-token", Roles: []string{RoleCompliance}},
+	}})
+	defer Configure(&config.Access{})
+
+	r := gin.New()
+	r.GET("/admin", Require(RoleAdmin), func(c *gin.Context) { c.String(http.StatusOK, Staff(c)) })
+	r.GET("/cases", Require(RoleCompliance), func(c *gin.Context) { c.String(http.StatusOK, Staff(c)) })
+
+	tests := []struct {
+		path          string
+		authorization string
+		status        int
+		staff         string
+	}{
+		{"/admin", "", http.StatusUnauthorized, ""},
+		{"/admin", "admin-token-admin-token-admin-token", http.StatusUnauthorized, ""},
+		{"/admin", "Bearer wrong", http.StatusUnauthorized, ""},
+		{"/admin", "Bearer admin-token-admin-token-admin-token", http.StatusOK, "ops"},
+		{"/admin", "Bearer compliance-token-compliance-token", http.StatusForbidden, ""},
+		{"/cases", "Bearer compliance-token-compliance-token", http.StatusOK, "review"},
+		// Admins have every role
+		{"/cases", "Bearer admin-token-admin-token-admin-token", http.StatusOK, "ops"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s with %q: status %d, want %d", tt.path, tt.authorization, w.Code, tt.status)
+		}
+		if tt.status == http.StatusOK && w.Body.String() != tt.staff {
+			t.Errorf("%s with %q: staff %q, want %q", tt.path, tt.authorization, w.Body.String(), tt.staff)
+		}
+	}
+}
+
+func TestRequireWithoutTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Configure(&config.Access{})
+
+	r := gin.New()
+	r.GET("/admin", Require(RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status %d without configured tokens, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,269 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/config"
+	"github.com/rohanchavan1918/kse-common/logging"
+)
+
+// Severity tells how urgent an alert is, sinks and routes can skip the
+// alerts below a severity
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Critical
+)
+
+var severityNames = []string{"info", "warning", "critical"}
+
+func (s Severity) String() string {
+	if s < Info || s > Critical {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ParseSeverity reads a severity from config, an empty one is Info
+func ParseSeverity(name string) (Severity, error) {
+	if name == "" {
+		return Info, nil
+	}
+	for i, known := range severityNames {
+		if strings.EqualFold(name, known) {
+			return Severity(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown severity %q", name)
+}
+
+// Alert is one thing that needs someone's attention. Alerts with the same
+// Key are duplicates, the Title is used when there is no key.
+type Alert struct {
+	Severity Severity          `json:"severity"`
+	Key      string            `json:"key"`
+	Title    string            `json:"title"`
+	Message  string            `json:"message"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Service  string            `json:"service"`
+	Time     time.Time         `json:"time"`
+	// Duplicates suppressed since the last alert with this key was sent
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+func (a Alert) dedupKey() string {
+	if a.Key != "" {
+		return a.Key
+	}
+	return a.Title
+}
+
+// Alerter delivers alerts somewhere, like a chat channel or a pager. Send
+// is retried when it fails, it must give up once ctx is done.
+type Alerter interface {
+	Send(ctx context.Context, a Alert) error
+}
+
+// Defaults for the settings left out of the alerting config
+const (
+	DefaultDedupWindow = 5 * time.Minute
+	DefaultQueueSize   = 100
+	DefaultMaxRetry    = 3
+	DefaultRetryWait   = time.Second
+	DefaultTimeout     = 10 * time.Second
+)
+
+// target is a sink alerts are routed to
+type target struct {
+	name        string
+	sink        Alerter
+	minSeverity Severity
+	limit       *limiter
+}
+
+type route struct {
+	minSeverity Severity
+	keyPrefix   string
+	sinks       []string
+}
+
+var (
+	mu          sync.RWMutex
+	serviceName string
+	settings    = withDefaults(config.Alerting{})
+	targets     = map[string]*target{}
+	routes      []route
+	// Sinks added with Use, they survive Configure
+	extra = map[string]Alerter{}
+)
+
+// Configure sets up the sinks and routes of base.Alerting, with the Slack
+// webhook of slack_url as the sink named slack. It can be called again to
+// change them while the service runs, alerts already queued are still
+// delivered to the sinks they were routed to.
+func Configure(base *config.Base) error {
+	cfg := withDefaults(base.Alerting)
+	sinks := cfg.Sinks
+	if base.SlackUrl != "" && !hasSink(sinks, config.LegacySlackSink) {
+		sinks = append(sinks, config.AlertSink{Name: config.LegacySlackSink, Type: "slack", URL: base.SlackUrl})
+	}
+	newTargets := make(map[string]*target, len(sinks))
+	for _, sinkConfig := range sinks {
+		sink, err := NewSink(sinkConfig)
+		if err != nil {
+			return err
+		}
+		minSeverity, err := ParseSeverity(sinkConfig.MinSeverity)
+		if err != nil {
+			return err
+		}
+		newTargets[sinkConfig.Name] = &target{
+			name:        sinkConfig.Name,
+			sink:        sink,
+			minSeverity: minSeverity,
+			limit:       newLimiter(sinkConfig.MaxPerMinute),
+		}
+	}
+	newRoutes := make([]route, 0, len(cfg.Routes))
+	for _, routeConfig := range cfg.Routes {
+		minSeverity, err := ParseSeverity(routeConfig.MinSeverity)
+		if err != nil {
+			return err
+		}
+		newRoutes = append(newRoutes, route{minSeverity: minSeverity, keyPrefix: routeConfig.KeyPrefix, sinks: routeConfig.Sinks})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	serviceName = base.ServiceName
+	settings = cfg
+	targets = newTargets
+	routes = newRoutes
+	startWorkers(cfg.QueueSize)
+	return nil
+}
+
+func withDefaults(cfg config.Alerting) config.Alerting {
+	if cfg.DedupWindow == 0 {
+		cfg.DedupWindow = DefaultDedupWindow
+	}
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.MaxRetry == 0 {
+		cfg.MaxRetry = DefaultMaxRetry
+	}
+	if cfg.RetryWait == 0 {
+		cfg.RetryWait = DefaultRetryWait
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return cfg
+}
+
+func hasSink(sinks []config.AlertSink, name string) bool {
+	for _, sink := range sinks {
+		if sink.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Use adds sink under name next to the configured ones. It gets every
+// alert, whatever the routes say, which suits tests and tools.
+func Use(name string, sink Alerter) {
+	mu.Lock()
+	defer mu.Unlock()
+	extra[name] = sink
+	startWorkers(DefaultQueueSize)
+}
+
+// routeAlert returns the sinks a should be delivered to. Callers hold mu.
+func routeAlert(a Alert) []*target {
+	names := map[string]bool{}
+	if len(routes) == 0 {
+		for name := range targets {
+			names[name] = true
+		}
+	}
+	for _, r := range routes {
+		if a.Severity >= r.minSeverity && strings.HasPrefix(a.dedupKey(), r.keyPrefix) {
+			for _, name := range r.sinks {
+				names[name] = true
+			}
+		}
+	}
+
+	matched := []*target{}
+	for name := range names {
+		if t, ok := targets[name]; ok && a.Severity >= t.minSeverity {
+			matched = append(matched, t)
+		}
+	}
+	for name, sink := range extra {
+		matched = append(matched, &target{name: name, sink: sink})
+	}
+	return matched
+}
+
+// Raise queues a for delivery to the sinks it is routed to and returns
+// right away. Duplicates of an alert sent less than the dedup window ago,
+// alerts over the rate limit of a sink and alerts that find the queue full
+// are dropped.
+func Raise(a Alert) {
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	mu.RLock()
+	if a.Service == "" {
+		a.Service = serviceName
+	}
+	matched := routeAlert(a)
+	cfg := settings
+	mu.RUnlock()
+
+	if len(matched) == 0 {
+		return
+	}
+	if !recent.allow(&a, cfg.DedupWindow) {
+		dropped("duplicate", a, "")
+		return
+	}
+	for _, t := range matched {
+		if t.limit != nil && !t.limit.allow(a.Time) {
+			dropped("rate_limited", a, t.name)
+			continue
+		}
+		enqueue(delivery{alert: a, target: t, maxRetry: cfg.MaxRetry, retryWait: cfg.RetryWait, timeout: cfg.Timeout})
+	}
+}
+
+// AndPanic logs err and alerts about it, waiting a while for the alert to
+// be delivered, before panicking
+func AndPanic(err error) {
+	logging.Logger().WithError(err).Error("Fatal error, panicking")
+	Raise(Alert{
+		Severity: Critical,
+		Key:      "panic: " + err.Error(),
+		Title:    "Fatal error",
+		Message:  err.Error(),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	if flushErr := Flush(ctx); flushErr != nil {
+		logging.Logger().WithError(flushErr).Error("Gave up waiting for alerts to be delivered")
+	}
+	panic(err)
+}
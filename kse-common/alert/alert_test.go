@@ -0,0 +1,240 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/config"
+)
+
+// recorder is a sink that keeps what it got, failing the first sends when
+// told to
+type recorder struct {
+	mu       sync.Mutex
+	failures int
+	attempts []time.Time
+	alerts   []Alert
+}
+
+func (r *recorder) Send(ctx context.Context, a Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, time.Now())
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("sink down")
+	}
+	r.alerts = append(r.alerts, a)
+	return nil
+}
+
+func (r *recorder) tries() []time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]time.Time(nil), r.attempts...)
+}
+
+func (r *recorder) received() []Alert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Alert(nil), r.alerts...)
+}
+
+// setup configures alerting afresh and adds a recorder with Use, which is
+// taken away again when the test ends
+func setup(t *testing.T, cfg config.Alerting) *recorder {
+	t.Helper()
+	if err := Configure(&config.Base{ServiceName: "test", Alerting: cfg}); err != nil {
+		t.Fatal(err)
+	}
+	recent = &dedup{sent: map[string]*sentKey{}}
+	r := &recorder{}
+	Use(t.Name(), r)
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(extra, t.Name())
+		mu.Unlock()
+		if err := Configure(&config.Base{}); err != nil {
+			t.Error(err)
+		}
+	})
+	return r
+}
+
+func flush(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Flush(ctx); err != nil {
+		t.Fatal("alerts were not delivered in time")
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	r := setup(t, config.Alerting{DedupWindow: time.Minute})
+	start := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	for _, a := range []Alert{
+		{Key: "db.down", Title: "DB down", Time: start},
+		// Duplicates within the window are suppressed
+		{Key: "db.down", Title: "DB down", Time: start.Add(10 * time.Second)},
+		{Key: "db.down", Title: "DB down again", Time: start.Add(59 * time.Second)},
+		// Other keys are not
+		{Key: "kafka.down", Title: "Kafka down", Time: start.Add(20 * time.Second)},
+		// Without a key the title is the key
+		{Title: "Disk full", Time: start},
+		{Title: "Disk full", Time: start.Add(time.Second)},
+		// Once the window is over the next one goes out with the count
+		{Key: "db.down", Title: "DB down", Time: start.Add(time.Minute)},
+	} {
+		Raise(a)
+	}
+	flush(t)
+
+	got := map[string][]int{}
+	for _, a := range r.received() {
+		got[a.dedupKey()] = append(got[a.dedupKey()], a.Suppressed)
+	}
+	for _, suppressed := range got {
+		sort.Ints(suppressed)
+	}
+	want := map[string][]int{"db.down": {0, 2}, "kafka.down": {0}, "Disk full": {0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sent with suppressed counts %v, want %v", got, want)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	server, received := sinkServer(t)
+	setup(t, config.Alerting{Sinks: []config.AlertSink{
+		{Name: "limited", Type: "webhook", URL: server.URL + "/limited", MaxPerMinute: 2},
+		{Name: "unlimited", Type: "webhook", URL: server.URL + "/unlimited"},
+	}})
+	start := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	for i, at := range []time.Duration{0, time.Second, 2 * time.Second, 59 * time.Second, time.Minute} {
+		Raise(Alert{Key: "key-" + string(rune('a'+i)), Time: start.Add(at)})
+	}
+	flush(t)
+
+	// The fifth alert starts a new minute
+	if got := received("/limited"); strings.Join(got, ",") != "key-a,key-b,key-e" {
+		t.Errorf("limited sink got %v, want key-a, key-b and key-e", got)
+	}
+	if got := received("/unlimited"); len(got) != 5 {
+		t.Errorf("unlimited sink got %v, want all 5", got)
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		attempts  int
+		delivered bool
+	}{
+		{"first try", 0, 1, true},
+		{"after failures", 2, 3, true},
+		{"given up", 5, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setup(t, config.Alerting{MaxRetry: 2, RetryWait: 20 * time.Millisecond})
+			r.mu.Lock()
+			r.failures = tt.failures
+			r.mu.Unlock()
+
+			Raise(Alert{Key: "retry." + tt.name})
+			flush(t)
+
+			attempts := r.tries()
+			if len(attempts) != tt.attempts {
+				t.Fatalf("%d attempts, want %d", len(attempts), tt.attempts)
+			}
+			if delivered := len(r.received()) == 1; delivered != tt.delivered {
+				t.Errorf("delivered is %v, want %v", delivered, tt.delivered)
+			}
+			// The wait doubles after every failure
+			for i := 1; i < len(attempts); i++ {
+				want := 20 * time.Millisecond << (i - 1)
+				if wait := attempts[i].Sub(attempts[i-1]); wait < want {
+					t.Errorf("attempt %d came after %s, want at least %s", i+1, wait, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRouting(t *testing.T) {
+	server, received := sinkServer(t)
+	r := setup(t, config.Alerting{
+		Sinks: []config.AlertSink{
+			{Name: "chat", Type: "webhook", URL: server.URL + "/chat"},
+			{Name: "pager", Type: "webhook", URL: server.URL + "/pager", MinSeverity: "critical"},
+			{Name: "db-team", Type: "webhook", URL: server.URL + "/db-team"},
+			{Name: "unrouted", Type: "webhook", URL: server.URL + "/unrouted"},
+		},
+		Routes: []config.AlertRoute{
+			{Sinks: []string{"chat", "pager"}},
+			{KeyPrefix: "db.", MinSeverity: "warning", Sinks: []string{"db-team"}},
+		},
+	})
+
+	Raise(Alert{Key: "db.slow", Severity: Info})
+	Raise(Alert{Key: "db.down", Severity: Critical})
+	Raise(Alert{Key: "kafka.lag", Severity: Warning})
+	flush(t)
+
+	want := map[string]string{
+		"/chat":     "db.down,db.slow,kafka.lag",
+		"/pager":    "db.down",
+		"/db-team":  "db.down",
+		"/unrouted": "",
+	}
+	for path, keys := range want {
+		if got := strings.Join(received(path), ","); got != keys {
+			t.Errorf("%s got %q, want %q", path, got, keys)
+		}
+	}
+	// Sinks added with Use get everything
+	if got := len(r.received()); got != 3 {
+		t.Errorf("sink added with Use got %d alerts, want 3", got)
+	}
+}
+
+// sinkServer stands in for webhook sinks, received returns the keys of the
+// alerts posted to a path, sorted
+func sinkServer(t *testing.T) (*httptest.Server, func(path string) []string) {
+	t.Helper()
+	var mu sync.Mutex
+	keys := map[string][]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a struct {
+			Key string `json:"key"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		keys[r.URL.Path] = append(keys[r.URL.Path], a.Key)
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return server, func(path string) []string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := append([]string(nil), keys[path]...)
+		sort.Strings(got)
+		return got
+	}
+}
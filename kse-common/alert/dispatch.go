@@ -0,0 +1,187 @@
+package alert
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// workers deliver alerts side by side, so one slow sink does not hold up
+// the others
+const workers = 4
+
+// delivery is an alert on its way to one sink, with the retry settings in
+// force when it was raised
+type delivery struct {
+	alert     Alert
+	target    *target
+	maxRetry  int
+	retryWait time.Duration
+	timeout   time.Duration
+}
+
+var (
+	queue     chan delivery
+	startOnce sync.Once
+	// Deliveries queued or being sent, Flush waits for them
+	pending int64
+)
+
+// startWorkers creates the queue with room for size alerts the first time
+// it is called, a later size is ignored
+func startWorkers(size int) {
+	startOnce.Do(func() {
+		queue = make(chan delivery, size)
+		for i := 0; i < workers; i++ {
+			go func() {
+				for d := range queue {
+					deliver(d)
+				}
+			}()
+		}
+	})
+}
+
+func enqueue(d delivery) {
+	atomic.AddInt64(&pending, 1)
+	select {
+	case queue <- d:
+	default:
+		atomic.AddInt64(&pending, -1)
+		dropped("overflow", d.alert, d.target.name)
+	}
+}
+
+// deliver sends d, retrying with a backoff that doubles every attempt
+func deliver(d delivery) {
+	defer atomic.AddInt64(&pending, -1)
+
+	var err error
+	wait := d.retryWait
+	for attempt := 0; attempt <= d.maxRetry; attempt++ {
+		if attempt > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		err = d.target.sink.Send(ctx, d.alert)
+		cancel()
+		if err == nil {
+			return
+		}
+	}
+	metrics.AlertDropped("failed")
+	logging.Logger().WithError(err).WithFields(log.Fields{
+		"sink":      d.target.name,
+		"alert_key": d.alert.dedupKey(),
+	}).Errorf("Failed to deliver alert after %d attempts", d.maxRetry+1)
+}
+
+// Flush waits until every queued alert was delivered or given up on, or
+// until ctx is done
+func Flush(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&pending) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func dropped(reason string, a Alert, sink string) {
+	metrics.AlertDropped(reason)
+	entry := logging.Logger().WithFields(log.Fields{
+		"alert_key": a.dedupKey(),
+		"reason":    reason,
+	})
+	if sink != "" {
+		entry = entry.WithField("sink", sink)
+	}
+	if reason == "duplicate" {
+		entry.Debug("Alert suppressed")
+		return
+	}
+	entry.Warn("Alert dropped")
+}
+
+// maxTracked bounds the keys dedup remembers, the ones past their window are
+// forgotten once there are more
+const maxTracked = 1000
+
+var recent = &dedup{sent: map[string]*sentKey{}}
+
+// dedup remembers when alerts were last sent by key
+type dedup struct {
+	mu   sync.Mutex
+	sent map[string]*sentKey
+}
+
+type sentKey struct {
+	at         time.Time
+	suppressed int
+}
+
+// allow reports whether a should be sent, that is whether no alert with its
+// key was sent within window. An alert that is let through carries the
+// count of duplicates suppressed before it.
+func (d *dedup) allow(a *Alert, window time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := a.dedupKey()
+	if last, ok := d.sent[key]; ok && a.Time.Sub(last.at) < window {
+		last.suppressed++
+		return false
+	} else if ok {
+		a.Suppressed = last.suppressed
+	}
+
+	if len(d.sent) >= maxTracked {
+		for k, last := range d.sent {
+			if a.Time.Sub(last.at) >= window {
+				delete(d.sent, k)
+			}
+		}
+	}
+	d.sent[key] = &sentKey{at: a.Time}
+	return true
+}
+
+// limiter lets through max alerts a minute
+type limiter struct {
+	mu    sync.Mutex
+	max   int
+	start time.Time
+	count int
+}
+
+// newLimiter returns nil, which limits nothing, for a max of zero
+func newLimiter(max int) *limiter {
+	if max == 0 {
+		return nil
+	}
+	return &limiter{max: max}
+}
+
+func (l *limiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.start) >= time.Minute {
+		l.start = now
+		l.count = 0
+	}
+	if l.count >= l.max {
+		return false
+	}
+	l.count++
+	return true
+}
@@ -0,0 +1,217 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/config"
+)
+
+// PagerDutyURL is the Events API v2 endpoint pagerduty sinks post to when
+// no url is given
+const PagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// NewSink returns the sink cfg describes
+func NewSink(cfg config.AlertSink) (Alerter, error) {
+	switch cfg.Type {
+	case "slack":
+		return &Slack{URL: cfg.URL}, nil
+	case "webhook":
+		return &Webhook{URL: cfg.URL}, nil
+	case "pagerduty":
+		url := cfg.URL
+		if url == "" {
+			url = PagerDutyURL
+		}
+		return &PagerDuty{URL: url, RoutingKey: cfg.RoutingKey}, nil
+	case "smtp":
+		port := cfg.SMTPPort
+		if port == 0 {
+			port = 25
+		}
+		sink := &Email{Addr: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(port)), From: cfg.From, To: cfg.To}
+		if cfg.SMTPUsername != "" {
+			sink.Auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+		}
+		return sink, nil
+	}
+	return nil, fmt.Errorf("unknown alert sink type %q", cfg.Type)
+}
+
+// summary is the one line an alert is shown as
+func summary(a Alert) string {
+	line := fmt.Sprintf("[%s] %s: %s", a.Service, strings.ToUpper(a.Severity.String()), a.Title)
+	if a.Suppressed > 0 {
+		line += fmt.Sprintf(" (%d similar suppressed)", a.Suppressed)
+	}
+	return line
+}
+
+// sortedFields lists the fields of a as key: value lines in key order
+func sortedFields(a Alert) []string {
+	lines := make([]string, 0, len(a.Fields))
+	for key, value := range a.Fields {
+		lines = append(lines, key+": "+value)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// Slack posts alerts to a Slack incoming webhook
+type Slack struct {
+	URL string
+}
+
+type slackPayload struct {
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Types string    `json:"type"`
+	Text  slackText `json:"text,omitempty"`
+}
+
+type slackText struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Verbatim bool   `json:"verbatim"`
+}
+
+func (s *Slack) Send(ctx context.Context, a Alert) error {
+	blocks := []slackBlock{
+		{Types: "section", Text: slackText{Type: "mrkdwn", Text: "*" + summary(a) + "*"}},
+		{Types: "section", Text: slackText{Type: "mrkdwn", Text: a.Message}},
+	}
+	if fields := sortedFields(a); len(fields) > 0 {
+		blocks = append(blocks, slackBlock{Types: "section", Text: slackText{Type: "mrkdwn", Text: strings.Join(fields, "\n")}})
+	}
+	return post(ctx, s.URL, slackPayload{Blocks: blocks})
+}
+
+// Webhook posts alerts as JSON to any URL
+type Webhook struct {
+	URL string
+}
+
+func (w *Webhook) Send(ctx context.Context, a Alert) error {
+	return post(ctx, w.URL, a)
+}
+
+// PagerDuty triggers incidents with the PagerDuty Events API v2, the alert
+// key is the dedup key so repeats land on the same incident
+type PagerDuty struct {
+	URL        string
+	RoutingKey string
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key,omitempty"`
+	Payload     pagerDutyPayload `json:"payload"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+func (p *PagerDuty) Send(ctx context.Context, a Alert) error {
+	details := map[string]string{"message": a.Message}
+	for key, value := range a.Fields {
+		details[key] = value
+	}
+	return post(ctx, p.URL, pagerDutyEvent{
+		RoutingKey:  p.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    a.dedupKey(),
+		Payload: pagerDutyPayload{
+			Summary:       summary(a),
+			Source:        a.Service,
+			Severity:      a.Severity.String(),
+			Timestamp:     a.Time.Format(time.RFC3339),
+			CustomDetails: details,
+		},
+	})
+}
+
+// Email mails alerts over SMTP. Auth is only used when set, so a local fake
+// server like MailHog works without credentials.
+type Email struct {
+	Addr string
+	Auth smtp.Auth
+	From string
+	To   []string
+}
+
+func (e *Email) Send(ctx context.Context, a Alert) error {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", e.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(e.To, ", "))
+	// A title with line breaks would add headers of its own
+	fmt.Fprintf(&body, "Subject: %s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(summary(a)))
+	fmt.Fprintf(&body, "Date: %s\r\n", a.Time.Format(time.RFC1123Z))
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body.WriteString(a.Message + "\r\n")
+	for _, field := range sortedFields(a) {
+		body.WriteString(field + "\r\n")
+	}
+
+	// net/smtp takes no context, stop waiting for it instead
+	sent := make(chan error, 1)
+	go func() { sent <- smtp.SendMail(e.Addr, e.Auth, e.From, e.To, body.Bytes()) }()
+	select {
+	case err := <-sent:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// post sends body as JSON to endpoint, non 2xx responses are errors. The
+// endpoint is left out of errors, webhook urls are secrets.
+func post(ctx context.Context, endpoint string, body interface{}) error {
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(requestBody))
+	if err != nil {
+		return errors.New("invalid alert endpoint url")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("alert endpoint unreachable : %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("alert endpoint returned %s : %s", resp.Status, bytes.TrimSpace(responseBody))
+	}
+	return nil
+}
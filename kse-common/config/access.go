@@ -0,0 +1,16 @@
+package config
+
+// Access lists the tokens operators and back office tools authenticate
+// with, sent as bearer tokens
+type Access struct {
+	Tokens []AccessToken `validate:"dive" reload:"live" mapstructure:"tokens"`
+}
+
+// AccessToken grants its holder the listed roles, admin or compliance.
+// Admins may do everything.
+type AccessToken struct {
+	// Who holds the token, it shows up in logs instead of the token
+	Name  string   `viper:"string" validate:"required" mapstructure:"name"`
+	Token string   `viper:"string" validate:"required,min=32" secret:"true" mapstructure:"token"`
+	Roles []string `validate:"required,dive,oneof=admin compliance" mapstructure:"roles"`
+}
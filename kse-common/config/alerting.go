@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LegacySlackSink is the name of the Slack sink slack_url sets up, routes
+// can send alerts to it like to any sink in alerting.sinks. A sink of that
+// name in alerting.sinks takes its place.
+const LegacySlackSink = "slack"
+
+// Alerting specifies where alerts are sent. An alert goes to the sinks of
+// every route it matches, or to every sink when there are no routes, and
+// each sink then skips the alerts below its min_severity. Alerts with the
+// key of one sent less than DedupWindow ago are suppressed. Everything but
+// the queue size can change while the service runs.
+type Alerting struct {
+	Sinks       []AlertSink   `validate:"dive" reload:"live" mapstructure:"sinks"`
+	Routes      []AlertRoute  `validate:"dive" reload:"live" mapstructure:"routes"`
+	DedupWindow time.Duration `viper:"string" validate:"gte=0" reload:"live" mapstructure:"dedup_window"`
+	// Alerts waiting to be delivered, more are dropped
+	QueueSize int           `viper:"int" validate:"gte=0" mapstructure:"queue_size"`
+	MaxRetry  int           `viper:"int" validate:"gte=0" reload:"live" mapstructure:"max_retry"`
+	RetryWait time.Duration `viper:"string" validate:"gte=0" reload:"live" mapstructure:"retry_wait"`
+	Timeout   time.Duration `viper:"string" validate:"gte=0" reload:"live" mapstructure:"timeout"`
+}
+
+// AlertSink is one place alerts are delivered to. Type picks the fields
+// that apply: url for slack and webhook, url and routing_key for pagerduty,
+// and the smtp_ ones for smtp.
+type AlertSink struct {
+	Name        string `viper:"string" validate:"required" mapstructure:"name"`
+	Type        string `viper:"string" validate:"required,oneof=slack webhook smtp pagerduty" mapstructure:"type"`
+	MinSeverity string `viper:"string" validate:"omitempty,oneof=info warning critical" mapstructure:"min_severity"`
+	// Alerts delivered per minute at most, the others are dropped. Zero
+	// does not limit them.
+	MaxPerMinute int `viper:"int" validate:"gte=0" mapstructure:"max_per_minute"`
+
+	URL        string `viper:"string" secret:"true" mapstructure:"url"`
+	RoutingKey string `viper:"string" secret:"true" mapstructure:"routing_key"`
+
+	SMTPHost     string   `viper:"string" mapstructure:"smtp_host"`
+	SMTPPort     int      `viper:"int" validate:"gte=0,lte=65535" mapstructure:"smtp_port"`
+	SMTPUsername string   `viper:"string" mapstructure:"smtp_username"`
+	SMTPPassword string   `viper:"string" secret:"true" mapstructure:"smtp_password"`
+	From         string   `viper:"string" mapstructure:"from"`
+	To           []string `mapstructure:"to"`
+}
+
+func (s *AlertSink) Validate() error {
+	switch s.Type {
+	case "slack", "webhook":
+		if s.URL == "" {
+			return fmt.Errorf("%s sink %q needs a url", s.Type, s.Name)
+		}
+	case "pagerduty":
+		if s.RoutingKey == "" {
+			return fmt.Errorf("pagerduty sink %q needs a routing_key", s.Name)
+		}
+	case "smtp":
+		if s.SMTPHost == "" || s.From == "" || len(s.To) == 0 {
+			return fmt.Errorf("smtp sink %q needs smtp_host, from and to", s.Name)
+		}
+	}
+	return nil
+}
+
+// AlertRoute sends the alerts of at least MinSeverity whose key starts
+// with KeyPrefix to Sinks
+type AlertRoute struct {
+	MinSeverity string   `viper:"string" validate:"omitempty,oneof=info warning critical" mapstructure:"min_severity"`
+	KeyPrefix   string   `viper:"string" mapstructure:"key_prefix"`
+	Sinks       []string `validate:"required,min=1" mapstructure:"sinks"`
+}
+
+func (a *Alerting) Validate() error {
+	names := map[string]bool{}
+	for _, sink := range a.Sinks {
+		if names[sink.Name] {
+			return fmt.Errorf("sink name %q is used twice", sink.Name)
+		}
+		names[sink.Name] = true
+	}
+	for _, route := range a.Routes {
+		for _, name := range route.Sinks {
+			if !names[name] && name != LegacySlackSink {
+				return errors.New("routes send alerts to unknown sink " + name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+)
+
+// Command returns the config command. `config validate` loads the config
+// file into out, a pointer to the service's config struct, and reports what
+// is wrong with it without starting the service.
+func Command(out interface{}) *cobra.Command {
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the config file without starting the service",
+		Args:  cobra.NoArgs,
+		// main reports the error, cobra would print it a second time
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := Load(cmd, out); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Config is valid")
+			return nil
+		},
+	}
+
+	encryptCmd := &cobra.Command{
+		Use:   "encrypt-secrets <secrets.json> <output>",
+		Short: "Encrypt a JSON object of secrets with the key in " + SecretsKeyEnv,
+		Long: "Encrypt a JSON object of secrets with the key in " + SecretsKeyEnv + ". Point secrets_file at the\n" +
+			"output and refer to a secret with secret:<name> in the config.",
+		Args:          cobra.ExactArgs(2),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			secrets := map[string]string{}
+			if err := json.Unmarshal(data, &secrets); err != nil {
+				return fmt.Errorf("%s must hold a JSON object of strings : %s", args[0], err)
+			}
+			sealed, err := EncryptSecrets(secrets)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(args[1], sealed, 0600); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Encrypted %d secrets to %s\n", len(secrets), args[1])
+			return nil
+		},
+	}
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Work with the service config",
+	}
+	configCmd.AddCommand(validateCmd, encryptCmd)
+	return configCmd
+}
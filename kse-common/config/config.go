@@ -0,0 +1,80 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Base holds the settings every service has. Services embed it in their own
+// Config with `mapstructure:",squash"` so the keys stay at the top level.
+type Base struct {
+	Port        int64         `viper:"int" validate:"required,min=1,max=65535"`
+	ServiceName string        `viper:"string" validate:"required" mapstructure:"service_name"`
+	DB          DB            `mapstructure:"db"`
+	Redis       Redis         `mapstructure:"redis"`
+	Fluent      Fluent        `mapstructure:"fluent"`
+	LogConfig   LoggingConfig `mapstructure:"log_config"`
+	Tracing     Tracing       `mapstructure:"tracing"`
+	Alerting    Alerting      `mapstructure:"alerting"`
+	Health      Health        `mapstructure:"health"`
+	Access      Access        `mapstructure:"access"`
+	SlackUrl    string        `secret:"true" reload:"live" mapstructure:"slack_url"`
+
+	// Addresses or CIDR ranges of the load balancers in front of the
+	// service. X-Forwarded-For is only believed when a request comes from
+	// one of them, without any the client IP is always the peer address.
+	TrustedProxies []string `validate:"dive,ip|cidr" mapstructure:"trusted_proxies"`
+
+	// Encrypted file that secret: references are read from
+	SecretsFile string `viper:"string" mapstructure:"secrets_file"`
+}
+
+// Load reads the file given with --config, ./config/config.json by default,
+// into out, resolves secret references and validates it. Environment
+// variables override file values, with dots in keys replaced by underscores
+// (DB_DB_HOST for db.db_host).
+func Load(cmd *cobra.Command, out interface{}) error {
+	if err := viper.BindPFlags(cmd.Flags()); err != nil {
+		return err
+	}
+
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+
+	if configFile, _ := cmd.Flags().GetString("config"); configFile != "" {
+		viper.SetConfigFile(configFile)
+	} else {
+		viper.SetConfigFile("./config/config.json")
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		return err
+	}
+	return decode(out)
+}
+
+// Reread reads the config file Load was given again into out, a new value
+// of the same type, with secrets resolved and validated
+func Reread(out interface{}) error {
+	if err := viper.ReadInConfig(); err != nil {
+		return err
+	}
+	return decode(out)
+}
+
+// Settings returns the shared settings, services get it through embedding
+func (b *Base) Settings() *Base {
+	return b
+}
+
+func decode(out interface{}) error {
+	if err := viper.Unmarshal(out); err != nil {
+		return err
+	}
+	if err := ResolveSecrets(out, viper.GetString("secrets_file")); err != nil {
+		return err
+	}
+	return Validate(out)
+}
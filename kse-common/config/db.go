@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type DB struct {
+	DBType string `viper:"string" validate:"required,oneof=mysql postgres" mapstructure:"db_type"`
+	DBHost string `viper:"string" validate:"required" mapstructure:"db_host"`
+	DBPort string `viper:"string" validate:"required" mapstructure:"db_port"`
+	DBUser string `viper:"string" validate:"required" mapstructure:"db_user"`
+	DBPass string `viper:"string" secret:"true" mapstructure:"db_pass"`
+	DBName string `viper:"string" mapstructure:"db_name"`
+}
+
+func (db *DB) GetConnectionString() string {
+	switch db.DBType {
+	case "mysql":
+		return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+			db.DBUser, db.DBPass, db.DBHost, db.DBPort, db.DBName)
+
+	case "postgres":
+		return fmt.Sprintf("host=%s port=%s user=%s "+
+			"password=%s dbname=%s sslmode=disable",
+			db.DBHost, db.DBPort, db.DBUser, db.DBPass, db.DBName)
+	}
+	return ""
+}
+
+func (db *DB) Validate() error {
+	// The port is a string so it can come straight from the environment
+	if port, err := strconv.Atoi(db.DBPort); db.DBPort != "" && (err != nil || port < 1 || port > 65535) {
+		return fmt.Errorf("db_port must be a port number, got %q", db.DBPort)
+	}
+	return nil
+}
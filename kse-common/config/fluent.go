@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+// Fluent specifies the Fluentd or Fluent Bit forward input logs are shipped
+// to, next to stdout and the log file. Nothing is forwarded without a host.
+// Entries wait in a buffer of BufferLimit entries while the endpoint is
+// slow or down, and are dropped once it is full or once MaxRetry attempts
+// to send them failed, logging never blocks the service.
+type Fluent struct {
+	Host string `viper:"string" mapstructure:"fluent_host"`
+	Port int    `viper:"int" validate:"gte=0,lte=65535" mapstructure:"fluent_port"`
+	// Tag of every entry, kse.<service_name> when left out
+	Tag         string        `viper:"string" mapstructure:"tag"`
+	BufferLimit int           `viper:"int" validate:"gte=0" mapstructure:"buffer_limit"`
+	MaxRetry    int           `viper:"int" validate:"gte=0" mapstructure:"max_retry"`
+	RetryWait   time.Duration `viper:"string" validate:"gte=0" mapstructure:"retry_wait"`
+	Timeout     time.Duration `viper:"string" validate:"gte=0" mapstructure:"timeout"`
+}
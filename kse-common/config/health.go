@@ -0,0 +1,12 @@
+package config
+
+import "time"
+
+// Health tunes the /livez and /readyz checks
+type Health struct {
+	// How long a single check may take, 2s when left out
+	Timeout time.Duration `viper:"string" validate:"gte=0" reload:"live" mapstructure:"timeout"`
+	// Lag over which a consumer group makes the service not ready, zero
+	// ignores lag
+	MaxConsumerLag int64 `viper:"int" validate:"gte=0" reload:"live" mapstructure:"max_consumer_lag"`
+}
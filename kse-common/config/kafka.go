@@ -0,0 +1,273 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/metrics"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+var ErrKafkaNotConfigured = errors.New("Kafka brokers or topic cannot be empty")
+
+// Kafka is the broker connection shared by all services. Services embed it
+// in their own KafkaConfig next to the topics they use. Brokers lists the
+// host:port of the brokers of a cluster, kafka_host and kafka_port name a
+// single one when it is left out.
+type Kafka struct {
+	Host    string   `viper:"string" mapstructure:"kafka_host"`
+	Port    int64    `viper:"string" validate:"omitempty,min=1,max=65535" mapstructure:"kafka_port"`
+	Brokers []string `mapstructure:"brokers"`
+	GroupID string   `viper:"string" mapstructure:"group_id"`
+
+	// Sent with every request, so brokers can tell the services apart in
+	// their logs and quotas
+	ClientID string `viper:"string" mapstructure:"client_id"`
+	// How long connecting to a broker may take, 10s when left out
+	DialTimeout time.Duration `viper:"string" validate:"gte=0" mapstructure:"dial_timeout"`
+
+	TLS  KafkaTLS  `mapstructure:"tls"`
+	SASL KafkaSASL `mapstructure:"sasl"`
+
+	Provision KafkaProvision `mapstructure:"provision"`
+}
+
+// KafkaTLS turns on TLS to the brokers. The system roots verify them unless
+// a CA file is given, a cert and key file authenticate the client.
+type KafkaTLS struct {
+	Enabled            bool   `viper:"bool" mapstructure:"enabled"`
+	CAFile             string `viper:"string" mapstructure:"ca_file"`
+	CertFile           string `viper:"string" mapstructure:"cert_file"`
+	KeyFile            string `viper:"string" mapstructure:"key_file"`
+	ServerName         string `viper:"string" mapstructure:"server_name"`
+	InsecureSkipVerify bool   `viper:"bool" mapstructure:"insecure_skip_verify"`
+}
+
+// KafkaSASL authenticates to the brokers, no mechanism means no SASL
+type KafkaSASL struct {
+	Mechanism string `viper:"string" validate:"omitempty,oneof=plain scram-sha-256 scram-sha-512" mapstructure:"mechanism"`
+	Username  string `viper:"string" mapstructure:"username"`
+	Password  string `viper:"string" secret:"true" mapstructure:"password"`
+}
+
+// KafkaProvision is how the topics a service uses should be set up, by the
+// topics command or when the service starts. Defaults apply to all of them,
+// Topics overrides them by name and can add topics the service does not use.
+type KafkaProvision struct {
+	// Create missing topics and fix the settings of existing ones on startup
+	EnsureOnStartup bool                  `viper:"bool" mapstructure:"ensure_on_startup"`
+	Defaults        KafkaTopic            `mapstructure:"defaults"`
+	Topics          map[string]KafkaTopic `validate:"dive" mapstructure:"topics"`
+}
+
+// KafkaTopic is the setup of a topic, zero values are left to the brokers
+type KafkaTopic struct {
+	Partitions        int `viper:"int" validate:"gte=0" mapstructure:"partitions"`
+	ReplicationFactor int `viper:"int" validate:"gte=0" mapstructure:"replication_factor"`
+	// How long messages are kept, a negative value keeps them forever
+	Retention time.Duration `viper:"string" mapstructure:"retention"`
+	// delete, compact, or compact,delete for compacted topics that also
+	// expire, compact suits topics that only need the latest message per
+	// key, like last prices
+	CleanupPolicy string `viper:"string" mapstructure:"cleanup_policy"`
+}
+
+func (t *KafkaTopic) Validate() error {
+	switch t.CleanupPolicy {
+	case "", "delete", "compact", "compact,delete", "delete,compact":
+		return nil
+	}
+	return fmt.Errorf("cleanup_policy must be delete, compact or compact,delete, got %q", t.CleanupPolicy)
+}
+
+// Topic returns the setup of topic, its overrides on top of the defaults
+func (p *KafkaProvision) Topic(topic string) KafkaTopic {
+	spec := p.Defaults
+	override, ok := p.Topics[topic]
+	if !ok {
+		return spec
+	}
+	if override.Partitions != 0 {
+		spec.Partitions = override.Partitions
+	}
+	if override.ReplicationFactor != 0 {
+		spec.ReplicationFactor = override.ReplicationFactor
+	}
+	if override.Retention != 0 {
+		spec.Retention = override.Retention
+	}
+	if override.CleanupPolicy != "" {
+		spec.CleanupPolicy = override.CleanupPolicy
+	}
+	return spec
+}
+
+func (c *Kafka) Validate() error {
+	if len(c.Brokers) == 0 && (c.Host == "" || c.Port == 0) {
+		return errors.New("brokers, or kafka_host and kafka_port, are required")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("tls.cert_file and tls.key_file go together")
+	}
+	if c.SASL.Mechanism != "" && c.SASL.Username == "" {
+		return fmt.Errorf("sasl.username is required for %s", c.SASL.Mechanism)
+	}
+	return nil
+}
+
+// BrokerList returns the addresses of the brokers
+func (c *Kafka) BrokerList() []string {
+	if len(c.Brokers) > 0 {
+		return c.Brokers
+	}
+	if c.Host == "" || c.Port == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s:%d", c.Host, c.Port)}
+}
+
+// tlsConfig returns nil when TLS is off
+func (c *Kafka) tlsConfig() (*tls.Config, error) {
+	if !c.TLS.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.TLS.ServerName,
+		InsecureSkipVerify: c.TLS.InsecureSkipVerify,
+	}
+	if c.TLS.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read Kafka CA file : %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in Kafka CA file %s", c.TLS.CAFile)
+		}
+	}
+	if c.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load Kafka client certificate : %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// saslMechanism returns nil when SASL is off
+func (c *Kafka) saslMechanism() (sasl.Mechanism, error) {
+	switch c.SASL.Mechanism {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: c.SASL.Username, Password: c.SASL.Password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, c.SASL.Username, c.SASL.Password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, c.SASL.Username, c.SASL.Password)
+	}
+	return nil, fmt.Errorf("unknown SASL mechanism %q", c.SASL.Mechanism)
+}
+
+// Dialer returns the dialer readers and writers connect to the brokers
+// with, TLS, SASL, client id and timeout included
+func (c *Kafka) Dialer() (*kafka.Dialer, error) {
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := c.saslMechanism()
+	if err != nil {
+		return nil, err
+	}
+	dialer := &kafka.Dialer{
+		Timeout:       c.DialTimeout,
+		DualStack:     true,
+		ClientID:      c.ClientID,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}
+	if dialer.Timeout == 0 {
+		dialer.Timeout = kafka.DefaultDialer.Timeout
+	}
+	if dialer.ClientID == "" {
+		dialer.ClientID = kafka.DefaultDialer.ClientID
+	}
+	return dialer, nil
+}
+
+// Client returns a client for admin requests to the brokers, like reading
+// metadata and offsets, connecting the way Dialer does. Every client keeps
+// its own connections, reuse it or close them with CloseClient.
+func (c *Kafka) Client() (*kafka.Client, error) {
+	brokers := c.BrokerList()
+	if len(brokers) == 0 {
+		return nil, ErrKafkaNotConfigured
+	}
+	dialer, err := c.Dialer()
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Client{Addr: kafka.TCP(brokers...), Transport: metrics.Transport(dialer)}, nil
+}
+
+// CloseClient closes the connections of a client made by Client that is
+// not used again
+func CloseClient(client *kafka.Client) {
+	if transport, ok := client.Transport.(*kafka.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+}
+
+// GetProducer returns a writer for topic, messages with the same key always
+// land on the same partition. Its stats are exported as metrics, so create
+// one per topic and reuse it.
+func (c *Kafka) GetProducer(topic string) (*kafka.Writer, error) {
+	brokers := c.BrokerList()
+	if len(brokers) == 0 || topic == "" {
+		return nil, ErrKafkaNotConfigured
+	}
+	dialer, err := c.Dialer()
+	if err != nil {
+		return nil, err
+	}
+	writer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:  brokers,
+		Topic:    topic,
+		Balancer: &kafka.Hash{},
+		Dialer:   dialer,
+	})
+	metrics.TrackWriter(writer)
+	return writer, nil
+}
+
+// GetConsumer returns a reader for topic. With an empty groupID the reader
+// is not part of a consumer group and reads a single partition. Its stats
+// and lag are exported as metrics.
+func (c *Kafka) GetConsumer(topic, groupID string) (*kafka.Reader, error) {
+	brokers := c.BrokerList()
+	if len(brokers) == 0 || topic == "" {
+		return nil, ErrKafkaNotConfigured
+	}
+	dialer, err := c.Dialer()
+	if err != nil {
+		return nil, err
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: brokers,
+		Topic:   topic,
+		GroupID: groupID,
+		Dialer:  dialer,
+	})
+	metrics.TrackReader(reader)
+	return reader, nil
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LoggingConfig specifies all the parameters needed for logging. Without a
+// file, logs only go to stdout. Format is json, the default, or text for
+// reading logs in a terminal.
+type LoggingConfig struct {
+	Level      string `viper:"string" reload:"live" mapstructure:"level"`
+	Format     string `viper:"string" validate:"omitempty,oneof=json text" mapstructure:"format"`
+	File       string `viper:"string" mapstructure:"file"`
+	Rotate     int64  `viper:"string" mapstructure:"rotate"`
+	MaxSize    int64  `viper:"string" validate:"gte=0" mapstructure:"max_size"`
+	MaxBackups int64  `viper:"string" validate:"gte=0" mapstructure:"max_backups"`
+	MaxAge     int64  `viper:"string" validate:"gte=0" mapstructure:"max_age"`
+	Compress   bool   `viper:"string" mapstructure:"compress"`
+}
+
+func (c *LoggingConfig) Validate() error {
+	if c.Level == "" {
+		return nil
+	}
+	if _, err := log.ParseLevel(strings.ToUpper(c.Level)); err != nil {
+		return fmt.Errorf("level must be one of trace, debug, info, warn, error, fatal or panic, got %q", c.Level)
+	}
+	return nil
+}
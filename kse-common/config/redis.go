@@ -1,4 +1,4 @@
-package conf
+package config
 
 type Redis struct {
 	RedisHost string `viper:"string" mapstructure:"redis_host"`
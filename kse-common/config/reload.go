@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// LiveTag marks settings that can change while a service runs, with
+// `reload:"live"`. On a struct it covers the whole section.
+const LiveTag = "reload"
+
+// Reconcile compares the running config with next, a freshly loaded config
+// of the same type, and returns the keys of the settings that changed.
+// Changes to live settings are kept in next, the others are reverted to
+// their running values and returned as needing a restart, so next can
+// replace the running config.
+func Reconcile(current, next interface{}) (applied, restart []string) {
+	r := &reconciler{}
+	r.walk(reflect.ValueOf(current).Elem(), reflect.ValueOf(next).Elem(), "", false)
+	return r.applied, r.restart
+}
+
+type reconciler struct {
+	applied []string
+	restart []string
+}
+
+func (r *reconciler) walk(current, next reflect.Value, path string, live bool) {
+	if current.Kind() == reflect.Struct && exported(current.Type()) {
+		t := current.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fieldPath := path
+			if name := keyName(field); name != squashed {
+				fieldPath = joinPath(path, name)
+			}
+			r.walk(current.Field(i), next.Field(i), fieldPath, live || field.Tag.Get(LiveTag) == "live")
+		}
+		return
+	}
+
+	if reflect.DeepEqual(current.Interface(), next.Interface()) {
+		return
+	}
+	if live {
+		r.applied = append(r.applied, path)
+		return
+	}
+	r.restart = append(r.restart, path)
+	next.Set(current)
+}
+
+// exported reports whether every field of a struct type is exported, others
+// like time.Time are compared as a whole
+func exported(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// NewLike returns a pointer to a new zero value of the type cfg points at
+func NewLike(cfg interface{}) (interface{}, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a pointer to a struct, got %T", cfg)
+	}
+	return reflect.New(v.Elem().Type()).Interface(), nil
+}
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Prefixes of config values that point at a secret instead of holding it
+const (
+	FileRef   = "file://"
+	EnvRef    = "env:"
+	SecretRef = "secret:"
+)
+
+// SecretsKeyEnv names the environment variable holding the key of the
+// encrypted secrets file
+const SecretsKeyEnv = "KSE_SECRETS_KEY"
+
+const redacted = "[redacted]"
+
+// resolver looks up secret references, the encrypted file is only read
+// when a value refers to it
+type resolver struct {
+	secretsFile string
+	secrets     map[string]string
+	secretsErr  error
+}
+
+func (r *resolver) resolve(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, FileRef):
+		path := strings.TrimPrefix(value, FileRef)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("cannot read secret file %s : %s", path, err)
+		}
+		// Secret files usually end with a newline that is not part of the secret
+		return strings.TrimRight(string(data), "\r\n"), nil
+
+	case strings.HasPrefix(value, EnvRef):
+		name := strings.TrimPrefix(value, EnvRef)
+		secret, ok := os.LookupEnv(name)
+		if !ok || secret == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+
+	case strings.HasPrefix(value, SecretRef):
+		name := strings.TrimPrefix(value, SecretRef)
+		if r.secrets == nil && r.secretsErr == nil {
+			r.secrets, r.secretsErr = ReadSecretsFile(r.secretsFile)
+		}
+		if r.secretsErr != nil {
+			return "", r.secretsErr
+		}
+		secret, ok := r.secrets[name]
+		if !ok {
+			return "", fmt.Errorf("secret %q is not in %s", name, r.secretsFile)
+		}
+		return secret, nil
+	}
+	return value, nil
+}
+
+// ResolveSecrets replaces every string in cfg that is a secret reference
+// with the secret itself. secretsFile is the encrypted file secret:
+// references are read from. Unresolved references are errors, a service
+// should never start with a reference where its password belongs.
+func ResolveSecrets(cfg interface{}, secretsFile string) error {
+	r := &resolver{secretsFile: secretsFile}
+	problems := r.walk(reflect.ValueOf(cfg), "")
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (r *resolver) walk(v reflect.Value, path string) []string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	problems := []string{}
+	switch v.Kind() {
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+		secret, err := r.resolve(v.String())
+		if err != nil {
+			return []string{withPath(path, err.Error())}
+		}
+		v.SetString(secret)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldPath := path
+			if name := keyName(field); name != squashed {
+				fieldPath = joinPath(path, name)
+			}
+			problems = append(problems, r.walk(v.Field(i), fieldPath)...)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			problems = append(problems, r.walk(v.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// Map values are not addressable, resolve a copy and put it back
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			problems = append(problems, r.walk(value, fmt.Sprintf("%s[%v]", path, iter.Key()))...)
+			v.SetMapIndex(iter.Key(), value)
+		}
+	}
+	return problems
+}
+
+// Redact returns a copy of cfg, a pointer to a config struct, with every
+// field tagged `secret:"true"` blanked out, so the config can be logged
+func Redact(cfg interface{}) interface{} {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return cfg
+	}
+	redactedCopy := reflect.New(v.Elem().Type())
+	redactedCopy.Elem().Set(redactValue(v.Elem()))
+	return redactedCopy.Interface()
+}
+
+// redactValue copies v. Slices and maps are copied too, they would otherwise
+// share their elements with the original.
+func redactValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if field.Tag.Get("secret") == "true" && field.Type.Kind() == reflect.String {
+				if v.Field(i).String() != "" {
+					out.Field(i).SetString(redacted)
+				}
+				continue
+			}
+			out.Field(i).Set(redactValue(v.Field(i)))
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redactValue(v.Index(i)))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), redactValue(iter.Value()))
+		}
+		return out
+	}
+	return v
+}
+
+func secretsAEAD() (cipher.AEAD, error) {
+	key := os.Getenv(SecretsKeyEnv)
+	if key == "" {
+		return nil, fmt.Errorf("%s is not set", SecretsKeyEnv)
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ReadSecretsFile decrypts a secrets file written by EncryptSecrets with the
+// key in KSE_SECRETS_KEY
+func ReadSecretsFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, errors.New("secret references need secrets_file to be set")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read secrets file : %s", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("secrets file %s is not base64 : %s", path, err)
+	}
+	aead, err := secretsAEAD()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("secrets file %s is too short", path)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt %s, is %s right?", path, SecretsKeyEnv)
+	}
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("secrets file %s does not hold a JSON object of strings : %s", path, err)
+	}
+	return secrets, nil
+}
+
+// EncryptSecrets seals a name to secret map with the key in KSE_SECRETS_KEY,
+// the result is what ReadSecretsFile expects
+func EncryptSecrets(secrets map[string]string) ([]byte, error) {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := secretsAEAD()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, plain, nil)
+	return []byte(base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
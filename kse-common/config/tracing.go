@@ -0,0 +1,15 @@
+package config
+
+// Tracing specifies where spans are exported. Trace context is passed on
+// over HTTP and Kafka even when nothing is exported.
+type Tracing struct {
+	// otlp sends spans to an OpenTelemetry collector, stdout prints them
+	// and an empty exporter records none
+	Exporter string `viper:"string" validate:"omitempty,oneof=otlp stdout" mapstructure:"exporter"`
+	// host:port of the collector's OTLP/HTTP receiver, the
+	// OTEL_EXPORTER_OTLP_ENDPOINT variable or localhost:4318 when left out
+	Endpoint string `viper:"string" mapstructure:"endpoint"`
+	Insecure bool   `viper:"bool" mapstructure:"insecure"`
+	// Share of new traces that are recorded, all of them when left out
+	SampleRatio float64 `viper:"float" validate:"gte=0,lte=1" mapstructure:"sample_ratio"`
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator is implemented by config sections with rules the validate tags
+// cannot express, usually ones that relate several fields
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError lists every problem found in a config, so a broken file
+// can be fixed in one go
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// squashed stands in for the name of embedded sections in key paths, their
+// keys sit directly under the parent
+const squashed = "~"
+
+var validate = newValidate()
+
+func newValidate() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(keyName)
+	return v
+}
+
+// keyName returns the config key a field is read from
+func keyName(field reflect.StructField) string {
+	name, opts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+	if strings.Contains(opts, "squash") {
+		return squashed
+	}
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// Validate checks cfg, a pointer to a config struct, against its validate
+// tags and the Validate methods of its sections. Problems are reported by
+// config key, like kafka.topics.trades.
+func Validate(cfg interface{}) error {
+	problems := []string{}
+	if err := validate.Struct(cfg); err != nil {
+		var fieldErrs validator.ValidationErrors
+		if !errors.As(err, &fieldErrs) {
+			return err
+		}
+		for _, fieldErr := range fieldErrs {
+			problems = append(problems, describe(fieldErr))
+		}
+	}
+	problems = append(problems, checkSections(reflect.ValueOf(cfg), "", false)...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func describe(fieldErr validator.FieldError) string {
+	// The namespace starts with the type name of the root struct
+	segments := strings.Split(fieldErr.Namespace(), ".")[1:]
+	path := []string{}
+	for _, segment := range segments {
+		if segment != squashed {
+			path = append(path, segment)
+		}
+	}
+	key := strings.Join(path, ".")
+
+	param := fieldErr.Param()
+	switch fieldErr.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		switch fieldErr.Tag() {
+		case "min", "gte":
+			return fmt.Sprintf("%s needs at least %s entries", key, param)
+		case "max", "lte":
+			return fmt.Sprintf("%s can have at most %s entries", key, param)
+		}
+	case reflect.String:
+		switch fieldErr.Tag() {
+		case "min", "gte":
+			return fmt.Sprintf("%s must be at least %s characters long", key, param)
+		case "max", "lte":
+			return fmt.Sprintf("%s can be at most %s characters long", key, param)
+		}
+	}
+
+	switch fieldErr.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", key)
+	case "min", "gte":
+		return fmt.Sprintf("%s must be at least %s, got %v", key, param, fieldErr.Value())
+	case "max", "lte":
+		return fmt.Sprintf("%s must be at most %s, got %v", key, param, fieldErr.Value())
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s, got %v", key, param, fieldErr.Value())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s, got %q", key, strings.Join(strings.Fields(param), ", "), fmt.Sprint(fieldErr.Value()))
+	}
+	return fmt.Sprintf("%s fails the %s check", key, fieldErr.Tag())
+}
+
+// checkSections calls Validate on every section that implements Validator,
+// slices and maps of sections included. Embedded sections are validated
+// through their parent when it is a Validator, by the promoted method or by
+// the parent's own, so parentChecked skips them.
+func checkSections(v reflect.Value, path string, parentChecked bool) []string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	problems := []string{}
+	switch v.Kind() {
+	case reflect.Struct:
+		checked := parentChecked
+		if !parentChecked && v.CanAddr() {
+			if section, ok := v.Addr().Interface().(Validator); ok {
+				checked = true
+				if err := section.Validate(); err != nil {
+					problems = append(problems, withPath(path, err.Error()))
+				}
+			}
+		}
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldPath := path
+			if name := keyName(field); name != squashed {
+				fieldPath = joinPath(path, name)
+			}
+			problems = append(problems, checkSections(v.Field(i), fieldPath, checked && field.Anonymous)...)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			problems = append(problems, checkSections(v.Index(i), fmt.Sprintf("%s[%d]", path, i), false)...)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// Map values are not addressable, check a copy
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			problems = append(problems, checkSections(value, fmt.Sprintf("%s[%v]", path, iter.Key()), false)...)
+		}
+	}
+	return problems
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func withPath(path, msg string) string {
+	if path == "" {
+		return msg
+	}
+	return path + ": " + msg
+}
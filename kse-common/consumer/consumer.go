@@ -0,0 +1,118 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/segmentio/kafka-go"
+)
+
+// Backoff bounds between retries of a failed read or a failed message. The
+// wait doubles with every failure in a row.
+var (
+	MinBackoff = 100 * time.Millisecond
+	MaxBackoff = 30 * time.Second
+)
+
+// Handler processes one message. Returning an error makes Run retry the
+// message, so handlers have to be idempotent. Messages that can never be
+// processed, like malformed ones, should be logged and skipped by returning
+// nil.
+type Handler func(ctx context.Context, msg kafka.Message) error
+
+// Run hands every message of reader to handle until ctx is done or reader
+// is closed. Failed reads and failed messages are retried with backoff, a
+// message is only committed once it was handled, so nothing is lost when a
+// dependency like the DB is down for a while. Readers without a consumer
+// group have nothing to commit.
+func Run(ctx context.Context, reader *kafka.Reader, handle Handler) {
+	group := reader.Config().GroupID
+	wait := backoff{}
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if stopped(ctx, err) {
+				return
+			}
+			logging.Logger().WithError(err).WithField(logging.FieldTopic, reader.Config().Topic).
+				Errorf("Failed to read from Kafka, retrying in %s", wait.peek())
+			if !wait.sleep(ctx) {
+				return
+			}
+			continue
+		}
+		wait.reset()
+
+		if !process(ctx, reader, msg, handle) {
+			return
+		}
+		if group == "" {
+			continue
+		}
+		if err := reader.CommitMessages(ctx, msg); err != nil && !stopped(ctx, err) {
+			// The message comes again after a rebalance or restart, which
+			// handlers cope with
+			logging.ForMessage(ctx, msg).WithError(err).Error("Failed to commit Kafka message")
+		}
+	}
+}
+
+// process calls handle until it succeeds, it returns false when ctx ended
+// first. Every attempt is traced as a consumer span around handle.
+func process(ctx context.Context, reader *kafka.Reader, msg kafka.Message, handle Handler) bool {
+	wait := backoff{}
+	for attempt := 1; ; attempt++ {
+		msgCtx, span := tracing.StartConsumer(reader, msg)
+		err := tracing.End(span, handle(msgCtx, msg))
+		if err == nil {
+			return true
+		}
+		logging.ForMessage(msgCtx, msg).WithError(err).
+			Errorf("Failed to process Kafka message on attempt %d, retrying in %s", attempt, wait.peek())
+		if !wait.sleep(ctx) {
+			return false
+		}
+	}
+}
+
+// stopped reports whether err means the loop should end rather than retry
+func stopped(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, io.EOF)
+}
+
+type backoff struct {
+	next time.Duration
+}
+
+func (b *backoff) peek() time.Duration {
+	if b.next == 0 {
+		return MinBackoff
+	}
+	return b.next
+}
+
+// sleep waits for the next backoff, it returns false when ctx ended first
+func (b *backoff) sleep(ctx context.Context) bool {
+	wait := b.peek()
+	b.next = wait * 2
+	if b.next > MaxBackoff {
+		b.next = MaxBackoff
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (b *backoff) reset() {
+	b.next = 0
+}
@@ -0,0 +1,82 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	defer func(min, max time.Duration) { MinBackoff, MaxBackoff = min, max }(MinBackoff, MaxBackoff)
+	MinBackoff, MaxBackoff = time.Millisecond, 4*time.Millisecond
+
+	wait := backoff{}
+	want := []time.Duration{1, 2, 4, 4}
+	for i, w := range want {
+		if got := wait.peek(); got != w*time.Millisecond {
+			t.Fatalf("wait %d is %s, want %s", i, got, w*time.Millisecond)
+		}
+		if !wait.sleep(context.Background()) {
+			t.Fatalf("sleep %d returned false without a cancelled context", i)
+		}
+	}
+
+	wait.reset()
+	if got := wait.peek(); got != time.Millisecond {
+		t.Fatalf("wait after reset is %s, want %s", got, time.Millisecond)
+	}
+}
+
+func TestBackoffStopsWithContext(t *testing.T) {
+	defer func(min time.Duration) { MinBackoff = min }(MinBackoff)
+	MinBackoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	wait := backoff{}
+	if wait.sleep(ctx) {
+		t.Fatal("sleep returned true with a cancelled context")
+	}
+}
+
+func TestProcessTracesEveryAttempt(t *testing.T) {
+	defer func(min time.Duration) { MinBackoff = min }(MinBackoff)
+	MinBackoff = time.Millisecond
+
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown := tracing.UseExporter("test", exporter)
+	defer shutdown(context.Background())
+
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: []string{"127.0.0.1:9092"}, Topic: "trades"})
+	defer reader.Close()
+
+	attempts := 0
+	handled := process(context.Background(), reader, kafka.Message{Topic: "trades"}, func(ctx context.Context, msg kafka.Message) error {
+		attempts++
+		if !trace.SpanFromContext(ctx).IsRecording() {
+			t.Error("handler runs without a recording span")
+		}
+		if attempts == 1 {
+			return errors.New("db down")
+		}
+		return nil
+	})
+	if !handled {
+		t.Fatal("process gave up")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans for 2 attempts", len(spans))
+	}
+	if spans[0].Status.Code != codes.Error || spans[1].Status.Code == codes.Error {
+		t.Errorf("attempts ended with %s and %s, want the first one failed", spans[0].Status.Code, spans[1].Status.Code)
+	}
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/rohanchavan1918/kse-common/config"
+)
+
+// Open returns a pool for the configured database. Like sql.Open it does not
+// connect, callers Ping to check the database is reachable.
+func Open(dbConfig *config.DB) (*sql.DB, error) {
+	db, err := sql.Open(dbConfig.DBType, dbConfig.GetConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	db.SetConnMaxLifetime(time.Minute * 3)
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(10)
+	return db, nil
+}
@@ -0,0 +1,161 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rohanchavan1918/kse-common/config"
+	"github.com/rohanchavan1918/kse-common/metrics"
+	"github.com/segmentio/kafka-go"
+)
+
+// DB checks that db answers a ping
+func DB(db *sql.DB) Check {
+	return db.PingContext
+}
+
+var kafkaClients = struct {
+	sync.Mutex
+	byConfig map[*config.Kafka]*kafka.Client
+}{byConfig: map[*config.Kafka]*kafka.Client{}}
+
+// kafkaClient returns the client the checks of cfg share, built when the
+// first of them is added, so checks keep their connections between runs
+func kafkaClient(cfg *config.Kafka) (*kafka.Client, error) {
+	kafkaClients.Lock()
+	defer kafkaClients.Unlock()
+	if client, ok := kafkaClients.byConfig[cfg]; ok {
+		return client, nil
+	}
+	client, err := cfg.Client()
+	if err != nil {
+		return nil, err
+	}
+	kafkaClients.byConfig[cfg] = client
+	return client, nil
+}
+
+// Kafka checks that the brokers answer a metadata request
+func Kafka(cfg *config.Kafka) Check {
+	client, err := kafkaClient(cfg)
+	return func(ctx context.Context) error {
+		if err != nil {
+			return err
+		}
+		_, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{}})
+		return err
+	}
+}
+
+// KafkaTopics checks that every one of topics exists. Asking for them does
+// not create them, whatever the brokers' auto create setting.
+func KafkaTopics(cfg *config.Kafka, topics ...string) Check {
+	client, err := kafkaClient(cfg)
+	return func(ctx context.Context) error {
+		if err != nil {
+			return err
+		}
+		metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+		if err != nil {
+			return err
+		}
+		errs := map[string]error{}
+		for _, topic := range metadata.Topics {
+			errs[topic.Name] = topic.Error
+		}
+		problems := []string{}
+		for _, topic := range topics {
+			if err, ok := errs[topic]; !ok {
+				problems = append(problems, topic+": missing")
+			} else if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s", topic, err))
+			}
+		}
+		if len(problems) > 0 {
+			sort.Strings(problems)
+			return fmt.Errorf("topics not usable : %s", strings.Join(problems, ", "))
+		}
+		return nil
+	}
+}
+
+// ConsumerLag checks that group is no further behind on topic than the
+// max_consumer_lag setting allows
+func ConsumerLag(cfg *config.Kafka, group, topic string) Check {
+	client, err := kafkaClient(cfg)
+	return func(ctx context.Context) error {
+		mu.RLock()
+		max := settings.MaxConsumerLag
+		mu.RUnlock()
+		if max == 0 {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+		partitions, err := metrics.GroupLag(ctx, client, group, topic)
+		if err != nil {
+			return err
+		}
+		var lag int64
+		for _, partitionLag := range partitions {
+			lag += partitionLag
+		}
+		if lag > max {
+			return fmt.Errorf("%d messages behind, more than %d", lag, max)
+		}
+		return nil
+	}
+}
+
+// WatchConsumer adds a readiness check on the lag of group on topic
+func WatchConsumer(cfg *config.Kafka, group, topic string) {
+	Ready(fmt.Sprintf("consumer_lag:%s/%s", group, topic), ConsumerLag(cfg, group, topic))
+}
+
+var workers = struct {
+	sync.Mutex
+	once    sync.Once
+	running map[string]int
+	stopped map[string]int
+}{running: map[string]int{}, stopped: map[string]int{}}
+
+// Go runs fn in a goroutine that is meant to run as long as the service,
+// like a Kafka consumer loop. Once fn returns the workers liveness check
+// fails and names it.
+func Go(name string, fn func()) {
+	workers.once.Do(func() { Live("workers", checkWorkers) })
+
+	workers.Lock()
+	workers.running[name]++
+	workers.Unlock()
+
+	go func() {
+		defer func() {
+			workers.Lock()
+			workers.running[name]--
+			workers.stopped[name]++
+			workers.Unlock()
+		}()
+		fn()
+	}()
+}
+
+func checkWorkers(context.Context) error {
+	workers.Lock()
+	defer workers.Unlock()
+	stopped := []string{}
+	for name, count := range workers.stopped {
+		stopped = append(stopped, fmt.Sprintf("%s (%d of %d)", name, count, count+workers.running[name]))
+	}
+	if len(stopped) > 0 {
+		sort.Strings(stopped)
+		return fmt.Errorf("workers stopped : %s", strings.Join(stopped, ", "))
+	}
+	return nil
+}
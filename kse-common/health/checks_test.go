@@ -0,0 +1,41 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rohanchavan1918/kse-common/config"
+)
+
+func TestKafkaChecksShareAClient(t *testing.T) {
+	cfg := &config.Kafka{Brokers: []string{"127.0.0.1:9092"}}
+	first, err := kafkaClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := kafkaClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("checks of the same config got different clients")
+	}
+
+	other, err := kafkaClient(&config.Kafka{Brokers: []string{"127.0.0.1:9093"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Error("checks of another config share the client")
+	}
+}
+
+func TestKafkaCheckWithoutBrokers(t *testing.T) {
+	check := Kafka(&config.Kafka{})
+	for i := 0; i < 2; i++ {
+		if err := check(context.Background()); !errors.Is(err, config.ErrKafkaNotConfigured) {
+			t.Errorf("run %d failed with %v, want %v", i+1, err, config.ErrKafkaNotConfigured)
+		}
+	}
+}
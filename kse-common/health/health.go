@@ -0,0 +1,150 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/config"
+)
+
+// Check reports a problem with a dependency or a part of the service. It
+// must give up once ctx is done.
+type Check func(ctx context.Context) error
+
+// DefaultTimeout bounds every check when the config gives no timeout
+const DefaultTimeout = 2 * time.Second
+
+var (
+	mu        sync.RWMutex
+	settings  config.Health
+	liveness  = map[string]Check{}
+	readiness = map[string]Check{}
+)
+
+// Configure applies the health settings, it can be called again while the
+// service runs
+func Configure(cfg *config.Health) {
+	mu.Lock()
+	defer mu.Unlock()
+	settings = *cfg
+}
+
+// Live adds a liveness check. A failing one means the service is stuck and
+// should be restarted, so only use it for problems a restart fixes.
+func Live(name string, check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	liveness[name] = check
+}
+
+// Ready adds a readiness check. A failing one means the service cannot do
+// its work right now, usually because a dependency is down.
+func Ready(name string, check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	readiness[name] = check
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// Report is the outcome of all the checks of a probe, Status is ok only
+// when every check passed
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// Run runs checks side by side, each within the configured timeout
+func Run(ctx context.Context, checks map[string]Check) Report {
+	mu.RLock()
+	timeout := settings.Timeout
+	mu.RUnlock()
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]Result, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			results[i] = Result{Status: StatusOK, DurationMs: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				results[i].Status = StatusFailing
+				results[i].Error = err.Error()
+			}
+		}(i, checks[name])
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+	return report
+}
+
+// Register serves the liveness checks on /livez and the readiness checks on
+// /readyz. Both answer 200 when every check passed and 503 otherwise, with
+// the result of each check.
+func Register(r *gin.Engine) {
+	r.GET("/livez", LiveHandler())
+	r.GET("/readyz", ReadyHandler())
+}
+
+// LiveHandler answers with the result of the liveness checks
+func LiveHandler() gin.HandlerFunc {
+	return handler(liveness)
+}
+
+// ReadyHandler answers with the result of the readiness checks
+func ReadyHandler() gin.HandlerFunc {
+	return handler(readiness)
+}
+
+func handler(registry map[string]Check) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mu.RLock()
+		checks := make(map[string]Check, len(registry))
+		for name, check := range registry {
+			checks[name] = check
+		}
+		mu.RUnlock()
+
+		report := Run(c.Request.Context(), checks)
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
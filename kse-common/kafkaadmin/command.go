@@ -0,0 +1,139 @@
+package kafkaadmin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/config"
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/cobra"
+)
+
+// Command returns the topics command. It loads the config file into out, a
+// pointer to the service's config struct, and works on the topics the
+// service uses:
+//
+//	topics diff    shows how they differ from the provision settings
+//	topics ensure  creates the missing ones and fixes their settings
+//	topics lag     lists how far the consumer groups reading them are behind
+func Command(out Service) *cobra.Command {
+	var timeout time.Duration
+
+	// run loads the config and calls fn with the connection settings, a
+	// client, the topics and a context that ends after --timeout
+	run := func(fn func(ctx context.Context, cmd *cobra.Command, cfg *config.Kafka, client *kafka.Client, topics []string) error) func(*cobra.Command, []string) error {
+		return func(cmd *cobra.Command, args []string) error {
+			if err := config.Load(cmd, out); err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			cfg, used := out.KafkaSettings()
+			client, err := cfg.Client()
+			if err != nil {
+				return err
+			}
+			defer config.CloseClient(client)
+			return fn(ctx, cmd, cfg, client, Topics(cfg, used))
+		}
+	}
+
+	diffCmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show how the topics differ from the config, fails when they do",
+		Args:  cobra.NoArgs,
+		// main reports the error, cobra would print it a second time
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: run(func(ctx context.Context, cmd *cobra.Command, cfg *config.Kafka, client *kafka.Client, topics []string) error {
+			diffs, err := Compare(ctx, client, cfg, topics)
+			if err != nil {
+				return err
+			}
+			if len(diffs) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "%d topics match the config\n", len(topics))
+				return nil
+			}
+			printDiffs(cmd, diffs)
+			return fmt.Errorf("%d of %d topics differ from the config", len(diffs), len(topics))
+		}),
+	}
+
+	ensureCmd := &cobra.Command{
+		Use:           "ensure",
+		Short:         "Create missing topics and apply the configured settings",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: run(func(ctx context.Context, cmd *cobra.Command, cfg *config.Kafka, client *kafka.Client, topics []string) error {
+			applied, err := Ensure(ctx, client, cfg, topics)
+			if len(applied) > 0 {
+				printDiffs(cmd, applied)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%d topics set up, %d changed\n", len(topics), len(applied))
+			return nil
+		}),
+	}
+
+	var all bool
+	lagCmd := &cobra.Command{
+		Use:           "lag",
+		Short:         "List the lag of the consumer groups on the topics",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: run(func(ctx context.Context, cmd *cobra.Command, cfg *config.Kafka, client *kafka.Client, topics []string) error {
+			if all {
+				topics = nil
+			}
+			lags, err := Lags(ctx, client, topics)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "GROUP\tTOPIC\tPARTITION\tLAG")
+			for _, lag := range lags {
+				partitions := make([]int, 0, len(lag.Partitions))
+				for partition := range lag.Partitions {
+					partitions = append(partitions, partition)
+				}
+				sort.Ints(partitions)
+				for _, partition := range partitions {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", lag.Group, lag.Topic, partition, lag.Partitions[partition])
+				}
+				fmt.Fprintf(w, "%s\t%s\ttotal\t%d\n", lag.Group, lag.Topic, lag.Total())
+			}
+			return w.Flush()
+		}),
+	}
+	lagCmd.Flags().BoolVar(&all, "all", false, "include topics the service does not use")
+
+	topicsCmd := &cobra.Command{
+		Use:   "topics",
+		Short: "Provision and inspect the Kafka topics of the service",
+	}
+	topicsCmd.PersistentFlags().DurationVar(&timeout, "timeout", 30*time.Second, "how long to wait for the brokers")
+	topicsCmd.AddCommand(diffCmd, ensureCmd, lagCmd)
+	return topicsCmd
+}
+
+func printDiffs(cmd *cobra.Command, diffs []Diff) {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tSETTING\tACTUAL\tDESIRED")
+	for _, diff := range diffs {
+		if diff.Missing {
+			fmt.Fprintf(w, "%s\texists\tno\tyes\n", diff.Topic)
+			continue
+		}
+		for _, change := range diff.Changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", diff.Topic, change.Setting, change.Actual, change.Desired)
+		}
+	}
+	w.Flush()
+}
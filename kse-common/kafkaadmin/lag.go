@@ -0,0 +1,96 @@
+package kafkaadmin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/rohanchavan1918/kse-common/metrics"
+	"github.com/segmentio/kafka-go"
+)
+
+// Lag is how far a consumer group is behind on a topic
+type Lag struct {
+	Group      string
+	Topic      string
+	Partitions map[int]int64
+}
+
+// Total is the lag summed over the partitions
+func (l Lag) Total() int64 {
+	var total int64
+	for _, lag := range l.Partitions {
+		total += lag
+	}
+	return total
+}
+
+// Lags returns the lag of every consumer group that committed offsets on
+// one of topics, or on any topic when topics is empty, sorted by group and
+// topic
+func Lags(ctx context.Context, client *kafka.Client, topics []string) ([]Lag, error) {
+	wanted := map[string]bool{}
+	for _, topic := range topics {
+		wanted[topic] = true
+	}
+
+	groups, err := listGroups(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	lags := []Lag{}
+	for _, group := range groups {
+		committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: group})
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the offsets of group %s : %w", group, err)
+		}
+		if committed.Error != nil {
+			return nil, fmt.Errorf("cannot read the offsets of group %s : %w", group, committed.Error)
+		}
+		for topic := range committed.Topics {
+			if len(wanted) > 0 && !wanted[topic] {
+				continue
+			}
+			partitions, err := metrics.GroupLag(ctx, client, group, topic)
+			if err != nil {
+				return nil, fmt.Errorf("consumer lag of %s on %s : %w", group, topic, err)
+			}
+			lags = append(lags, Lag{Group: group, Topic: topic, Partitions: partitions})
+		}
+	}
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Group != lags[j].Group {
+			return lags[i].Group < lags[j].Group
+		}
+		return lags[i].Topic < lags[j].Topic
+	})
+	return lags, nil
+}
+
+// listGroups asks every broker for the groups it coordinates, one only
+// knows about its own
+func listGroups(ctx context.Context, client *kafka.Client) ([]string, error) {
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{}})
+	if err != nil {
+		return nil, err
+	}
+	groups := []string{}
+	for _, broker := range metadata.Brokers {
+		resp, err := client.ListGroups(ctx, &kafka.ListGroupsRequest{
+			Addr: kafka.TCP(net.JoinHostPort(broker.Host, strconv.Itoa(broker.Port))),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot list the groups of broker %d : %w", broker.ID, err)
+		}
+		if resp.Error != nil {
+			return nil, fmt.Errorf("cannot list the groups of broker %d : %w", broker.ID, resp.Error)
+		}
+		for _, group := range resp.Groups {
+			groups = append(groups, group.GroupID)
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
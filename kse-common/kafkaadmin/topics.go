@@ -0,0 +1,335 @@
+package kafkaadmin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/config"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/segmentio/kafka-go"
+)
+
+// StartupTimeout bounds how long EnsureOnStartup may take
+var StartupTimeout = 30 * time.Second
+
+// Service is implemented by the configs of services that use Kafka, it
+// returns the connection and the topics the service produces to or consumes
+// from
+type Service interface {
+	KafkaSettings() (*config.Kafka, []string)
+}
+
+// Topic level config entries the provision settings map to
+const (
+	retentionConfig     = "retention.ms"
+	cleanupPolicyConfig = "cleanup.policy"
+)
+
+// Diff is how a topic differs from the setup in the config
+type Diff struct {
+	Topic   string
+	Missing bool
+	Changes []Change
+}
+
+// Change is a setting of a topic that is not the configured one
+type Change struct {
+	Setting string
+	Actual  string
+	Desired string
+}
+
+// fixable reports whether Ensure can apply c. Kafka cannot take partitions
+// away and changing the replication factor needs a reassignment plan.
+func (c Change) fixable() bool {
+	switch c.Setting {
+	case "replication_factor":
+		return false
+	case "partitions":
+		actual, _ := strconv.Atoi(c.Actual)
+		desired, _ := strconv.Atoi(c.Desired)
+		return desired > actual
+	}
+	return true
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s -> %s", c.Setting, c.Actual, c.Desired)
+}
+
+// Topics returns the topics to set up for a service using used, sorted and
+// without duplicates. Topics only named in the provision settings are
+// included.
+func Topics(cfg *config.Kafka, used []string) []string {
+	seen := map[string]bool{}
+	topics := []string{}
+	add := func(topic string) {
+		if topic != "" && !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	for _, topic := range used {
+		add(topic)
+	}
+	for topic := range cfg.Provision.Topics {
+		add(topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Compare returns how each of topics differs from its setup in cfg, topics
+// that match it are left out
+func Compare(ctx context.Context, client *kafka.Client, cfg *config.Kafka, topics []string) ([]Diff, error) {
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]kafka.Topic{}
+	for _, topic := range metadata.Topics {
+		if errors.Is(topic.Error, kafka.UnknownTopicOrPartition) {
+			continue
+		}
+		if topic.Error != nil {
+			return nil, fmt.Errorf("cannot describe topic %s : %w", topic.Name, topic.Error)
+		}
+		found[topic.Name] = topic
+	}
+
+	configs, err := topicConfigs(ctx, client, found)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []Diff{}
+	for _, name := range topics {
+		topic, ok := found[name]
+		if !ok {
+			diffs = append(diffs, Diff{Topic: name, Missing: true})
+			continue
+		}
+		spec := cfg.Provision.Topic(name)
+		diff := Diff{Topic: name}
+		if spec.Partitions != 0 && len(topic.Partitions) != spec.Partitions {
+			diff.Changes = append(diff.Changes, Change{"partitions", strconv.Itoa(len(topic.Partitions)), strconv.Itoa(spec.Partitions)})
+		}
+		if replicas := replicationFactor(topic); spec.ReplicationFactor != 0 && replicas != spec.ReplicationFactor {
+			diff.Changes = append(diff.Changes, Change{"replication_factor", strconv.Itoa(replicas), strconv.Itoa(spec.ReplicationFactor)})
+		}
+		for _, entry := range configEntries(spec) {
+			actual := configs[name][entry.ConfigName]
+			if normalize(entry.ConfigName, actual) != normalize(entry.ConfigName, entry.ConfigValue) {
+				diff.Changes = append(diff.Changes, Change{entry.ConfigName, actual, entry.ConfigValue})
+			}
+		}
+		if len(diff.Changes) > 0 {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs, nil
+}
+
+// Ensure creates the missing topics and brings the settings of existing ones
+// in line with cfg, then returns what it changed. The changes Kafka cannot
+// make, like fewer partitions, are left alone and reported in the error.
+func Ensure(ctx context.Context, client *kafka.Client, cfg *config.Kafka, topics []string) ([]Diff, error) {
+	diffs, err := Compare(ctx, client, cfg, topics)
+	if err != nil {
+		return nil, err
+	}
+
+	create := []kafka.TopicConfig{}
+	partitions := []kafka.TopicPartitionsConfig{}
+	alter := []kafka.IncrementalAlterConfigsRequestResource{}
+	applied := []Diff{}
+	problems := []string{}
+	for _, diff := range diffs {
+		if diff.Missing {
+			spec := cfg.Provision.Topic(diff.Topic)
+			create = append(create, kafka.TopicConfig{
+				Topic:             diff.Topic,
+				NumPartitions:     orUnset(spec.Partitions),
+				ReplicationFactor: orUnset(spec.ReplicationFactor),
+				ConfigEntries:     configEntries(spec),
+			})
+			applied = append(applied, diff)
+			continue
+		}
+
+		resource := kafka.IncrementalAlterConfigsRequestResource{ResourceType: kafka.ResourceTypeTopic, ResourceName: diff.Topic}
+		fixed := Diff{Topic: diff.Topic}
+		for _, change := range diff.Changes {
+			if !change.fixable() {
+				problems = append(problems, fmt.Sprintf("%s: %s", diff.Topic, change))
+				continue
+			}
+			fixed.Changes = append(fixed.Changes, change)
+			if change.Setting == "partitions" {
+				count, _ := strconv.Atoi(change.Desired)
+				partitions = append(partitions, kafka.TopicPartitionsConfig{Name: diff.Topic, Count: int32(count)})
+				continue
+			}
+			resource.Configs = append(resource.Configs, kafka.IncrementalAlterConfigsRequestConfig{
+				Name:            change.Setting,
+				Value:           change.Desired,
+				ConfigOperation: kafka.ConfigOperationSet,
+			})
+		}
+		if len(resource.Configs) > 0 {
+			alter = append(alter, resource)
+		}
+		if len(fixed.Changes) > 0 {
+			applied = append(applied, fixed)
+		}
+	}
+
+	if len(create) > 0 {
+		resp, err := client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: create})
+		if err != nil {
+			return nil, err
+		}
+		for topic, err := range resp.Errors {
+			// Another service may have created it in the meantime
+			if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+				problems = append(problems, fmt.Sprintf("%s: cannot create : %s", topic, err))
+			}
+		}
+	}
+	if len(partitions) > 0 {
+		resp, err := client.CreatePartitions(ctx, &kafka.CreatePartitionsRequest{Topics: partitions})
+		if err != nil {
+			return nil, err
+		}
+		for topic, err := range resp.Errors {
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: cannot add partitions : %s", topic, err))
+			}
+		}
+	}
+	if len(alter) > 0 {
+		resp, err := client.IncrementalAlterConfigs(ctx, &kafka.IncrementalAlterConfigsRequest{Resources: alter})
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resp.Resources {
+			if resource.Error != nil {
+				problems = append(problems, fmt.Sprintf("%s: cannot change config : %s", resource.ResourceName, resource.Error))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return applied, fmt.Errorf("topics not set up as configured : %s", strings.Join(problems, ", "))
+	}
+	return applied, nil
+}
+
+// EnsureOnStartup runs Ensure for the topics of a service when the
+// provision settings ask for it and logs what changed
+func EnsureOnStartup(cfg *config.Kafka, used []string) error {
+	if !cfg.Provision.EnsureOnStartup {
+		return nil
+	}
+	client, err := cfg.Client()
+	if err != nil {
+		return err
+	}
+	defer config.CloseClient(client)
+	ctx, cancel := context.WithTimeout(context.Background(), StartupTimeout)
+	defer cancel()
+
+	applied, err := Ensure(ctx, client, cfg, Topics(cfg, used))
+	for _, diff := range applied {
+		if diff.Missing {
+			logging.Logger().WithField("topic", diff.Topic).Info("Created Kafka topic")
+			continue
+		}
+		for _, change := range diff.Changes {
+			logging.Logger().WithField("topic", diff.Topic).Infof("Changed Kafka topic %s", change)
+		}
+	}
+	return err
+}
+
+// topicConfigs returns the provisioned config entries of topics by name
+func topicConfigs(ctx context.Context, client *kafka.Client, topics map[string]kafka.Topic) (map[string]map[string]string, error) {
+	configs := map[string]map[string]string{}
+	if len(topics) == 0 {
+		return configs, nil
+	}
+	resources := []kafka.DescribeConfigRequestResource{}
+	for name := range topics {
+		resources = append(resources, kafka.DescribeConfigRequestResource{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: name,
+			ConfigNames:  []string{retentionConfig, cleanupPolicyConfig},
+		})
+	}
+	resp, err := client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{Resources: resources})
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range resp.Resources {
+		if resource.Error != nil {
+			return nil, fmt.Errorf("cannot describe the config of topic %s : %w", resource.ResourceName, resource.Error)
+		}
+		entries := map[string]string{}
+		for _, entry := range resource.ConfigEntries {
+			entries[entry.ConfigName] = entry.ConfigValue
+		}
+		configs[resource.ResourceName] = entries
+	}
+	return configs, nil
+}
+
+// configEntries returns the topic level config entries spec sets
+func configEntries(spec config.KafkaTopic) []kafka.ConfigEntry {
+	entries := []kafka.ConfigEntry{}
+	if spec.Retention != 0 {
+		retention := "-1"
+		if spec.Retention > 0 {
+			retention = strconv.FormatInt(spec.Retention.Milliseconds(), 10)
+		}
+		entries = append(entries, kafka.ConfigEntry{ConfigName: retentionConfig, ConfigValue: retention})
+	}
+	if spec.CleanupPolicy != "" {
+		entries = append(entries, kafka.ConfigEntry{ConfigName: cleanupPolicyConfig, ConfigValue: spec.CleanupPolicy})
+	}
+	return entries
+}
+
+// normalize makes equal config values compare equal, cleanup policies can
+// list compact and delete in either order
+func normalize(name, value string) string {
+	if name != cleanupPolicyConfig {
+		return value
+	}
+	policies := strings.Split(value, ",")
+	for i := range policies {
+		policies[i] = strings.TrimSpace(policies[i])
+	}
+	sort.Strings(policies)
+	return strings.Join(policies, ",")
+}
+
+func replicationFactor(topic kafka.Topic) int {
+	if len(topic.Partitions) == 0 {
+		return 0
+	}
+	return len(topic.Partitions[0].Replicas)
+}
+
+// orUnset turns a setting left to the brokers into the -1 kafka-go expects
+func orUnset(n int) int {
+	if n == 0 {
+		return -1
+	}
+	return n
+}
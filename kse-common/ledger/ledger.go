@@ -0,0 +1,140 @@
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Every service posts into the same ledger_entries table through this
+// package, platform_apis settles trades and transfers and the order processor
+// books fees, so a user's balance is the sum of all of them.
+
+const DefaultAsset = "USD"
+
+// Accounts owned by the exchange itself
+const (
+	// Money on its way to or from the payment provider
+	PaymentClearingAccount = "exchange:payment_clearing"
+	// Counterparty of both legs of a trade, it nets to zero once both
+	// sides are booked
+	TradeSettlementAccount = "exchange:trade_settlement"
+	// Fees charged on trades
+	FeeRevenueAccount = "exchange:fee_revenue"
+	// Rebates paid out to makers
+	RebateAccount = "exchange:rebates"
+)
+
+// UserAccount holds a user's cash, the order processor charges fees to it
+func UserAccount(userID int64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// PendingDepositsAccount holds deposits the provider has not confirmed yet
+func PendingDepositsAccount(userID int64) string {
+	return fmt.Sprintf("user:%d:pending_deposits", userID)
+}
+
+// WithdrawalHoldsAccount holds cash set aside for withdrawals in flight
+func WithdrawalHoldsAccount(userID int64) string {
+	return fmt.Sprintf("user:%d:withdrawal_holds", userID)
+}
+
+// Entry is one leg of a double entry posting. Positive amounts credit the
+// account, negative amounts debit it.
+type Entry struct {
+	ID        int64     `json:"id"`
+	TxID      string    `json:"tx_id"`
+	AccountID string    `json:"account_id"`
+	Asset     string    `json:"asset"`
+	Amount    float64   `json:"amount"`
+	Kind      string    `json:"kind"`
+	Reference string    `json:"reference"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const schema = `CREATE TABLE IF NOT EXISTS ledger_entries (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	tx_id VARCHAR(64) NOT NULL,
+	account_id VARCHAR(128) NOT NULL,
+	asset VARCHAR(16) NOT NULL,
+	amount DECIMAL(24, 8) NOT NULL,
+	kind VARCHAR(32) NOT NULL,
+	reference VARCHAR(128) NOT NULL DEFAULT '',
+	created_at DATETIME(6) NOT NULL,
+	INDEX idx_ledger_account (account_id, created_at),
+	INDEX idx_ledger_tx (tx_id)
+)`
+
+func EnsureSchema(db *sql.DB) error {
+	// Create the ledger table if it is not there yet
+	_, err := db.Exec(schema)
+	return err
+}
+
+// Post writes all entries of a posting in a transaction of its own
+func Post(db *sql.DB, txID string, entries []Entry) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := PostTx(tx, txID, entries); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PostTx writes all entries of a posting as part of tx, so the posting
+// commits or rolls back together with the change that caused it. The
+// entries of every asset have to balance to zero.
+func PostTx(tx *sql.Tx, txID string, entries []Entry) error {
+	if len(entries) == 0 {
+		return errors.New("ledger posting needs at least one entry")
+	}
+
+	balance := map[string]float64{}
+	for _, entry := range entries {
+		balance[entry.Asset] += entry.Amount
+	}
+	for asset, sum := range balance {
+		if math.Abs(sum) > 1e-9 {
+			return fmt.Errorf("ledger posting %s does not balance for %s: %f", txID, asset, sum)
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, entry := range entries {
+		_, err := tx.Exec(
+			"INSERT INTO ledger_entries (tx_id, account_id, asset, amount, kind, reference, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			txID, entry.AccountID, entry.Asset, entry.Amount, entry.Kind, entry.Reference, now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Transfer builds the two entries moving amount from one account to another
+func Transfer(from, to, asset string, amount float64, kind, reference string) []Entry {
+	return []Entry{
+		{AccountID: from, Asset: asset, Amount: -amount, Kind: kind, Reference: reference},
+		{AccountID: to, Asset: asset, Amount: amount, Kind: kind, Reference: reference},
+	}
+}
+
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Balance sums up the entries of an account. It takes a transaction as well,
+// to read balances under the locks the transaction holds.
+func Balance(q querier, accountID, asset string) (float64, error) {
+	var balance sql.NullFloat64
+	err := q.QueryRow("SELECT SUM(amount) FROM ledger_entries WHERE account_id = ? AND asset = ?", accountID, asset).Scan(&balance)
+	return balance.Float64, err
+}
@@ -0,0 +1,137 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/access"
+	"github.com/rohanchavan1918/kse-common/alert"
+	"github.com/rohanchavan1918/kse-common/config"
+	"github.com/rohanchavan1918/kse-common/health"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/sirupsen/logrus"
+)
+
+// ShutdownTimeout is how long in-flight requests get to finish once a
+// shutdown signal arrives
+var ShutdownTimeout = 15 * time.Second
+
+var (
+	mu    sync.Mutex
+	hooks []func()
+
+	shutdown, startShutdown = context.WithCancel(context.Background())
+)
+
+// Context is cancelled as soon as a shutdown starts, long running workers
+// like Kafka consumers stop on it
+func Context() context.Context {
+	return shutdown
+}
+
+// Setup configures logging, log forwarding, alerting, health checks and
+// tracing from the settings every service shares, it runs right after the config is loaded
+func Setup(base *config.Base) (*logrus.Entry, error) {
+	logger, err := logging.Configure(base.ServiceName, &base.LogConfig)
+	if err != nil {
+		return nil, err
+	}
+	closeForward, err := logging.Forward(base.ServiceName, &base.Fluent)
+	if err != nil {
+		return nil, err
+	}
+	// Registered first so it runs last, after every other hook logged
+	OnShutdown(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if err := closeForward(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to forward the last logs : %s\n", err)
+		}
+	})
+	if err := alert.Configure(base); err != nil {
+		return nil, err
+	}
+	health.Configure(&base.Health)
+	access.Configure(&base.Access)
+	OnShutdown(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if err := alert.Flush(ctx); err != nil {
+			logger.Errorf("Failed to deliver the last alerts : %s", err)
+		}
+	})
+
+	flush, err := tracing.Configure(base.ServiceName, &base.Tracing)
+	if err != nil {
+		return nil, err
+	}
+	OnShutdown(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if err := flush(ctx); err != nil {
+			logger.Errorf("Failed to export the last spans : %s", err)
+		}
+	})
+	return logger, nil
+}
+
+// OnShutdown registers fn to run after the HTTP server stopped. Hooks run in
+// reverse order of registration, like deferred calls, so whatever was set up
+// last is torn down first.
+func OnShutdown(fn func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, fn)
+}
+
+// Serve runs handler on port until SIGINT or SIGTERM. It then stops
+// accepting connections, waits up to ShutdownTimeout for in-flight requests
+// and runs the shutdown hooks before returning.
+func Serve(handler http.Handler, port int64) error {
+	server := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: handler}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	failed := make(chan error, 1)
+	go func() {
+		logging.Logger().Infof("Listening on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+
+	var err error
+	select {
+	case sig := <-stop:
+		logging.Logger().Infof("Received %s, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		err = server.Shutdown(ctx)
+		cancel()
+	case err = <-failed:
+	}
+
+	startShutdown()
+	runHooks()
+	return err
+}
+
+func runHooks() {
+	mu.Lock()
+	pending := hooks
+	hooks = nil
+	mu.Unlock()
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		pending[i]()
+	}
+}
@@ -0,0 +1,187 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rohanchavan1918/kse-common/access"
+	"github.com/rohanchavan1918/kse-common/alert"
+	"github.com/rohanchavan1918/kse-common/config"
+	"github.com/rohanchavan1918/kse-common/health"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/spf13/viper"
+)
+
+// MaxReloads is how many reloads are kept for the admin endpoint
+var MaxReloads = 20
+
+// Reload is the outcome of one attempt to reload the config
+type Reload struct {
+	At      time.Time `json:"at"`
+	Trigger string    `json:"trigger"`
+	// Keys of the changed settings that took effect
+	Applied []string `json:"applied,omitempty"`
+	// Keys of the changed settings that were ignored until the next restart
+	NeedsRestart []string `json:"needs_restart,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// settings is implemented by every service config through the embedded
+// config.Base
+type settings interface {
+	Settings() *config.Base
+}
+
+var (
+	reloadMu sync.Mutex
+	running  *atomic.Value
+	onReload func() error
+	reloads  []Reload
+)
+
+// WatchConfig reloads the config whenever its file changes or the process
+// gets SIGHUP. cfg holds a pointer to the running config, the one handlers
+// read.
+//
+// A reload is validated as a whole and an invalid one is ignored. A config
+// with the changed settings tagged `reload:"live"` replaces the one in cfg,
+// logging and alerting are updated and onChange runs so the service can
+// apply the rest. When onChange returns an error the previous config is put
+// back and the reload is recorded as failed, so onChange has to leave the
+// service as it was when it fails. Other changes are logged as needing a
+// restart and left out. The running config is never changed in place, so
+// handlers can read it without locking while a reload happens.
+func WatchConfig(cfg *atomic.Value, onChange func() error) {
+	reloadMu.Lock()
+	running = cfg
+	onReload = onChange
+	reloadMu.Unlock()
+
+	viper.OnConfigChange(func(fsnotify.Event) {
+		ReloadConfig("file")
+	})
+	viper.WatchConfig()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			ReloadConfig("SIGHUP")
+		}
+	}()
+}
+
+// ReloadConfig reloads the config right away, trigger says what asked for
+// it in logs and the reload history
+func ReloadConfig(trigger string) Reload {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	result := Reload{At: time.Now().UTC(), Trigger: trigger}
+	if running == nil {
+		result.Error = "config reloading is not enabled"
+		return result
+	}
+
+	current := running.Load()
+	next, err := config.NewLike(current)
+	if err == nil {
+		err = config.Reread(next)
+	}
+	if err != nil {
+		logging.Logger().Errorf("Ignoring config reload (%s) : %s", trigger, err)
+		result.Error = err.Error()
+		return record(result)
+	}
+
+	result.Applied, result.NeedsRestart = config.Reconcile(current, next)
+	if len(result.Applied) == 0 && len(result.NeedsRestart) == 0 {
+		// Editors often write a file several times for one save
+		logging.Logger().Debugf("Config reload (%s) changed nothing", trigger)
+		return result
+	}
+	if len(result.NeedsRestart) > 0 {
+		logging.Logger().Warnf("Config reload (%s) ignored changes that need a restart : %s", trigger, strings.Join(result.NeedsRestart, ", "))
+	}
+	if len(result.Applied) > 0 {
+		use(next)
+		if onReload != nil {
+			if err := onReload(); err != nil {
+				use(current)
+				logging.Logger().Errorf("Rolled back config reload (%s), the service could not apply it : %s", trigger, err)
+				result.Applied = nil
+				result.Error = err.Error()
+				return record(result)
+			}
+		}
+		logging.Logger().Infof("Config reloaded (%s), applied : %s", trigger, strings.Join(result.Applied, ", "))
+	}
+	return record(result)
+}
+
+// use makes cfg the running config and applies its shared settings
+func use(cfg interface{}) {
+	running.Store(cfg)
+	if s, ok := cfg.(settings); ok {
+		base := s.Settings()
+		if err := logging.SetLevel(base.LogConfig.Level); err != nil {
+			logging.Logger().Errorf("Failed to change the log level : %s", err)
+		}
+		if err := alert.Configure(base); err != nil {
+			logging.Logger().Errorf("Failed to change the alert sinks : %s", err)
+		}
+		health.Configure(&base.Health)
+		access.Configure(&base.Access)
+	}
+}
+
+func record(result Reload) Reload {
+	reloads = append(reloads, result)
+	if len(reloads) > MaxReloads {
+		reloads = reloads[len(reloads)-MaxReloads:]
+	}
+	return result
+}
+
+// Reloads returns the recent reloads that changed something or failed,
+// newest last
+func Reloads() []Reload {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	return append([]Reload{}, reloads...)
+}
+
+// ReloadsHandler lists the recent reloads on GET and reloads the config on
+// POST, answering with the outcome
+func ReloadsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"reloads": Reloads()})
+	case http.MethodPost:
+		result := ReloadConfig("admin")
+		status := http.StatusOK
+		if result.Error != "" {
+			status = http.StatusUnprocessableEntity
+		}
+		writeJSON(w, status, result)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logging.Logger().Errorf("Failed to write response : %s", err)
+	}
+}
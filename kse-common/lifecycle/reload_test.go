@@ -0,0 +1,146 @@
+package lifecycle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rohanchavan1918/kse-common/config"
+	"github.com/spf13/viper"
+)
+
+type reloadConfig struct {
+	config.Base `mapstructure:",squash"`
+
+	Limit int    `reload:"live" mapstructure:"limit"`
+	Name  string `mapstructure:"name"`
+}
+
+const reloadFile = `{
+	"port": 8080,
+	"service_name": "test",
+	"db": {"db_type": "mysql", "db_host": "127.0.0.1", "db_port": "3306", "db_user": "root"},
+	"log_config": {"level": "INFO"},
+	"limit": %LIMIT%,
+	"name": "%NAME%"
+}`
+
+func writeReloadFile(t *testing.T, path, limit, name string) {
+	t.Helper()
+	body := strings.NewReplacer("%LIMIT%", limit, "%NAME%", name).Replace(reloadFile)
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadReplacesRunningConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeReloadFile(t, path, "1", "first")
+	viper.Reset()
+	defer viper.Reset()
+	viper.SetConfigFile(path)
+
+	first := &reloadConfig{}
+	if err := config.Reread(first); err != nil {
+		t.Fatal(err)
+	}
+	var holder atomic.Value
+	holder.Store(first)
+	reloadMu.Lock()
+	running, onReload, reloads = &holder, nil, nil
+	reloadMu.Unlock()
+	defer func() {
+		reloadMu.Lock()
+		running, reloads = nil, nil
+		reloadMu.Unlock()
+	}()
+
+	// Readers keep going while the config is reloaded
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_ = holder.Load().(*reloadConfig).Limit
+			}
+		}
+	}()
+
+	writeReloadFile(t, path, "2", "second")
+	result := ReloadConfig("test")
+	close(done)
+	<-stopped
+
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	if !reflect.DeepEqual(result.Applied, []string{"limit"}) || !reflect.DeepEqual(result.NeedsRestart, []string{"name"}) {
+		t.Errorf("applied %v and needs restart %v, want [limit] and [name]", result.Applied, result.NeedsRestart)
+	}
+
+	next := holder.Load().(*reloadConfig)
+	if next == first {
+		t.Fatal("reload changed the running config in place")
+	}
+	if next.Limit != 2 || next.Name != "first" {
+		t.Errorf("reloaded config has limit %d and name %q, want 2 and first", next.Limit, next.Name)
+	}
+	if first.Limit != 1 {
+		t.Errorf("the config readers held changed to limit %d", first.Limit)
+	}
+	if got := Reloads(); len(got) != 1 || got[0].Trigger != "test" {
+		t.Errorf("reload history is %+v, want the test reload", got)
+	}
+}
+
+func TestReloadRollsBackWhenOnChangeFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeReloadFile(t, path, "1", "first")
+	viper.Reset()
+	defer viper.Reset()
+	viper.SetConfigFile(path)
+
+	first := &reloadConfig{}
+	if err := config.Reread(first); err != nil {
+		t.Fatal(err)
+	}
+	var holder atomic.Value
+	holder.Store(first)
+	var seen int
+	reloadMu.Lock()
+	running, reloads = &holder, nil
+	onReload = func() error {
+		seen = holder.Load().(*reloadConfig).Limit
+		return errors.New("limit rejected")
+	}
+	reloadMu.Unlock()
+	defer func() {
+		reloadMu.Lock()
+		running, onReload, reloads = nil, nil, nil
+		reloadMu.Unlock()
+	}()
+
+	writeReloadFile(t, path, "2", "first")
+	result := ReloadConfig("test")
+
+	if seen != 2 {
+		t.Errorf("onChange saw limit %d, want the reloaded 2", seen)
+	}
+	if result.Error != "limit rejected" || len(result.Applied) != 0 {
+		t.Errorf("reload applied %v with error %q, want nothing applied and the onChange error", result.Applied, result.Error)
+	}
+	if holder.Load() != first {
+		t.Errorf("running config is %+v, want the one before the reload", holder.Load())
+	}
+	if got := Reloads(); len(got) != 1 || got[0].Error != "limit rejected" {
+		t.Errorf("reload history is %+v, want the failed reload", got)
+	}
+}
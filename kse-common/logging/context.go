@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Field names shared by every service, so logs can be searched the same
+// way everywhere
+const (
+	FieldService       = "service"
+	FieldRequestID     = "request_id"
+	FieldCorrelationID = "correlation_id"
+	FieldTraceID       = "trace_id"
+	FieldSymbol        = "symbol"
+	FieldOrderID       = "order_id"
+	FieldTopic         = "topic"
+	FieldPartition     = "partition"
+	FieldOffset        = "offset"
+)
+
+// Headers the ids travel in, over HTTP and in Kafka messages
+const (
+	RequestIDHeader     = "X-Request-ID"
+	CorrelationIDHeader = "X-Correlation-ID"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	correlationIDKey
+)
+
+// WithRequestID returns a copy of ctx carrying the id of the HTTP request
+// being served
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request id in ctx, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithCorrelationID returns a copy of ctx carrying the id that ties
+// together everything done for one request, across services
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+// CorrelationID returns the correlation id in ctx, if any
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
+
+// FromContext returns the logger with the request, correlation and trace
+// ids found in ctx
+func FromContext(ctx context.Context) *log.Entry {
+	fields := log.Fields{}
+	if id := RequestID(ctx); id != "" {
+		fields[FieldRequestID] = id
+	}
+	if id := CorrelationID(ctx); id != "" {
+		fields[FieldCorrelationID] = id
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		fields[FieldTraceID] = spanContext.TraceID().String()
+	}
+	return Logger().WithFields(fields)
+}
+
+// ForMessage returns the logger for processing msg, with the ids of ctx and
+// where msg was read from
+func ForMessage(ctx context.Context, msg kafka.Message) *log.Entry {
+	return FromContext(ctx).WithFields(log.Fields{
+		FieldTopic:     msg.Topic,
+		FieldPartition: msg.Partition,
+		FieldOffset:    msg.Offset,
+	})
+}
+
+// CorrelationPropagator passes the correlation id on in the
+// X-Correlation-ID header. It is installed next to the trace context
+// propagator, so the id follows every HTTP request and Kafka message the
+// trace does.
+type CorrelationPropagator struct{}
+
+var _ propagation.TextMapPropagator = CorrelationPropagator{}
+
+func (CorrelationPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if id := CorrelationID(ctx); id != "" {
+		carrier.Set(CorrelationIDHeader, id)
+	}
+}
+
+func (CorrelationPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	if id := carrier.Get(CorrelationIDHeader); validID(id) {
+		return WithCorrelationID(ctx, id)
+	}
+	return ctx
+}
+
+func (CorrelationPropagator) Fields() []string {
+	return []string{CorrelationIDHeader}
+}
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fluent/fluent-logger-golang/fluent"
+	"github.com/rohanchavan1918/kse-common/config"
+	"github.com/rohanchavan1918/kse-common/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// Forward ships every entry of the standard logger to the Fluent forward
+// input in cfg, on top of the outputs set by Configure. It does nothing
+// without a host. The returned func sends the entries still buffered, call
+// it on shutdown.
+func Forward(service string, cfg *config.Fluent) (func(context.Context) error, error) {
+	if cfg.Host == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	tag := cfg.Tag
+	if tag == "" {
+		tag = "kse." + service
+	}
+	client, err := fluent.New(fluent.Config{
+		FluentHost:  cfg.Host,
+		FluentPort:  cfg.Port,
+		Timeout:     cfg.Timeout,
+		BufferLimit: cfg.BufferLimit,
+		MaxRetry:    cfg.MaxRetry,
+		RetryWait:   int(cfg.RetryWait / time.Millisecond),
+		// Send from a goroutine, so a slow or dead endpoint never holds up
+		// the caller, and keep the sub second part of the time
+		Async:              true,
+		SubSecondPrecision: true,
+		AsyncResultCallback: func(_ []byte, err error) {
+			if err != nil {
+				metrics.LogDropped("failed")
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.AddHook(&fluentHook{client: client, tag: tag})
+
+	return func(ctx context.Context) error {
+		closed := make(chan error, 1)
+		go func() { closed <- client.Close() }()
+		select {
+		case err := <-closed:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, nil
+}
+
+// fluentHook queues entries for the Fluent client, dropping them when its
+// buffer is full
+type fluentHook struct {
+	client *fluent.Fluent
+	tag    string
+}
+
+func (h *fluentHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *fluentHook) Fire(entry *log.Entry) error {
+	record := make(map[string]interface{}, len(entry.Data)+2)
+	for key, value := range entry.Data {
+		record[key] = fluentValue(value)
+	}
+	record["level"] = entry.Level.String()
+	record["msg"] = entry.Message
+
+	if err := h.client.PostWithTime(h.tag, entry.Time, record); err != nil {
+		// Returning the error would have logrus print it for every entry
+		metrics.LogDropped("overflow")
+	}
+	return nil
+}
+
+// fluentValue turns a field into something msgpack can encode, the way the
+// JSON formatter would print it
+func fluentValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string, int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprintf("%+v", v)
+	}
+}
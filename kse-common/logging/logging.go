@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/config"
+	log "github.com/sirupsen/logrus"
+	lj "gopkg.in/natefinch/lumberjack.v2"
+)
+
+var logger = log.NewEntry(log.StandardLogger())
+
+// Logger returns the entry set up by Configure. Before that it logs through
+// the plain logrus standard logger.
+func Logger() *log.Entry {
+	return logger
+}
+
+// Configure sets up the standard logger from config, it always writes to
+// stdout and also to a rotated file when one is given. Every entry names
+// service.
+func Configure(service string, config *config.LoggingConfig) (*log.Entry, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := SetLevel(config.Level); err != nil {
+		return nil, err
+	}
+
+	if config.Format == "text" {
+		// always use the fulltimestamp
+		log.SetFormatter(&log.TextFormatter{
+			FullTimestamp:    true,
+			DisableTimestamp: false,
+		})
+	} else {
+		log.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	}
+
+	var output io.Writer = os.Stdout
+	if config.File != "" {
+		output = io.MultiWriter(os.Stdout, &lj.Logger{
+			Filename:   config.File,
+			MaxSize:    int(config.MaxSize),    // Max megabytes before log is rotated
+			MaxBackups: int(config.MaxBackups), // Max number of old log files to keep
+			MaxAge:     int(config.MaxAge),     // Max number of days to retain log files
+			Compress:   config.Compress,
+		})
+	}
+	log.SetOutput(output)
+
+	log.WithFields(log.Fields{
+		"Runtime Version": runtime.Version(),
+		"Number of CPUs":  runtime.NumCPU(),
+		"Arch":            runtime.GOARCH,
+	}).Info("Application Initializing")
+
+	logger = log.StandardLogger().WithFields(log.Fields{
+		FieldService: service,
+		"hostname":   hostname,
+	})
+	return logger, nil
+}
+
+// SetLevel changes the level of the standard logger, it can be called at
+// any time. An empty level leaves it as it is.
+func SetLevel(level string) error {
+	if level == "" {
+		return nil
+	}
+	parsed, err := log.ParseLevel(strings.ToUpper(level))
+	if err != nil {
+		return err
+	}
+	log.SetLevel(parsed)
+	return nil
+}
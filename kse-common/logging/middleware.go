@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxIDLength caps ids taken from request headers, anything longer is
+// replaced rather than logged
+const maxIDLength = 128
+
+// Middleware gives every request a request id, the X-Request-ID header
+// when the caller sent a usable one, and a correlation id, X-Correlation-ID
+// or else the request id. Both are echoed in the response, put in the
+// request context for FromContext and logged with every request once it
+// is served. It replaces gin's own request log.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validID(requestID) {
+			requestID = newID()
+		}
+		correlationID := c.GetHeader(CorrelationIDHeader)
+		if !validID(correlationID) {
+			correlationID = requestID
+		}
+		c.Header(RequestIDHeader, requestID)
+		c.Header(CorrelationIDHeader, correlationID)
+
+		ctx := WithCorrelationID(WithRequestID(c.Request.Context(), requestID), correlationID)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		entry := FromContext(c.Request.Context()).WithFields(log.Fields{
+			"method":     c.Request.Method,
+			"route":      route,
+			"path":       c.Request.URL.Path,
+			"status":     status,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip":  c.ClientIP(),
+		})
+		if len(c.Errors) > 0 {
+			entry = entry.WithField(log.ErrorKey, c.Errors.String())
+		}
+
+		switch {
+		case status >= 500:
+			entry.Error("Request failed")
+		case status >= 400:
+			entry.Warn("Request rejected")
+		default:
+			entry.Info("Request served")
+		}
+	}
+}
+
+// validID accepts ids made of printable ASCII of a sane length, so callers
+// cannot inject anything odd into logs or headers
+func validID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,292 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// LagTimeout bounds how long a scrape waits for the brokers to report the
+// offsets consumer lag is worked out from
+var LagTimeout = 5 * time.Second
+
+var (
+	producedDesc = prometheus.NewDesc(Namespace+"_kafka_produced_messages_total",
+		"Messages written to Kafka.", []string{"topic"}, nil)
+	produceErrorsDesc = prometheus.NewDesc(Namespace+"_kafka_produce_errors_total",
+		"Failed Kafka writes.", []string{"topic"}, nil)
+	produceDurationDesc = prometheus.NewDesc(Namespace+"_kafka_produce_duration_seconds",
+		"Time taken by Kafka writes.", []string{"topic"}, nil)
+	consumedDesc = prometheus.NewDesc(Namespace+"_kafka_consumed_messages_total",
+		"Messages read from Kafka.", []string{"topic", "group"}, nil)
+	consumeErrorsDesc = prometheus.NewDesc(Namespace+"_kafka_consume_errors_total",
+		"Failed Kafka reads.", []string{"topic", "group"}, nil)
+	consumeDurationDesc = prometheus.NewDesc(Namespace+"_kafka_consume_duration_seconds",
+		"Time taken by Kafka reads.", []string{"topic", "group"}, nil)
+	lagDesc = prometheus.NewDesc(Namespace+"_kafka_consumer_lag",
+		"Messages on a partition the consumer has not read yet.", []string{"topic", "group", "partition"}, nil)
+)
+
+// kafkaStats exports the stats kafka-go keeps for every tracked reader and
+// writer. kafka-go resets them each time they are read, so they are added
+// up here.
+var kafkaStats = &kafkaCollector{clients: map[string]*kafka.Client{}}
+
+type totals struct {
+	messages int64
+	errors   int64
+	count    int64
+	seconds  float64
+}
+
+func (t *totals) add(messages, errors int64, d kafka.DurationStats) {
+	t.messages += messages
+	t.errors += errors
+	t.count += d.Count
+	t.seconds += d.Sum.Seconds()
+}
+
+func (t *totals) merge(other totals) {
+	t.messages += other.messages
+	t.errors += other.errors
+	t.count += other.count
+	t.seconds += other.seconds
+}
+
+type trackedWriter struct {
+	writer *kafka.Writer
+	totals
+}
+
+type trackedReader struct {
+	reader *kafka.Reader
+	// lagClient asks the brokers for the lag of the reader's group, nil
+	// outside a group
+	lagClient *kafka.Client
+	totals
+}
+
+type kafkaCollector struct {
+	mu      sync.Mutex
+	writers []*trackedWriter
+	readers []*trackedReader
+	// Lag clients by broker set, their connections are kept between
+	// scrapes
+	clients map[string]*kafka.Client
+}
+
+// TrackWriter exports the stats of w until the process exits
+func TrackWriter(w *kafka.Writer) {
+	kafkaStats.mu.Lock()
+	defer kafkaStats.mu.Unlock()
+	kafkaStats.writers = append(kafkaStats.writers, &trackedWriter{writer: w})
+}
+
+// TrackReader exports the stats of r until the process exits. The lag of
+// consumer group readers is read from the brokers on every scrape.
+func TrackReader(r *kafka.Reader) {
+	kafkaStats.mu.Lock()
+	defer kafkaStats.mu.Unlock()
+	tracked := &trackedReader{reader: r}
+	if config := r.Config(); config.GroupID != "" {
+		tracked.lagClient = kafkaStats.lagClient(config)
+	}
+	kafkaStats.readers = append(kafkaStats.readers, tracked)
+}
+
+// lagClient returns the client shared by the readers of the same brokers,
+// c.mu must be held
+func (c *kafkaCollector) lagClient(config kafka.ReaderConfig) *kafka.Client {
+	brokers := append([]string(nil), config.Brokers...)
+	sort.Strings(brokers)
+	key := strings.Join(brokers, ",")
+	if client, ok := c.clients[key]; ok {
+		return client
+	}
+	client := &kafka.Client{Addr: kafka.TCP(config.Brokers...), Transport: Transport(config.Dialer), Timeout: LagTimeout}
+	c.clients[key] = client
+	return client
+}
+
+func (c *kafkaCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		producedDesc, produceErrorsDesc, produceDurationDesc,
+		consumedDesc, consumeErrorsDesc, consumeDurationDesc, lagDesc,
+	} {
+		ch <- desc
+	}
+}
+
+type readerKey struct {
+	topic string
+	group string
+}
+
+func (c *kafkaCollector) Collect(ch chan<- prometheus.Metric) {
+	lags := c.collectStats(ch)
+
+	// The brokers are asked outside the lock and for all groups at once, so
+	// a slow broker holds a scrape up for one LagTimeout at most
+	var wg sync.WaitGroup
+	for key, client := range lags {
+		wg.Add(1)
+		go func(key readerKey, client *kafka.Client) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), LagTimeout)
+			defer cancel()
+			partitions, err := GroupLag(ctx, client, key.group, key.topic)
+			if err != nil {
+				ch <- prometheus.NewInvalidMetric(lagDesc, fmt.Errorf("consumer lag of %s on %s : %w", key.group, key.topic, err))
+				return
+			}
+			for partition, lag := range partitions {
+				ch <- prometheus.MustNewConstMetric(lagDesc, prometheus.GaugeValue, float64(lag),
+					key.topic, key.group, strconv.Itoa(partition))
+			}
+		}(key, client)
+	}
+	wg.Wait()
+}
+
+// collectStats sends the stats of the tracked writers and readers and
+// returns the lag client of every consumer group and topic
+func (c *kafkaCollector) collectStats(ch chan<- prometheus.Metric) map[readerKey]*kafka.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Several writers or readers can share a topic, and a group, their
+	// series are summed
+	produced := map[string]*totals{}
+	for _, w := range c.writers {
+		stats := w.writer.Stats()
+		w.add(stats.Messages, stats.Errors, stats.WriteTime)
+		sum, ok := produced[stats.Topic]
+		if !ok {
+			sum = &totals{}
+			produced[stats.Topic] = sum
+		}
+		sum.merge(w.totals)
+	}
+	for topic, t := range produced {
+		ch <- prometheus.MustNewConstMetric(producedDesc, prometheus.CounterValue, float64(t.messages), topic)
+		ch <- prometheus.MustNewConstMetric(produceErrorsDesc, prometheus.CounterValue, float64(t.errors), topic)
+		ch <- prometheus.MustNewConstSummary(produceDurationDesc, uint64(t.count), t.seconds, nil, topic)
+	}
+
+	consumed := map[readerKey]*totals{}
+	lags := map[readerKey]*kafka.Client{}
+	for _, r := range c.readers {
+		stats := r.reader.Stats()
+		r.add(stats.Messages, stats.Errors, stats.ReadTime)
+		config := r.reader.Config()
+		key := readerKey{topic: config.Topic, group: config.GroupID}
+		sum, ok := consumed[key]
+		if !ok {
+			sum = &totals{}
+			consumed[key] = sum
+		}
+		sum.merge(r.totals)
+
+		if config.GroupID == "" {
+			// Readers outside a group track the lag of their partition
+			ch <- prometheus.MustNewConstMetric(lagDesc, prometheus.GaugeValue, float64(stats.Lag),
+				config.Topic, "", strconv.Itoa(config.Partition))
+		} else {
+			lags[key] = r.lagClient
+		}
+	}
+	for key, t := range consumed {
+		ch <- prometheus.MustNewConstMetric(consumedDesc, prometheus.CounterValue, float64(t.messages), key.topic, key.group)
+		ch <- prometheus.MustNewConstMetric(consumeErrorsDesc, prometheus.CounterValue, float64(t.errors), key.topic, key.group)
+		ch <- prometheus.MustNewConstSummary(consumeDurationDesc, uint64(t.count), t.seconds, nil, key.topic, key.group)
+	}
+	return lags
+}
+
+// Transport returns a transport for kafka.Client that connects the way
+// dialer does, with its TLS, SASL, client id and timeout. A nil dialer is
+// the default one.
+func Transport(dialer *kafka.Dialer) *kafka.Transport {
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+	return &kafka.Transport{
+		DialTimeout: dialer.Timeout,
+		ClientID:    dialer.ClientID,
+		TLS:         dialer.TLS,
+		SASL:        dialer.SASLMechanism,
+	}
+}
+
+// GroupLag returns, per partition of topic, how many messages the consumer
+// group has not committed yet. Partitions the group never committed on
+// count every message still on them.
+func GroupLag(ctx context.Context, client *kafka.Client, group, topic string) (map[int]int64, error) {
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata.Topics) != 1 {
+		return nil, fmt.Errorf("topic %s not found", topic)
+	}
+	if err := metadata.Topics[0].Error; err != nil {
+		return nil, err
+	}
+
+	ids := []int{}
+	requests := []kafka.OffsetRequest{}
+	for _, partition := range metadata.Topics[0].Partitions {
+		ids = append(ids, partition.ID)
+		requests = append(requests, kafka.FirstOffsetOf(partition.ID), kafka.LastOffsetOf(partition.ID))
+	}
+
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: requests},
+	})
+	if err != nil {
+		return nil, err
+	}
+	committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: group,
+		Topics:  map[string][]int{topic: ids},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if committed.Error != nil {
+		return nil, committed.Error
+	}
+
+	commits := map[int]int64{}
+	for _, partition := range committed.Topics[topic] {
+		if partition.Error != nil {
+			return nil, partition.Error
+		}
+		commits[partition.Partition] = partition.CommittedOffset
+	}
+
+	lag := map[int]int64{}
+	problems := []string{}
+	for _, partition := range offsets.Topics[topic] {
+		if partition.Error != nil {
+			problems = append(problems, fmt.Sprintf("partition %d: %s", partition.Partition, partition.Error))
+			continue
+		}
+		offset, ok := commits[partition.Partition]
+		if !ok || offset < partition.FirstOffset {
+			offset = partition.FirstOffset
+		}
+		lag[partition.Partition] = partition.LastOffset - offset
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("cannot list offsets: %s", strings.Join(problems, ", "))
+	}
+	return lag, nil
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestLagClientPerBrokerSet(t *testing.T) {
+	c := &kafkaCollector{clients: map[string]*kafka.Client{}}
+	first := c.lagClient(kafka.ReaderConfig{Brokers: []string{"kafka-1:9092", "kafka-2:9092"}, GroupID: "a", Topic: "trades"})
+	same := c.lagClient(kafka.ReaderConfig{Brokers: []string{"kafka-2:9092", "kafka-1:9092"}, GroupID: "b", Topic: "ticks"})
+	other := c.lagClient(kafka.ReaderConfig{Brokers: []string{"kafka-3:9092"}, GroupID: "a", Topic: "trades"})
+
+	if first != same {
+		t.Error("readers of the same brokers got different lag clients")
+	}
+	if first == other {
+		t.Error("readers of different brokers share a lag client")
+	}
+	if len(c.clients) != 2 {
+		t.Errorf("%d lag clients, want 2", len(c.clients))
+	}
+}
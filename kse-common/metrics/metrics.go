@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// Namespace prefixes every metric the services export, so the same metric
+// has the same name in all of them
+const Namespace = "kse"
+
+var requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: Namespace,
+	Subsystem: "http",
+	Name:      "request_duration_seconds",
+	Help:      "Time taken to serve HTTP requests, by route.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "route", "status"})
+
+var logsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: Namespace,
+	Subsystem: "logs",
+	Name:      "dropped_total",
+	Help:      "Log entries that could not be forwarded, by reason.",
+}, []string{"reason"})
+
+var alertsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: Namespace,
+	Subsystem: "alerts",
+	Name:      "dropped_total",
+	Help:      "Alerts that were not delivered, by reason.",
+}, []string{"reason"})
+
+func init() {
+	// The default registry already exports Go runtime and process metrics
+	prometheus.MustRegister(requestDuration, kafkaStats, logsDropped, alertsDropped)
+}
+
+// Register adds the request metrics middleware to r and serves the metrics
+// on /metrics. Call it before adding routes, the middleware only sees
+// routes added after it.
+func Register(r *gin.Engine) {
+	r.Use(Middleware())
+	r.GET("/metrics", Handler())
+}
+
+// Middleware observes the duration of every request, labelled with the
+// route pattern rather than the path so ids do not blow up the series
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		requestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format. Metrics that
+// cannot be collected, like consumer lag while a broker is down, are logged
+// and left out rather than failing the scrape.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+		ErrorLog:      log.StandardLogger(),
+		ErrorHandling: promhttp.ContinueOnError,
+	}))
+}
+
+// TrackDB exports the connection pool stats of db, name tells databases
+// apart when a service has several
+func TrackDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// TrackQueue exports the depth and capacity of an in-process queue, usually
+// a channel, read when metrics are scraped
+func TrackQueue(name string, depth, capacity func() int) {
+	labels := prometheus.Labels{"queue": name}
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   Namespace,
+			Subsystem:   "queue",
+			Name:        "depth",
+			Help:        "Items waiting in an in-process queue.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(depth()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   Namespace,
+			Subsystem:   "queue",
+			Name:        "capacity",
+			Help:        "Items an in-process queue holds before senders block.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(capacity()) }),
+	)
+}
+
+// LogDropped counts a log entry that was not forwarded, reason is overflow
+// when the buffer was full and failed when sending it failed
+func LogDropped(reason string) {
+	logsDropped.WithLabelValues(reason).Inc()
+}
+
+// AlertDropped counts an alert that was not delivered to a sink, reason is
+// duplicate, rate_limited, overflow or failed
+func AlertDropped(reason string) {
+	alertsDropped.WithLabelValues(reason).Inc()
+}
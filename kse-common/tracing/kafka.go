@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headers carries trace context in the headers of a Kafka message
+type headers struct {
+	msg *kafka.Message
+}
+
+func (h headers) Get(key string) string {
+	for _, header := range h.msg.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (h headers) Set(key, value string) {
+	for i, header := range h.msg.Headers {
+		if header.Key == key {
+			h.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	h.msg.Headers = append(h.msg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (h headers) Keys() []string {
+	keys := make([]string, 0, len(h.msg.Headers))
+	for _, header := range h.msg.Headers {
+		keys = append(keys, header.Key)
+	}
+	return keys
+}
+
+// StartProducer starts a producer span for writing msg to topic and puts
+// its trace context in the message headers. End the span once the write
+// returned.
+func StartProducer(ctx context.Context, topic string, msg *kafka.Message) (context.Context, trace.Span) {
+	ctx, span := Tracer().Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystem("kafka"),
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingOperationPublish,
+		),
+	)
+	if len(msg.Key) > 0 {
+		span.SetAttributes(semconv.MessagingKafkaMessageKey(string(msg.Key)))
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headers{msg: msg})
+	return ctx, span
+}
+
+// StartConsumer starts a consumer span for processing msg, read by reader,
+// continuing the trace of the producer. End the span once msg was
+// processed.
+func StartConsumer(reader *kafka.Reader, msg kafka.Message) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), headers{msg: &msg})
+	ctx, span := Tracer().Start(ctx, msg.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystem("kafka"),
+			semconv.MessagingSourceName(msg.Topic),
+			semconv.MessagingOperationProcess,
+			semconv.MessagingKafkaSourcePartition(msg.Partition),
+			attribute.Int64("messaging.kafka.message.offset", msg.Offset),
+		),
+	)
+	if group := reader.Config().GroupID; group != "" {
+		span.SetAttributes(semconv.MessagingKafkaConsumerGroup(group))
+	}
+	return ctx, span
+}
@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestConsumerSpanCoversProcessing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown := UseExporter("test", exporter)
+	defer shutdown(context.Background())
+
+	msg := kafka.Message{Topic: "trades", Key: []byte("AAPL"), Partition: 2, Offset: 42}
+	_, producer := StartProducer(context.Background(), "trades", &msg)
+	producer.End()
+
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: []string{"127.0.0.1:9092"}, Topic: "trades"})
+	defer reader.Close()
+	ctx, consumer := StartConsumer(reader, msg)
+	_, db := Start(ctx, "traders.ApplyFill")
+	End(db, errors.New("db down"))
+	if spans := exporter.GetSpans(); len(spans) != 2 {
+		t.Fatalf("%d spans ended while the message is processed, want the producer and the DB span", len(spans))
+	}
+	End(consumer, errors.New("db down"))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("%d spans, want 3", len(spans))
+	}
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	published, processed, applied := byName["trades publish"], byName["trades process"], byName["traders.ApplyFill"]
+
+	if processed.SpanKind != trace.SpanKindConsumer {
+		t.Errorf("consumer span is a %s span", processed.SpanKind)
+	}
+	if processed.Parent.SpanID() != published.SpanContext.SpanID() {
+		t.Error("consumer span does not continue the producer span")
+	}
+	if applied.Parent.SpanID() != processed.SpanContext.SpanID() {
+		t.Error("DB span is not a child of the consumer span")
+	}
+	for _, span := range spans {
+		if span.SpanContext.TraceID() != published.SpanContext.TraceID() {
+			t.Errorf("%s is in another trace", span.Name)
+		}
+	}
+	if processed.Status.Code != codes.Error || applied.Status.Code != codes.Error {
+		t.Error("failed spans are not marked failed")
+	}
+	if processed.EndTime.Before(applied.EndTime) {
+		t.Error("consumer span ended before the processing did")
+	}
+}
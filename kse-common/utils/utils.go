@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	"strconv"
+
+	"github.com/rohanchavan1918/kse-common/alert"
+	"github.com/rohanchavan1918/kse-common/logging"
+)
+
+// AlertAndPanic sends an alert before panicking
+func AlertAndPanic(err error) {
+	alert.AndPanic(err)
+}
+
+func LogInfo(msg string, args ...interface{}) {
+	logging.Logger().Infof(msg, args...)
+}
+
+func LogError(msg string, args ...interface{}) {
+	logging.Logger().Errorf(msg, args...)
+}
+
+func NewID() string {
+	// Random 128 bit identifier, hex encoded
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func RoundTo(value float64, decimals int) float64 {
+	pow := math.Pow(10, float64(decimals))
+	return math.Round(value*pow) / pow
+}
+
+func StringToFloat64(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
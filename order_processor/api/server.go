@@ -2,21 +2,85 @@ package api
 
 import (
 	"fmt"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/database"
+	"github.com/rohanchavan1918/kse-common/health"
+	"github.com/rohanchavan1918/kse-common/kafkaadmin"
+	"github.com/rohanchavan1918/kse-common/lifecycle"
+	"github.com/rohanchavan1918/kse-common/metrics"
+	"github.com/rohanchavan1918/kse-common/utils"
 	"github.com/rohanchavan1918/order_processor/conf"
-	"github.com/rohanchavan1918/order_processor/utils"
+	"github.com/rohanchavan1918/order_processor/fees"
+	"github.com/rohanchavan1918/order_processor/trades"
 )
 
 func RunServer(config *conf.Config) {
-	r := gin.Default()
+	// Requests are logged by the logging middleware, as JSON
+	r := gin.New()
+	// Client IPs come from X-Forwarded-For only behind the configured proxies
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	r.Use(gin.Recovery())
 	SetupRoutes(r)
-	dbConn := conf.GetDBConnection(&config.DB)
-	err := dbConn.Ping()
+	dbConn, err := database.Open(&config.DB)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer dbConn.Close()
+	err = dbConn.Ping()
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+
+	// Once DB Connection is validated, add it to the global connections
+	conf.AppConnections.DB = dbConn
+	metrics.TrackDB(dbConn, config.ServiceName)
+	health.Ready("db", health.DB(dbConn))
+
+	feeEngine, err := fees.NewEngine(config.Fees, dbConn)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	fees.DefaultEngine = feeEngine
+
+	kafkaConfig, topicNames := config.KafkaSettings()
+	topics := config.KafkaConfig.Topics
+	// Create or fix the topics first when provision.ensure_on_startup is set
+	if err := kafkaadmin.EnsureOnStartup(kafkaConfig, topicNames); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	health.Ready("kafka", health.Kafka(kafkaConfig))
+	health.Ready("kafka_topics", health.KafkaTopics(kafkaConfig, topicNames...))
+
+	// Matches come in from the matching engine without fees, both sides are
+	// charged and the match goes out as a trade for the rest of the exchange
+	writer, err := config.KafkaConfig.GetProducer(topics.Trades)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	conf.AppConnections.KafkaWriter = writer
+	defer writer.Close()
+
+	matchReader, err := config.KafkaConfig.GetConsumer(topics.Matches, config.KafkaConfig.GroupID)
 	if err != nil {
 		utils.AlertAndPanic(err)
 	}
-	port := fmt.Sprintf(":%s", strconv.Itoa(int(conf.AppConfig.Port)))
-	r.Run(port)
+	defer matchReader.Close()
+	health.WatchConsumer(kafkaConfig, config.KafkaConfig.GroupID, topics.Matches)
+	health.Go("trades.matches", func() { trades.Consume(lifecycle.Context(), fees.DefaultEngine, matchReader, writer) })
+
+	// Pick up fee schedule edits in the config file without a restart, a
+	// schedule the engine rejects rolls the reload back
+	lifecycle.WatchConfig(&conf.Running, func() error {
+		if err := fees.DefaultEngine.SetSchedule(conf.AppConfig().Fees); err != nil {
+			return fmt.Errorf("cannot apply fee schedule : %w", err)
+		}
+		return nil
+	})
+
+	if err := lifecycle.Serve(r, config.Port); err != nil {
+		utils.LogError("Server stopped : %s", err)
+	}
 }
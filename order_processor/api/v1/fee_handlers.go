@@ -0,0 +1,73 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/order_processor/conf"
+	"github.com/rohanchavan1918/order_processor/fees"
+)
+
+type feeQuoteRequest struct {
+	AccountID string         `json:"account_id" binding:"required"`
+	Symbol    string         `json:"symbol" binding:"required"`
+	Liquidity fees.Liquidity `json:"liquidity" binding:"required"`
+	Notional  float64        `json:"notional" binding:"required"`
+}
+
+func GetFeeSchedule(c *gin.Context) {
+	c.JSON(http.StatusOK, fees.DefaultEngine.Schedule())
+}
+
+func UpdateFeeSchedule(c *gin.Context) {
+	// Swap the active fee schedule, it is lost on restart unless the config
+	// file is updated as well
+	var schedule conf.FeeSchedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := fees.DefaultEngine.SetSchedule(schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, fees.DefaultEngine.Schedule())
+}
+
+func QuoteFee(c *gin.Context) {
+	var req feeQuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	fee, err := fees.DefaultEngine.Quote(req.AccountID, req.Symbol, req.Liquidity, req.Notional, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, fee)
+}
+
+func GetAccountFeeTier(c *gin.Context) {
+	accountID := c.Param("account_id")
+	now := time.Now()
+	c.JSON(http.StatusOK, gin.H{
+		"account_id":  accountID,
+		"volume":      fees.DefaultEngine.Volume(accountID, now),
+		"window_days": fees.DefaultEngine.Schedule().VolumeWindowDays,
+		"tier":        fees.DefaultEngine.Tier(accountID, now),
+	})
+}
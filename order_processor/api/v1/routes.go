@@ -2,9 +2,16 @@ package v1
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/access"
 )
 
 func SetupRoutes(r *gin.RouterGroup) {
 	v1Group := r.Group("/v1")
 	v1Group.GET("/healthcheck", Healthcheck)
+
+	feeGroup := v1Group.Group("/fees")
+	feeGroup.GET("/schedule", GetFeeSchedule)
+	feeGroup.PUT("/schedule", access.Require(access.RoleAdmin), UpdateFeeSchedule)
+	feeGroup.POST("/quote", QuoteFee)
+	feeGroup.GET("/accounts/:account_id", GetAccountFeeTier)
 }
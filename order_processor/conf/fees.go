@@ -0,0 +1,84 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FeeTier is one band of a volume tiered schedule. An account lands in the
+// highest tier whose MinVolume is covered by its traded notional over the
+// schedule's volume window. Rates are in basis points of the trade notional,
+// a negative rate is a rebate paid to the account.
+type FeeTier struct {
+	Name      string  `viper:"string" mapstructure:"name"`
+	MinVolume float64 `viper:"float" mapstructure:"min_volume"`
+	MakerBps  float64 `viper:"float" mapstructure:"maker_bps"`
+	TakerBps  float64 `viper:"float" mapstructure:"taker_bps"`
+}
+
+// SymbolFeeOverride replaces the tiered rates for a single symbol. Fields
+// left out of the config fall back to the account's tier.
+type SymbolFeeOverride struct {
+	MakerBps *float64 `mapstructure:"maker_bps"`
+	TakerBps *float64 `mapstructure:"taker_bps"`
+	MinFee   *float64 `mapstructure:"min_fee"`
+}
+
+// FeeSchedule specifies how trades are charged
+type FeeSchedule struct {
+	Name             string                       `viper:"string" mapstructure:"name"`
+	VolumeWindowDays int                          `viper:"int" mapstructure:"volume_window_days"`
+	MinFee           float64                      `viper:"float" mapstructure:"min_fee"`
+	Tiers            []FeeTier                    `mapstructure:"tiers"`
+	Overrides        map[string]SymbolFeeOverride `mapstructure:"overrides"`
+}
+
+// Validate checks that the schedule can be used to price trades
+func (s *FeeSchedule) Validate() error {
+	if len(s.Tiers) == 0 {
+		return errors.New("fee schedule needs at least one tier")
+	}
+	if s.VolumeWindowDays < 0 {
+		return errors.New("volume_window_days cannot be negative")
+	}
+	if s.MinFee < 0 {
+		return errors.New("min_fee cannot be negative")
+	}
+	if s.Tiers[0].MinVolume != 0 {
+		return errors.New("the first fee tier must start at min_volume 0")
+	}
+	for i, tier := range s.Tiers {
+		if tier.TakerBps < 0 {
+			return fmt.Errorf("tier %d: taker_bps cannot be negative", i)
+		}
+		if tier.MakerBps < 0 && -tier.MakerBps > tier.TakerBps {
+			return fmt.Errorf("tier %d: maker rebate cannot exceed the taker fee", i)
+		}
+		if i > 0 && tier.MinVolume <= s.Tiers[i-1].MinVolume {
+			return fmt.Errorf("tier %d: min_volume must be greater than the previous tier", i)
+		}
+	}
+	for symbol, override := range s.Overrides {
+		if override.TakerBps != nil && *override.TakerBps < 0 {
+			return fmt.Errorf("override %s: taker_bps cannot be negative", symbol)
+		}
+		if override.MinFee != nil && *override.MinFee < 0 {
+			return fmt.Errorf("override %s: min_fee cannot be negative", symbol)
+		}
+	}
+	return nil
+}
+
+// Normalize fills in defaults and upper cases the override symbols, viper
+// lower cases every map key it reads.
+func (s *FeeSchedule) Normalize() {
+	if s.VolumeWindowDays == 0 {
+		s.VolumeWindowDays = 30
+	}
+	overrides := make(map[string]SymbolFeeOverride, len(s.Overrides))
+	for symbol, override := range s.Overrides {
+		overrides[strings.ToUpper(symbol)] = override
+	}
+	s.Overrides = overrides
+}
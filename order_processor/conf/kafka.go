@@ -0,0 +1,25 @@
+package conf
+
+import commonconf "github.com/rohanchavan1918/kse-common/config"
+
+type KafkaConfig struct {
+	commonconf.Kafka `mapstructure:",squash"`
+
+	Topics KafkaTopics `mapstructure:"topics"`
+}
+
+// KafkaTopics names every topic the order processor produces to or consumes
+// from
+type KafkaTopics struct {
+	// Matches as the matching engine publishes them, before fees
+	Matches string `viper:"string" validate:"required" mapstructure:"matches"`
+	// Trades with the fees of both sides, for the rest of the exchange
+	Trades string `viper:"string" validate:"required" mapstructure:"trades"`
+}
+
+// KafkaSettings returns the Kafka connection and the topics the service
+// uses, for the topics command and startup provisioning
+func (c *Config) KafkaSettings() (*commonconf.Kafka, []string) {
+	topics := c.KafkaConfig.Topics
+	return &c.KafkaConfig.Kafka, []string{topics.Matches, topics.Trades}
+}
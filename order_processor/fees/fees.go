@@ -0,0 +1,304 @@
+package fees
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/rohanchavan1918/kse-common/ledger"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/order_processor/conf"
+)
+
+type Liquidity string
+
+const (
+	Maker Liquidity = "maker"
+	Taker Liquidity = "taker"
+)
+
+// trade_fees remembers which trades were charged, and what for
+const tradeFeesSchema = `CREATE TABLE IF NOT EXISTS trade_fees (
+	trade_id VARCHAR(64) PRIMARY KEY,
+	fees JSON NOT NULL,
+	charged_at DATETIME(6) NOT NULL
+)`
+
+// Fee is the charge for one side of a trade. A negative Amount is a rebate
+// paid to the account.
+type Fee struct {
+	AccountID string    `json:"account_id"`
+	Symbol    string    `json:"symbol"`
+	Liquidity Liquidity `json:"liquidity"`
+	Notional  float64   `json:"notional"`
+	Tier      string    `json:"tier"`
+	RateBps   float64   `json:"rate_bps"`
+	Amount    float64   `json:"amount"`
+	Rebate    bool      `json:"rebate"`
+}
+
+// Trade is what the engine needs to know about an execution to charge both
+// sides of it
+type Trade struct {
+	TradeID     string    `json:"trade_id"`
+	Symbol      string    `json:"symbol"`
+	Price       float64   `json:"price"`
+	Quantity    float64   `json:"quantity"`
+	MakerUserID int64     `json:"maker_user_id"`
+	TakerUserID int64     `json:"taker_user_id"`
+	ExecutedAt  time.Time `json:"executed_at"`
+}
+
+// TradeFees is attached to trade events so both counterparties can see what
+// they were charged
+type TradeFees struct {
+	MakerFee Fee `json:"maker_fee"`
+	TakerFee Fee `json:"taker_fee"`
+}
+
+// Engine prices trades against the active fee schedule. The schedule can be
+// swapped at any time, in flight quotes keep the schedule they started with.
+type Engine struct {
+	mu       sync.RWMutex
+	schedule conf.FeeSchedule
+	volumes  *VolumeTracker
+	db       *sql.DB
+}
+
+var DefaultEngine *Engine
+
+// NewEngine builds an engine for the schedule. When db is not nil fees are
+// booked into the ledger and traded volume is persisted.
+func NewEngine(schedule conf.FeeSchedule, db *sql.DB) (*Engine, error) {
+	schedule.Normalize()
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+
+	e := &Engine{
+		schedule: schedule,
+		volumes:  NewVolumeTracker(db),
+		db:       db,
+	}
+	if db != nil {
+		if err := ledger.EnsureSchema(db); err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec(tradeFeesSchema); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.volumes.Load(schedule.VolumeWindowDays, time.Now()); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Engine) Schedule() conf.FeeSchedule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.schedule
+}
+
+// SetSchedule validates and activates a new schedule
+func (e *Engine) SetSchedule(schedule conf.FeeSchedule) error {
+	schedule.Normalize()
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.schedule = schedule
+	e.mu.Unlock()
+	utils.LogInfo("Fee schedule %q activated with %d tiers", schedule.Name, len(schedule.Tiers))
+	return nil
+}
+
+// Volume returns the traded notional of the account over the volume window
+// of the active schedule
+func (e *Engine) Volume(accountID string, at time.Time) float64 {
+	return e.volumes.Volume(accountID, e.Schedule().VolumeWindowDays, at)
+}
+
+// Tier returns the tier the account is in at the given time
+func (e *Engine) Tier(accountID string, at time.Time) conf.FeeTier {
+	schedule := e.Schedule()
+	return tierFor(schedule, e.volumes.Volume(accountID, schedule.VolumeWindowDays, at))
+}
+
+func tierFor(schedule conf.FeeSchedule, volume float64) conf.FeeTier {
+	// Tiers are validated to be sorted by MinVolume
+	tier := schedule.Tiers[0]
+	for _, t := range schedule.Tiers {
+		if volume >= t.MinVolume {
+			tier = t
+		}
+	}
+	return tier
+}
+
+// Quote prices one side of a trade without recording anything
+func (e *Engine) Quote(accountID, symbol string, liquidity Liquidity, notional float64, at time.Time) (Fee, error) {
+	if liquidity != Maker && liquidity != Taker {
+		return Fee{}, errors.New("liquidity must be maker or taker")
+	}
+	if notional < 0 {
+		return Fee{}, errors.New("notional cannot be negative")
+	}
+
+	schedule := e.Schedule()
+	symbol = strings.ToUpper(symbol)
+	tier := tierFor(schedule, e.volumes.Volume(accountID, schedule.VolumeWindowDays, at))
+
+	rate := tier.TakerBps
+	if liquidity == Maker {
+		rate = tier.MakerBps
+	}
+	minFee := schedule.MinFee
+	if override, ok := schedule.Overrides[symbol]; ok {
+		if liquidity == Maker && override.MakerBps != nil {
+			rate = *override.MakerBps
+		}
+		if liquidity == Taker && override.TakerBps != nil {
+			rate = *override.TakerBps
+		}
+		if override.MinFee != nil {
+			minFee = *override.MinFee
+		}
+	}
+
+	amount := notional * rate / 10000
+	// The minimum only applies to charges, rebates and free trades are paid
+	// out as computed
+	if rate > 0 && amount < minFee {
+		amount = minFee
+	}
+
+	return Fee{
+		AccountID: accountID,
+		Symbol:    symbol,
+		Liquidity: liquidity,
+		Notional:  notional,
+		Tier:      tier.Name,
+		RateBps:   rate,
+		Amount:    utils.RoundTo(amount, 2),
+		Rebate:    amount < 0,
+	}, nil
+}
+
+// ChargeTrade prices both sides of the trade, books the fees into the ledger
+// and counts the notional towards both accounts' traded volume. Fees are
+// charged to the users' cash accounts, ledger.UserAccount, which is also
+// the account id their volume and tier are tracked under.
+//
+// A trade is only charged once, charging it again returns the fees it was
+// charged the first time, so redelivered matches are safe to retry.
+func (e *Engine) ChargeTrade(trade Trade) (TradeFees, error) {
+	if trade.TradeID == "" {
+		return TradeFees{}, errors.New("trade needs an id")
+	}
+	if trade.MakerUserID == 0 || trade.TakerUserID == 0 {
+		return TradeFees{}, errors.New("trade needs a maker and a taker user")
+	}
+	makerAccount, takerAccount := ledger.UserAccount(trade.MakerUserID), ledger.UserAccount(trade.TakerUserID)
+	if trade.ExecutedAt.IsZero() {
+		trade.ExecutedAt = time.Now()
+	}
+	notional := trade.Price * trade.Quantity
+
+	makerFee, err := e.Quote(makerAccount, trade.Symbol, Maker, notional, trade.ExecutedAt)
+	if err != nil {
+		return TradeFees{}, err
+	}
+	takerFee, err := e.Quote(takerAccount, trade.Symbol, Taker, notional, trade.ExecutedAt)
+	if err != nil {
+		return TradeFees{}, err
+	}
+	tradeFees := TradeFees{MakerFee: makerFee, TakerFee: takerFee}
+	accounts := []string{makerAccount, takerAccount}
+
+	if e.db != nil {
+		charged, err := e.book(trade, tradeFees, accounts, notional)
+		if err != nil {
+			return TradeFees{}, err
+		}
+		if charged != nil {
+			return *charged, nil
+		}
+	}
+
+	// The volume is persisted with the fees, only the buckets in memory
+	// are left
+	windowDays := e.Schedule().VolumeWindowDays
+	for _, account := range accounts {
+		e.volumes.record(account, notional, trade.ExecutedAt, windowDays)
+	}
+	return tradeFees, nil
+}
+
+// book records that the trade was charged, posts its fees and adds its
+// notional to the accounts' traded volume in one transaction. When the trade
+// was charged before nothing is written and the fees it was charged then are
+// returned.
+func (e *Engine) book(trade Trade, tradeFees TradeFees, accounts []string, notional float64) (*TradeFees, error) {
+	payload, err := json.Marshal(tradeFees)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := e.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO trade_fees (trade_id, fees, charged_at) VALUES (?, ?, ?)", trade.TradeID, payload, time.Now().UTC())
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		var stored []byte
+		if err := e.db.QueryRow("SELECT fees FROM trade_fees WHERE trade_id = ?", trade.TradeID).Scan(&stored); err != nil {
+			return nil, err
+		}
+		charged := &TradeFees{}
+		return charged, json.Unmarshal(stored, charged)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if entries := ledgerEntries(trade, tradeFees); len(entries) > 0 {
+		if err := ledger.PostTx(tx, "fees:"+trade.TradeID, entries); err != nil {
+			return nil, err
+		}
+	}
+	for _, account := range accounts {
+		if err := addTx(tx, account, notional, trade.ExecutedAt); err != nil {
+			return nil, err
+		}
+	}
+	return nil, tx.Commit()
+}
+
+func ledgerEntries(trade Trade, tradeFees TradeFees) []ledger.Entry {
+	// Every fee debits the account and credits fee revenue, every rebate
+	// debits the rebate account and credits the account
+	entries := []ledger.Entry{}
+	for _, fee := range []Fee{tradeFees.MakerFee, tradeFees.TakerFee} {
+		if fee.Amount == 0 {
+			continue
+		}
+		kind, exchangeAccount := "fee", ledger.FeeRevenueAccount
+		if fee.Rebate {
+			kind, exchangeAccount = "rebate", ledger.RebateAccount
+		}
+		entries = append(entries,
+			ledger.Entry{AccountID: fee.AccountID, Asset: ledger.DefaultAsset, Amount: -fee.Amount, Kind: kind, Reference: trade.TradeID},
+			ledger.Entry{AccountID: exchangeAccount, Asset: ledger.DefaultAsset, Amount: fee.Amount, Kind: kind, Reference: trade.TradeID},
+		)
+	}
+	return entries
+}
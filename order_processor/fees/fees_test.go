@@ -0,0 +1,142 @@
+package fees
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rohanchavan1918/order_processor/conf"
+)
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func testSchedule() conf.FeeSchedule {
+	return conf.FeeSchedule{
+		Name:             "test",
+		VolumeWindowDays: 30,
+		MinFee:           0.01,
+		Tiers: []conf.FeeTier{
+			{Name: "tier-1", MinVolume: 0, MakerBps: 10, TakerBps: 20},
+			{Name: "tier-2", MinVolume: 1000000, MakerBps: 5, TakerBps: 15},
+			{Name: "tier-3", MinVolume: 10000000, MakerBps: 0, TakerBps: 10},
+			{Name: "tier-4", MinVolume: 50000000, MakerBps: -1, TakerBps: 7},
+		},
+		Overrides: map[string]conf.SymbolFeeOverride{
+			"aapl": {TakerBps: float(12), MinFee: float(0.05)},
+			"TSLA": {MakerBps: float(-2)},
+		},
+	}
+}
+
+func TestQuote(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	engine, err := NewEngine(testSchedule(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumes := map[string]float64{
+		"user:2": 1000000,
+		"user:3": 20000000,
+		"user:4": 60000000,
+	}
+	for account, volume := range volumes {
+		if err := engine.volumes.Add(account, volume, now.AddDate(0, 0, -3), 30); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Volume older than the window does not count
+	if err := engine.volumes.Add("user:5", 50000000, now.AddDate(0, 0, -40), 30); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		account   string
+		symbol    string
+		liquidity Liquidity
+		notional  float64
+		tier      string
+		rate      float64
+		amount    float64
+		rebate    bool
+	}{
+		{"lowest tier maker", "user:1", "MSFT", Maker, 10000, "tier-1", 10, 10, false},
+		{"lowest tier taker", "user:1", "MSFT", Taker, 10000, "tier-1", 20, 20, false},
+		{"rounded to cents", "user:1", "MSFT", Taker, 1234.56, "tier-1", 20, 2.47, false},
+		{"min fee", "user:1", "MSFT", Taker, 1, "tier-1", 20, 0.01, false},
+		{"tier starts at its min volume", "user:2", "MSFT", Taker, 10000, "tier-2", 15, 15, false},
+		{"zero rate is free", "user:3", "MSFT", Maker, 10000, "tier-3", 0, 0, false},
+		{"zero rate skips the min fee", "user:3", "MSFT", Maker, 1, "tier-3", 0, 0, false},
+		{"negative rate is a rebate", "user:4", "MSFT", Maker, 10000, "tier-4", -1, -1, true},
+		{"rebate skips the min fee", "user:4", "MSFT", Maker, 1, "tier-4", -1, 0, true},
+		{"volume out of the window", "user:5", "MSFT", Taker, 10000, "tier-1", 20, 20, false},
+		{"override rate", "user:1", "AAPL", Taker, 10000, "tier-1", 12, 12, false},
+		{"override matches any case", "user:1", "aapl", Taker, 10000, "tier-1", 12, 12, false},
+		{"override min fee", "user:1", "AAPL", Taker, 1, "tier-1", 12, 0.05, false},
+		{"override keeps the other side", "user:1", "AAPL", Maker, 10000, "tier-1", 10, 10, false},
+		{"override beats the tier", "user:3", "AAPL", Taker, 10000, "tier-3", 12, 12, false},
+		{"override rebate", "user:1", "TSLA", Maker, 10000, "tier-1", -2, -2, true},
+		{"override rebate keeps the tier taker rate", "user:1", "TSLA", Taker, 10000, "tier-1", 20, 20, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fee, err := engine.Quote(tt.account, tt.symbol, tt.liquidity, tt.notional, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fee.Tier != tt.tier || fee.RateBps != tt.rate || fee.Amount != tt.amount || fee.Rebate != tt.rebate {
+				t.Errorf("got tier %s, %v bps, amount %v, rebate %v, want tier %s, %v bps, amount %v, rebate %v",
+					fee.Tier, fee.RateBps, fee.Amount, fee.Rebate, tt.tier, tt.rate, tt.amount, tt.rebate)
+			}
+			if fee.AccountID != tt.account || fee.Liquidity != tt.liquidity || fee.Notional != tt.notional {
+				t.Errorf("fee is for %s %s %v, want %s %s %v", fee.AccountID, fee.Liquidity, fee.Notional, tt.account, tt.liquidity, tt.notional)
+			}
+		})
+	}
+}
+
+func TestQuoteRejects(t *testing.T) {
+	engine, err := NewEngine(testSchedule(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Quote("user:1", "MSFT", "both", 100, time.Now()); err == nil {
+		t.Error("quote with an unknown liquidity did not fail")
+	}
+	if _, err := engine.Quote("user:1", "MSFT", Taker, -100, time.Now()); err == nil {
+		t.Error("quote with a negative notional did not fail")
+	}
+}
+
+func TestChargeTrade(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	engine, err := NewEngine(testSchedule(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trade := Trade{TradeID: "t-1", Symbol: "MSFT", Price: 100, Quantity: 10000, MakerUserID: 7, TakerUserID: 8, ExecutedAt: now}
+	tradeFees, err := engine.ChargeTrade(trade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tradeFees.MakerFee.AccountID != "user:7" || tradeFees.MakerFee.Amount != 1000 {
+		t.Errorf("maker fee is %+v, want 1000 charged to user:7", tradeFees.MakerFee)
+	}
+	if tradeFees.TakerFee.AccountID != "user:8" || tradeFees.TakerFee.Amount != 2000 {
+		t.Errorf("taker fee is %+v, want 2000 charged to user:8", tradeFees.TakerFee)
+	}
+
+	// The notional counts towards both users' volume, which moves them up
+	// a tier for the next trade
+	for _, account := range []string{"user:7", "user:8"} {
+		if tier := engine.Tier(account, now); tier.Name != "tier-2" {
+			t.Errorf("%s is in %s after the trade, want tier-2", account, tier.Name)
+		}
+	}
+
+	if _, err := engine.ChargeTrade(Trade{TradeID: "t-2", Symbol: "MSFT", Price: 1, Quantity: 1, MakerUserID: 7}); err == nil {
+		t.Error("trade without a taker was charged")
+	}
+}
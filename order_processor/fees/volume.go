@@ -0,0 +1,127 @@
+package fees
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+const volumeSchema = `CREATE TABLE IF NOT EXISTS account_daily_volume (
+	account_id VARCHAR(128) NOT NULL,
+	day DATE NOT NULL,
+	notional DECIMAL(24, 8) NOT NULL,
+	PRIMARY KEY (account_id, day)
+)`
+
+// VolumeTracker keeps the traded notional of every account in daily buckets
+// so the rolling window used for tier selection is cheap to compute. When a
+// DB is set the buckets are also persisted, so tiers survive a restart.
+type VolumeTracker struct {
+	mu    sync.Mutex
+	db    *sql.DB
+	daily map[string]map[int64]float64
+}
+
+func NewVolumeTracker(db *sql.DB) *VolumeTracker {
+	return &VolumeTracker{
+		db:    db,
+		daily: map[string]map[int64]float64{},
+	}
+}
+
+func dayOf(t time.Time) int64 {
+	return t.UTC().Unix() / 86400
+}
+
+// Load reads the buckets of the last windowDays from the DB
+func (v *VolumeTracker) Load(windowDays int, now time.Time) error {
+	if v.db == nil {
+		return nil
+	}
+	if _, err := v.db.Exec(volumeSchema); err != nil {
+		return err
+	}
+
+	since := time.Unix((dayOf(now)-int64(windowDays)+1)*86400, 0).UTC()
+	rows, err := v.db.Query(
+		"SELECT account_id, day, notional FROM account_daily_volume WHERE day >= ?",
+		since.Format("2006-01-02"),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for rows.Next() {
+		var account, day string
+		var notional float64
+		if err := rows.Scan(&account, &day, &notional); err != nil {
+			return err
+		}
+		t, err := time.Parse("2006-01-02", day[:10])
+		if err != nil {
+			return err
+		}
+		if v.daily[account] == nil {
+			v.daily[account] = map[int64]float64{}
+		}
+		v.daily[account][dayOf(t)] = notional
+	}
+	return rows.Err()
+}
+
+// Add records traded notional for an account and drops buckets that fell
+// out of the window
+func (v *VolumeTracker) Add(account string, notional float64, at time.Time, windowDays int) error {
+	v.record(account, notional, at, windowDays)
+	if v.db == nil {
+		return nil
+	}
+	_, err := v.db.Exec(addVolume, account, at.UTC().Format("2006-01-02"), notional)
+	return err
+}
+
+const addVolume = "INSERT INTO account_daily_volume (account_id, day, notional) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE notional = notional + VALUES(notional)"
+
+// addTx persists traded notional as part of tx. The buckets in memory are
+// left alone, record the notional once tx is committed.
+func addTx(tx *sql.Tx, account string, notional float64, at time.Time) error {
+	_, err := tx.Exec(addVolume, account, at.UTC().Format("2006-01-02"), notional)
+	return err
+}
+
+// record adds traded notional to the buckets in memory only
+func (v *VolumeTracker) record(account string, notional float64, at time.Time, windowDays int) {
+	day := dayOf(at)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	buckets := v.daily[account]
+	if buckets == nil {
+		buckets = map[int64]float64{}
+		v.daily[account] = buckets
+	}
+	buckets[day] += notional
+	for d := range buckets {
+		if d <= day-int64(windowDays) {
+			delete(buckets, d)
+		}
+	}
+}
+
+// Volume returns the notional traded by account over the windowDays ending at
+func (v *VolumeTracker) Volume(account string, windowDays int, at time.Time) float64 {
+	day := dayOf(at)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	total := 0.0
+	for d, notional := range v.daily[account] {
+		if d > day-int64(windowDays) && d <= day {
+			total += notional
+		}
+	}
+	return total
+}
@@ -0,0 +1,127 @@
+package trades
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/consumer"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/rohanchavan1918/order_processor/fees"
+	"github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const publishTimeout = 10 * time.Second
+
+// Match is a trade as the matching engine publishes it, before fees
+type Match struct {
+	TradeID     string    `json:"trade_id"`
+	Symbol      string    `json:"symbol"`
+	Price       float64   `json:"price"`
+	Quantity    float64   `json:"quantity"`
+	BuyOrderID  string    `json:"buy_order_id"`
+	SellOrderID string    `json:"sell_order_id"`
+	BuyUserID   int64     `json:"buy_user_id"`
+	SellUserID  int64     `json:"sell_user_id"`
+	MakerSide   string    `json:"maker_side"`
+	ExecutedAt  time.Time `json:"executed_at"`
+}
+
+func (m *Match) Validate() error {
+	if m.TradeID == "" || m.Symbol == "" {
+		return errors.New("match needs a trade id and a symbol")
+	}
+	if m.Price <= 0 || m.Quantity <= 0 {
+		return errors.New("match needs a positive price and quantity")
+	}
+	if m.BuyUserID == 0 || m.SellUserID == 0 {
+		return errors.New("match needs a buyer and a seller")
+	}
+	if m.MakerSide != "buy" && m.MakerSide != "sell" {
+		return fmt.Errorf("maker side must be buy or sell, not %q", m.MakerSide)
+	}
+	return nil
+}
+
+// feeTrade is the match as the fee engine sees it, by maker and taker
+func (m *Match) feeTrade() fees.Trade {
+	trade := fees.Trade{
+		TradeID:     m.TradeID,
+		Symbol:      m.Symbol,
+		Price:       m.Price,
+		Quantity:    m.Quantity,
+		MakerUserID: m.SellUserID,
+		TakerUserID: m.BuyUserID,
+		ExecutedAt:  m.ExecutedAt,
+	}
+	if m.MakerSide == "buy" {
+		trade.MakerUserID, trade.TakerUserID = m.BuyUserID, m.SellUserID
+	}
+	return trade
+}
+
+// Trade is a match with the fees of both sides, published on the trades
+// topic for platform_apis and user_analytics
+type Trade struct {
+	Match
+	Fees fees.TradeFees `json:"fees"`
+}
+
+// Consume charges the fees of every match and publishes it as a trade until
+// ctx is done. Charging is idempotent, so a match is retried as a whole when
+// publishing fails and the trade goes out with the fees charged the first
+// time.
+func Consume(ctx context.Context, engine *fees.Engine, reader *kafka.Reader, writer *kafka.Writer) {
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		logger := logging.ForMessage(ctx, msg)
+
+		var match Match
+		if err := json.Unmarshal(msg.Value, &match); err != nil {
+			logger.WithError(err).Error("Skipping malformed match")
+			return nil
+		}
+		logger = logger.WithFields(log.Fields{"trade_id": match.TradeID, logging.FieldSymbol: match.Symbol})
+		if err := match.Validate(); err != nil {
+			logger.WithError(err).Error("Skipping invalid match")
+			return nil
+		}
+		if match.ExecutedAt.IsZero() {
+			match.ExecutedAt = msg.Time
+		}
+
+		_, span := tracing.Start(ctx, "fees.ChargeTrade")
+		tradeFees, err := engine.ChargeTrade(match.feeTrade())
+		if tracing.End(span, err) != nil {
+			return fmt.Errorf("cannot charge fees : %w", err)
+		}
+
+		if err := publish(ctx, writer, Trade{Match: match, Fees: tradeFees}); err != nil {
+			return fmt.Errorf("cannot publish trade : %w", err)
+		}
+		logger.WithFields(log.Fields{
+			"maker_fee": tradeFees.MakerFee.Amount,
+			"taker_fee": tradeFees.TakerFee.Amount,
+		}).Debug("Trade published")
+		return nil
+	})
+}
+
+func publish(ctx context.Context, w *kafka.Writer, trade Trade) error {
+	value, err := json.Marshal(trade)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	msg := kafka.Message{
+		Key:   []byte(trade.Symbol),
+		Value: value,
+	}
+	ctx, span := tracing.StartProducer(ctx, w.Topic, &msg)
+	return tracing.End(span, w.WriteMessages(ctx, msg))
+}
@@ -0,0 +1,37 @@
+package trades
+
+import "testing"
+
+func TestFeeTradeSides(t *testing.T) {
+	match := Match{TradeID: "t-1", Symbol: "MSFT", Price: 10, Quantity: 5, BuyUserID: 1, SellUserID: 2, MakerSide: "buy"}
+	if trade := match.feeTrade(); trade.MakerUserID != 1 || trade.TakerUserID != 2 {
+		t.Errorf("buy side maker: maker %d, taker %d, want 1 and 2", trade.MakerUserID, trade.TakerUserID)
+	}
+	match.MakerSide = "sell"
+	if trade := match.feeTrade(); trade.MakerUserID != 2 || trade.TakerUserID != 1 {
+		t.Errorf("sell side maker: maker %d, taker %d, want 2 and 1", trade.MakerUserID, trade.TakerUserID)
+	}
+}
+
+func TestMatchValidate(t *testing.T) {
+	valid := Match{TradeID: "t-1", Symbol: "MSFT", Price: 10, Quantity: 5, BuyUserID: 1, SellUserID: 2, MakerSide: "buy"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid match rejected : %s", err)
+	}
+
+	tests := map[string]func(m *Match){
+		"no trade id":      func(m *Match) { m.TradeID = "" },
+		"no price":         func(m *Match) { m.Price = 0 },
+		"no quantity":      func(m *Match) { m.Quantity = -1 },
+		"no seller":        func(m *Match) { m.SellUserID = 0 },
+		"no maker side":    func(m *Match) { m.MakerSide = "" },
+		"wrong maker side": func(m *Match) { m.MakerSide = "both" },
+	}
+	for name, change := range tests {
+		m := valid
+		change(&m)
+		if err := m.Validate(); err == nil {
+			t.Errorf("match with %s accepted", name)
+		}
+	}
+}
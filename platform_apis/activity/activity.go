@@ -0,0 +1,164 @@
+package activity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/auth"
+	"github.com/segmentio/kafka-go"
+)
+
+// Activity event types. user_analytics only accepts the types listed here.
+const (
+	TypeSignup                 = "signup"
+	TypeLogin                  = "login"
+	TypeLogout                 = "logout"
+	TypeOrderPlaced            = "order_placed"
+	TypeOrderCancelRequested   = "order_cancel_requested"
+	TypeOrderReplaceRequested  = "order_replace_requested"
+	TypeWatchlistCreated       = "watchlist_created"
+	TypeWatchlistRenamed       = "watchlist_renamed"
+	TypeWatchlistDeleted       = "watchlist_deleted"
+	TypeWatchlistSymbolAdded   = "watchlist_symbol_added"
+	TypeWatchlistSymbolRemoved = "watchlist_symbol_removed"
+	TypePageView               = "page_view"
+	TypeDepositCompleted       = "deposit_completed"
+	TypeWithdrawalCompleted    = "withdrawal_completed"
+	TypeTradeExecuted          = "trade_executed"
+)
+
+// Sources of an event, client events come from the tracking endpoint and
+// carry client supplied data
+const (
+	SourceServer = "server"
+	SourceClient = "client"
+)
+
+const (
+	batchSize     = 100
+	flushInterval = 500 * time.Millisecond
+	writeTimeout  = 10 * time.Second
+)
+
+// Event is the message published to the activity topic, keyed by user so a
+// user's events stay in order
+type Event struct {
+	EventID       string                 `json:"event_id"`
+	Type          string                 `json:"type"`
+	UserID        int64                  `json:"user_id"`
+	OccurredAt    time.Time              `json:"occurred_at"`
+	Source        string                 `json:"source"`
+	AuthSessionID string                 `json:"auth_session_id,omitempty"`
+	IP            string                 `json:"ip,omitempty"`
+	UserAgent     string                 `json:"user_agent,omitempty"`
+	Properties    map[string]interface{} `json:"properties,omitempty"`
+}
+
+// Publisher sends activity events to Kafka in the background. Analytics is
+// best effort, events are dropped rather than slowing down requests when
+// Kafka cannot keep up.
+type Publisher struct {
+	writer *kafka.Writer
+	events chan Event
+}
+
+var DefaultPublisher *Publisher
+
+func NewPublisher(writer *kafka.Writer, buffer int) *Publisher {
+	return &Publisher{writer: writer, events: make(chan Event, buffer)}
+}
+
+// Publish queues an event without blocking
+func (p *Publisher) Publish(e Event) {
+	select {
+	case p.events <- e:
+	default:
+		utils.LogError("Dropping %s activity event of user %d, the queue is full", e.Type, e.UserID)
+	}
+}
+
+// Run writes queued events in batches, it never returns
+func (p *Publisher) Run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := []kafka.Message{}
+	for {
+		select {
+		case e := <-p.events:
+			value, err := json.Marshal(e)
+			if err != nil {
+				utils.LogError("Failed to encode activity event : %s", err)
+				continue
+			}
+			batch = append(batch, kafka.Message{Key: []byte(strconv.FormatInt(e.UserID, 10)), Value: value})
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+		if err := p.writer.WriteMessages(ctx, batch...); err != nil {
+			utils.LogError("Failed to publish %d activity events : %s", len(batch), err)
+		}
+		cancel()
+		batch = batch[:0]
+	}
+}
+
+// New builds a server side event for the user behind the request
+func New(c *gin.Context, userID int64, eventType string, properties map[string]interface{}) Event {
+	return Event{
+		EventID:       utils.NewID(),
+		Type:          eventType,
+		UserID:        userID,
+		OccurredAt:    time.Now().UTC(),
+		Source:        SourceServer,
+		AuthSessionID: auth.CurrentSessionID(c),
+		IP:            c.ClientIP(),
+		UserAgent:     c.Request.UserAgent(),
+		Properties:    properties,
+	}
+}
+
+// Track publishes an event for the user behind the request, it is a no-op
+// when no publisher is configured
+func Track(c *gin.Context, userID int64, eventType string, properties map[string]interface{}) {
+	if DefaultPublisher == nil {
+		return
+	}
+	DefaultPublisher.Publish(New(c, userID, eventType, properties))
+}
+
+// NewSystem builds a server side event that no request is behind, such as a
+// settled deposit. The event ID is derived from key, so emitting the event
+// again for the same key is deduplicated downstream.
+func NewSystem(userID int64, eventType, key string, occurredAt time.Time, properties map[string]interface{}) Event {
+	sum := sha256.Sum256([]byte(eventType + ":" + key))
+	return Event{
+		EventID:    hex.EncodeToString(sum[:16]),
+		Type:       eventType,
+		UserID:     userID,
+		OccurredAt: occurredAt.UTC(),
+		Source:     SourceServer,
+		Properties: properties,
+	}
+}
+
+// Emit publishes an event, it is a no-op when no publisher is configured
+func Emit(e Event) {
+	if DefaultPublisher == nil {
+		return
+	}
+	DefaultPublisher.Publish(e)
+}
@@ -0,0 +1,270 @@
+package alerts
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rohanchavan1918/platform_apis/conf"
+)
+
+// Conditions an alert can watch for
+const (
+	// The price moves from below the threshold to at or above it
+	ConditionCrossesAbove = "crosses_above"
+	// The price moves from above the threshold to at or below it
+	ConditionCrossesBelow = "crosses_below"
+	// The price moved by at least threshold percent, either way, within window
+	ConditionPctMove = "pct_move"
+	// The traded volume of the last window is at least threshold times the
+	// average volume of the windows before it
+	ConditionVolumeSpike = "volume_spike"
+)
+
+const (
+	StatusActive    = "active"
+	StatusTriggered = "triggered"
+)
+
+var (
+	ErrNotFound      = errors.New("Alert not found")
+	ErrTooManyAlerts = errors.New("Alert limit reached, delete an unused alert first")
+)
+
+// Alert fires once, after that it stays around as triggered until the user
+// deletes it
+type Alert struct {
+	ID            int64      `json:"id"`
+	UserID        int64      `json:"user_id"`
+	Symbol        string     `json:"symbol"`
+	Condition     string     `json:"condition"`
+	Threshold     float64    `json:"threshold"`
+	WindowSeconds int64      `json:"window_seconds,omitempty"`
+	WebhookURL    string     `json:"webhook_url,omitempty"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	TriggeredAt   *time.Time `json:"triggered_at"`
+}
+
+func (a *Alert) window() time.Duration {
+	return time.Duration(a.WindowSeconds) * time.Second
+}
+
+// CreateRequest is what a user sends to set up an alert
+type CreateRequest struct {
+	Symbol        string  `json:"symbol" binding:"required"`
+	Condition     string  `json:"condition" binding:"required"`
+	Threshold     float64 `json:"threshold" binding:"required"`
+	WindowSeconds int64   `json:"window_seconds"`
+	WebhookURL    string  `json:"webhook_url"`
+}
+
+func (r *CreateRequest) Normalize() {
+	r.Symbol = strings.ToUpper(strings.TrimSpace(r.Symbol))
+	r.Condition = strings.ToLower(strings.TrimSpace(r.Condition))
+	r.WebhookURL = strings.TrimSpace(r.WebhookURL)
+}
+
+func (r *CreateRequest) Validate() error {
+	if r.Symbol == "" {
+		return errors.New("Symbol cannot be empty")
+	}
+	if math.IsNaN(r.Threshold) || math.IsInf(r.Threshold, 0) {
+		return errors.New("Threshold must be a number")
+	}
+
+	maxWindow := conf.AppConfig().Alerts.MaxWindow
+	if maxWindow == 0 {
+		maxWindow = 24 * time.Hour
+	}
+	window := time.Duration(r.WindowSeconds) * time.Second
+
+	switch r.Condition {
+	case ConditionCrossesAbove, ConditionCrossesBelow:
+		if r.Threshold <= 0 {
+			return errors.New("Threshold must be a positive price")
+		}
+		if r.WindowSeconds != 0 {
+			return errors.New("Price cross alerts do not take a window")
+		}
+	case ConditionPctMove, ConditionVolumeSpike:
+		if r.Condition == ConditionPctMove && r.Threshold <= 0 {
+			return errors.New("Threshold must be a positive percentage")
+		}
+		if r.Condition == ConditionVolumeSpike && r.Threshold <= 1 {
+			return errors.New("Threshold must be a multiple of the average volume greater than 1")
+		}
+		if r.WindowSeconds <= 0 || window > maxWindow {
+			return errors.New("window_seconds must be positive and at most " + maxWindow.String())
+		}
+	default:
+		return errors.New("Condition must be crosses_above, crosses_below, pct_move or volume_spike")
+	}
+
+	if r.WebhookURL != "" {
+		u, err := url.Parse(r.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("webhook_url must be an http or https URL")
+		}
+		// Names are checked again when the webhook is called, against
+		// whatever they resolve to then
+		host := u.Hostname()
+		if ip := net.ParseIP(host); (ip != nil && !publicAddress(ip)) || strings.EqualFold(host, "localhost") {
+			return errors.New("webhook_url must point to a public address")
+		}
+	}
+	return nil
+}
+
+const schema = `CREATE TABLE IF NOT EXISTS price_alerts (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	symbol VARCHAR(32) NOT NULL,
+	` + "`condition`" + ` VARCHAR(24) NOT NULL,
+	threshold DECIMAL(24, 8) NOT NULL,
+	window_seconds BIGINT NOT NULL DEFAULT 0,
+	webhook_url VARCHAR(2048) NOT NULL DEFAULT '',
+	status VARCHAR(16) NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	triggered_at DATETIME(6) NULL,
+	INDEX idx_price_alerts_user (user_id, created_at),
+	INDEX idx_price_alerts_status (status)
+)`
+
+// condition is a reserved word in MySQL
+const selectAlert = "SELECT id, user_id, symbol, `condition`, threshold, window_seconds, webhook_url, status, created_at, triggered_at FROM price_alerts"
+
+func EnsureSchema(db *sql.DB) error {
+	// Create the price_alerts table if it is not there yet
+	_, err := db.Exec(schema)
+	return err
+}
+
+// Create stores a validated request as an active alert of the user
+func Create(db *sql.DB, userID int64, r *CreateRequest) (*Alert, error) {
+	if limit := conf.AppConfig().Alerts.MaxAlertsPerUser; limit > 0 {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM price_alerts WHERE user_id = ? AND status = ?", userID, StatusActive).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count >= limit {
+			return nil, ErrTooManyAlerts
+		}
+	}
+
+	a := &Alert{
+		UserID:        userID,
+		Symbol:        r.Symbol,
+		Condition:     r.Condition,
+		Threshold:     r.Threshold,
+		WindowSeconds: r.WindowSeconds,
+		WebhookURL:    r.WebhookURL,
+		Status:        StatusActive,
+		CreatedAt:     time.Now().UTC(),
+	}
+	res, err := db.Exec(
+		"INSERT INTO price_alerts (user_id, symbol, `condition`, threshold, window_seconds, webhook_url, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		a.UserID, a.Symbol, a.Condition, a.Threshold, a.WindowSeconds, a.WebhookURL, a.Status, a.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if a.ID, err = res.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// ListForUser returns the user's alerts, newest first. An empty status
+// returns all of them.
+func ListForUser(db *sql.DB, userID int64, status string) ([]Alert, error) {
+	query, args := selectAlert+" WHERE user_id = ?", []interface{}{userID}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	return list(db, query+" ORDER BY created_at DESC, id DESC", args...)
+}
+
+// Get returns an alert of the user
+func Get(db *sql.DB, userID, id int64) (*Alert, error) {
+	a, err := scanAlert(db.QueryRow(selectAlert+" WHERE id = ? AND user_id = ?", id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return a, err
+}
+
+// Delete removes an alert of the user, active or not
+func Delete(db *sql.DB, userID, id int64) error {
+	res, err := db.Exec("DELETE FROM price_alerts WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func listActive(db *sql.DB) ([]Alert, error) {
+	return list(db, selectAlert+" WHERE status = ?", StatusActive)
+}
+
+// markTriggered flips an active alert to triggered. It returns false when
+// the alert was deleted or another instance fired it first.
+func markTriggered(db *sql.DB, id int64, at time.Time) (bool, error) {
+	res, err := db.Exec("UPDATE price_alerts SET status = ?, triggered_at = ? WHERE id = ? AND status = ?", StatusTriggered, at, id, StatusActive)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func list(db *sql.DB, query string, args ...interface{}) ([]Alert, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, *a)
+	}
+	return alerts, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAlert(row scanner) (*Alert, error) {
+	a := &Alert{}
+	var triggeredAt sql.NullTime
+	err := row.Scan(&a.ID, &a.UserID, &a.Symbol, &a.Condition, &a.Threshold, &a.WindowSeconds, &a.WebhookURL, &a.Status, &a.CreatedAt, &triggeredAt)
+	if err != nil {
+		return nil, err
+	}
+	if triggeredAt.Valid {
+		a.TriggeredAt = &triggeredAt.Time
+	}
+	return a, nil
+}
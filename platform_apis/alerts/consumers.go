@@ -0,0 +1,56 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/rohanchavan1918/kse-common/consumer"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/platform_apis/orders"
+	"github.com/segmentio/kafka-go"
+)
+
+// ConsumeTicks feeds the prices published by the stock ingestor to the
+// engine until ctx is done. Ticks are keyed by symbol with the price as the
+// value.
+func ConsumeTicks(ctx context.Context, e *Engine, reader *kafka.Reader) {
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		symbol := strings.ToUpper(strings.TrimSpace(string(msg.Key)))
+		price, err := strconv.ParseFloat(strings.TrimSpace(string(msg.Value)), 64)
+		if err != nil {
+			logging.ForMessage(ctx, msg).WithError(err).Error("Skipping tick with a price that is not a number")
+			return nil
+		}
+		if symbol == "" || price <= 0 {
+			logging.ForMessage(ctx, msg).WithField("price", price).Error("Skipping tick without symbol or price")
+			return nil
+		}
+		e.OnTick(symbol, price, msg.Time)
+		return nil
+	})
+}
+
+// ConsumeTrades feeds traded volume to the engine until ctx is done
+func ConsumeTrades(ctx context.Context, e *Engine, reader *kafka.Reader) {
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		logger := logging.ForMessage(ctx, msg)
+
+		var trade orders.Trade
+		if err := json.Unmarshal(msg.Value, &trade); err != nil {
+			logger.WithError(err).Error("Skipping malformed trade")
+			return nil
+		}
+		if trade.Symbol == "" {
+			logger.WithField("trade_id", trade.TradeID).Error("Skipping trade without symbol")
+			return nil
+		}
+		at := trade.ExecutedAt
+		if at.IsZero() {
+			at = msg.Time
+		}
+		e.OnTrade(strings.ToUpper(trade.Symbol), trade.Quantity, at)
+		return nil
+	})
+}
@@ -0,0 +1,309 @@
+package alerts
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/conf"
+)
+
+// Fired describes why an alert went off, it is what notifiers deliver
+type Fired struct {
+	AlertID       int64   `json:"alert_id"`
+	Symbol        string  `json:"symbol"`
+	Condition     string  `json:"condition"`
+	Threshold     float64 `json:"threshold"`
+	WindowSeconds int64   `json:"window_seconds,omitempty"`
+	// Value is the price for crosses, the percentage change for moves and
+	// the window's volume for spikes. Reference is what it was compared
+	// with: the previous price, the price at the start of the window or the
+	// average volume per window.
+	Value       float64   `json:"value"`
+	Reference   float64   `json:"reference"`
+	Price       float64   `json:"price"`
+	Message     string    `json:"message"`
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+type point struct {
+	at    time.Time
+	value float64
+}
+
+// symbolState is the recent history of one symbol, only as much of it as
+// the symbol's alerts look at
+type symbolState struct {
+	lastPrice  float64
+	hasPrice   bool
+	prices     []point
+	volumes    []point
+	volumeKeep time.Duration
+	// Volume history is complete from here on
+	firstVolume time.Time
+}
+
+// Engine evaluates every active alert against the ticks and trades it is fed
+type Engine struct {
+	db        *sql.DB
+	notifiers []Notifier
+
+	mu       sync.Mutex
+	bySymbol map[string]map[int64]Alert
+	states   map[string]*symbolState
+}
+
+var DefaultEngine *Engine
+
+func NewEngine(db *sql.DB, notifiers ...Notifier) *Engine {
+	return &Engine{
+		db:        db,
+		notifiers: notifiers,
+		bySymbol:  map[string]map[int64]Alert{},
+		states:    map[string]*symbolState{},
+	}
+}
+
+func baselineWindows() int {
+	if n := conf.AppConfig().Alerts.BaselineWindows; n > 0 {
+		return n
+	}
+	return 12
+}
+
+// Track starts evaluating an alert created on this instance right away,
+// instead of waiting for the next reload
+func (e *Engine) Track(a Alert) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.bySymbol[a.Symbol] == nil {
+		e.bySymbol[a.Symbol] = map[int64]Alert{}
+	}
+	e.bySymbol[a.Symbol][a.ID] = a
+}
+
+// Forget stops evaluating an alert
+func (e *Engine) Forget(symbol string, id int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.bySymbol[symbol], id)
+}
+
+// Reload replaces the tracked alerts with the active ones in the database,
+// which picks up alerts created or deleted on other instances
+func (e *Engine) Reload() error {
+	active, err := listActive(e.db)
+	if err != nil {
+		return err
+	}
+	bySymbol := map[string]map[int64]Alert{}
+	for _, a := range active {
+		if bySymbol[a.Symbol] == nil {
+			bySymbol[a.Symbol] = map[int64]Alert{}
+		}
+		bySymbol[a.Symbol][a.ID] = a
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.bySymbol = bySymbol
+	return nil
+}
+
+// Run reloads the alerts every interval, it never returns
+func (e *Engine) Run(interval time.Duration) {
+	for {
+		if err := e.Reload(); err != nil {
+			utils.LogError("Failed to reload price alerts : %s", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (e *Engine) state(symbol string) *symbolState {
+	s := e.states[symbol]
+	if s == nil {
+		s = &symbolState{}
+		e.states[symbol] = s
+	}
+	return s
+}
+
+// OnTick evaluates the price alerts of symbol against a new price
+func (e *Engine) OnTick(symbol string, price float64, at time.Time) {
+	e.mu.Lock()
+	s := e.state(symbol)
+	previous, hadPrice := s.lastPrice, s.hasPrice
+	s.lastPrice, s.hasPrice = price, true
+
+	// Keep the longest window any move alert of the symbol looks at
+	var keep time.Duration
+	for _, a := range e.bySymbol[symbol] {
+		if a.Condition == ConditionPctMove && a.window() > keep {
+			keep = a.window()
+		}
+	}
+	s.prices = append(s.prices, point{at, price})
+	s.prices = trim(s.prices, at.Add(-keep))
+
+	fired := []firing{}
+	for _, a := range e.bySymbol[symbol] {
+		f := Fired{Value: price, Price: price}
+		switch a.Condition {
+		case ConditionCrossesAbove:
+			if !hadPrice || previous >= a.Threshold || price < a.Threshold {
+				continue
+			}
+			f.Reference = previous
+			f.Message = fmt.Sprintf("%s crossed above %g, now at %g", symbol, a.Threshold, price)
+		case ConditionCrossesBelow:
+			if !hadPrice || previous <= a.Threshold || price > a.Threshold {
+				continue
+			}
+			f.Reference = previous
+			f.Message = fmt.Sprintf("%s crossed below %g, now at %g", symbol, a.Threshold, price)
+		case ConditionPctMove:
+			start := first(s.prices, at.Add(-a.window()))
+			if start <= 0 {
+				continue
+			}
+			change := (price - start) / start * 100
+			if math.Abs(change) < a.Threshold {
+				continue
+			}
+			f.Value, f.Reference = change, start
+			f.Message = fmt.Sprintf("%s moved %+.2f%% within %s, now at %g", symbol, change, a.window(), price)
+		default:
+			continue
+		}
+		fired = append(fired, e.take(a, f, at))
+	}
+	e.mu.Unlock()
+
+	e.fire(fired)
+}
+
+// OnTrade evaluates the volume alerts of symbol after a trade
+func (e *Engine) OnTrade(symbol string, quantity float64, at time.Time) {
+	e.mu.Lock()
+	s := e.state(symbol)
+	n := time.Duration(baselineWindows())
+	var keep time.Duration
+	for _, a := range e.bySymbol[symbol] {
+		if a.Condition == ConditionVolumeSpike && a.window()*(n+1) > keep {
+			keep = a.window() * (n + 1)
+		}
+	}
+	// Trades older than the previous keep were already dropped, so the
+	// history starts over when a longer alert shows up
+	if s.firstVolume.IsZero() || keep > s.volumeKeep {
+		s.firstVolume = at
+	}
+	s.volumeKeep = keep
+	s.volumes = append(s.volumes, point{at, quantity})
+	s.volumes = trim(s.volumes, at.Add(-keep))
+
+	fired := []firing{}
+	for _, a := range e.bySymbol[symbol] {
+		if a.Condition != ConditionVolumeSpike {
+			continue
+		}
+		window := a.window()
+		// Until n windows were observed the baseline covers what there is,
+		// but at least one whole window
+		covered := at.Sub(s.firstVolume) - window
+		if covered > window*n {
+			covered = window * n
+		}
+		if covered < window {
+			continue
+		}
+
+		current := sum(s.volumes, at.Add(-window), at)
+		baseline := sum(s.volumes, at.Add(-window-covered), at.Add(-window)) / (float64(covered) / float64(window))
+		if baseline <= 0 || current < a.Threshold*baseline {
+			continue
+		}
+		f := Fired{Value: current, Reference: baseline, Price: s.lastPrice}
+		f.Message = fmt.Sprintf("%s traded %g within %s, %.1fx its average volume", symbol, current, window, current/baseline)
+		fired = append(fired, e.take(a, f, at))
+	}
+	e.mu.Unlock()
+
+	e.fire(fired)
+}
+
+type firing struct {
+	alert Alert
+	fired Fired
+}
+
+// take stops tracking an alert that fired, so a burst of ticks cannot fire it
+// again while it is being marked. The caller holds the lock.
+func (e *Engine) take(a Alert, f Fired, at time.Time) firing {
+	delete(e.bySymbol[a.Symbol], a.ID)
+	f.AlertID, f.Symbol, f.Condition, f.Threshold, f.WindowSeconds = a.ID, a.Symbol, a.Condition, a.Threshold, a.WindowSeconds
+	f.TriggeredAt = at.UTC()
+	return firing{a, f}
+}
+
+func (e *Engine) fire(fired []firing) {
+	for _, f := range fired {
+		won, err := markTriggered(e.db, f.alert.ID, f.fired.TriggeredAt)
+		if err != nil {
+			// The alert is still active in the database, the next reload
+			// tracks it again
+			utils.LogError("Failed to mark alert %d as triggered : %s", f.alert.ID, err)
+			continue
+		}
+		if !won {
+			continue
+		}
+		utils.LogInfo("Alert %d of user %d fired : %s", f.alert.ID, f.alert.UserID, f.fired.Message)
+
+		// Slow webhooks must not hold up the tick stream
+		for _, n := range e.notifiers {
+			go func(n Notifier, f firing) {
+				if err := n.Notify(f.alert, f.fired); err != nil {
+					utils.LogError("Failed to deliver alert %d : %s", f.alert.ID, err)
+				}
+			}(n, f)
+		}
+	}
+}
+
+// trim drops the points before cutoff, points arrive in time order
+func trim(points []point, cutoff time.Time) []point {
+	i := 0
+	for i < len(points)-1 && points[i].at.Before(cutoff) {
+		i++
+	}
+	if i == 0 {
+		return points
+	}
+	return append(points[:0], points[i:]...)
+}
+
+// first returns the value of the oldest point at or after from
+func first(points []point, from time.Time) float64 {
+	for _, p := range points {
+		if !p.at.Before(from) {
+			return p.value
+		}
+	}
+	return 0
+}
+
+// sum adds up the values of the points in (from, to]
+func sum(points []point, from, to time.Time) float64 {
+	total := 0.0
+	for _, p := range points {
+		if p.at.After(from) && !p.at.After(to) {
+			total += p.value
+		}
+	}
+	return total
+}
@@ -0,0 +1,137 @@
+package alerts
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rohanchavan1918/platform_apis/userevents"
+)
+
+// Notifier delivers fired alerts to their owner
+type Notifier interface {
+	Notify(a Alert, f Fired) error
+}
+
+// StreamNotifier appends fired alerts to the user's event stream, which
+// pushes them over the user's WebSocket connections
+type StreamNotifier struct {
+	DB *sql.DB
+}
+
+func (n *StreamNotifier) Notify(a Alert, f Fired) error {
+	// Alerts fire once, so the alert id is enough to make the event unique
+	_, err := userevents.Append(n.DB, a.UserID, userevents.TypeAlert, fmt.Sprintf("alert:%d", a.ID), f)
+	return err
+}
+
+// WebhookNotifier posts fired alerts as JSON to the alert's webhook URL.
+// When Secret is set the body is signed, receivers check
+// X-KSE-SIGNATURE = hex(HMAC-SHA256(secret, timestamp + "." + body)).
+type WebhookNotifier struct {
+	Client   *http.Client
+	Secret   string
+	Attempts int
+}
+
+// NewWebhookNotifier returns a notifier whose client only connects to
+// public addresses and does not follow redirects, so users cannot point
+// webhooks at the exchange's own network
+func NewWebhookNotifier(secret string, timeout time.Duration) *WebhookNotifier {
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: timeout, Control: dialPublic}
+	client := &http.Client{
+		Timeout: timeout,
+		// No proxy from the environment, it would be dialed instead of the
+		// webhook's address
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// A redirect could point anywhere, the response is returned as is
+		// and fails as a non 2xx status
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &WebhookNotifier{Client: client, Secret: secret, Attempts: 3}
+}
+
+// dialPublic refuses connections to addresses that are not public. It runs
+// for the address a name resolved to, right before connecting, so a name
+// that changes what it resolves to after validation cannot get around it.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
+
+// publicAddress reports whether ip is reachable from the internet, rather
+// than loopback, private, link-local, multicast or unspecified
+func publicAddress(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast())
+}
+
+func (n *WebhookNotifier) Notify(a Alert, f Fired) error {
+	if a.WebhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = n.post(a.WebhookURL, body)
+		if err == nil || attempt >= n.Attempts {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+func (n *WebhookNotifier) post(url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-KSE-EVENT", "alert.fired")
+	req.Header.Set("X-KSE-TIMESTAMP", timestamp)
+	if n.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.Secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		req.Header.Set("X-KSE-SIGNATURE", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
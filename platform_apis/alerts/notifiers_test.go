@@ -0,0 +1,93 @@
+package alerts
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":         true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"fd00::1":         false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"0.0.0.0":         false,
+		"::":              false,
+		"224.0.0.1":       false,
+		"::ffff:10.0.0.1": false,
+	}
+	for address, public := range tests {
+		if got := publicAddress(net.ParseIP(address)); got != public {
+			t.Errorf("publicAddress(%s) = %v, want %v", address, got, public)
+		}
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://hooks.example.com/alerts": true,
+		"http://93.184.216.34/hook":        true,
+		"ftp://example.com/hook":           false,
+		"http://127.0.0.1:8080/hook":       false,
+		"http://localhost/hook":            false,
+		"http://[::1]/hook":                false,
+		"http://169.254.169.254/latest":    false,
+		"http://10.0.0.5/internal":         false,
+	}
+	for webhook, valid := range tests {
+		r := CreateRequest{Symbol: "AAPL", Condition: ConditionCrossesAbove, Threshold: 100, WebhookURL: webhook}
+		if err := r.Validate(); (err == nil) != valid {
+			t.Errorf("webhook %s: got error %v, want valid %v", webhook, err, valid)
+		}
+	}
+}
+
+func TestWebhookRefusesPrivateAddresses(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	// Names resolving to a private address are refused when dialing, like
+	// the address itself
+	n := NewWebhookNotifier("", time.Second)
+	for _, url := range []string{server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)} {
+		err := n.post(url, []byte("{}"))
+		if err == nil || !strings.Contains(err.Error(), "is not public") {
+			t.Errorf("post to %s: got error %v, want the address refused", url, err)
+		}
+	}
+	if called {
+		t.Error("webhook on a loopback address was called")
+	}
+}
+
+func TestWebhookDoesNotFollowRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("redirect was followed")
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer server.Close()
+
+	// The test servers are on loopback, so only the redirect policy of the
+	// notifier's client is used here
+	n := NewWebhookNotifier("", time.Second)
+	n.Client.Transport = nil
+	if err := n.post(server.URL, []byte("{}")); err == nil || !strings.Contains(err.Error(), "302") {
+		t.Errorf("got error %v, want the redirect reported as a failed call", err)
+	}
+}
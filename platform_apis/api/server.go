@@ -2,21 +2,210 @@ package api
 
 import (
 	"fmt"
-	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/database"
+	"github.com/rohanchavan1918/kse-common/health"
+	"github.com/rohanchavan1918/kse-common/kafkaadmin"
+	"github.com/rohanchavan1918/kse-common/ledger"
+	"github.com/rohanchavan1918/kse-common/lifecycle"
+	"github.com/rohanchavan1918/kse-common/metrics"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/activity"
+	"github.com/rohanchavan1918/platform_apis/alerts"
+	"github.com/rohanchavan1918/platform_apis/apikeys"
+	"github.com/rohanchavan1918/platform_apis/auth"
 	"github.com/rohanchavan1918/platform_apis/conf"
-	"github.com/rohanchavan1918/platform_apis/utils"
+	"github.com/rohanchavan1918/platform_apis/gateway"
+	"github.com/rohanchavan1918/platform_apis/orders"
+	"github.com/rohanchavan1918/platform_apis/portfolio"
+	"github.com/rohanchavan1918/platform_apis/transfers"
+	"github.com/rohanchavan1918/platform_apis/userevents"
+	"github.com/rohanchavan1918/platform_apis/users"
+	"github.com/rohanchavan1918/platform_apis/watchlists"
 )
 
 func RunServer(config *conf.Config) {
-	r := gin.Default()
+	// Requests are logged by the logging middleware, as JSON
+	r := gin.New()
+	// Client IPs come from X-Forwarded-For only behind the configured proxies
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	r.Use(gin.Recovery())
 	SetupRoutes(r)
-	dbConn := conf.GetDBConnection(&config.DB)
-	err := dbConn.Ping()
+	dbConn, err := database.Open(&config.DB)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer dbConn.Close()
+	err = dbConn.Ping()
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+
+	// Once DB Connection is validated, add it to the global connections
+	conf.AppConnections.DB = dbConn
+	metrics.TrackDB(dbConn, config.ServiceName)
+	health.Ready("db", health.DB(dbConn))
+	kafkaConfig, topicNames := config.KafkaSettings()
+	topics := config.KafkaConfig.Topics
+	// Create or fix the topics first when provision.ensure_on_startup is set
+	if err := kafkaadmin.EnsureOnStartup(kafkaConfig, topicNames); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	health.Ready("kafka", health.Kafka(kafkaConfig))
+	health.Ready("kafka_topics", health.KafkaTopics(kafkaConfig, topicNames...))
+
+	if err := users.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	if err := auth.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	if err := apikeys.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	if err := orders.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	if err := userevents.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	if err := watchlists.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	if err := alerts.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	if err := portfolio.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	if err := ledger.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	if err := transfers.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	health.Go("apikeys.prune_nonces", func() { apikeys.PruneNonces(dbConn, time.Minute) })
+
+	// User activity goes to user_analytics, settled transfers and fills
+	// included
+	activityWriter, err := config.KafkaConfig.GetProducer(config.KafkaConfig.Topics.Activity)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer activityWriter.Close()
+	activity.DefaultPublisher = activity.NewPublisher(activityWriter, 10000)
+	health.Go("activity.publisher", func() { activity.DefaultPublisher.Run() })
+
+	// Deposits and withdrawals go through the configured payment provider,
+	// the reconciler settles them once the provider reports back
+	switch config.Payments.Provider {
+	case "fake", "":
+		fake := config.Payments.Fake
+		transfers.DefaultProvider = &transfers.FakeProvider{
+			MinDelay:    fake.MinDelay,
+			MaxDelay:    fake.MaxDelay,
+			FailureRate: fake.FailureRate,
+			MaxAmount:   fake.MaxAmount,
+		}
+	default:
+		utils.AlertAndPanic(fmt.Errorf("Unknown payment provider %q", config.Payments.Provider))
+	}
+	reconcileInterval := config.Payments.ReconcileInterval
+	if reconcileInterval == 0 {
+		reconcileInterval = 5 * time.Second
+	}
+	health.Go("transfers.reconcile", func() { transfers.Reconcile(dbConn, transfers.DefaultProvider, reconcileInterval) })
+
+	// Orders are submitted to the order processor through Kafka
+	writer, err := config.KafkaConfig.GetProducer(config.KafkaConfig.Topics.OrderCommands)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	conf.AppConnections.KafkaWriter = writer
+	defer writer.Close()
+
+	// and their progress comes back as execution reports
+	reportReader, err := config.KafkaConfig.GetConsumer(config.KafkaConfig.Topics.ExecutionReports, config.KafkaConfig.GroupID)
 	if err != nil {
 		utils.AlertAndPanic(err)
 	}
-	port := fmt.Sprintf(":%s", strconv.Itoa(int(conf.AppConfig.Port)))
-	r.Run(port)
+	defer reportReader.Close()
+	health.WatchConsumer(kafkaConfig, config.KafkaConfig.GroupID, topics.ExecutionReports)
+	health.Go("orders.execution_reports", func() { orders.ConsumeExecutionReports(lifecycle.Context(), dbConn, reportReader) })
+
+	tradeReader, err := config.KafkaConfig.GetConsumer(config.KafkaConfig.Topics.Trades, config.KafkaConfig.GroupID)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer tradeReader.Close()
+	health.WatchConsumer(kafkaConfig, config.KafkaConfig.GroupID, topics.Trades)
+	health.Go("orders.trades", func() { orders.ConsumeTrades(lifecycle.Context(), dbConn, tradeReader) })
+
+	// Positions have their own consumer group so they see every trade too
+	positionReader, err := config.KafkaConfig.GetConsumer(config.KafkaConfig.Topics.Trades, config.KafkaConfig.GroupID+"-portfolio")
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer positionReader.Close()
+	health.WatchConsumer(kafkaConfig, config.KafkaConfig.GroupID+"-portfolio", topics.Trades)
+	health.Go("portfolio.trades", func() { portfolio.ConsumeTrades(lifecycle.Context(), dbConn, positionReader) })
+
+	snapshotInterval := config.Portfolio.SnapshotInterval
+	if snapshotInterval == 0 {
+		snapshotInterval = 15 * time.Minute
+	}
+	health.Go("portfolio.snapshots", func() { portfolio.RunSnapshots(dbConn, snapshotInterval) })
+
+	// Price alerts are evaluated against the ingested ticks and the traded
+	// volume. Their own consumer group gets every trade, independent of the
+	// fill events above.
+	alerts.DefaultEngine = alerts.NewEngine(
+		dbConn,
+		&alerts.StreamNotifier{DB: dbConn},
+		alerts.NewWebhookNotifier(config.Alerts.WebhookSecret, config.Alerts.WebhookTimeout),
+	)
+	reloadInterval := config.Alerts.ReloadInterval
+	if reloadInterval == 0 {
+		reloadInterval = 30 * time.Second
+	}
+	health.Go("alerts.engine", func() { alerts.DefaultEngine.Run(reloadInterval) })
+
+	alertGroupID := config.KafkaConfig.GroupID + "-alerts"
+	tickReader, err := config.KafkaConfig.GetConsumer(config.KafkaConfig.Topics.Ticks, alertGroupID)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer tickReader.Close()
+	health.WatchConsumer(kafkaConfig, alertGroupID, topics.Ticks)
+	health.Go("alerts.ticks", func() { alerts.ConsumeTicks(lifecycle.Context(), alerts.DefaultEngine, tickReader) })
+
+	volumeReader, err := config.KafkaConfig.GetConsumer(config.KafkaConfig.Topics.Trades, alertGroupID)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer volumeReader.Close()
+	health.WatchConsumer(kafkaConfig, alertGroupID, topics.Trades)
+	health.Go("alerts.trades", func() { alerts.ConsumeTrades(lifecycle.Context(), alerts.DefaultEngine, volumeReader) })
+
+	// Reports, trades and fired alerts end up in the per user event stream, every instance
+	// tails it to push events to the sockets connected to it
+	pollInterval := config.WebSocket.PollInterval
+	if pollInterval == 0 {
+		pollInterval = 250 * time.Millisecond
+	}
+	health.Go("userevents.tail", func() { userevents.Tail(dbConn, pollInterval, gateway.DefaultHub.Notify) })
+	if retention := config.WebSocket.EventRetention; retention > 0 {
+		health.Go("userevents.prune", func() { userevents.Prune(dbConn, retention, time.Hour) })
+	}
+
+	// Apply live settings from the config file without a restart
+	lifecycle.WatchConfig(&conf.Running, nil)
+
+	if err := lifecycle.Serve(r, config.Port); err != nil {
+		utils.LogError("Server stopped : %s", err)
+	}
 }
@@ -0,0 +1,76 @@
+package v1
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/platform_apis/activity"
+	"github.com/rohanchavan1918/platform_apis/auth"
+)
+
+const (
+	maxTrackedEvents = 50
+	// Client clocks are not trusted beyond this, events outside of it are
+	// stamped with the server time
+	maxClockSkew = 24 * time.Hour
+)
+
+type trackedEvent struct {
+	Type       string                 `json:"type" binding:"required"`
+	OccurredAt *time.Time             `json:"occurred_at"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type trackRequest struct {
+	Events []trackedEvent `json:"events" binding:"required"`
+}
+
+func TrackEvents(c *gin.Context) {
+	// Collects page views from the web and mobile clients
+	var req trackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if len(req.Events) == 0 || len(req.Events) > maxTrackedEvents {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "events must hold between 1 and 50 events",
+		})
+		return
+	}
+	for _, e := range req.Events {
+		if e.Type != activity.TypePageView {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Only page_view events can be tracked",
+			})
+			return
+		}
+		if page, _ := e.Properties["page"].(string); strings.TrimSpace(page) == "" || len(page) > 2048 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "page_view events need a page property of at most 2048 characters",
+			})
+			return
+		}
+	}
+
+	userID := auth.CurrentUser(c).ID
+	now := time.Now().UTC()
+	for _, e := range req.Events {
+		event := activity.New(c, userID, e.Type, e.Properties)
+		event.Source = activity.SourceClient
+		if e.OccurredAt != nil && e.OccurredAt.After(now.Add(-maxClockSkew)) && e.OccurredAt.Before(now.Add(maxClockSkew)) {
+			event.OccurredAt = e.OccurredAt.UTC()
+		}
+		if activity.DefaultPublisher != nil {
+			activity.DefaultPublisher.Publish(event)
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"accepted": len(req.Events),
+	})
+}
@@ -0,0 +1,109 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/alerts"
+	"github.com/rohanchavan1918/platform_apis/auth"
+	"github.com/rohanchavan1918/platform_apis/conf"
+)
+
+func alertError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, alerts.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, alerts.ErrTooManyAlerts):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		utils.LogError("Failed to %s : %s", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + "."})
+	}
+}
+
+func CreateAlert(c *gin.Context) {
+	var req alerts.CreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	alert, err := alerts.Create(conf.AppConnections.DB, auth.CurrentUser(c).ID, &req)
+	if err != nil {
+		alertError(c, err, "create alert")
+		return
+	}
+	alerts.DefaultEngine.Track(*alert)
+
+	c.JSON(http.StatusCreated, alert)
+}
+
+func ListAlerts(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != alerts.StatusActive && status != alerts.StatusTriggered {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "status must be active or triggered",
+		})
+		return
+	}
+
+	list, err := alerts.ListForUser(conf.AppConnections.DB, auth.CurrentUser(c).ID, status)
+	if err != nil {
+		alertError(c, err, "list alerts")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"alerts": list,
+	})
+}
+
+func GetAlert(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		alertError(c, alerts.ErrNotFound, "load alert")
+		return
+	}
+	alert, err := alerts.Get(conf.AppConnections.DB, auth.CurrentUser(c).ID, id)
+	if err != nil {
+		alertError(c, err, "load alert")
+		return
+	}
+
+	c.JSON(http.StatusOK, alert)
+}
+
+func DeleteAlert(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		alertError(c, alerts.ErrNotFound, "delete alert")
+		return
+	}
+	userID := auth.CurrentUser(c).ID
+	alert, err := alerts.Get(conf.AppConnections.DB, userID, id)
+	if err == nil {
+		err = alerts.Delete(conf.AppConnections.DB, userID, id)
+	}
+	if err != nil {
+		alertError(c, err, "delete alert")
+		return
+	}
+	alerts.DefaultEngine.Forget(alert.Symbol, alert.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Alert deleted.",
+	})
+}
@@ -0,0 +1,102 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/apikeys"
+	"github.com/rohanchavan1918/platform_apis/auth"
+	"github.com/rohanchavan1918/platform_apis/conf"
+)
+
+type createAPIKeyRequest struct {
+	Label       string   `json:"label"`
+	Scopes      []string `json:"scopes" binding:"required"`
+	IPAllowlist []string `json:"ip_allowlist"`
+}
+
+func CreateAPIKey(c *gin.Context) {
+	var req createAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	key, secret, err := apikeys.Create(conf.AppConnections.DB, auth.CurrentUser(c).ID, req.Label, req.Scopes, req.IPAllowlist)
+	if errors.Is(err, apikeys.ErrInvalidScope) || errors.Is(err, apikeys.ErrInvalidIP) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, apikeys.ErrTooManyKeys) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		utils.LogError("Failed to create API key : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create API key.",
+		})
+		return
+	}
+
+	// The secret is not stored in a readable form, this is the only time it
+	// is returned
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": key,
+		"secret":  secret,
+	})
+}
+
+func ListAPIKeys(c *gin.Context) {
+	keys, err := apikeys.ListForUser(conf.AppConnections.DB, auth.CurrentUser(c).ID)
+	if err != nil {
+		utils.LogError("Failed to list API keys : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to list API keys.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": keys,
+	})
+}
+
+func RevokeAPIKey(c *gin.Context) {
+	err := apikeys.Revoke(conf.AppConnections.DB, auth.CurrentUser(c).ID, c.Param("id"))
+	if errors.Is(err, apikeys.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		utils.LogError("Failed to revoke API key : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to revoke API key.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key revoked.",
+	})
+}
+
+func VerifyAPIKey(c *gin.Context) {
+	// Lets bots check their signing code before they start trading
+	key := apikeys.CurrentKey(c)
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": auth.CurrentUser(c).ID,
+		"key_id":  key.ID,
+		"scopes":  key.Scopes,
+	})
+}
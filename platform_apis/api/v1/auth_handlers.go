@@ -0,0 +1,172 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/activity"
+	"github.com/rohanchavan1918/platform_apis/auth"
+	"github.com/rohanchavan1918/platform_apis/conf"
+	"github.com/rohanchavan1918/platform_apis/users"
+)
+
+type signupRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Name     string `json:"name"`
+	Password string `json:"password" binding:"required"`
+}
+
+type loginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Compared against when the email is unknown so that login takes the same
+// time whether or not the account exists
+const dummyPasswordHash = "$2a$12$vFc68MxJL28gAA.Wkk.0/uEXRYfDUhsdTwCZnZBVcD/OQPCuT6oVS"
+
+func Signup(c *gin.Context) {
+	var req signupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := auth.ValidatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		utils.LogError("Failed to hash password : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create user.",
+		})
+		return
+	}
+
+	user, err := users.Create(conf.AppConnections.DB, req.Email, req.Name, hash)
+	if errors.Is(err, users.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		utils.LogError("Failed to create user : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create user.",
+		})
+		return
+	}
+	activity.Track(c, user.ID, activity.TypeSignup, nil)
+
+	c.JSON(http.StatusCreated, user)
+}
+
+func Login(c *gin.Context) {
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	user, err := users.GetByEmail(conf.AppConnections.DB, req.Email)
+	if err != nil && !errors.Is(err, users.ErrNotFound) {
+		utils.LogError("Failed to look up user : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to login.",
+		})
+		return
+	}
+
+	hash := dummyPasswordHash
+	if user != nil {
+		hash = user.PasswordHash
+	}
+	if !auth.CheckPassword(hash, req.Password) || user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid email or password",
+		})
+		return
+	}
+
+	tokens, err := auth.StartSession(conf.AppConnections.DB, user.ID)
+	if err != nil {
+		utils.LogError("Failed to start session : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to login.",
+		})
+		return
+	}
+	activity.Track(c, user.ID, activity.TypeLogin, nil)
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func RefreshToken(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tokens, err := auth.Refresh(conf.AppConnections.DB, req.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		utils.LogError("Failed to refresh token : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to refresh token.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func Logout(c *gin.Context) {
+	// Ends the current session, or every session of the user with ?all=true
+	var err error
+	all := c.Query("all") == "true"
+	if all {
+		err = auth.RevokeAllSessions(conf.AppConnections.DB, auth.CurrentUser(c).ID)
+	} else {
+		err = auth.RevokeSession(conf.AppConnections.DB, auth.CurrentSessionID(c))
+	}
+	if err != nil {
+		utils.LogError("Failed to revoke session : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to logout.",
+		})
+		return
+	}
+	activity.Track(c, auth.CurrentUser(c).ID, activity.TypeLogout, map[string]interface{}{"all_sessions": all})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Logged out.",
+	})
+}
+
+func Me(c *gin.Context) {
+	c.JSON(http.StatusOK, auth.CurrentUser(c))
+}
@@ -0,0 +1,166 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/activity"
+	"github.com/rohanchavan1918/platform_apis/auth"
+	"github.com/rohanchavan1918/platform_apis/conf"
+	"github.com/rohanchavan1918/platform_apis/orders"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+func orderError(c *gin.Context, err error, action string) {
+	var invalid *orders.InvalidRequestError
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, orders.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, orders.ErrNotOpen), errors.Is(err, orders.ErrClientOrderIDReused):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, orders.ErrPublishFailed):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		utils.LogError("Failed to %s : %s", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + "."})
+	}
+}
+
+func PlaceOrder(c *gin.Context) {
+	var req orders.NewOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	order, created, err := orders.Place(c.Request.Context(), conf.AppConnections.DB, conf.AppConnections.KafkaWriter, auth.CurrentUser(c).ID, req)
+	if err != nil {
+		orderError(c, err, "place order")
+		return
+	}
+
+	// A retried client order ID gets the original order back
+	status := http.StatusAccepted
+	if !created {
+		status = http.StatusOK
+	} else {
+		activity.Track(c, order.UserID, activity.TypeOrderPlaced, map[string]interface{}{
+			"order_id": order.ID, "symbol": order.Symbol, "side": order.Side, "type": order.Type,
+			"quantity": order.Quantity, "price": order.Price,
+		})
+	}
+	c.JSON(status, order)
+}
+
+func CancelOrder(c *gin.Context) {
+	order, err := orders.Cancel(c.Request.Context(), conf.AppConnections.DB, conf.AppConnections.KafkaWriter, auth.CurrentUser(c).ID, c.Param("id"))
+	if err != nil {
+		orderError(c, err, "cancel order")
+		return
+	}
+	activity.Track(c, order.UserID, activity.TypeOrderCancelRequested, map[string]interface{}{"order_id": order.ID, "symbol": order.Symbol})
+
+	c.JSON(http.StatusAccepted, order)
+}
+
+func ReplaceOrder(c *gin.Context) {
+	var req orders.ReplaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	order, err := orders.Replace(c.Request.Context(), conf.AppConnections.DB, conf.AppConnections.KafkaWriter, auth.CurrentUser(c).ID, c.Param("id"), req)
+	if err != nil {
+		orderError(c, err, "replace order")
+		return
+	}
+	activity.Track(c, order.UserID, activity.TypeOrderReplaceRequested, map[string]interface{}{"order_id": order.ID, "symbol": order.Symbol})
+
+	c.JSON(http.StatusAccepted, order)
+}
+
+func GetOrder(c *gin.Context) {
+	order, err := orders.Get(conf.AppConnections.DB, auth.CurrentUser(c).ID, c.Param("id"))
+	if err != nil {
+		orderError(c, err, "get order")
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func ListOrders(c *gin.Context) {
+	// Filters: symbol, side, status (comma separated), from and to (RFC3339),
+	// paginated with limit and offset
+	filter := orders.Filter{
+		Symbol: strings.ToUpper(c.Query("symbol")),
+		Side:   strings.ToLower(c.Query("side")),
+		Limit:  defaultPageSize,
+	}
+	if status := c.Query("status"); status != "" {
+		filter.Status = strings.Split(strings.ToLower(status), ",")
+	}
+
+	var err error
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC3339 timestamp"})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC3339 timestamp"})
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 1 || filter.Limit > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxPageSize)})
+			return
+		}
+	}
+	if offset := c.Query("offset"); offset != "" {
+		if filter.Offset, err = strconv.Atoi(offset); err != nil || filter.Offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative number"})
+			return
+		}
+	}
+
+	list, total, err := orders.List(conf.AppConnections.DB, auth.CurrentUser(c).ID, filter)
+	if err != nil {
+		orderError(c, err, "list orders")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders": list,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
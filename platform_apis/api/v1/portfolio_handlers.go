@@ -0,0 +1,73 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/auth"
+	"github.com/rohanchavan1918/platform_apis/conf"
+	"github.com/rohanchavan1918/platform_apis/portfolio"
+)
+
+const defaultHistoryDays = 90
+
+func GetPortfolio(c *gin.Context) {
+	valuation, err := portfolio.Value(conf.AppConnections.DB, auth.CurrentUser(c).ID, time.Now())
+	if err != nil {
+		utils.LogError("Failed to value portfolio : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to value portfolio.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, valuation)
+}
+
+func GetPortfolioHistory(c *gin.Context) {
+	// from and to are days, the curve defaults to the last 90 of them
+	to := time.Now().UTC()
+	if raw := c.Query("to"); raw != "" {
+		t, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date like 2006-01-02"})
+			return
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -defaultHistoryDays+1)
+	if raw := c.Query("from"); raw != "" {
+		t, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date like 2006-01-02"})
+			return
+		}
+		from = t
+	}
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from cannot be after to"})
+		return
+	}
+	if maxDays := conf.AppConfig().Portfolio.MaxHistoryDays; maxDays > 0 && to.Sub(from) > time.Duration(maxDays)*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "History is limited to " + strconv.Itoa(maxDays) + " days per request"})
+		return
+	}
+
+	snapshots, err := portfolio.History(conf.AppConnections.DB, auth.CurrentUser(c).ID, from, to)
+	if err != nil {
+		utils.LogError("Failed to load portfolio history : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load portfolio history.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":   from.Format("2006-01-02"),
+		"to":     to.Format("2006-01-02"),
+		"equity": snapshots,
+	})
+}
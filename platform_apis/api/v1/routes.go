@@ -2,9 +2,65 @@ package v1
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/platform_apis/apikeys"
+	"github.com/rohanchavan1918/platform_apis/auth"
 )
 
 func SetupRoutes(r *gin.RouterGroup) {
 	v1Group := r.Group("/v1")
 	v1Group.GET("/healthcheck", Healthcheck)
+	v1Group.GET("/ws", UserStream)
+
+	authGroup := v1Group.Group("/auth")
+	authGroup.POST("/signup", Signup)
+	authGroup.POST("/login", Login)
+	authGroup.POST("/refresh", RefreshToken)
+
+	// Everything registered on protected needs a valid access token
+	protected := v1Group.Group("")
+	protected.Use(auth.RequireAuth())
+	protected.POST("/auth/logout", Logout)
+	protected.GET("/me", Me)
+	protected.POST("/track", TrackEvents)
+	protected.POST("/api-keys", CreateAPIKey)
+	protected.GET("/api-keys", ListAPIKeys)
+	protected.DELETE("/api-keys/:id", RevokeAPIKey)
+
+	protected.POST("/watchlists", CreateWatchlist)
+	protected.GET("/watchlists", ListWatchlists)
+	protected.GET("/watchlists/:id", GetWatchlist)
+	protected.PATCH("/watchlists/:id", RenameWatchlist)
+	protected.DELETE("/watchlists/:id", DeleteWatchlist)
+	protected.POST("/watchlists/:id/symbols", AddWatchlistSymbol)
+	protected.DELETE("/watchlists/:id/symbols/:symbol", RemoveWatchlistSymbol)
+
+	protected.POST("/alerts", CreateAlert)
+	protected.GET("/alerts", ListAlerts)
+	protected.GET("/alerts/:id", GetAlert)
+	protected.DELETE("/alerts/:id", DeleteAlert)
+
+	// Signed with an API key instead of an access token
+	signed := v1Group.Group("")
+	signed.GET("/api-keys/verify", apikeys.RequireSignature(apikeys.ScopeRead), VerifyAPIKey)
+
+	// Orders take either an access token or a signed API key request
+	read := apikeys.RequireUserOrSignature(apikeys.ScopeRead)
+	trade := apikeys.RequireUserOrSignature(apikeys.ScopeTrade)
+	orderGroup := v1Group.Group("/orders")
+	orderGroup.POST("", trade, PlaceOrder)
+	orderGroup.DELETE("/:id", trade, CancelOrder)
+	orderGroup.PATCH("/:id", trade, ReplaceOrder)
+	orderGroup.GET("", read, ListOrders)
+	orderGroup.GET("/:id", read, GetOrder)
+
+	v1Group.GET("/portfolio", read, GetPortfolio)
+	v1Group.GET("/portfolio/history", read, GetPortfolioHistory)
+
+	// Moving money needs the withdraw scope in both directions
+	withdraw := apikeys.RequireUserOrSignature(apikeys.ScopeWithdraw)
+	v1Group.POST("/deposits", withdraw, CreateDeposit)
+	v1Group.POST("/withdrawals", withdraw, CreateWithdrawal)
+	v1Group.GET("/transfers", read, ListTransfers)
+	v1Group.GET("/transfers/:id", read, GetTransfer)
+	v1Group.GET("/balances", read, GetBalances)
 }
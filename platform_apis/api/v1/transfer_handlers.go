@@ -0,0 +1,133 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/auth"
+	"github.com/rohanchavan1918/platform_apis/conf"
+	"github.com/rohanchavan1918/platform_apis/transfers"
+)
+
+func transferError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, transfers.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, transfers.ErrClientTransferIDReused):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, transfers.ErrInsufficientFunds):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		utils.LogError("Failed to %s : %s", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + "."})
+	}
+}
+
+func createTransfer(c *gin.Context, transferType string) {
+	var req transfers.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	transfer, created, err := transfers.Create(conf.AppConnections.DB, transfers.DefaultProvider, auth.CurrentUser(c).ID, transferType, req)
+	if err != nil {
+		transferError(c, err, "create "+transferType)
+		return
+	}
+
+	// The provider confirms transfers asynchronously, a retried client
+	// transfer ID gets the original transfer back
+	status := http.StatusAccepted
+	if !created {
+		status = http.StatusOK
+	}
+	c.JSON(status, transfer)
+}
+
+func CreateDeposit(c *gin.Context) {
+	createTransfer(c, transfers.TypeDeposit)
+}
+
+func CreateWithdrawal(c *gin.Context) {
+	createTransfer(c, transfers.TypeWithdrawal)
+}
+
+func ListTransfers(c *gin.Context) {
+	transferType, status := c.Query("type"), c.Query("status")
+	if transferType != "" && transferType != transfers.TypeDeposit && transferType != transfers.TypeWithdrawal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be deposit or withdrawal"})
+		return
+	}
+
+	limit, offset := defaultPageSize, 0
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxPageSize)})
+			return
+		}
+		limit = n
+	}
+	if raw := c.Query("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative number"})
+			return
+		}
+		offset = n
+	}
+
+	list, err := transfers.List(conf.AppConnections.DB, auth.CurrentUser(c).ID, transferType, status, limit, offset)
+	if err != nil {
+		transferError(c, err, "list transfers")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transfers": list,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+func GetTransfer(c *gin.Context) {
+	transfer, err := transfers.Get(conf.AppConnections.DB, auth.CurrentUser(c).ID, c.Param("id"))
+	if err != nil {
+		transferError(c, err, "load transfer")
+		return
+	}
+	events, err := transfers.Events(conf.AppConnections.DB, transfer.ID)
+	if err != nil {
+		transferError(c, err, "load transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transfer": transfer,
+		"events":   events,
+	})
+}
+
+func GetBalances(c *gin.Context) {
+	balance, err := transfers.Balances(conf.AppConnections.DB, auth.CurrentUser(c).ID)
+	if err != nil {
+		transferError(c, err, "load balances")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"balances": []*transfers.Balance{balance},
+	})
+}
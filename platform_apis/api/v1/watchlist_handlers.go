@@ -0,0 +1,182 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/activity"
+	"github.com/rohanchavan1918/platform_apis/auth"
+	"github.com/rohanchavan1918/platform_apis/conf"
+	"github.com/rohanchavan1918/platform_apis/watchlists"
+)
+
+type watchlistRequest struct {
+	Name    string   `json:"name" binding:"required"`
+	Symbols []string `json:"symbols"`
+}
+
+type watchlistSymbolRequest struct {
+	Symbol string `json:"symbol" binding:"required"`
+}
+
+func watchlistError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, watchlists.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, watchlists.ErrNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, watchlists.ErrInvalidSymbol), errors.Is(err, watchlists.ErrTooManySymbols):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		utils.LogError("Failed to %s : %s", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + "."})
+	}
+}
+
+// watchlistID parses the :id path parameter, replying 404 when it is not one
+func watchlistID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": watchlists.ErrNotFound.Error()})
+		return 0, false
+	}
+	return id, true
+}
+
+func CreateWatchlist(c *gin.Context) {
+	var req watchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := watchlists.ValidateName(req.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	w, err := watchlists.Create(conf.AppConnections.DB, auth.CurrentUser(c).ID, req.Name, req.Symbols)
+	if err != nil {
+		watchlistError(c, err, "create watchlist")
+		return
+	}
+	activity.Track(c, w.UserID, activity.TypeWatchlistCreated, map[string]interface{}{"watchlist_id": w.ID, "symbols": len(w.Symbols)})
+
+	c.JSON(http.StatusCreated, w)
+}
+
+func ListWatchlists(c *gin.Context) {
+	lists, err := watchlists.ListForUser(conf.AppConnections.DB, auth.CurrentUser(c).ID)
+	if err != nil {
+		watchlistError(c, err, "list watchlists")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"watchlists": lists,
+	})
+}
+
+func GetWatchlist(c *gin.Context) {
+	id, ok := watchlistID(c)
+	if !ok {
+		return
+	}
+	w, err := watchlists.Get(conf.AppConnections.DB, auth.CurrentUser(c).ID, id)
+	if err != nil {
+		watchlistError(c, err, "load watchlist")
+		return
+	}
+
+	c.JSON(http.StatusOK, w)
+}
+
+func RenameWatchlist(c *gin.Context) {
+	id, ok := watchlistID(c)
+	if !ok {
+		return
+	}
+	var req watchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := watchlists.ValidateName(req.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	w, err := watchlists.Rename(conf.AppConnections.DB, auth.CurrentUser(c).ID, id, req.Name)
+	if err != nil {
+		watchlistError(c, err, "rename watchlist")
+		return
+	}
+	activity.Track(c, w.UserID, activity.TypeWatchlistRenamed, map[string]interface{}{"watchlist_id": w.ID})
+
+	c.JSON(http.StatusOK, w)
+}
+
+func DeleteWatchlist(c *gin.Context) {
+	id, ok := watchlistID(c)
+	if !ok {
+		return
+	}
+	if err := watchlists.Delete(conf.AppConnections.DB, auth.CurrentUser(c).ID, id); err != nil {
+		watchlistError(c, err, "delete watchlist")
+		return
+	}
+	activity.Track(c, auth.CurrentUser(c).ID, activity.TypeWatchlistDeleted, map[string]interface{}{"watchlist_id": id})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Watchlist deleted.",
+	})
+}
+
+func AddWatchlistSymbol(c *gin.Context) {
+	id, ok := watchlistID(c)
+	if !ok {
+		return
+	}
+	var req watchlistSymbolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	w, err := watchlists.AddSymbol(conf.AppConnections.DB, auth.CurrentUser(c).ID, id, req.Symbol)
+	if err != nil {
+		watchlistError(c, err, "add symbol")
+		return
+	}
+	activity.Track(c, w.UserID, activity.TypeWatchlistSymbolAdded, map[string]interface{}{"watchlist_id": w.ID, "symbol": strings.ToUpper(strings.TrimSpace(req.Symbol))})
+
+	c.JSON(http.StatusOK, w)
+}
+
+func RemoveWatchlistSymbol(c *gin.Context) {
+	id, ok := watchlistID(c)
+	if !ok {
+		return
+	}
+	w, err := watchlists.RemoveSymbol(conf.AppConnections.DB, auth.CurrentUser(c).ID, id, c.Param("symbol"))
+	if err != nil {
+		watchlistError(c, err, "remove symbol")
+		return
+	}
+	activity.Track(c, w.UserID, activity.TypeWatchlistSymbolRemoved, map[string]interface{}{"watchlist_id": w.ID, "symbol": strings.ToUpper(c.Param("symbol"))})
+
+	c.JSON(http.StatusOK, w)
+}
@@ -0,0 +1,13 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/platform_apis/conf"
+	"github.com/rohanchavan1918/platform_apis/gateway"
+)
+
+func UserStream(c *gin.Context) {
+	// Private order and fill updates. The socket authenticates with its
+	// first message, see gateway.Serve, so it is not behind RequireAuth.
+	gateway.DefaultHub.Serve(conf.AppConnections.DB, c.Writer, c.Request)
+}
@@ -0,0 +1,284 @@
+package apikeys
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/conf"
+)
+
+// Scopes an API key can be granted
+const (
+	ScopeRead     = "read"
+	ScopeTrade    = "trade"
+	ScopeWithdraw = "withdraw"
+)
+
+var validScopes = map[string]bool{ScopeRead: true, ScopeTrade: true, ScopeWithdraw: true}
+
+var (
+	ErrNotFound     = errors.New("API key not found")
+	ErrTooManyKeys  = errors.New("API key limit reached, revoke an unused key first")
+	ErrInvalidScope = errors.New("Scopes must be any of read, trade, withdraw")
+	ErrInvalidIP    = errors.New("IP allowlist entries must be IP addresses or CIDR ranges")
+)
+
+type APIKey struct {
+	ID          string     `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Label       string     `json:"label"`
+	Scopes      []string   `json:"scopes"`
+	IPAllowlist []string   `json:"ip_allowlist"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+
+	secret string
+}
+
+var schemas = []string{
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id VARCHAR(64) PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		label VARCHAR(255) NOT NULL DEFAULT '',
+		encrypted_secret VARCHAR(255) NOT NULL,
+		scopes VARCHAR(255) NOT NULL,
+		ip_allowlist TEXT NOT NULL,
+		created_at DATETIME(6) NOT NULL,
+		last_used_at DATETIME(6) NULL,
+		revoked_at DATETIME(6) NULL,
+		INDEX idx_api_keys_user (user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS api_key_nonces (
+		key_id VARCHAR(64) NOT NULL,
+		nonce VARCHAR(128) NOT NULL,
+		expires_at DATETIME(6) NOT NULL,
+		PRIMARY KEY (key_id, nonce),
+		INDEX idx_nonces_expiry (expires_at)
+	)`,
+}
+
+func EnsureSchema(db *sql.DB) error {
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasScope reports whether the key was granted scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsIP reports whether ip is covered by the allowlist, an empty allowlist
+// allows every address
+func (k *APIKey) AllowsIP(ip string) bool {
+	if len(k.IPAllowlist) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range k.IPAllowlist {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !validScopes[scope] {
+			return nil, ErrInvalidScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
+
+func normalizeAllowlist(entries []string) ([]string, error) {
+	normalized := []string{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return nil, fmt.Errorf("%w, got %q", ErrInvalidIP, entry)
+		}
+		normalized = append(normalized, entry)
+	}
+	return normalized, nil
+}
+
+// Create issues a new key for the user. The returned secret is only ever
+// shown here, afterwards it is kept encrypted.
+func Create(db *sql.DB, userID int64, label string, scopes, ipAllowlist []string) (*APIKey, string, error) {
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	ipAllowlist, err = normalizeAllowlist(ipAllowlist)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if limit := conf.AppConfig().Auth.APIKeys.MaxKeysPerUser; limit > 0 {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM api_keys WHERE user_id = ? AND revoked_at IS NULL", userID).Scan(&count)
+		if err != nil {
+			return nil, "", err
+		}
+		if count >= limit {
+			return nil, "", ErrTooManyKeys
+		}
+	}
+
+	secret := utils.NewID() + utils.NewID()
+	encrypted, err := encryptSecret(secret)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &APIKey{
+		ID:          "kse_" + utils.NewID(),
+		UserID:      userID,
+		Label:       strings.TrimSpace(label),
+		Scopes:      scopes,
+		IPAllowlist: ipAllowlist,
+		CreatedAt:   time.Now().UTC(),
+	}
+	_, err = db.Exec(
+		"INSERT INTO api_keys (id, user_id, label, encrypted_secret, scopes, ip_allowlist, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		key.ID, key.UserID, key.Label, encrypted, strings.Join(key.Scopes, ","), strings.Join(key.IPAllowlist, ","), key.CreatedAt,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+const keyColumns = "id, user_id, label, scopes, ip_allowlist, created_at, last_used_at, revoked_at"
+
+// ListForUser returns all keys of the user, revoked ones included. Secrets
+// are not loaded, listing keys has no use for them.
+func ListForUser(db *sql.DB, userID int64) ([]APIKey, error) {
+	rows, err := db.Query("SELECT "+keyColumns+" FROM api_keys WHERE user_id = ? ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanKey(rows, nil)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// Get loads an active key together with its decrypted secret
+func Get(db *sql.DB, id string) (*APIKey, error) {
+	var encrypted string
+	key, err := scanKey(db.QueryRow("SELECT "+keyColumns+", encrypted_secret FROM api_keys WHERE id = ? AND revoked_at IS NULL", id), &encrypted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	key.secret, err = decryptSecret(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Revoke disables a key of the user
+func Revoke(db *sql.DB, userID int64, id string) error {
+	res, err := db.Exec("UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", time.Now().UTC(), id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func touch(db *sql.DB, id string) error {
+	_, err := db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now().UTC(), id)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanKey reads the keyColumns of a key, followed by its encrypted secret
+// when encrypted is not nil
+func scanKey(row scanner, encrypted *string) (*APIKey, error) {
+	key := &APIKey{}
+	var scopes, allowlist string
+	var lastUsedAt, revokedAt sql.NullTime
+	dest := []interface{}{&key.ID, &key.UserID, &key.Label, &scopes, &allowlist, &key.CreatedAt, &lastUsedAt, &revokedAt}
+	if encrypted != nil {
+		dest = append(dest, encrypted)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	key.Scopes = splitList(scopes)
+	key.IPAllowlist = splitList(allowlist)
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,59 @@
+package apikeys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"github.com/rohanchavan1918/platform_apis/conf"
+)
+
+// Secrets are needed in the clear to verify signatures, so unlike passwords
+// they cannot be hashed. They are stored AES-GCM encrypted with a key
+// derived from the configured encryption key.
+func cipherAEAD() (cipher.AEAD, error) {
+	if conf.AppConfig().Auth.APIKeys.EncryptionKey == "" {
+		return nil, errors.New("auth.api_keys.encryption_key is not configured")
+	}
+	key := sha256.Sum256([]byte(conf.AppConfig().Auth.APIKeys.EncryptionKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptSecret(secret string) (string, error) {
+	aead, err := cipherAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSecret(encrypted string) (string, error) {
+	aead, err := cipherAEAD()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+	secret, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
@@ -0,0 +1,130 @@
+package apikeys
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/auth"
+	"github.com/rohanchavan1918/platform_apis/conf"
+	"github.com/rohanchavan1918/platform_apis/users"
+)
+
+const apiKeyContextKey = "apikeys.key"
+
+// RequireSignature authenticates a request signed with an API key that was
+// granted scope and attaches the key's owner as the current user
+func RequireSignature(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, status, err := verifyRequest(c, scope)
+		if err != nil {
+			c.AbortWithStatusJSON(status, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		user, err := users.GetByID(conf.AppConnections.DB, key.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": ErrNotFound.Error(),
+			})
+			return
+		}
+
+		if err := touch(conf.AppConnections.DB, key.ID); err != nil {
+			utils.LogError("Failed to update last use of API key %s : %s", key.ID, err)
+		}
+		auth.SetCurrentUser(c, user, "")
+		c.Set(apiKeyContextKey, key)
+		c.Next()
+	}
+}
+
+// RequireUserOrSignature accepts either a signed API key request with scope
+// or a user access token, so the same routes serve the web app and bots
+func RequireUserOrSignature(scope string) gin.HandlerFunc {
+	signed := RequireSignature(scope)
+	user := auth.RequireAuth()
+	return func(c *gin.Context) {
+		if c.GetHeader(HeaderAPIKey) != "" {
+			signed(c)
+			return
+		}
+		user(c)
+	}
+}
+
+// CurrentKey returns the API key a request was signed with, nil for requests
+// authenticated with an access token
+func CurrentKey(c *gin.Context) *APIKey {
+	key, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return nil
+	}
+	return key.(*APIKey)
+}
+
+func verifyRequest(c *gin.Context, scope string) (*APIKey, int, error) {
+	keyID := c.GetHeader(HeaderAPIKey)
+	timestamp := c.GetHeader(HeaderTimestamp)
+	nonce := c.GetHeader(HeaderNonce)
+	signature := c.GetHeader(HeaderSignature)
+	if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return nil, http.StatusUnauthorized, errors.New("Missing API key signature headers")
+	}
+	if len(nonce) > 128 {
+		return nil, http.StatusBadRequest, errors.New("Nonce cannot be longer than 128 characters")
+	}
+
+	now := time.Now()
+	timestampMs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("Timestamp must be milliseconds since the epoch")
+	}
+	if err := checkTimestamp(timestampMs, now); err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	key, err := Get(conf.AppConnections.DB, keyID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, http.StatusUnauthorized, err
+	}
+	if err != nil {
+		utils.LogError("Failed to load API key %s : %s", keyID, err)
+		return nil, http.StatusInternalServerError, errors.New("Failed to authenticate request")
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("Failed to read request body")
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+
+	canonical := CanonicalRequest(timestamp, nonce, c.Request.Method, c.Request.URL.RequestURI(), body)
+	if !key.VerifySignature(canonical, signature) {
+		return nil, http.StatusUnauthorized, ErrBadSignature
+	}
+	if !key.AllowsIP(c.ClientIP()) {
+		return nil, http.StatusForbidden, errors.New("Request IP is not in the API key allowlist")
+	}
+	if !key.HasScope(scope) {
+		return nil, http.StatusForbidden, errors.New("API key is missing the " + scope + " scope")
+	}
+
+	// Nonces are recorded last, so a request rejected above can be fixed and
+	// retried with the same nonce
+	if err := useNonce(conf.AppConnections.DB, key.ID, nonce, now); err != nil {
+		if errors.Is(err, ErrReplay) {
+			return nil, http.StatusUnauthorized, err
+		}
+		utils.LogError("Failed to record nonce for API key %s : %s", key.ID, err)
+		return nil, http.StatusInternalServerError, errors.New("Failed to authenticate request")
+	}
+	return key, 0, nil
+}
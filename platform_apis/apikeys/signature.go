@@ -0,0 +1,99 @@
+package apikeys
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/conf"
+)
+
+// Headers of a signed request
+const (
+	HeaderAPIKey    = "X-KSE-APIKEY"
+	HeaderTimestamp = "X-KSE-TIMESTAMP"
+	HeaderNonce     = "X-KSE-NONCE"
+	HeaderSignature = "X-KSE-SIGNATURE"
+)
+
+const defaultSignatureWindow = 30 * time.Second
+
+var (
+	ErrStaleRequest = errors.New("Request timestamp is outside the signature window")
+	ErrReplay       = errors.New("Nonce was already used")
+	ErrBadSignature = errors.New("Invalid request signature")
+)
+
+func signatureWindow() time.Duration {
+	if window := conf.AppConfig().Auth.APIKeys.SignatureWindow; window > 0 {
+		return window
+	}
+	return defaultSignatureWindow
+}
+
+// CanonicalRequest is the string that gets signed:
+//
+//	timestamp \n nonce \n METHOD \n path?query \n hex(sha256(body))
+func CanonicalRequest(timestamp, nonce, method, requestURI string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{
+		timestamp,
+		nonce,
+		strings.ToUpper(method),
+		requestURI,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the canonical request
+func Sign(secret, canonicalRequest string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonicalRequest))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature in constant time
+func (k *APIKey) VerifySignature(canonicalRequest, signature string) bool {
+	expected := Sign(k.secret, canonicalRequest)
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
+
+func checkTimestamp(timestampMs int64, now time.Time) error {
+	sent := time.UnixMilli(timestampMs)
+	window := signatureWindow()
+	if sent.Before(now.Add(-window)) || sent.After(now.Add(window)) {
+		return ErrStaleRequest
+	}
+	return nil
+}
+
+// useNonce records the nonce for the key, a nonce can only be used once
+// while its request timestamp is inside the signature window
+func useNonce(db *sql.DB, keyID, nonce string, now time.Time) error {
+	_, err := db.Exec(
+		"INSERT INTO api_key_nonces (key_id, nonce, expires_at) VALUES (?, ?, ?)",
+		keyID, nonce, now.Add(2*signatureWindow()),
+	)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		return ErrReplay
+	}
+	return err
+}
+
+// PruneNonces deletes expired nonces every interval, it never returns
+func PruneNonces(db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := db.Exec("DELETE FROM api_key_nonces WHERE expires_at < ?", time.Now().UTC()); err != nil {
+			utils.LogError("Failed to prune API key nonces : %s", err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package apikeys
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"github.com/rohanchavan1918/platform_apis/conf"
+)
+
+func setup(t *testing.T, keys conf.APIKeyConfig) sqlmock.Sqlmock {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Running.Store(&conf.Config{Auth: conf.AuthConfig{APIKeys: keys}})
+	conf.AppConnections.DB = db
+	t.Cleanup(func() {
+		db.Close()
+		conf.AppConnections.DB = nil
+		conf.Running.Store(&conf.Config{})
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return mock
+}
+
+func TestCanonicalRequest(t *testing.T) {
+	canonical := CanonicalRequest("1700000000000", "n-1", "get", "/api/v1/orders?symbol=KSE", nil)
+	want := "1700000000000\nn-1\nGET\n/api/v1/orders?symbol=KSE\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if canonical != want {
+		t.Errorf("canonical request %q, want %q", canonical, want)
+	}
+	if got := Sign("top-secret", canonical); got != "61f49235d07e98c650e38e5a252f79b9a9fd55a41db2ba7d1061a6688e8358f2" {
+		t.Errorf("signature %s does not match the HMAC-SHA256 of the canonical request", got)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	key := &APIKey{secret: "top-secret"}
+	canonical := CanonicalRequest("1700000000000", "n-1", "POST", "/api/v1/orders", []byte(`{"symbol":"KSE"}`))
+	signature := Sign("top-secret", canonical)
+
+	tests := []struct {
+		name      string
+		canonical string
+		signature string
+		valid     bool
+	}{
+		{"signed with the key", canonical, signature, true},
+		{"upper case hex", canonical, strings.ToUpper(signature), true},
+		{"other secret", canonical, Sign("other-secret", canonical), false},
+		{"body changed", CanonicalRequest("1700000000000", "n-1", "POST", "/api/v1/orders", []byte(`{"symbol":"ABC"}`)), signature, false},
+		{"nonce changed", CanonicalRequest("1700000000000", "n-2", "POST", "/api/v1/orders", []byte(`{"symbol":"KSE"}`)), signature, false},
+		{"empty", canonical, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := key.VerifySignature(tt.canonical, tt.signature); got != tt.valid {
+				t.Errorf("VerifySignature = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		window time.Duration
+		sent   time.Duration
+		err    error
+	}{
+		{"now", 0, 0, nil},
+		{"just inside the default window", 0, -29 * time.Second, nil},
+		{"clock ahead", 0, 29 * time.Second, nil},
+		{"too old", 0, -31 * time.Second, ErrStaleRequest},
+		{"too far ahead", 0, 31 * time.Second, ErrStaleRequest},
+		{"inside a configured window", time.Minute, -59 * time.Second, nil},
+		{"outside a configured window", 5 * time.Second, -6 * time.Second, ErrStaleRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, conf.APIKeyConfig{SignatureWindow: tt.window})
+			if err := checkTimestamp(now.Add(tt.sent).UnixMilli(), now); !errors.Is(err, tt.err) {
+				t.Errorf("error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRequireSignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keyColumnNames := []string{"id", "user_id", "label", "scopes", "ip_allowlist", "created_at", "last_used_at", "revoked_at", "encrypted_secret"}
+	selectKey := regexp.QuoteMeta("FROM api_keys WHERE id = ? AND revoked_at IS NULL")
+	insertNonce := regexp.QuoteMeta("INSERT INTO api_key_nonces")
+
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		secret    string
+		// Whether the key is loaded and the nonce recorded before the
+		// request is answered
+		loaded   bool
+		recorded bool
+		nonceErr error
+		status   int
+	}{
+		{"signed", time.Now(), "top-secret", true, true, nil, http.StatusOK},
+		{"duplicate nonce", time.Now(), "top-secret", true, true, &mysql.MySQLError{Number: 1062}, http.StatusUnauthorized},
+		{"bad signature", time.Now(), "other-secret", true, false, nil, http.StatusUnauthorized},
+		{"stale", time.Now().Add(-time.Minute), "top-secret", false, false, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setup(t, conf.APIKeyConfig{EncryptionKey: "test-encryption-key"})
+			encrypted, err := encryptSecret("top-secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.loaded {
+				mock.ExpectQuery(selectKey).WithArgs("kse_1").WillReturnRows(sqlmock.NewRows(keyColumnNames).
+					AddRow("kse_1", int64(7), "bot", "read,trade", "", time.Now().UTC(), nil, nil, encrypted))
+			}
+			if tt.recorded {
+				nonce := mock.ExpectExec(insertNonce).WithArgs("kse_1", "n-1", sqlmock.AnyArg())
+				if tt.nonceErr != nil {
+					nonce.WillReturnError(tt.nonceErr)
+				} else {
+					nonce.WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+			}
+			if tt.status == http.StatusOK {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE id = ?")).WithArgs(int64(7)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "password_hash", "created_at"}).
+						AddRow(int64(7), "bot@example.com", "Bot", "", time.Now().UTC()))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE api_keys SET last_used_at = ? WHERE id = ?")).
+					WithArgs(sqlmock.AnyArg(), "kse_1").WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			r := gin.New()
+			r.POST("/api/v1/orders", RequireSignature(ScopeTrade), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			body := `{"symbol":"KSE"}`
+			timestamp := strconv.FormatInt(tt.timestamp.UnixMilli(), 10)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/orders", strings.NewReader(body))
+			req.Header.Set(HeaderAPIKey, "kse_1")
+			req.Header.Set(HeaderTimestamp, timestamp)
+			req.Header.Set(HeaderNonce, "n-1")
+			req.Header.Set(HeaderSignature, Sign(tt.secret, CanonicalRequest(timestamp, "n-1", http.MethodPost, "/api/v1/orders", []byte(body))))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestListForUserSkipsSecrets(t *testing.T) {
+	// Without an encryption key a secret could not be decrypted, listing
+	// works regardless
+	mock := setup(t, conf.APIKeyConfig{})
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT " + keyColumns + " FROM api_keys WHERE user_id = ?")).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "label", "scopes", "ip_allowlist", "created_at", "last_used_at", "revoked_at"}).
+			AddRow("kse_1", int64(7), "bot", "read,trade", "10.0.0.0/8", time.Now().UTC(), nil, nil))
+
+	keys, err := ListForUser(conf.AppConnections.DB, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].secret != "" || !keys[0].HasScope(ScopeTrade) || len(keys[0].IPAllowlist) != 1 {
+		t.Errorf("listed %+v, want key kse_1 without its secret", keys)
+	}
+}
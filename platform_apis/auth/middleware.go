@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/conf"
+	"github.com/rohanchavan1918/platform_apis/users"
+)
+
+const (
+	userContextKey    = "auth.user"
+	sessionContextKey = "auth.session"
+)
+
+// RequireAuth rejects requests without a valid bearer access token and
+// attaches the authenticated user to the request context
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		tokenString := strings.TrimPrefix(header, "Bearer ")
+		if header == "" || tokenString == header {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Missing bearer token",
+			})
+			return
+		}
+
+		claims, err := ParseAccessToken(tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		active, err := IsSessionActive(conf.AppConnections.DB, claims.SessionID)
+		if err != nil {
+			utils.LogError("Failed to look up session %s : %s", claims.SessionID, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to authenticate request",
+			})
+			return
+		}
+		if !active {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": ErrInvalidToken.Error(),
+			})
+			return
+		}
+
+		user, err := users.GetByID(conf.AppConnections.DB, claims.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": ErrInvalidToken.Error(),
+			})
+			return
+		}
+
+		SetCurrentUser(c, user, claims.SessionID)
+		c.Next()
+	}
+}
+
+// SetCurrentUser attaches an authenticated user to the request context, it is
+// also used by the API key middleware so handlers do not care which
+// credentials were presented
+func SetCurrentUser(c *gin.Context, user *users.User, sessionID string) {
+	c.Set(userContextKey, user)
+	c.Set(sessionContextKey, sessionID)
+}
+
+// CurrentUser returns the user attached by RequireAuth
+func CurrentUser(c *gin.Context) *users.User {
+	user, ok := c.Get(userContextKey)
+	if !ok {
+		return nil
+	}
+	return user.(*users.User)
+}
+
+// CurrentSessionID returns the session of the access token used for the request
+func CurrentSessionID(c *gin.Context) string {
+	return c.GetString(sessionContextKey)
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/rohanchavan1918/platform_apis/conf"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLength = 8
+
+func ValidatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return errors.New("Password must be at least 8 characters long")
+	}
+	// bcrypt ignores everything after the 72nd byte
+	if len(password) > 72 {
+		return errors.New("Password cannot be longer than 72 bytes")
+	}
+	return nil
+}
+
+func HashPassword(password string) (string, error) {
+	cost := conf.AppConfig().Auth.BcryptCost
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/conf"
+)
+
+var ErrTokenReused = errors.New("Refresh token was already used, session revoked")
+
+// A session is one login. Every refresh rotates the refresh token inside the
+// session, presenting an already rotated token revokes the whole session.
+var schemas = []string{
+	`CREATE TABLE IF NOT EXISTS auth_sessions (
+		id VARCHAR(64) PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		created_at DATETIME(6) NOT NULL,
+		revoked_at DATETIME(6) NULL,
+		INDEX idx_sessions_user (user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS refresh_tokens (
+		token_hash CHAR(64) PRIMARY KEY,
+		session_id VARCHAR(64) NOT NULL,
+		user_id BIGINT NOT NULL,
+		expires_at DATETIME(6) NOT NULL,
+		used_at DATETIME(6) NULL,
+		INDEX idx_refresh_session (session_id)
+	)`,
+}
+
+func EnsureSchema(db *sql.DB) error {
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRefreshToken() string {
+	return utils.NewID() + utils.NewID()
+}
+
+// StartSession creates a session for a freshly authenticated user
+func StartSession(db *sql.DB, userID int64) (*TokenPair, error) {
+	now := time.Now().UTC()
+	sessionID := utils.NewID()
+	refreshToken := newRefreshToken()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("INSERT INTO auth_sessions (id, user_id, created_at) VALUES (?, ?, ?)", sessionID, userID, now); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := insertRefreshToken(tx, refreshToken, sessionID, userID, now); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return tokenPair(userID, sessionID, refreshToken, now)
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented token
+// is spent, replaying it later revokes the session.
+func Refresh(db *sql.DB, refreshToken string) (*TokenPair, error) {
+	now := time.Now().UTC()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var sessionID string
+	var userID int64
+	var expiresAt time.Time
+	var usedAt, revokedAt sql.NullTime
+	err = tx.QueryRow(
+		`SELECT t.session_id, t.user_id, t.expires_at, t.used_at, s.revoked_at
+		FROM refresh_tokens t JOIN auth_sessions s ON s.id = t.session_id
+		WHERE t.token_hash = ? FOR UPDATE`,
+		hashToken(refreshToken),
+	).Scan(&sessionID, &userID, &expiresAt, &usedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid || now.After(expiresAt) {
+		return nil, ErrInvalidToken
+	}
+	if usedAt.Valid {
+		// Somebody holds a copy of a rotated token, end the session for everyone
+		if _, err := tx.Exec("UPDATE auth_sessions SET revoked_at = ? WHERE id = ?", now, sessionID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		utils.LogInfo("Refresh token reuse detected, revoked session %s of user %d", sessionID, userID)
+		return nil, ErrTokenReused
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET used_at = ? WHERE token_hash = ?", now, hashToken(refreshToken)); err != nil {
+		return nil, err
+	}
+	newToken := newRefreshToken()
+	if err := insertRefreshToken(tx, newToken, sessionID, userID, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return tokenPair(userID, sessionID, newToken, now)
+}
+
+// RevokeSession logs out a single session
+func RevokeSession(db *sql.DB, sessionID string) error {
+	_, err := db.Exec("UPDATE auth_sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().UTC(), sessionID)
+	return err
+}
+
+// RevokeAllSessions logs the user out everywhere
+func RevokeAllSessions(db *sql.DB, userID int64) error {
+	_, err := db.Exec("UPDATE auth_sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now().UTC(), userID)
+	return err
+}
+
+func IsSessionActive(db *sql.DB, sessionID string) (bool, error) {
+	var revokedAt sql.NullTime
+	err := db.QueryRow("SELECT revoked_at FROM auth_sessions WHERE id = ?", sessionID).Scan(&revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !revokedAt.Valid, nil
+}
+
+func insertRefreshToken(tx *sql.Tx, token, sessionID string, userID int64, now time.Time) error {
+	_, err := tx.Exec(
+		"INSERT INTO refresh_tokens (token_hash, session_id, user_id, expires_at) VALUES (?, ?, ?, ?)",
+		hashToken(token), sessionID, userID, now.Add(conf.AppConfig().Auth.RefreshTokenTTL),
+	)
+	return err
+}
+
+func tokenPair(userID int64, sessionID, refreshToken string, now time.Time) (*TokenPair, error) {
+	accessToken, err := issueAccessToken(userID, sessionID, now)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(conf.AppConfig().Auth.AccessTokenTTL.Seconds()),
+	}, nil
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/platform_apis/conf"
+)
+
+func setup(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Running.Store(&conf.Config{Auth: conf.AuthConfig{
+		JWTSecret:       "test-secret",
+		Issuer:          "kse-platform-api",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 24 * time.Hour,
+	}})
+	conf.AppConnections.DB = db
+	t.Cleanup(func() {
+		db.Close()
+		conf.AppConnections.DB = nil
+		conf.Running.Store(&conf.Config{})
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return mock
+}
+
+var selectRefreshToken = regexp.QuoteMeta("SELECT t.session_id, t.user_id, t.expires_at, t.used_at, s.revoked_at")
+
+func TestRefresh(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name string
+		// Row found for the presented token, nil when there is none
+		row    []driver.Value
+		expect func(mock sqlmock.Sqlmock)
+		err    error
+	}{
+		{
+			name: "rotation",
+			row:  []driver.Value{"s-1", int64(7), now.Add(time.Hour), nil, nil},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE refresh_tokens SET used_at = ? WHERE token_hash = ?")).
+					WithArgs(sqlmock.AnyArg(), hashToken("old-token")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO refresh_tokens")).
+					WithArgs(sqlmock.AnyArg(), "s-1", int64(7), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			// A rotated token shows up again, the session and every token
+			// issued in it stop working
+			name: "reuse after rotate",
+			row:  []driver.Value{"s-1", int64(7), now.Add(time.Hour), now.Add(-time.Minute), nil},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE auth_sessions SET revoked_at = ? WHERE id = ?")).
+					WithArgs(sqlmock.AnyArg(), "s-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			err: ErrTokenReused,
+		},
+		{
+			name:   "revoked session",
+			row:    []driver.Value{"s-1", int64(7), now.Add(time.Hour), nil, now.Add(-time.Minute)},
+			expect: func(mock sqlmock.Sqlmock) { mock.ExpectRollback() },
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "expired",
+			row:    []driver.Value{"s-1", int64(7), now.Add(-time.Minute), nil, nil},
+			expect: func(mock sqlmock.Sqlmock) { mock.ExpectRollback() },
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "unknown token",
+			expect: func(mock sqlmock.Sqlmock) { mock.ExpectRollback() },
+			err:    ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setup(t)
+			rows := sqlmock.NewRows([]string{"session_id", "user_id", "expires_at", "used_at", "revoked_at"})
+			if tt.row != nil {
+				rows.AddRow(tt.row...)
+			}
+			mock.ExpectBegin()
+			mock.ExpectQuery(selectRefreshToken).WithArgs(hashToken("old-token")).WillReturnRows(rows)
+			tt.expect(mock)
+
+			pair, err := Refresh(conf.AppConnections.DB, "old-token")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if pair.RefreshToken == "" || pair.RefreshToken == "old-token" {
+				t.Errorf("refresh token %q was not rotated", pair.RefreshToken)
+			}
+			claims, err := ParseAccessToken(pair.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserID != 7 || claims.SessionID != "s-1" {
+				t.Errorf("access token is for user %d session %s, want user 7 session s-1", claims.UserID, claims.SessionID)
+			}
+		})
+	}
+}
+
+func TestRequireAuthSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	selectSession := regexp.QuoteMeta("SELECT revoked_at FROM auth_sessions WHERE id = ?")
+
+	tests := []struct {
+		name   string
+		expect func(mock sqlmock.Sqlmock)
+		status int
+	}{
+		{
+			name: "active session",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectSession).WithArgs("s-1").
+					WillReturnRows(sqlmock.NewRows([]string{"revoked_at"}).AddRow(nil))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE id = ?")).WithArgs(int64(7)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "password_hash", "created_at"}).
+						AddRow(int64(7), "trader@example.com", "Trader", "", time.Now().UTC()))
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "revoked session",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectSession).WithArgs("s-1").
+					WillReturnRows(sqlmock.NewRows([]string{"revoked_at"}).AddRow(time.Now().UTC()))
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown session",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectSession).WithArgs("s-1").WillReturnError(sql.ErrNoRows)
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "lookup failure",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectSession).WithArgs("s-1").WillReturnError(errors.New("connection lost"))
+			},
+			status: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setup(t)
+			tt.expect(mock)
+			token, err := issueAccessToken(7, "s-1", time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := gin.New()
+			r.GET("/me", RequireAuth(), func(c *gin.Context) { c.Status(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
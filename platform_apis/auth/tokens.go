@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rohanchavan1918/platform_apis/conf"
+)
+
+var ErrInvalidToken = errors.New("Invalid or expired token")
+
+// Claims carried by access tokens. SessionID ties the token to the refresh
+// token family it was issued from, so revoking the session also rejects
+// access tokens that have not expired yet.
+type Claims struct {
+	UserID    int64  `json:"uid"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// TokenPair is returned on login and on every refresh
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func issueAccessToken(userID int64, sessionID string, now time.Time) (string, error) {
+	claims := Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(userID, 10),
+			Issuer:    conf.AppConfig().Auth.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(conf.AppConfig().Auth.AccessTokenTTL)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(conf.AppConfig().Auth.JWTSecret))
+}
+
+// ParseAccessToken verifies the signature, expiry and issuer of a token
+func ParseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return []byte(conf.AppConfig().Auth.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if issuer := conf.AppConfig().Auth.Issuer; issuer != "" && !claims.VerifyIssuer(issuer, true) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,13 @@
+package conf
+
+import "time"
+
+// AlertsConfig specifies how price alerts are evaluated and delivered
+type AlertsConfig struct {
+	MaxAlertsPerUser int           `viper:"int" validate:"gte=0" reload:"live" mapstructure:"max_alerts_per_user"`
+	MaxWindow        time.Duration `viper:"string" validate:"gte=0" reload:"live" mapstructure:"max_window"`
+	BaselineWindows  int           `viper:"int" validate:"gte=0" reload:"live" mapstructure:"baseline_windows"`
+	ReloadInterval   time.Duration `viper:"string" validate:"gte=0" mapstructure:"reload_interval"`
+	WebhookTimeout   time.Duration `viper:"string" validate:"gte=0" mapstructure:"webhook_timeout"`
+	WebhookSecret    string        `viper:"string" secret:"true" mapstructure:"webhook_secret"`
+}
@@ -0,0 +1,31 @@
+package conf
+
+import (
+	"errors"
+	"time"
+)
+
+// AuthConfig specifies how access and refresh tokens are issued
+type AuthConfig struct {
+	JWTSecret       string        `viper:"string" validate:"required" secret:"true" mapstructure:"jwt_secret"`
+	Issuer          string        `viper:"string" mapstructure:"issuer"`
+	AccessTokenTTL  time.Duration `viper:"string" validate:"required,gt=0" reload:"live" mapstructure:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `viper:"string" validate:"required" reload:"live" mapstructure:"refresh_token_ttl"`
+	BcryptCost      int           `viper:"int" validate:"omitempty,min=4,max=31" reload:"live" mapstructure:"bcrypt_cost"`
+	APIKeys         APIKeyConfig  `mapstructure:"api_keys"`
+}
+
+// APIKeyConfig specifies how API key secrets are stored and how signed
+// requests are checked
+type APIKeyConfig struct {
+	EncryptionKey   string        `viper:"string" validate:"required" secret:"true" mapstructure:"encryption_key"`
+	SignatureWindow time.Duration `viper:"string" validate:"gte=0" reload:"live" mapstructure:"signature_window"`
+	MaxKeysPerUser  int           `viper:"int" validate:"gte=0" reload:"live" mapstructure:"max_keys_per_user"`
+}
+
+func (c *AuthConfig) Validate() error {
+	if c.RefreshTokenTTL > 0 && c.RefreshTokenTTL <= c.AccessTokenTTL {
+		return errors.New("refresh_token_ttl must be longer than access_token_ttl")
+	}
+	return nil
+}
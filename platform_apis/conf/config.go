@@ -1,48 +1,50 @@
 package conf
 
 import (
-	"strings"
+	"database/sql"
+	"sync/atomic"
 
+	commonconf "github.com/rohanchavan1918/kse-common/config"
+	"github.com/segmentio/kafka-go"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Port        int64         `viper:"int"`
-	ServiceName string        `viper:"string" mapstructure:"service_name"`
-	DB          DB            `mapstructure:"db"`
-	Redis       Redis         `mapstructure:"redis"`
-	Fluent      Fluent        `mapstructure:"fluent"`
-	LogConfig   LoggingConfig `mapstructure:"log_config"`
-	SlackUrl    string        `mapstructure:"slack_url"`
+	commonconf.Base `mapstructure:",squash"`
+
+	Auth        AuthConfig      `mapstructure:"auth"`
+	KafkaConfig KafkaConfig     `mapstructure:"kafka"`
+	WebSocket   WebSocketConfig `mapstructure:"websocket"`
+	Alerts      AlertsConfig    `mapstructure:"alerts"`
+	Portfolio   PortfolioConfig `mapstructure:"portfolio"`
+	Payments    PaymentsConfig  `mapstructure:"payments"`
 }
 
-var AppConfig Config
+type appConnections struct {
+	KafkaWriter *kafka.Writer
+	DB          *sql.DB
+}
 
-func LoadConfig(cmd *cobra.Command) (*Config, error) {
-	err := viper.BindPFlags(cmd.Flags())
-	config := Config{}
-	if err != nil {
-		return nil, err
-	}
+var AppConnections appConnections
 
-	// viper.SetEnvPrefix("")
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-	viper.AutomaticEnv()
+// Running holds the running *Config. Reloads replace it with a new one
+// rather than change it, so it can be read without locking.
+var Running atomic.Value
 
-	if configFile, _ := cmd.Flags().GetString("config"); configFile != "" {
-		viper.SetConfigFile(configFile)
-	} else {
-		viper.SetConfigFile("./config/config.json")
+// AppConfig returns the running config, treat it as read only
+func AppConfig() *Config {
+	if config, ok := Running.Load().(*Config); ok {
+		return config
 	}
+	return &Config{}
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, err
-	}
-	if err := viper.Unmarshal(&config); err != nil {
+func LoadConfig(cmd *cobra.Command) (*Config, error) {
+	config := Config{}
+	if err := commonconf.Load(cmd, &config); err != nil {
 		return nil, err
 	}
-	AppConfig = config
+	Running.Store(&config)
 
 	return &config, nil
 }
@@ -0,0 +1,25 @@
+package conf
+
+import commonconf "github.com/rohanchavan1918/kse-common/config"
+
+type KafkaConfig struct {
+	commonconf.Kafka `mapstructure:",squash"`
+
+	Topics KafkaTopics `mapstructure:"topics"`
+}
+
+// KafkaTopics names every topic platform_apis produces to or consumes from
+type KafkaTopics struct {
+	OrderCommands    string `viper:"string" validate:"required" mapstructure:"order_commands"`
+	ExecutionReports string `viper:"string" validate:"required" mapstructure:"execution_reports"`
+	Trades           string `viper:"string" validate:"required" mapstructure:"trades"`
+	Ticks            string `viper:"string" validate:"required" mapstructure:"ticks"`
+	Activity         string `viper:"string" validate:"required" mapstructure:"activity"`
+}
+
+// KafkaSettings returns the Kafka connection and the topics the service
+// uses, for the topics command and startup provisioning
+func (c *Config) KafkaSettings() (*commonconf.Kafka, []string) {
+	topics := c.KafkaConfig.Topics
+	return &c.KafkaConfig.Kafka, []string{topics.OrderCommands, topics.ExecutionReports, topics.Trades, topics.Ticks, topics.Activity}
+}
@@ -0,0 +1,38 @@
+package conf
+
+import (
+	"errors"
+	"time"
+)
+
+// PaymentsConfig specifies deposits, withdrawals and the payment provider
+// behind them
+type PaymentsConfig struct {
+	Provider          string             `viper:"string" validate:"omitempty,oneof=fake" mapstructure:"provider"`
+	MinAmount         float64            `viper:"float" validate:"gte=0" reload:"live" mapstructure:"min_amount"`
+	MaxAmount         float64            `viper:"float" validate:"gte=0" reload:"live" mapstructure:"max_amount"`
+	ReconcileInterval time.Duration      `viper:"string" validate:"gte=0" mapstructure:"reconcile_interval"`
+	Fake              FakeProviderConfig `mapstructure:"fake"`
+}
+
+// FakeProviderConfig tunes the simulated provider used for local setups
+type FakeProviderConfig struct {
+	MinDelay    time.Duration `viper:"string" validate:"gte=0" mapstructure:"min_delay"`
+	MaxDelay    time.Duration `viper:"string" validate:"gte=0" mapstructure:"max_delay"`
+	FailureRate float64       `viper:"float" validate:"gte=0,lte=1" mapstructure:"failure_rate"`
+	MaxAmount   float64       `viper:"float" validate:"gte=0" mapstructure:"max_amount"`
+}
+
+func (c *PaymentsConfig) Validate() error {
+	if c.MaxAmount > 0 && c.MinAmount > c.MaxAmount {
+		return errors.New("min_amount cannot be greater than max_amount")
+	}
+	return nil
+}
+
+func (c *FakeProviderConfig) Validate() error {
+	if c.MinDelay > c.MaxDelay {
+		return errors.New("min_delay cannot be greater than max_delay")
+	}
+	return nil
+}
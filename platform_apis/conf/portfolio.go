@@ -0,0 +1,9 @@
+package conf
+
+import "time"
+
+// PortfolioConfig specifies how often equity curve snapshots are taken
+type PortfolioConfig struct {
+	SnapshotInterval time.Duration `viper:"string" validate:"gte=0" mapstructure:"snapshot_interval"`
+	MaxHistoryDays   int           `viper:"int" validate:"gte=0" reload:"live" mapstructure:"max_history_days"`
+}
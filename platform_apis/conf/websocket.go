@@ -0,0 +1,11 @@
+package conf
+
+import "time"
+
+// WebSocketConfig specifies the private user event stream
+type WebSocketConfig struct {
+	MaxConnectionsPerUser int           `viper:"int" validate:"gte=0" reload:"live" mapstructure:"max_connections_per_user"`
+	EventRetention        time.Duration `viper:"string" validate:"gte=0" mapstructure:"event_retention"`
+	PollInterval          time.Duration `viper:"string" validate:"gte=0" mapstructure:"poll_interval"`
+	AuthTimeout           time.Duration `viper:"string" validate:"gte=0" reload:"live" mapstructure:"auth_timeout"`
+}
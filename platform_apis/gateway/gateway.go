@@ -0,0 +1,259 @@
+package gateway
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/auth"
+	"github.com/rohanchavan1918/platform_apis/conf"
+	"github.com/rohanchavan1918/platform_apis/userevents"
+)
+
+const (
+	writeTimeout = 10 * time.Second
+	pongTimeout  = 60 * time.Second
+	pingInterval = 25 * time.Second
+
+	// Safety net for notifications the tailer missed
+	resyncInterval = 5 * time.Second
+	replayBatch    = 500
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Tokens are sent in the first message rather than as cookies, so cross
+	// origin pages cannot ride on a user's session
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// authMessage must be the first message of every connection. LastSeq is
+// the seq of the last event the client processed, nil to only receive new
+// events.
+type authMessage struct {
+	Op      string `json:"op"`
+	Token   string `json:"token"`
+	LastSeq *int64 `json:"last_seq"`
+}
+
+// serverMessage is everything the gateway sends besides events
+type serverMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message,omitempty"`
+	UserID  int64  `json:"user_id,omitempty"`
+	LastSeq int64  `json:"last_seq"`
+}
+
+// Hub tracks the connections of this instance so the tailer can wake them up
+type Hub struct {
+	mu    sync.Mutex
+	conns map[int64]map[*connection]bool
+}
+
+var DefaultHub = &Hub{conns: map[int64]map[*connection]bool{}}
+
+type connection struct {
+	ws     *websocket.Conn
+	userID int64
+	wake   chan struct{}
+}
+
+func (h *Hub) register(c *connection) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if limit := conf.AppConfig().WebSocket.MaxConnectionsPerUser; limit > 0 && len(h.conns[c.userID]) >= limit {
+		return false
+	}
+	if h.conns[c.userID] == nil {
+		h.conns[c.userID] = map[*connection]bool{}
+	}
+	h.conns[c.userID][c] = true
+	return true
+}
+
+func (h *Hub) unregister(c *connection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns[c.userID], c)
+	if len(h.conns[c.userID]) == 0 {
+		delete(h.conns, c.userID)
+	}
+}
+
+// Notify wakes up the connections of users with new events
+func (h *Hub) Notify(userIDs []int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, userID := range userIDs {
+		for c := range h.conns[userID] {
+			// A pending wake up already covers this one
+			select {
+			case c.wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Serve upgrades the request and streams the authenticated user's events
+// until the client goes away or its access token expires
+func (h *Hub) Serve(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied with an error
+		return
+	}
+	defer ws.Close()
+
+	claims, lastSeq, err := authenticate(db, ws)
+	if err != nil {
+		closeWith(ws, websocket.ClosePolicyViolation, err.Error())
+		return
+	}
+
+	c := &connection{ws: ws, userID: claims.UserID, wake: make(chan struct{}, 1)}
+	if !h.register(c) {
+		closeWith(ws, websocket.ClosePolicyViolation, "Too many connections")
+		return
+	}
+	defer h.unregister(c)
+
+	oldest, latest, err := userevents.Bounds(db, c.userID)
+	if err != nil {
+		utils.LogError("Failed to read event bounds of user %d : %s", c.userID, err)
+		closeWith(ws, websocket.CloseInternalServerErr, "Failed to load events")
+		return
+	}
+	cursor := latest
+	if lastSeq != nil {
+		cursor = *lastSeq
+		// Events after the client's position were pruned, it has to reload
+		// its state over REST before the stream makes sense again
+		if oldest > cursor+1 {
+			if err := writeJSON(ws, serverMessage{Type: "reset", Message: "Missed events are no longer available", LastSeq: oldest - 1}); err != nil {
+				return
+			}
+			cursor = oldest - 1
+		}
+		// A client ahead of the stream would silently skip new events
+		if cursor > latest {
+			if err := writeJSON(ws, serverMessage{Type: "reset", Message: "last_seq is ahead of the stream", LastSeq: latest}); err != nil {
+				return
+			}
+			cursor = latest
+		}
+	}
+	if err := writeJSON(ws, serverMessage{Type: "authenticated", UserID: c.userID, LastSeq: cursor}); err != nil {
+		return
+	}
+
+	closed := make(chan struct{})
+	go readLoop(ws, closed)
+	c.stream(db, cursor, claims.ExpiresAt.Time, closed)
+}
+
+func authenticate(db *sql.DB, ws *websocket.Conn) (*auth.Claims, *int64, error) {
+	timeout := conf.AppConfig().WebSocket.AuthTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ws.SetReadDeadline(time.Now().Add(timeout))
+
+	var msg authMessage
+	if err := ws.ReadJSON(&msg); err != nil || msg.Op != "auth" {
+		return nil, nil, errors.New("First message must be {\"op\": \"auth\", \"token\": ...}")
+	}
+	claims, err := auth.ParseAccessToken(msg.Token)
+	if err != nil {
+		return nil, nil, err
+	}
+	active, err := auth.IsSessionActive(db, claims.SessionID)
+	if err != nil || !active {
+		return nil, nil, auth.ErrInvalidToken
+	}
+	if msg.LastSeq != nil && *msg.LastSeq < 0 {
+		return nil, nil, errors.New("last_seq cannot be negative")
+	}
+	return claims, msg.LastSeq, nil
+}
+
+// readLoop keeps the read side serviced so pongs and close frames are seen,
+// clients have nothing else to say after authenticating
+func readLoop(ws *websocket.Conn, closed chan struct{}) {
+	defer close(closed)
+	ws.SetReadDeadline(time.Now().Add(pongTimeout))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// stream is the only writer of the connection. Replay after a reconnect and
+// live delivery both read the user's events after cursor, so the client sees
+// every event exactly once and in order.
+func (c *connection) stream(db *sql.DB, cursor int64, expiresAt time.Time, closed chan struct{}) {
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	resync := time.NewTicker(resyncInterval)
+	defer resync.Stop()
+	expired := time.NewTimer(time.Until(expiresAt))
+	defer expired.Stop()
+
+	for {
+		for {
+			events, err := userevents.Since(db, c.userID, cursor, replayBatch)
+			if err != nil {
+				utils.LogError("Failed to load events of user %d : %s", c.userID, err)
+				break
+			}
+			for _, event := range events {
+				if err := writeJSON(c.ws, event); err != nil {
+					return
+				}
+				cursor = event.Seq
+			}
+			if len(events) < replayBatch {
+				break
+			}
+		}
+
+		select {
+		case <-c.wake:
+		case <-resync.C:
+		case <-ping.C:
+			c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-expired.C:
+			closeWith(c.ws, websocket.ClosePolicyViolation, "Access token expired, reconnect with a fresh token")
+			return
+		case <-closed:
+			return
+		}
+	}
+}
+
+func writeJSON(ws *websocket.Conn, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return ws.WriteMessage(websocket.TextMessage, payload)
+}
+
+func closeWith(ws *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeTimeout))
+}
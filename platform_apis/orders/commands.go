@@ -0,0 +1,237 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// Command types published to the order command topic
+const (
+	CommandNew     = "new"
+	CommandCancel  = "cancel"
+	CommandReplace = "replace"
+)
+
+var ErrPublishFailed = errors.New("Failed to submit order, try again")
+
+const publishTimeout = 10 * time.Second
+
+// Command is the message the order processor consumes. It is keyed by
+// symbol so all commands of a symbol are processed in order.
+type Command struct {
+	Type          string    `json:"type"`
+	OrderID       string    `json:"order_id"`
+	ClientOrderID string    `json:"client_order_id"`
+	UserID        int64     `json:"user_id"`
+	Symbol        string    `json:"symbol"`
+	Side          string    `json:"side"`
+	OrderType     string    `json:"order_type"`
+	TimeInForce   string    `json:"time_in_force"`
+	Price         float64   `json:"price"`
+	Quantity      float64   `json:"quantity"`
+	SentAt        time.Time `json:"sent_at"`
+}
+
+func commandFor(commandType string, o *Order) Command {
+	return Command{
+		Type:          commandType,
+		OrderID:       o.ID,
+		ClientOrderID: o.ClientOrderID,
+		UserID:        o.UserID,
+		Symbol:        o.Symbol,
+		Side:          o.Side,
+		OrderType:     o.Type,
+		TimeInForce:   o.TimeInForce,
+		Price:         o.Price,
+		Quantity:      o.Quantity,
+		SentAt:        time.Now().UTC(),
+	}
+}
+
+func publish(ctx context.Context, w *kafka.Writer, cmd Command) error {
+	value, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	// The order is stored already, a client that went away should not stop
+	// the processor from hearing about it
+	ctx, cancel := context.WithTimeout(tracing.Detach(ctx), publishTimeout)
+	defer cancel()
+	msg := kafka.Message{
+		Key:   []byte(cmd.Symbol),
+		Value: value,
+	}
+	ctx, span := tracing.StartProducer(ctx, w.Topic, &msg)
+	return tracing.End(span, w.WriteMessages(ctx, msg))
+}
+
+// Place stores the order and publishes it to the order processor. Placing
+// the same client order ID again returns the existing order with created
+// false instead of trading twice, unless the order could not be published
+// the last time, then it is published again.
+func Place(ctx context.Context, db *sql.DB, w *kafka.Writer, userID int64, req NewOrderRequest) (*Order, bool, error) {
+	if req.ClientOrderID != "" {
+		existing, err := GetByClientOrderID(db, userID, req.ClientOrderID)
+		if err == nil {
+			return resubmit(ctx, db, w, &req, existing)
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, false, err
+		}
+	}
+
+	now := time.Now().UTC()
+	o := &Order{
+		ID:            utils.NewID(),
+		ClientOrderID: req.ClientOrderID,
+		UserID:        userID,
+		Symbol:        req.Symbol,
+		Side:          req.Side,
+		Type:          req.Type,
+		TimeInForce:   req.TimeInForce,
+		Price:         req.Price,
+		Quantity:      req.Quantity,
+		Status:        StatusPendingNew,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if o.ClientOrderID == "" {
+		o.ClientOrderID = o.ID
+	}
+
+	if err := insert(db, o); err != nil {
+		if errors.Is(err, ErrClientOrderIDReused) {
+			// A concurrent retry won the insert
+			existing, getErr := GetByClientOrderID(db, userID, req.ClientOrderID)
+			if getErr != nil {
+				return nil, false, getErr
+			}
+			return resubmit(ctx, db, w, &req, existing)
+		}
+		return nil, false, err
+	}
+
+	if err := submit(ctx, db, w, o); err != nil {
+		return nil, false, err
+	}
+	return o, true, nil
+}
+
+// submit publishes a stored order. When the order processor cannot be
+// reached the order is rejected with ErrPublishFailed, which tells the
+// client to place it again.
+func submit(ctx context.Context, db *sql.DB, w *kafka.Writer, o *Order) error {
+	if err := publish(ctx, w, commandFor(CommandNew, o)); err != nil {
+		logger := logging.FromContext(ctx).WithFields(log.Fields{logging.FieldOrderID: o.ID, logging.FieldSymbol: o.Symbol})
+		logger.WithError(err).Error("Failed to publish order")
+		if err := setStatus(db, o.ID, StatusRejected, ErrPublishFailed.Error()); err != nil {
+			logger.WithError(err).Error("Failed to reject unpublished order")
+		}
+		return ErrPublishFailed
+	}
+	return nil
+}
+
+// resubmit answers an order placed again with the client order ID of
+// existing. Orders rejected because they could not be published get
+// published again, as the client was told to retry, any other order is
+// returned as it is.
+func resubmit(ctx context.Context, db *sql.DB, w *kafka.Writer, req *NewOrderRequest, existing *Order) (*Order, bool, error) {
+	if !req.Matches(existing) {
+		return nil, false, ErrClientOrderIDReused
+	}
+	if existing.Status != StatusRejected || existing.RejectReason != ErrPublishFailed.Error() {
+		return existing, false, nil
+	}
+
+	reopened, err := reopen(db, existing.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !reopened {
+		// A concurrent retry got to it first
+		current, err := Get(db, existing.UserID, existing.ID)
+		if err != nil {
+			return nil, false, err
+		}
+		return current, false, nil
+	}
+	existing.Status, existing.RejectReason = StatusPendingNew, ""
+	if err := submit(ctx, db, w, existing); err != nil {
+		return nil, false, err
+	}
+	return existing, true, nil
+}
+
+// Cancel asks the order processor to cancel an open order
+func Cancel(ctx context.Context, db *sql.DB, w *kafka.Writer, userID int64, id string) (*Order, error) {
+	o, err := Get(db, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !o.IsOpen() {
+		return nil, ErrNotOpen
+	}
+
+	if err := requestChange(ctx, db, w, o, StatusPendingCancel, commandFor(CommandCancel, o)); err != nil {
+		return nil, err
+	}
+	return Get(db, userID, id)
+}
+
+// Replace asks the order processor to change the price and/or quantity of an
+// open order
+func Replace(ctx context.Context, db *sql.DB, w *kafka.Writer, userID int64, id string, req ReplaceRequest) (*Order, error) {
+	o, err := Get(db, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !o.IsOpen() {
+		return nil, ErrNotOpen
+	}
+	if err := req.Validate(o); err != nil {
+		return nil, &InvalidRequestError{Err: err}
+	}
+
+	cmd := commandFor(CommandReplace, o)
+	if req.Price != nil {
+		cmd.Price = *req.Price
+	}
+	if req.Quantity != nil {
+		cmd.Quantity = *req.Quantity
+	}
+	if err := requestChange(ctx, db, w, o, StatusPendingReplace, cmd); err != nil {
+		return nil, err
+	}
+	return Get(db, userID, id)
+}
+
+func requestChange(ctx context.Context, db *sql.DB, w *kafka.Writer, o *Order, pending string, cmd Command) error {
+	if err := setPendingStatus(db, o.ID, pending); err != nil {
+		return err
+	}
+	if err := publish(ctx, w, cmd); err != nil {
+		logger := logging.FromContext(ctx).WithFields(log.Fields{logging.FieldOrderID: o.ID, logging.FieldSymbol: o.Symbol})
+		logger.WithError(err).Errorf("Failed to publish %s", cmd.Type)
+		// Put the order back the way it was unless a report moved it on
+		_, revertErr := db.Exec(
+			"UPDATE orders SET status = ?, updated_at = ? WHERE id = ? AND status = ?",
+			o.Status, time.Now().UTC(), o.ID, pending,
+		)
+		if revertErr != nil {
+			logger.WithError(revertErr).Errorf("Failed to revert order to %s", o.Status)
+		}
+		return ErrPublishFailed
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package orders
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+
+	TypeLimit  = "limit"
+	TypeMarket = "market"
+
+	TimeInForceGTC = "gtc"
+	TimeInForceIOC = "ioc"
+	TimeInForceFOK = "fok"
+)
+
+// Order states. The pending ones are set by this service when a command is
+// published, everything else comes from execution reports.
+const (
+	StatusPendingNew      = "pending_new"
+	StatusNew             = "new"
+	StatusPartiallyFilled = "partially_filled"
+	StatusFilled          = "filled"
+	StatusPendingCancel   = "pending_cancel"
+	StatusCancelled       = "cancelled"
+	StatusPendingReplace  = "pending_replace"
+	StatusRejected        = "rejected"
+	StatusExpired         = "expired"
+)
+
+// openStatuses can still be cancelled or replaced
+var openStatuses = []string{StatusPendingNew, StatusNew, StatusPartiallyFilled}
+
+var (
+	ErrNotFound            = errors.New("Order not found")
+	ErrNotOpen             = errors.New("Order is no longer open")
+	ErrClientOrderIDReused = errors.New("client_order_id was already used for a different order")
+)
+
+// InvalidRequestError is returned when the order request itself is at fault
+type InvalidRequestError struct {
+	Err error
+}
+
+func (e *InvalidRequestError) Error() string {
+	return e.Err.Error()
+}
+
+type Order struct {
+	ID             string    `json:"id"`
+	ClientOrderID  string    `json:"client_order_id"`
+	UserID         int64     `json:"user_id"`
+	Symbol         string    `json:"symbol"`
+	Side           string    `json:"side"`
+	Type           string    `json:"type"`
+	TimeInForce    string    `json:"time_in_force"`
+	Price          float64   `json:"price"`
+	Quantity       float64   `json:"quantity"`
+	FilledQuantity float64   `json:"filled_quantity"`
+	AvgFillPrice   float64   `json:"avg_fill_price"`
+	Status         string    `json:"status"`
+	RejectReason   string    `json:"reject_reason,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// NewOrderRequest is what a user sends to place an order
+type NewOrderRequest struct {
+	ClientOrderID string  `json:"client_order_id"`
+	Symbol        string  `json:"symbol" binding:"required"`
+	Side          string  `json:"side" binding:"required"`
+	Type          string  `json:"type" binding:"required"`
+	TimeInForce   string  `json:"time_in_force"`
+	Price         float64 `json:"price"`
+	Quantity      float64 `json:"quantity" binding:"required"`
+}
+
+// ReplaceRequest changes the price and/or quantity of an open order
+type ReplaceRequest struct {
+	Price    *float64 `json:"price"`
+	Quantity *float64 `json:"quantity"`
+}
+
+func validNumber(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// Normalize lower cases the enums, upper cases the symbol and fills in the
+// defaults
+func (r *NewOrderRequest) Normalize() {
+	r.ClientOrderID = strings.TrimSpace(r.ClientOrderID)
+	r.Symbol = strings.ToUpper(strings.TrimSpace(r.Symbol))
+	r.Side = strings.ToLower(r.Side)
+	r.Type = strings.ToLower(r.Type)
+	r.TimeInForce = strings.ToLower(r.TimeInForce)
+	if r.TimeInForce == "" && r.Type == TypeMarket {
+		r.TimeInForce = TimeInForceIOC
+	} else if r.TimeInForce == "" {
+		r.TimeInForce = TimeInForceGTC
+	}
+}
+
+func (r *NewOrderRequest) Validate() error {
+	if r.Symbol == "" {
+		return errors.New("Symbol cannot be empty")
+	}
+	if len(r.ClientOrderID) > 64 {
+		return errors.New("client_order_id cannot be longer than 64 characters")
+	}
+	if r.Side != SideBuy && r.Side != SideSell {
+		return errors.New("Side must be buy or sell")
+	}
+	if r.TimeInForce != TimeInForceGTC && r.TimeInForce != TimeInForceIOC && r.TimeInForce != TimeInForceFOK {
+		return errors.New("time_in_force must be gtc, ioc or fok")
+	}
+	if r.Quantity <= 0 || !validNumber(r.Quantity) {
+		return errors.New("Quantity must be a positive number")
+	}
+
+	switch r.Type {
+	case TypeLimit:
+		if r.Price <= 0 || !validNumber(r.Price) {
+			return errors.New("Limit orders need a positive price")
+		}
+	case TypeMarket:
+		if r.Price != 0 {
+			return errors.New("Market orders cannot have a price")
+		}
+		if r.TimeInForce == TimeInForceGTC {
+			return errors.New("Market orders must be ioc or fok")
+		}
+	default:
+		return errors.New("Type must be limit or market")
+	}
+	return nil
+}
+
+// Matches reports whether a retried request describes the order that was
+// created for its client order ID the first time
+func (r *NewOrderRequest) Matches(o *Order) bool {
+	return r.Symbol == o.Symbol && r.Side == o.Side && r.Type == o.Type &&
+		r.TimeInForce == o.TimeInForce && r.Price == o.Price && r.Quantity == o.Quantity
+}
+
+func (r *ReplaceRequest) Validate(o *Order) error {
+	if r.Price == nil && r.Quantity == nil {
+		return errors.New("Replace needs a new price or quantity")
+	}
+	if o.Type != TypeLimit {
+		return errors.New("Only limit orders can be replaced")
+	}
+	if r.Price != nil && (*r.Price <= 0 || !validNumber(*r.Price)) {
+		return errors.New("Price must be a positive number")
+	}
+	if r.Quantity != nil && (*r.Quantity <= o.FilledQuantity || !validNumber(*r.Quantity)) {
+		return errors.New("Quantity must be greater than the filled quantity")
+	}
+	return nil
+}
+
+// IsOpen reports whether the order can still be cancelled or replaced
+func (o *Order) IsOpen() bool {
+	for _, status := range openStatuses {
+		if o.Status == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/consumer"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/rohanchavan1918/platform_apis/userevents"
+	"github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// ExecutionReport is published by the order processor whenever an order
+// changes. Sequence increases with every report of an order and carries the
+// full order state, so the latest report alone describes the order.
+type ExecutionReport struct {
+	OrderID        string    `json:"order_id"`
+	ClientOrderID  string    `json:"client_order_id"`
+	UserID         int64     `json:"user_id"`
+	Symbol         string    `json:"symbol"`
+	ExecType       string    `json:"exec_type"`
+	Status         string    `json:"status"`
+	Price          float64   `json:"price"`
+	Quantity       float64   `json:"quantity"`
+	FilledQuantity float64   `json:"filled_quantity"`
+	AvgFillPrice   float64   `json:"avg_fill_price"`
+	LastQuantity   float64   `json:"last_quantity"`
+	LastPrice      float64   `json:"last_price"`
+	Reason         string    `json:"reason"`
+	Sequence       int64     `json:"seq"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// ConsumeExecutionReports applies execution reports to the stored orders
+// until ctx is done
+func ConsumeExecutionReports(ctx context.Context, db *sql.DB, reader *kafka.Reader) {
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		logger := logging.ForMessage(ctx, msg)
+
+		var report ExecutionReport
+		if err := json.Unmarshal(msg.Value, &report); err != nil {
+			logger.WithError(err).Error("Skipping malformed execution report")
+			return nil
+		}
+		logger = logger.WithFields(log.Fields{
+			logging.FieldOrderID: report.OrderID,
+			logging.FieldSymbol:  report.Symbol,
+			"seq":                report.Sequence,
+		})
+		if report.OrderID == "" || report.Status == "" {
+			logger.Error("Skipping execution report without order id or status")
+			return nil
+		}
+		if report.Timestamp.IsZero() {
+			report.Timestamp = msg.Time
+		}
+
+		// Reports older than the stored state are not applied, so a retry
+		// after a failure further down does not apply one twice
+		_, span := tracing.Start(ctx, "applyReport")
+		applied, err := applyReport(db, &report)
+		if tracing.End(span, err) != nil {
+			return fmt.Errorf("cannot apply execution report : %w", err)
+		}
+		if applied {
+			logger.Infof("Order is %s after %s report", report.Status, report.ExecType)
+		}
+
+		key := fmt.Sprintf("order:%s:%d", report.OrderID, report.Sequence)
+		if _, err := userevents.Append(db, report.UserID, userevents.TypeOrder, key, report); err != nil {
+			return fmt.Errorf("cannot record order event : %w", err)
+		}
+		return nil
+	})
+}
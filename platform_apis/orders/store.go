@@ -0,0 +1,240 @@
+package orders
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const schema = `CREATE TABLE IF NOT EXISTS orders (
+	id VARCHAR(64) PRIMARY KEY,
+	client_order_id VARCHAR(64) NOT NULL,
+	user_id BIGINT NOT NULL,
+	symbol VARCHAR(32) NOT NULL,
+	side VARCHAR(8) NOT NULL,
+	type VARCHAR(16) NOT NULL,
+	time_in_force VARCHAR(8) NOT NULL,
+	price DECIMAL(24, 8) NOT NULL,
+	quantity DECIMAL(24, 8) NOT NULL,
+	filled_quantity DECIMAL(24, 8) NOT NULL DEFAULT 0,
+	avg_fill_price DECIMAL(24, 8) NOT NULL DEFAULT 0,
+	status VARCHAR(24) NOT NULL,
+	reject_reason VARCHAR(255) NOT NULL DEFAULT '',
+	last_report_seq BIGINT NOT NULL DEFAULT 0,
+	created_at DATETIME(6) NOT NULL,
+	updated_at DATETIME(6) NOT NULL,
+	UNIQUE KEY uq_orders_client_order_id (user_id, client_order_id),
+	INDEX idx_orders_user (user_id, created_at)
+)`
+
+const selectOrder = `SELECT id, client_order_id, user_id, symbol, side, type, time_in_force, price, quantity,
+	filled_quantity, avg_fill_price, status, reject_reason, created_at, updated_at FROM orders`
+
+func EnsureSchema(db *sql.DB) error {
+	// Create the orders table if it is not there yet
+	_, err := db.Exec(schema)
+	return err
+}
+
+// Filter narrows down a user's orders, zero values are ignored
+type Filter struct {
+	Symbol string
+	Side   string
+	Status []string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+func insert(db *sql.DB, o *Order) error {
+	_, err := db.Exec(
+		`INSERT INTO orders (id, client_order_id, user_id, symbol, side, type, time_in_force, price, quantity, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		o.ID, o.ClientOrderID, o.UserID, o.Symbol, o.Side, o.Type, o.TimeInForce, o.Price, o.Quantity, o.Status, o.CreatedAt, o.UpdatedAt,
+	)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		return ErrClientOrderIDReused
+	}
+	return err
+}
+
+// Get returns an order of the user
+func Get(db *sql.DB, userID int64, id string) (*Order, error) {
+	return getOne(db, selectOrder+" WHERE user_id = ? AND id = ?", userID, id)
+}
+
+// GetByClientOrderID returns the order the user placed with clientOrderID
+func GetByClientOrderID(db *sql.DB, userID int64, clientOrderID string) (*Order, error) {
+	return getOne(db, selectOrder+" WHERE user_id = ? AND client_order_id = ?", userID, clientOrderID)
+}
+
+// List returns a page of the user's orders, newest first, and the number of
+// orders matching the filter
+func List(db *sql.DB, userID int64, filter Filter) ([]Order, int, error) {
+	where := []string{"user_id = ?"}
+	args := []interface{}{userID}
+	if filter.Symbol != "" {
+		where = append(where, "symbol = ?")
+		args = append(args, filter.Symbol)
+	}
+	if filter.Side != "" {
+		where = append(where, "side = ?")
+		args = append(args, filter.Side)
+	}
+	if len(filter.Status) > 0 {
+		where = append(where, "status IN (?"+strings.Repeat(", ?", len(filter.Status)-1)+")")
+		for _, status := range filter.Status {
+			args = append(args, status)
+		}
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.To)
+	}
+	clause := " WHERE " + strings.Join(where, " AND ")
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM orders"+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(
+		selectOrder+clause+" ORDER BY created_at DESC, id LIMIT ? OFFSET ?",
+		append(args, filter.Limit, filter.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, *o)
+	}
+	return orders, total, rows.Err()
+}
+
+// ListOpen returns the user's orders on one side that can still trade,
+// including those waiting for a cancel or replace to go through
+func ListOpen(db *sql.DB, userID int64, side string) ([]Order, error) {
+	statuses := append([]interface{}{userID, side}, StatusPendingNew, StatusNew, StatusPartiallyFilled, StatusPendingCancel, StatusPendingReplace)
+	rows, err := db.Query(selectOrder+" WHERE user_id = ? AND side = ? AND status IN (?, ?, ?, ?, ?)", statuses...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *o)
+	}
+	return orders, rows.Err()
+}
+
+// setPendingStatus moves an open order to a pending status. It fails with
+// ErrNotOpen when an execution report closed the order first.
+func setPendingStatus(db *sql.DB, id, status string) error {
+	args := []interface{}{status, time.Now().UTC(), id}
+	for _, s := range openStatuses {
+		args = append(args, s)
+	}
+	res, err := db.Exec(
+		"UPDATE orders SET status = ?, updated_at = ? WHERE id = ? AND status IN (?"+strings.Repeat(", ?", len(openStatuses)-1)+")",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotOpen
+	}
+	return nil
+}
+
+// reopen puts an order that was rejected because it could not be published
+// back to pending_new. It returns false when the order is not in that state
+// anymore.
+func reopen(db *sql.DB, id string) (bool, error) {
+	res, err := db.Exec(
+		"UPDATE orders SET status = ?, reject_reason = '', updated_at = ? WHERE id = ? AND status = ? AND reject_reason = ? AND last_report_seq = 0",
+		StatusPendingNew, time.Now().UTC(), id, StatusRejected, ErrPublishFailed.Error(),
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func setStatus(db *sql.DB, id, status, reason string) error {
+	_, err := db.Exec(
+		"UPDATE orders SET status = ?, reject_reason = ?, updated_at = ? WHERE id = ?",
+		status, reason, time.Now().UTC(), id,
+	)
+	return err
+}
+
+// applyReport stores the order state carried by an execution report. Reports
+// older than the last applied one are ignored, so redelivered or reordered
+// messages cannot move an order backwards. It returns false for those.
+func applyReport(db *sql.DB, r *ExecutionReport) (bool, error) {
+	res, err := db.Exec(
+		`UPDATE orders SET status = ?, price = ?, quantity = ?, filled_quantity = ?, avg_fill_price = ?,
+		reject_reason = ?, last_report_seq = ?, updated_at = ? WHERE id = ? AND last_report_seq < ?`,
+		r.Status, r.Price, r.Quantity, r.FilledQuantity, r.AvgFillPrice, r.Reason, r.Sequence, r.Timestamp, r.OrderID, r.Sequence,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func getOne(db *sql.DB, query string, args ...interface{}) (*Order, error) {
+	o, err := scanOrder(db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return o, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOrder(row scanner) (*Order, error) {
+	o := &Order{}
+	err := row.Scan(&o.ID, &o.ClientOrderID, &o.UserID, &o.Symbol, &o.Side, &o.Type, &o.TimeInForce, &o.Price, &o.Quantity,
+		&o.FilledQuantity, &o.AvgFillPrice, &o.Status, &o.RejectReason, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
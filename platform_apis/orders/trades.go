@@ -0,0 +1,101 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/consumer"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/rohanchavan1918/platform_apis/userevents"
+	"github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// TradeFee is one side's charge as priced by the order processor's fee engine
+type TradeFee struct {
+	Amount  float64 `json:"amount"`
+	RateBps float64 `json:"rate_bps"`
+	Rebate  bool    `json:"rebate"`
+}
+
+// Trade is published by the order processor for every match
+type Trade struct {
+	TradeID     string  `json:"trade_id"`
+	Symbol      string  `json:"symbol"`
+	Price       float64 `json:"price"`
+	Quantity    float64 `json:"quantity"`
+	BuyOrderID  string  `json:"buy_order_id"`
+	SellOrderID string  `json:"sell_order_id"`
+	BuyUserID   int64   `json:"buy_user_id"`
+	SellUserID  int64   `json:"sell_user_id"`
+	MakerSide   string  `json:"maker_side"`
+	Fees        struct {
+		MakerFee TradeFee `json:"maker_fee"`
+		TakerFee TradeFee `json:"taker_fee"`
+	} `json:"fees"`
+	ExecutedAt time.Time `json:"executed_at"`
+}
+
+// Fill is one user's side of a trade
+type Fill struct {
+	TradeID    string    `json:"trade_id"`
+	OrderID    string    `json:"order_id"`
+	Symbol     string    `json:"symbol"`
+	Side       string    `json:"side"`
+	Price      float64   `json:"price"`
+	Quantity   float64   `json:"quantity"`
+	Liquidity  string    `json:"liquidity"`
+	Fee        TradeFee  `json:"fee"`
+	ExecutedAt time.Time `json:"executed_at"`
+}
+
+// Fills splits a trade into the buyer's and the seller's fill
+func (t *Trade) Fills() (buy Fill, sell Fill) {
+	buy = Fill{TradeID: t.TradeID, OrderID: t.BuyOrderID, Symbol: t.Symbol, Side: SideBuy, Price: t.Price, Quantity: t.Quantity, ExecutedAt: t.ExecutedAt}
+	sell = Fill{TradeID: t.TradeID, OrderID: t.SellOrderID, Symbol: t.Symbol, Side: SideSell, Price: t.Price, Quantity: t.Quantity, ExecutedAt: t.ExecutedAt}
+	if t.MakerSide == SideBuy {
+		buy.Liquidity, buy.Fee = "maker", t.Fees.MakerFee
+		sell.Liquidity, sell.Fee = "taker", t.Fees.TakerFee
+	} else {
+		buy.Liquidity, buy.Fee = "taker", t.Fees.TakerFee
+		sell.Liquidity, sell.Fee = "maker", t.Fees.MakerFee
+	}
+	return buy, sell
+}
+
+// ConsumeTrades turns every trade into a fill event for both counterparties
+// until ctx is done
+func ConsumeTrades(ctx context.Context, db *sql.DB, reader *kafka.Reader) {
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		logger := logging.ForMessage(ctx, msg)
+
+		var trade Trade
+		if err := json.Unmarshal(msg.Value, &trade); err != nil {
+			logger.WithError(err).Error("Skipping malformed trade")
+			return nil
+		}
+		logger = logger.WithFields(log.Fields{"trade_id": trade.TradeID, logging.FieldSymbol: trade.Symbol})
+		if trade.TradeID == "" {
+			logger.Error("Skipping trade without id")
+			return nil
+		}
+
+		buy, sell := trade.Fills()
+		for _, fill := range []struct {
+			userID int64
+			fill   Fill
+		}{{trade.BuyUserID, buy}, {trade.SellUserID, sell}} {
+			key := fmt.Sprintf("fill:%s:%s", trade.TradeID, fill.fill.Side)
+			_, span := tracing.Start(ctx, "userevents.Append")
+			_, err := userevents.Append(db, fill.userID, userevents.TypeFill, key, fill.fill)
+			if tracing.End(span, err) != nil {
+				return fmt.Errorf("cannot record fill event of order %s : %w", fill.fill.OrderID, err)
+			}
+		}
+		return nil
+	})
+}
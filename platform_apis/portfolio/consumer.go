@@ -0,0 +1,60 @@
+package portfolio
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rohanchavan1918/kse-common/consumer"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/rohanchavan1918/platform_apis/activity"
+	"github.com/rohanchavan1918/platform_apis/orders"
+	"github.com/segmentio/kafka-go"
+)
+
+// ConsumeTrades books both sides of every trade into the counterparties'
+// positions until ctx is done
+func ConsumeTrades(ctx context.Context, db *sql.DB, reader *kafka.Reader) {
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		logger := logging.ForMessage(ctx, msg)
+
+		var trade orders.Trade
+		if err := json.Unmarshal(msg.Value, &trade); err != nil {
+			logger.WithError(err).Error("Skipping malformed trade")
+			return nil
+		}
+		if trade.TradeID == "" {
+			logger.Error("Skipping trade without id")
+			return nil
+		}
+
+		// ApplyFill ignores fills it applied before, so a trade is retried
+		// as a whole
+		buy, sell := trade.Fills()
+		_, span := tracing.Start(ctx, "portfolio.ApplyFill")
+		if err := tracing.End(span, ApplyFill(db, trade.BuyUserID, buy)); err != nil {
+			return fmt.Errorf("cannot update position of user %d for trade %s : %w", trade.BuyUserID, trade.TradeID, err)
+		}
+		_, span = tracing.Start(ctx, "portfolio.ApplyFill")
+		if err := tracing.End(span, ApplyFill(db, trade.SellUserID, sell)); err != nil {
+			return fmt.Errorf("cannot update position of user %d for trade %s : %w", trade.SellUserID, trade.TradeID, err)
+		}
+		trackFill(trade.BuyUserID, buy)
+		trackFill(trade.SellUserID, sell)
+		return nil
+	})
+}
+
+// trackFill reports the fill to analytics, redelivered trades map to the
+// same event ID
+func trackFill(userID int64, f orders.Fill) {
+	activity.Emit(activity.NewSystem(userID, activity.TypeTradeExecuted, f.TradeID+":"+f.Side, f.ExecutedAt, map[string]interface{}{
+		"trade_id": f.TradeID,
+		"symbol":   f.Symbol,
+		"side":     f.Side,
+		"price":    f.Price,
+		"quantity": f.Quantity,
+	}))
+}
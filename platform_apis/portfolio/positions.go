@@ -0,0 +1,178 @@
+package portfolio
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/rohanchavan1918/kse-common/ledger"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/orders"
+)
+
+// Quantities closer to zero than this are treated as a flat position
+const epsilon = 1e-9
+
+// Position is a user's holding of one symbol. Quantity is negative for short
+// positions. AvgCost is the average price of the open quantity, fees are not
+// part of it but come off RealizedPnL as they are charged.
+type Position struct {
+	UserID      int64     `json:"user_id"`
+	Symbol      string    `json:"symbol"`
+	Quantity    float64   `json:"quantity"`
+	AvgCost     float64   `json:"avg_cost"`
+	RealizedPnL float64   `json:"realized_pnl"`
+	Fees        float64   `json:"fees"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+var schemas = []string{
+	`CREATE TABLE IF NOT EXISTS positions (
+		user_id BIGINT NOT NULL,
+		symbol VARCHAR(32) NOT NULL,
+		quantity DECIMAL(24, 8) NOT NULL,
+		avg_cost DECIMAL(24, 8) NOT NULL,
+		realized_pnl DECIMAL(24, 8) NOT NULL,
+		fees DECIMAL(24, 8) NOT NULL,
+		updated_at DATETIME(6) NOT NULL,
+		PRIMARY KEY (user_id, symbol)
+	)`,
+	`CREATE TABLE IF NOT EXISTS position_fills (
+		trade_id VARCHAR(64) NOT NULL,
+		side VARCHAR(8) NOT NULL,
+		user_id BIGINT NOT NULL,
+		applied_at DATETIME(6) NOT NULL,
+		PRIMARY KEY (trade_id, side)
+	)`,
+	`CREATE TABLE IF NOT EXISTS portfolio_snapshots (
+		user_id BIGINT NOT NULL,
+		day DATE NOT NULL,
+		equity DECIMAL(24, 8) NOT NULL,
+		market_value DECIMAL(24, 8) NOT NULL,
+		cost_basis DECIMAL(24, 8) NOT NULL,
+		realized_pnl DECIMAL(24, 8) NOT NULL,
+		unrealized_pnl DECIMAL(24, 8) NOT NULL,
+		updated_at DATETIME(6) NOT NULL,
+		PRIMARY KEY (user_id, day)
+	)`,
+}
+
+func EnsureSchema(db *sql.DB) error {
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply books a fill against the position with the average cost method.
+// Reducing a position realizes the difference to the average cost, going
+// through zero opens the other way at the fill price.
+func (p *Position) apply(f orders.Fill) {
+	delta := f.Quantity
+	if f.Side == orders.SideSell {
+		delta = -delta
+	}
+
+	if math.Abs(p.Quantity) < epsilon || (p.Quantity > 0) == (delta > 0) {
+		quantity := p.Quantity + delta
+		p.AvgCost = (math.Abs(p.Quantity)*p.AvgCost + f.Quantity*f.Price) / math.Abs(quantity)
+		p.Quantity = quantity
+	} else {
+		closed := math.Min(f.Quantity, math.Abs(p.Quantity))
+		direction := 1.0
+		if p.Quantity < 0 {
+			direction = -1
+		}
+		p.RealizedPnL += closed * (f.Price - p.AvgCost) * direction
+		p.Quantity += delta
+		if math.Abs(p.Quantity) < epsilon {
+			p.Quantity, p.AvgCost = 0, 0
+		} else if f.Quantity > closed {
+			p.AvgCost = f.Price
+		}
+	}
+
+	// Rebates are negative fees
+	p.Fees += f.Fee.Amount
+	p.RealizedPnL -= f.Fee.Amount
+	p.UpdatedAt = f.ExecutedAt
+}
+
+// ApplyFill updates the user's position with a fill and settles its cash,
+// buyers pay the notional and sellers receive it. The order processor
+// charges the fee to the same cash account, UserAccount in the shared
+// ledger. Every fill is applied once, redelivered trades are ignored.
+func ApplyFill(db *sql.DB, userID int64, f orders.Fill) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO position_fills (trade_id, side, user_id, applied_at) VALUES (?, ?, ?, ?)", f.TradeID, f.Side, userID, time.Now().UTC())
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	p := &Position{UserID: userID, Symbol: f.Symbol}
+	err = tx.QueryRow(
+		"SELECT quantity, avg_cost, realized_pnl, fees FROM positions WHERE user_id = ? AND symbol = ? FOR UPDATE", userID, f.Symbol,
+	).Scan(&p.Quantity, &p.AvgCost, &p.RealizedPnL, &p.Fees)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	p.apply(f)
+	if p.UpdatedAt.IsZero() {
+		p.UpdatedAt = time.Now().UTC()
+	}
+	_, err = tx.Exec(
+		`INSERT INTO positions (user_id, symbol, quantity, avg_cost, realized_pnl, fees, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE quantity = VALUES(quantity), avg_cost = VALUES(avg_cost), realized_pnl = VALUES(realized_pnl),
+		fees = VALUES(fees), updated_at = VALUES(updated_at)`,
+		p.UserID, p.Symbol, p.Quantity, p.AvgCost, p.RealizedPnL, p.Fees, p.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	from, to := ledger.UserAccount(userID), ledger.TradeSettlementAccount
+	if f.Side == orders.SideSell {
+		from, to = to, from
+	}
+	entries := ledger.Transfer(from, to, ledger.DefaultAsset, f.Quantity*f.Price, "trade", f.TradeID)
+	if err := ledger.PostTx(tx, utils.NewID(), entries); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListPositions returns every position the user ever held, closed ones
+// included since they still carry realized P&L
+func ListPositions(db *sql.DB, userID int64) ([]Position, error) {
+	rows, err := db.Query(
+		"SELECT user_id, symbol, quantity, avg_cost, realized_pnl, fees, updated_at FROM positions WHERE user_id = ? ORDER BY symbol", userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := []Position{}
+	for rows.Next() {
+		var p Position
+		if err := rows.Scan(&p.UserID, &p.Symbol, &p.Quantity, &p.AvgCost, &p.RealizedPnL, &p.Fees, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
@@ -0,0 +1,78 @@
+package portfolio
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Quote is the latest price the stock aggregator recorded for a symbol
+type Quote struct {
+	Price float64
+	At    time.Time
+}
+
+func placeholders(n int) string {
+	return "?" + strings.Repeat(", ?", n-1)
+}
+
+// LatestPrices reads the prices the stock aggregator keeps in stock_prices,
+// symbols it has not seen are missing from the result
+func LatestPrices(db *sql.DB, symbols []string) (map[string]Quote, error) {
+	quotes := map[string]Quote{}
+	if len(symbols) == 0 {
+		return quotes, nil
+	}
+	args := []interface{}{}
+	for _, symbol := range symbols {
+		args = append(args, symbol)
+	}
+
+	rows, err := db.Query("SELECT symbol, price, updated_at FROM stock_prices WHERE symbol IN ("+placeholders(len(symbols))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var symbol string
+		var q Quote
+		if err := rows.Scan(&symbol, &q.Price, &q.At); err != nil {
+			return nil, err
+		}
+		quotes[symbol] = q
+	}
+	return quotes, rows.Err()
+}
+
+// previousCloses returns the close of the last trading day before day
+func previousCloses(db *sql.DB, symbols []string, day time.Time) (map[string]float64, error) {
+	closes := map[string]float64{}
+	if len(symbols) == 0 {
+		return closes, nil
+	}
+	args := []interface{}{}
+	for _, symbol := range symbols {
+		args = append(args, symbol)
+	}
+	args = append(args, day.Format("2006-01-02"))
+
+	rows, err := db.Query(
+		`SELECT d.symbol, d.close FROM stock_daily_prices d JOIN (
+			SELECT symbol, MAX(day) AS day FROM stock_daily_prices WHERE symbol IN (`+placeholders(len(symbols))+`) AND day < ? GROUP BY symbol
+		) last ON d.symbol = last.symbol AND d.day = last.day`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var symbol string
+		var close float64
+		if err := rows.Scan(&symbol, &close); err != nil {
+			return nil, err
+		}
+		closes[symbol] = close
+	}
+	return closes, rows.Err()
+}
@@ -0,0 +1,100 @@
+package portfolio
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/utils"
+)
+
+// Snapshot is one point of a user's equity curve, the portfolio as it was
+// valued last on that day
+type Snapshot struct {
+	Day           string    `json:"day"`
+	Equity        float64   `json:"equity"`
+	MarketValue   float64   `json:"market_value"`
+	CostBasis     float64   `json:"cost_basis"`
+	RealizedPnL   float64   `json:"realized_pnl"`
+	UnrealizedPnL float64   `json:"unrealized_pnl"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TakeSnapshots values every user with positions or transfers and stores the result as
+// today's snapshot. Later runs of the same day overwrite it, so the last run
+// of a day ends up as its close.
+func TakeSnapshots(db *sql.DB, now time.Time) error {
+	rows, err := db.Query("SELECT user_id FROM positions UNION SELECT user_id FROM transfers")
+	if err != nil {
+		return err
+	}
+	userIDs := []int64{}
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now = now.UTC()
+	for _, userID := range userIDs {
+		v, err := Value(db, userID, now)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(
+			`INSERT INTO portfolio_snapshots (user_id, day, equity, market_value, cost_basis, realized_pnl, unrealized_pnl, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE equity = VALUES(equity), market_value = VALUES(market_value), cost_basis = VALUES(cost_basis),
+			realized_pnl = VALUES(realized_pnl), unrealized_pnl = VALUES(unrealized_pnl), updated_at = VALUES(updated_at)`,
+			userID, now.Format("2006-01-02"), v.Totals.Equity, v.Totals.MarketValue, v.Totals.CostBasis,
+			v.Totals.RealizedPnL, v.Totals.UnrealizedPnL, now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunSnapshots takes snapshots every interval, it never returns
+func RunSnapshots(db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := TakeSnapshots(db, time.Now()); err != nil {
+			utils.LogError("Failed to take portfolio snapshots : %s", err)
+		}
+	}
+}
+
+// History returns the user's equity curve between from and to, both days
+// included, oldest first
+func History(db *sql.DB, userID int64, from, to time.Time) ([]Snapshot, error) {
+	rows, err := db.Query(
+		`SELECT day, equity, market_value, cost_basis, realized_pnl, unrealized_pnl, updated_at FROM portfolio_snapshots
+		WHERE user_id = ? AND day >= ? AND day <= ? ORDER BY day`,
+		userID, from.Format("2006-01-02"), to.Format("2006-01-02"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []Snapshot{}
+	for rows.Next() {
+		var s Snapshot
+		var day time.Time
+		if err := rows.Scan(&day, &s.Equity, &s.MarketValue, &s.CostBasis, &s.RealizedPnL, &s.UnrealizedPnL, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		s.Day = day.Format("2006-01-02")
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
@@ -0,0 +1,125 @@
+package portfolio
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/ledger"
+)
+
+// PositionValue is an open position valued at the latest price. Priced is
+// false when the aggregator has no price for the symbol yet, the position is
+// then valued at its average cost.
+type PositionValue struct {
+	Symbol         string     `json:"symbol"`
+	Quantity       float64    `json:"quantity"`
+	AvgCost        float64    `json:"avg_cost"`
+	CostBasis      float64    `json:"cost_basis"`
+	Price          float64    `json:"price"`
+	PriceAt        *time.Time `json:"price_at"`
+	Priced         bool       `json:"priced"`
+	MarketValue    float64    `json:"market_value"`
+	UnrealizedPnL  float64    `json:"unrealized_pnl"`
+	UnrealizedPct  float64    `json:"unrealized_pnl_pct"`
+	RealizedPnL    float64    `json:"realized_pnl"`
+	PreviousClose  *float64   `json:"previous_close"`
+	DailyChange    float64    `json:"daily_change"`
+	DailyChangePct float64    `json:"daily_change_pct"`
+}
+
+// Totals sum up the whole portfolio. RealizedPnL includes closed positions,
+// Equity is cash plus the market value of the positions.
+type Totals struct {
+	Equity         float64 `json:"equity"`
+	Cash           float64 `json:"cash"`
+	MarketValue    float64 `json:"market_value"`
+	CostBasis      float64 `json:"cost_basis"`
+	UnrealizedPnL  float64 `json:"unrealized_pnl"`
+	RealizedPnL    float64 `json:"realized_pnl"`
+	TotalPnL       float64 `json:"total_pnl"`
+	Fees           float64 `json:"fees"`
+	DailyChange    float64 `json:"daily_change"`
+	DailyChangePct float64 `json:"daily_change_pct"`
+}
+
+type Valuation struct {
+	Positions []PositionValue `json:"positions"`
+	Totals    Totals          `json:"totals"`
+	AsOf      time.Time       `json:"as_of"`
+}
+
+func pct(part, whole float64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return part / math.Abs(whole) * 100
+}
+
+// Value prices the user's positions at the latest aggregated prices. Daily
+// change is measured against the previous day's close.
+func Value(db *sql.DB, userID int64, now time.Time) (*Valuation, error) {
+	positions, err := ListPositions(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := []string{}
+	for _, p := range positions {
+		if p.Quantity != 0 {
+			symbols = append(symbols, p.Symbol)
+		}
+	}
+	quotes, err := LatestPrices(db, symbols)
+	if err != nil {
+		return nil, err
+	}
+	closes, err := previousCloses(db, symbols, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Valuation{Positions: []PositionValue{}, AsOf: now.UTC()}
+	for _, p := range positions {
+		v.Totals.RealizedPnL += p.RealizedPnL
+		v.Totals.Fees += p.Fees
+		if p.Quantity == 0 {
+			continue
+		}
+
+		pv := PositionValue{
+			Symbol:      p.Symbol,
+			Quantity:    p.Quantity,
+			AvgCost:     p.AvgCost,
+			CostBasis:   p.Quantity * p.AvgCost,
+			Price:       p.AvgCost,
+			RealizedPnL: p.RealizedPnL,
+		}
+		if q, ok := quotes[p.Symbol]; ok {
+			at := q.At
+			pv.Price, pv.PriceAt, pv.Priced = q.Price, &at, true
+		}
+		pv.MarketValue = p.Quantity * pv.Price
+		pv.UnrealizedPnL = pv.MarketValue - pv.CostBasis
+		pv.UnrealizedPct = pct(pv.UnrealizedPnL, pv.CostBasis)
+		if close, ok := closes[p.Symbol]; ok && pv.Priced {
+			previous := close
+			pv.PreviousClose = &previous
+			pv.DailyChange = p.Quantity * (pv.Price - close)
+			pv.DailyChangePct = pct(pv.Price-close, close)
+		}
+
+		v.Totals.MarketValue += pv.MarketValue
+		v.Totals.CostBasis += pv.CostBasis
+		v.Totals.UnrealizedPnL += pv.UnrealizedPnL
+		v.Totals.DailyChange += pv.DailyChange
+		v.Positions = append(v.Positions, pv)
+	}
+	if v.Totals.Cash, err = ledger.Balance(db, ledger.UserAccount(userID), ledger.DefaultAsset); err != nil {
+		return nil, err
+	}
+	v.Totals.Equity = v.Totals.Cash + v.Totals.MarketValue
+	v.Totals.TotalPnL = v.Totals.RealizedPnL + v.Totals.UnrealizedPnL
+	v.Totals.DailyChangePct = pct(v.Totals.DailyChange, v.Totals.MarketValue-v.Totals.DailyChange)
+	return v, nil
+}
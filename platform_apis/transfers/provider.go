@@ -0,0 +1,69 @@
+package transfers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// Result is the outcome of a transfer as reported by the payment provider
+type Result struct {
+	Succeeded bool
+	Reason    string
+}
+
+// PaymentProvider moves money between users' bank accounts and the
+// exchange. Providers work asynchronously: Submit only hands the transfer
+// over, the outcome is picked up later through Status.
+type PaymentProvider interface {
+	Name() string
+	// Submit hands the transfer to the provider and returns its reference
+	// for it. Submitting the same transfer again must not move money twice.
+	// Errors wrapping ErrProviderRejected are final, anything else is
+	// retried.
+	Submit(t *Transfer) (string, error)
+	// Status returns the outcome of a submitted transfer, nil while the
+	// provider is still working on it
+	Status(t *Transfer) (*Result, error)
+}
+
+// FakeProvider simulates a payment provider for local setups. Outcomes are
+// derived from the transfer ID, so they survive restarts and every instance
+// agrees on them without shared state.
+type FakeProvider struct {
+	MinDelay    time.Duration
+	MaxDelay    time.Duration
+	FailureRate float64
+	MaxAmount   float64
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Submit(t *Transfer) (string, error) {
+	if p.MaxAmount > 0 && t.Amount > p.MaxAmount {
+		return "", fmt.Errorf("%w: amount is above the provider limit of %g", ErrProviderRejected, p.MaxAmount)
+	}
+	return "fake_" + t.ID, nil
+}
+
+func (p *FakeProvider) Status(t *Transfer) (*Result, error) {
+	h := fnv.New64a()
+	h.Write([]byte(t.ID))
+	sum := h.Sum64()
+
+	delay := p.MinDelay
+	if span := p.MaxDelay - p.MinDelay; span > 0 {
+		delay += time.Duration(sum % uint64(span))
+	}
+	// UpdatedAt is when the transfer was submitted
+	if time.Since(t.UpdatedAt) < delay {
+		return nil, nil
+	}
+
+	if float64((sum>>32)%10000)/10000 < p.FailureRate {
+		return &Result{Succeeded: false, Reason: "Declined by the bank"}, nil
+	}
+	return &Result{Succeeded: true}, nil
+}
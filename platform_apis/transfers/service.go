@@ -0,0 +1,312 @@
+package transfers
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/ledger"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/platform_apis/activity"
+	"github.com/rohanchavan1918/platform_apis/conf"
+	"github.com/rohanchavan1918/platform_apis/orders"
+	"github.com/rohanchavan1918/platform_apis/portfolio"
+)
+
+// Transfers stuck in pending this long are submitted again by the
+// reconciler, an instance probably died right after creating them
+const resubmitAfter = 30 * time.Second
+
+var DefaultProvider PaymentProvider
+
+// Request is what a user sends to deposit or withdraw
+type Request struct {
+	ClientTransferID string  `json:"client_transfer_id"`
+	Amount           float64 `json:"amount" binding:"required"`
+}
+
+func (r *Request) Validate() error {
+	r.ClientTransferID = strings.TrimSpace(r.ClientTransferID)
+	if len(r.ClientTransferID) > 64 {
+		return errors.New("client_transfer_id cannot be longer than 64 characters")
+	}
+	if r.Amount <= 0 || math.IsNaN(r.Amount) || math.IsInf(r.Amount, 0) {
+		return errors.New("Amount must be a positive number")
+	}
+	if math.Abs(r.Amount*100-math.Round(r.Amount*100)) > 1e-6 {
+		return errors.New("Amount cannot have more than 2 decimals")
+	}
+	if minAmount := conf.AppConfig().Payments.MinAmount; minAmount > 0 && r.Amount < minAmount {
+		return errors.New("Amount is below the minimum transfer amount")
+	}
+	if maxAmount := conf.AppConfig().Payments.MaxAmount; maxAmount > 0 && r.Amount > maxAmount {
+		return errors.New("Amount is above the maximum transfer amount")
+	}
+	return nil
+}
+
+// Balance is a user's cash split up by what it can be used for
+type Balance struct {
+	Asset             string  `json:"asset"`
+	Cash              float64 `json:"cash"`
+	PendingDeposits   float64 `json:"pending_deposits"`
+	WithdrawalHolds   float64 `json:"withdrawal_holds"`
+	ReservedForOrders float64 `json:"reserved_for_orders"`
+	Available         float64 `json:"available"`
+}
+
+// reservedForOrders is what the user's open buy orders can still spend.
+// Market orders have no price of their own, they are reserved at the latest
+// aggregated price.
+func reservedForOrders(db *sql.DB, userID int64) (float64, error) {
+	open, err := orders.ListOpen(db, userID, orders.SideBuy)
+	if err != nil {
+		return 0, err
+	}
+	symbols := []string{}
+	for _, o := range open {
+		if o.Type == orders.TypeMarket {
+			symbols = append(symbols, o.Symbol)
+		}
+	}
+	quotes, err := portfolio.LatestPrices(db, symbols)
+	if err != nil {
+		return 0, err
+	}
+
+	reserved := 0.0
+	for _, o := range open {
+		price := o.Price
+		if o.Type == orders.TypeMarket {
+			price = quotes[o.Symbol].Price
+		}
+		reserved += (o.Quantity - o.FilledQuantity) * price
+	}
+	return reserved, nil
+}
+
+// Balances returns the user's cash position
+func Balances(db *sql.DB, userID int64) (*Balance, error) {
+	b := &Balance{Asset: ledger.DefaultAsset}
+	var err error
+	if b.Cash, err = ledger.Balance(db, ledger.UserAccount(userID), b.Asset); err != nil {
+		return nil, err
+	}
+	if b.PendingDeposits, err = ledger.Balance(db, ledger.PendingDepositsAccount(userID), b.Asset); err != nil {
+		return nil, err
+	}
+	if b.WithdrawalHolds, err = ledger.Balance(db, ledger.WithdrawalHoldsAccount(userID), b.Asset); err != nil {
+		return nil, err
+	}
+	if b.ReservedForOrders, err = reservedForOrders(db, userID); err != nil {
+		return nil, err
+	}
+	b.Available = math.Max(b.Cash-b.ReservedForOrders, 0)
+	return b, nil
+}
+
+// Create stores a new transfer and submits it to the provider. Deposits are
+// booked as pending until the provider confirms them. Withdrawals put the
+// amount on hold right away and are refused when it would dip into cash
+// reserved for open orders. Retrying with the same client transfer ID
+// returns the existing transfer with created false.
+func Create(db *sql.DB, provider PaymentProvider, userID int64, transferType string, req Request) (*Transfer, bool, error) {
+	if req.ClientTransferID != "" {
+		existing, err := GetByClientTransferID(db, userID, req.ClientTransferID)
+		if err == nil {
+			if existing.Type != transferType || existing.Amount != req.Amount {
+				return nil, false, ErrClientTransferIDReused
+			}
+			return existing, false, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, false, err
+		}
+	}
+
+	now := time.Now().UTC()
+	t := &Transfer{
+		ID:               "tr_" + utils.NewID(),
+		ClientTransferID: req.ClientTransferID,
+		UserID:           userID,
+		Type:             transferType,
+		Asset:            ledger.DefaultAsset,
+		Amount:           req.Amount,
+		Status:           StatusPending,
+		Provider:         provider.Name(),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if t.ClientTransferID == "" {
+		t.ClientTransferID = t.ID
+	}
+
+	// Open orders are not locked, reading them first keeps the transaction
+	// short
+	var reserved float64
+	if transferType == TypeWithdrawal {
+		var err error
+		if reserved, err = reservedForOrders(db, userID); err != nil {
+			return nil, false, err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	// Serializes the transfers of a user, two withdrawals cannot both spend
+	// the same cash
+	var locked int64
+	if err := tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Scan(&locked); err != nil {
+		return nil, false, err
+	}
+
+	var entries []ledger.Entry
+	if transferType == TypeWithdrawal {
+		cash, err := ledger.Balance(tx, ledger.UserAccount(userID), t.Asset)
+		if err != nil {
+			return nil, false, err
+		}
+		if cash-reserved < t.Amount-1e-9 {
+			return nil, false, ErrInsufficientFunds
+		}
+		entries = ledger.Transfer(ledger.UserAccount(userID), ledger.WithdrawalHoldsAccount(userID), t.Asset, t.Amount, TypeWithdrawal, t.ID)
+	} else {
+		entries = ledger.Transfer(ledger.PaymentClearingAccount, ledger.PendingDepositsAccount(userID), t.Asset, t.Amount, TypeDeposit, t.ID)
+	}
+
+	if err := insert(tx, t); err != nil {
+		return nil, false, err
+	}
+	if err := ledger.PostTx(tx, utils.NewID(), entries); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	if err := submit(db, provider, t); err != nil {
+		// The transfer exists, the reconciler submits it again later
+		utils.LogError("Failed to submit transfer %s : %s", t.ID, err)
+	}
+	return t, true, nil
+}
+
+// submit hands a pending transfer to the provider and moves it to
+// processing, or fails it when the provider rejects it
+func submit(db *sql.DB, provider PaymentProvider, t *Transfer) error {
+	reference, err := provider.Submit(t)
+	if errors.Is(err, ErrProviderRejected) {
+		return settle(db, t, Result{Succeeded: false, Reason: err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := setStatus(tx, t, StatusProcessing, reference, "", time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// settle applies the provider's outcome together with its ledger posting.
+// Completed deposits become cash, failed ones are reversed. Completed
+// withdrawals leave through the clearing account, failed ones release the
+// hold back to cash.
+func settle(db *sql.DB, t *Transfer, result Result) error {
+	to := StatusCompleted
+	if !result.Succeeded {
+		to = StatusFailed
+	}
+
+	var entries []ledger.Entry
+	switch {
+	case t.Type == TypeDeposit && result.Succeeded:
+		entries = ledger.Transfer(ledger.PendingDepositsAccount(t.UserID), ledger.UserAccount(t.UserID), t.Asset, t.Amount, TypeDeposit, t.ID)
+	case t.Type == TypeDeposit:
+		entries = ledger.Transfer(ledger.PendingDepositsAccount(t.UserID), ledger.PaymentClearingAccount, t.Asset, t.Amount, TypeDeposit, t.ID)
+	case result.Succeeded:
+		entries = ledger.Transfer(ledger.WithdrawalHoldsAccount(t.UserID), ledger.PaymentClearingAccount, t.Asset, t.Amount, TypeWithdrawal, t.ID)
+	default:
+		entries = ledger.Transfer(ledger.WithdrawalHoldsAccount(t.UserID), ledger.UserAccount(t.UserID), t.Asset, t.Amount, TypeWithdrawal, t.ID)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := setStatus(tx, t, to, "", result.Reason, time.Now().UTC()); err != nil {
+		return err
+	}
+	if err := ledger.PostTx(tx, utils.NewID(), entries); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if result.Succeeded {
+		eventType := activity.TypeDepositCompleted
+		if t.Type == TypeWithdrawal {
+			eventType = activity.TypeWithdrawalCompleted
+		}
+		activity.Emit(activity.NewSystem(t.UserID, eventType, t.ID, t.UpdatedAt, map[string]interface{}{
+			"transfer_id": t.ID,
+			"asset":       t.Asset,
+			"amount":      t.Amount,
+		}))
+	}
+	return nil
+}
+
+// Reconcile drives in flight transfers forward every interval, it never
+// returns. Pending transfers are submitted again and processing ones are
+// settled once the provider knows their outcome. Every step is a compare
+// and set on the status, so several instances can run it at once.
+func Reconcile(db *sql.DB, provider PaymentProvider, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now().UTC()
+
+		pending, err := listInFlight(db, StatusPending, now.Add(-resubmitAfter), 100)
+		if err != nil {
+			utils.LogError("Failed to load pending transfers : %s", err)
+		}
+		for i := range pending {
+			if err := submit(db, provider, &pending[i]); err != nil && !errors.Is(err, errTransitionAlreadyApplied) {
+				utils.LogError("Failed to submit transfer %s : %s", pending[i].ID, err)
+			}
+		}
+
+		processing, err := listInFlight(db, StatusProcessing, now, 100)
+		if err != nil {
+			utils.LogError("Failed to load processing transfers : %s", err)
+		}
+		for i := range processing {
+			t := &processing[i]
+			result, err := provider.Status(t)
+			if err != nil {
+				utils.LogError("Failed to check transfer %s with %s : %s", t.ID, provider.Name(), err)
+				continue
+			}
+			if result == nil {
+				continue
+			}
+			if err := settle(db, t, *result); err != nil && !errors.Is(err, errTransitionAlreadyApplied) {
+				utils.LogError("Failed to settle transfer %s : %s", t.ID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package transfers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	TypeDeposit    = "deposit"
+	TypeWithdrawal = "withdrawal"
+)
+
+// Transfer states. A transfer is created pending, becomes processing once
+// the payment provider accepted it and ends up completed or failed when the
+// provider reports the outcome.
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+)
+
+// transitions lists the states every state can move to
+var transitions = map[string][]string{
+	StatusPending:    {StatusProcessing, StatusFailed},
+	StatusProcessing: {StatusCompleted, StatusFailed},
+}
+
+func canTransition(from, to string) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrNotFound                 = errors.New("Transfer not found")
+	ErrInsufficientFunds        = errors.New("Insufficient available balance for this withdrawal")
+	ErrClientTransferIDReused   = errors.New("client_transfer_id was already used for a different transfer")
+	ErrInvalidTransition        = errors.New("Transfer cannot move to this state")
+	ErrProviderRejected         = errors.New("Payment provider rejected the transfer")
+	errTransitionAlreadyApplied = errors.New("transfer is no longer in the expected state")
+)
+
+// InvalidRequestError is returned when the transfer request itself is at
+// fault
+type InvalidRequestError struct {
+	Err error
+}
+
+func (e *InvalidRequestError) Error() string {
+	return e.Err.Error()
+}
+
+type Transfer struct {
+	ID                string     `json:"id"`
+	ClientTransferID  string     `json:"client_transfer_id"`
+	UserID            int64      `json:"user_id"`
+	Type              string     `json:"type"`
+	Asset             string     `json:"asset"`
+	Amount            float64    `json:"amount"`
+	Status            string     `json:"status"`
+	Provider          string     `json:"provider"`
+	ProviderReference string     `json:"provider_reference,omitempty"`
+	FailureReason     string     `json:"failure_reason,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	CompletedAt       *time.Time `json:"completed_at"`
+}
+
+// Event records one state change of a transfer
+type Event struct {
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+var schemas = []string{
+	`CREATE TABLE IF NOT EXISTS transfers (
+		id VARCHAR(64) PRIMARY KEY,
+		client_transfer_id VARCHAR(64) NOT NULL,
+		user_id BIGINT NOT NULL,
+		type VARCHAR(16) NOT NULL,
+		asset VARCHAR(16) NOT NULL,
+		amount DECIMAL(24, 8) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		provider VARCHAR(32) NOT NULL,
+		provider_reference VARCHAR(128) NOT NULL DEFAULT '',
+		failure_reason VARCHAR(255) NOT NULL DEFAULT '',
+		created_at DATETIME(6) NOT NULL,
+		updated_at DATETIME(6) NOT NULL,
+		completed_at DATETIME(6) NULL,
+		UNIQUE KEY uq_transfers_client_id (user_id, client_transfer_id),
+		INDEX idx_transfers_user (user_id, created_at),
+		INDEX idx_transfers_status (status, updated_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS transfer_events (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		transfer_id VARCHAR(64) NOT NULL,
+		from_status VARCHAR(16) NOT NULL,
+		to_status VARCHAR(16) NOT NULL,
+		reason VARCHAR(255) NOT NULL DEFAULT '',
+		created_at DATETIME(6) NOT NULL,
+		INDEX idx_transfer_events_transfer (transfer_id, id)
+	)`,
+}
+
+const selectTransfer = `SELECT id, client_transfer_id, user_id, type, asset, amount, status, provider, provider_reference,
+	failure_reason, created_at, updated_at, completed_at FROM transfers`
+
+func EnsureSchema(db *sql.DB) error {
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insert(tx *sql.Tx, t *Transfer) error {
+	_, err := tx.Exec(
+		`INSERT INTO transfers (id, client_transfer_id, user_id, type, asset, amount, status, provider, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.ClientTransferID, t.UserID, t.Type, t.Asset, t.Amount, t.Status, t.Provider, t.CreatedAt, t.UpdatedAt,
+	)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		return ErrClientTransferIDReused
+	}
+	if err != nil {
+		return err
+	}
+	return recordEvent(tx, t.ID, "", t.Status, "", t.CreatedAt)
+}
+
+// setStatus moves a transfer from one state to another within tx. It fails
+// with errTransitionAlreadyApplied when the transfer is not in from anymore,
+// which happens when another instance settled it first.
+func setStatus(tx *sql.Tx, t *Transfer, to, reference, reason string, at time.Time) error {
+	if !canTransition(t.Status, to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, t.Status, to)
+	}
+
+	var completedAt interface{}
+	if to == StatusCompleted || to == StatusFailed {
+		completedAt = at
+	}
+	res, err := tx.Exec(
+		`UPDATE transfers SET status = ?, provider_reference = IF(? = '', provider_reference, ?), failure_reason = ?,
+		updated_at = ?, completed_at = ? WHERE id = ? AND status = ?`,
+		to, reference, reference, reason, at, completedAt, t.ID, t.Status,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errTransitionAlreadyApplied
+	}
+	if err := recordEvent(tx, t.ID, t.Status, to, reason, at); err != nil {
+		return err
+	}
+
+	t.Status, t.FailureReason, t.UpdatedAt = to, reason, at
+	if reference != "" {
+		t.ProviderReference = reference
+	}
+	if completedAt != nil {
+		t.CompletedAt = &at
+	}
+	return nil
+}
+
+func recordEvent(tx *sql.Tx, transferID, from, to, reason string, at time.Time) error {
+	_, err := tx.Exec(
+		"INSERT INTO transfer_events (transfer_id, from_status, to_status, reason, created_at) VALUES (?, ?, ?, ?, ?)",
+		transferID, from, to, reason, at,
+	)
+	return err
+}
+
+// Get returns a transfer of the user
+func Get(db *sql.DB, userID int64, id string) (*Transfer, error) {
+	return getOne(db, selectTransfer+" WHERE user_id = ? AND id = ?", userID, id)
+}
+
+// GetByClientTransferID returns the transfer the user created with
+// clientTransferID
+func GetByClientTransferID(db *sql.DB, userID int64, clientTransferID string) (*Transfer, error) {
+	return getOne(db, selectTransfer+" WHERE user_id = ? AND client_transfer_id = ?", userID, clientTransferID)
+}
+
+// List returns a page of the user's transfers, newest first. Empty type and
+// status match everything.
+func List(db *sql.DB, userID int64, transferType, status string, limit, offset int) ([]Transfer, error) {
+	query, args := selectTransfer+" WHERE user_id = ?", []interface{}{userID}
+	if transferType != "" {
+		query += " AND type = ?"
+		args = append(args, transferType)
+	}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	return list(db, query+" ORDER BY created_at DESC, id LIMIT ? OFFSET ?", append(args, limit, offset)...)
+}
+
+// Events returns the state changes of a transfer, oldest first
+func Events(db *sql.DB, transferID string) ([]Event, error) {
+	rows, err := db.Query("SELECT from_status, to_status, reason, created_at FROM transfer_events WHERE transfer_id = ? ORDER BY id", transferID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.FromStatus, &e.ToStatus, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// listInFlight returns transfers in status that were last updated before
+// cutoff
+func listInFlight(db *sql.DB, status string, cutoff time.Time, limit int) ([]Transfer, error) {
+	return list(db, selectTransfer+" WHERE status = ? AND updated_at < ? ORDER BY updated_at LIMIT ?", status, cutoff, limit)
+}
+
+func list(db *sql.DB, query string, args ...interface{}) ([]Transfer, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []Transfer{}
+	for rows.Next() {
+		t, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, *t)
+	}
+	return transfers, rows.Err()
+}
+
+func getOne(db *sql.DB, query string, args ...interface{}) (*Transfer, error) {
+	t, err := scanTransfer(db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return t, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTransfer(row scanner) (*Transfer, error) {
+	t := &Transfer{}
+	var completedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.ClientTransferID, &t.UserID, &t.Type, &t.Asset, &t.Amount, &t.Status, &t.Provider, &t.ProviderReference,
+		&t.FailureReason, &t.CreatedAt, &t.UpdatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		t.CompletedAt = &completedAt.Time
+	}
+	return t, nil
+}
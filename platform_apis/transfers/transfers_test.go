@@ -0,0 +1,219 @@
+package transfers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/rohanchavan1918/kse-common/ledger"
+	"github.com/rohanchavan1918/platform_apis/orders"
+)
+
+func newMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return db, mock
+}
+
+var (
+	updateTransfer = regexp.QuoteMeta("UPDATE transfers SET status = ?")
+	insertEvent    = regexp.QuoteMeta("INSERT INTO transfer_events")
+	insertEntry    = regexp.QuoteMeta("INSERT INTO ledger_entries")
+)
+
+// expectTransition expects the compare and set of a transfer from one state
+// to another and the event recording it
+func expectTransition(mock sqlmock.Sqlmock, id, from, to string) {
+	mock.ExpectExec(updateTransfer).
+		WithArgs(to, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), id, from).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertEvent).WithArgs(id, from, to, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// expectPosting expects amount to move from one account to another, which
+// keeps the posting balanced
+func expectPosting(mock sqlmock.Sqlmock, from, to string, amount float64, kind string, reference driver.Value) {
+	for _, leg := range []struct {
+		account string
+		amount  float64
+	}{{from, -amount}, {to, amount}} {
+		mock.ExpectExec(insertEntry).
+			WithArgs(sqlmock.AnyArg(), leg.account, ledger.DefaultAsset, leg.amount, kind, reference, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+}
+
+func TestSetStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to string
+		legal    bool
+	}{
+		{StatusPending, StatusProcessing, true},
+		{StatusPending, StatusFailed, true},
+		{StatusProcessing, StatusCompleted, true},
+		{StatusProcessing, StatusFailed, true},
+		{StatusPending, StatusCompleted, false},
+		{StatusProcessing, StatusPending, false},
+		{StatusCompleted, StatusFailed, false},
+		{StatusCompleted, StatusProcessing, false},
+		{StatusFailed, StatusCompleted, false},
+		{StatusFailed, StatusPending, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			db, mock := newMock(t)
+			mock.ExpectBegin()
+			if tt.legal {
+				expectTransition(mock, "tr_1", tt.from, tt.to)
+			}
+			mock.ExpectRollback()
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+			transfer := &Transfer{ID: "tr_1", Status: tt.from}
+			err = setStatus(tx, transfer, tt.to, "", "", time.Now().UTC())
+			if tt.legal {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if transfer.Status != tt.to {
+					t.Errorf("status %s, want %s", transfer.Status, tt.to)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidTransition) {
+				t.Errorf("error %v, want %v", err, ErrInvalidTransition)
+			}
+			if transfer.Status != tt.from {
+				t.Errorf("status moved to %s", transfer.Status)
+			}
+		})
+	}
+}
+
+func TestSetStatusAlreadyApplied(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(updateTransfer).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := setStatus(tx, &Transfer{ID: "tr_1", Status: StatusPending}, StatusProcessing, "ref", "", time.Now()); !errors.Is(err, errTransitionAlreadyApplied) {
+		t.Errorf("error %v, want %v", err, errTransitionAlreadyApplied)
+	}
+}
+
+// provider accepts every transfer and never settles one
+type provider struct{}
+
+func (provider) Name() string                        { return "test" }
+func (provider) Submit(t *Transfer) (string, error)  { return "ref_" + t.ID, nil }
+func (provider) Status(t *Transfer) (*Result, error) { return nil, nil }
+
+func TestWithdrawalHold(t *testing.T) {
+	orderColumns := []string{"id", "client_order_id", "user_id", "symbol", "side", "type", "time_in_force", "price", "quantity",
+		"filled_quantity", "avg_fill_price", "status", "reject_reason", "created_at", "updated_at"}
+	now := time.Now().UTC()
+
+	// 1000 in cash, 6 x 50 left on a limit buy and 2 market buys at the
+	// latest price of 100 are reserved, so 500 can be withdrawn
+	tests := []struct {
+		name   string
+		amount float64
+		err    error
+	}{
+		{"within available cash", 500, nil},
+		{"into reserved cash", 500.01, ErrInsufficientFunds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock(t)
+			mock.ExpectQuery(regexp.QuoteMeta("FROM orders WHERE user_id = ? AND side = ?")).WithArgs(
+				int64(7), orders.SideBuy, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			).WillReturnRows(sqlmock.NewRows(orderColumns).
+				AddRow("o-1", "o-1", int64(7), "KSE", orders.SideBuy, orders.TypeLimit, "gtc", 50.0, 10.0, 4.0, 50.0, orders.StatusPartiallyFilled, "", now, now).
+				AddRow("o-2", "o-2", int64(7), "ABC", orders.SideBuy, orders.TypeMarket, "ioc", 0.0, 2.0, 0.0, 0.0, orders.StatusNew, "", now, now))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT symbol, price, updated_at FROM stock_prices")).WithArgs("ABC").
+				WillReturnRows(sqlmock.NewRows([]string{"symbol", "price", "updated_at"}).AddRow("ABC", 100.0, now))
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM users WHERE id = ? FOR UPDATE")).WithArgs(int64(7)).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(7)))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT SUM(amount) FROM ledger_entries")).WithArgs(ledger.UserAccount(7), ledger.DefaultAsset).
+				WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(1000.0))
+			if tt.err == nil {
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO transfers")).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(insertEvent).WithArgs(sqlmock.AnyArg(), "", StatusPending, "", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectPosting(mock, ledger.UserAccount(7), ledger.WithdrawalHoldsAccount(7), tt.amount, TypeWithdrawal, sqlmock.AnyArg())
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(updateTransfer).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(insertEvent).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			transfer, created, err := Create(db, provider{}, 7, TypeWithdrawal, Request{Amount: tt.amount})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && (!created || transfer.Status != StatusProcessing) {
+				t.Errorf("created %v in status %s, want a new processing transfer", created, transfer.Status)
+			}
+		})
+	}
+}
+
+func TestSettlePostings(t *testing.T) {
+	tests := []struct {
+		name         string
+		transferType string
+		succeeded    bool
+		status       string
+		from, to     string
+	}{
+		{"deposit completed", TypeDeposit, true, StatusCompleted, ledger.PendingDepositsAccount(7), ledger.UserAccount(7)},
+		{"deposit failed", TypeDeposit, false, StatusFailed, ledger.PendingDepositsAccount(7), ledger.PaymentClearingAccount},
+		{"withdrawal completed", TypeWithdrawal, true, StatusCompleted, ledger.WithdrawalHoldsAccount(7), ledger.PaymentClearingAccount},
+		{"withdrawal failed", TypeWithdrawal, false, StatusFailed, ledger.WithdrawalHoldsAccount(7), ledger.UserAccount(7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock(t)
+			mock.ExpectBegin()
+			expectTransition(mock, "tr_1", StatusProcessing, tt.status)
+			expectPosting(mock, tt.from, tt.to, 250, tt.transferType, "tr_1")
+			mock.ExpectCommit()
+
+			transfer := &Transfer{ID: "tr_1", UserID: 7, Type: tt.transferType, Asset: ledger.DefaultAsset, Amount: 250, Status: StatusProcessing}
+			if err := settle(db, transfer, Result{Succeeded: tt.succeeded}); err != nil {
+				t.Fatal(err)
+			}
+			if transfer.Status != tt.status || transfer.CompletedAt == nil {
+				t.Errorf("status %s completed at %v, want %s with a completion time", transfer.Status, transfer.CompletedAt, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package userevents
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/rohanchavan1918/kse-common/utils"
+)
+
+// Event types delivered to users
+const (
+	TypeOrder = "order"
+	TypeFill  = "fill"
+	TypeAlert = "alert"
+)
+
+// Event is one entry of a user's private stream. Seq starts at 1 and grows
+// by one with every event of the user, so a client that remembers the last
+// seq it saw can ask for exactly what it missed.
+type Event struct {
+	Seq       int64           `json:"seq"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+var schemas = []string{
+	`CREATE TABLE IF NOT EXISTS user_event_seqs (
+		user_id BIGINT PRIMARY KEY,
+		last_seq BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_events (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		seq BIGINT NOT NULL,
+		event_key VARCHAR(191) NOT NULL,
+		type VARCHAR(32) NOT NULL,
+		data JSON NOT NULL,
+		created_at DATETIME(6) NOT NULL,
+		UNIQUE KEY uq_user_events_seq (user_id, seq),
+		UNIQUE KEY uq_user_events_key (event_key),
+		INDEX idx_user_events_created (created_at)
+	)`,
+}
+
+func EnsureSchema(db *sql.DB) error {
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Append adds an event to the user's stream. key identifies the source
+// message, appending the same key twice is a no-op so redelivered Kafka
+// messages do not show up twice.
+func Append(db *sql.DB, userID int64, eventType, key string, data interface{}) (int64, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The counter row stays locked until commit, which serializes appends
+	// of the same user
+	_, err = tx.Exec(
+		"INSERT INTO user_event_seqs (user_id, last_seq) VALUES (?, 1) ON DUPLICATE KEY UPDATE last_seq = last_seq + 1",
+		userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var seq int64
+	if err := tx.QueryRow("SELECT last_seq FROM user_event_seqs WHERE user_id = ?", userID).Scan(&seq); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO user_events (user_id, seq, event_key, type, data, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, seq, key, eventType, payload, time.Now().UTC(),
+	)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		// Seen before, the rollback also undoes the counter bump
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return seq, tx.Commit()
+}
+
+// Since returns up to limit events of the user after afterSeq, oldest first
+func Since(db *sql.DB, userID, afterSeq int64, limit int) ([]Event, error) {
+	rows, err := db.Query(
+		"SELECT seq, type, data, created_at FROM user_events WHERE user_id = ? AND seq > ? ORDER BY seq LIMIT ?",
+		userID, afterSeq, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		var data []byte
+		if err := rows.Scan(&e.Seq, &e.Type, &data, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Data = json.RawMessage(data)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Bounds returns the oldest retained and the latest seq of the user, both
+// zero when the user has no events
+func Bounds(db *sql.DB, userID int64) (int64, int64, error) {
+	var oldest, latest sql.NullInt64
+	err := db.QueryRow("SELECT MIN(seq), MAX(seq) FROM user_events WHERE user_id = ?", userID).Scan(&oldest, &latest)
+	if err != nil {
+		return 0, 0, err
+	}
+	return oldest.Int64, latest.Int64, nil
+}
+
+// Prune deletes events older than retention every interval, it never returns
+func Prune(db *sql.DB, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		cutoff := time.Now().UTC().Add(-retention)
+		if _, err := db.Exec("DELETE FROM user_events WHERE created_at < ?", cutoff); err != nil {
+			utils.LogError("Failed to prune user events : %s", err)
+		}
+	}
+}
+
+// Tail polls for events appended by any instance and calls notify with the
+// users that have new events, it never returns. Only users matter here, the
+// subscribers read the events themselves.
+func Tail(db *sql.DB, interval time.Duration, notify func(userIDs []int64)) {
+	var lastID sql.NullInt64
+	for {
+		err := db.QueryRow("SELECT MAX(id) FROM user_events").Scan(&lastID)
+		if err == nil {
+			break
+		}
+		utils.LogError("Failed to start tailing user events : %s", err)
+		time.Sleep(interval)
+	}
+
+	cursor := lastID.Int64
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		rows, err := db.Query("SELECT id, user_id FROM user_events WHERE id > ? ORDER BY id LIMIT 1000", cursor)
+		if err != nil {
+			utils.LogError("Failed to tail user events : %s", err)
+			continue
+		}
+
+		seen := map[int64]bool{}
+		userIDs := []int64{}
+		for rows.Next() {
+			var id, userID int64
+			if err := rows.Scan(&id, &userID); err != nil {
+				utils.LogError("Failed to tail user events : %s", err)
+				break
+			}
+			cursor = id
+			if !seen[userID] {
+				seen[userID] = true
+				userIDs = append(userIDs, userID)
+			}
+		}
+		rows.Close()
+
+		if len(userIDs) > 0 {
+			notify(userIDs)
+		}
+	}
+}
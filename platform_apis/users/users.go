@@ -0,0 +1,88 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type User struct {
+	ID           int64     `json:"id"`
+	Email        string    `json:"email"`
+	Name         string    `json:"name"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+var (
+	ErrNotFound   = errors.New("user not found")
+	ErrEmailTaken = errors.New("email is already registered")
+)
+
+const schema = `CREATE TABLE IF NOT EXISTS users (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	email VARCHAR(255) NOT NULL UNIQUE,
+	name VARCHAR(255) NOT NULL DEFAULT '',
+	password_hash VARCHAR(255) NOT NULL,
+	created_at DATETIME(6) NOT NULL
+)`
+
+func EnsureSchema(db *sql.DB) error {
+	// Create the users table if it is not there yet
+	_, err := db.Exec(schema)
+	return err
+}
+
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func Create(db *sql.DB, email, name, passwordHash string) (*User, error) {
+	user := &User{
+		Email:        NormalizeEmail(email),
+		Name:         strings.TrimSpace(name),
+		PasswordHash: passwordHash,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	res, err := db.Exec(
+		"INSERT INTO users (email, name, password_hash, created_at) VALUES (?, ?, ?, ?)",
+		user.Email, user.Name, user.PasswordHash, user.CreatedAt,
+	)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return nil, ErrEmailTaken
+		}
+		return nil, err
+	}
+
+	user.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func GetByEmail(db *sql.DB, email string) (*User, error) {
+	return getOne(db, "SELECT id, email, name, password_hash, created_at FROM users WHERE email = ?", NormalizeEmail(email))
+}
+
+func GetByID(db *sql.DB, id int64) (*User, error) {
+	return getOne(db, "SELECT id, email, name, password_hash, created_at FROM users WHERE id = ?", id)
+}
+
+func getOne(db *sql.DB, query string, args ...interface{}) (*User, error) {
+	user := &User{}
+	err := db.QueryRow(query, args...).Scan(&user.ID, &user.Email, &user.Name, &user.PasswordHash, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,262 @@
+package watchlists
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const maxSymbols = 200
+
+var (
+	ErrNotFound       = errors.New("Watchlist not found")
+	ErrNameTaken      = errors.New("A watchlist with this name already exists")
+	ErrTooManySymbols = errors.New("Watchlists cannot hold more than 200 symbols")
+	ErrInvalidSymbol  = errors.New("Symbols must be 1 to 32 characters long")
+)
+
+type Watchlist struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Symbols   []string  `json:"symbols"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var schemas = []string{
+	`CREATE TABLE IF NOT EXISTS watchlists (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		created_at DATETIME(6) NOT NULL,
+		updated_at DATETIME(6) NOT NULL,
+		UNIQUE KEY uq_watchlists_name (user_id, name)
+	)`,
+	`CREATE TABLE IF NOT EXISTS watchlist_symbols (
+		watchlist_id BIGINT NOT NULL,
+		symbol VARCHAR(32) NOT NULL,
+		added_at DATETIME(6) NOT NULL,
+		PRIMARY KEY (watchlist_id, symbol)
+	)`,
+}
+
+func EnsureSchema(db *sql.DB) error {
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func normalizeSymbol(symbol string) (string, error) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if symbol == "" || len(symbol) > 32 {
+		return "", ErrInvalidSymbol
+	}
+	return symbol, nil
+}
+
+func ValidateName(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("Name cannot be empty")
+	}
+	if len(name) > 100 {
+		return errors.New("Name cannot be longer than 100 characters")
+	}
+	return nil
+}
+
+func isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+func Create(db *sql.DB, userID int64, name string, symbols []string) (*Watchlist, error) {
+	if len(symbols) > maxSymbols {
+		return nil, ErrTooManySymbols
+	}
+	for i := range symbols {
+		symbol, err := normalizeSymbol(symbols[i])
+		if err != nil {
+			return nil, err
+		}
+		symbols[i] = symbol
+	}
+	now := time.Now().UTC()
+	w := &Watchlist{UserID: userID, Name: strings.TrimSpace(name), Symbols: []string{}, CreatedAt: now, UpdatedAt: now}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO watchlists (user_id, name, created_at, updated_at) VALUES (?, ?, ?, ?)", userID, w.Name, now, now)
+	if isDuplicate(err) {
+		return nil, ErrNameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if w.ID, err = res.LastInsertId(); err != nil {
+		return nil, err
+	}
+
+	for _, symbol := range symbols {
+		_, err := tx.Exec("INSERT IGNORE INTO watchlist_symbols (watchlist_id, symbol, added_at) VALUES (?, ?, ?)", w.ID, symbol, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return Get(db, userID, w.ID)
+}
+
+func ListForUser(db *sql.DB, userID int64) ([]Watchlist, error) {
+	rows, err := db.Query("SELECT id, user_id, name, created_at, updated_at FROM watchlists WHERE user_id = ? ORDER BY name", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []Watchlist{}
+	for rows.Next() {
+		var w Watchlist
+		if err := rows.Scan(&w.ID, &w.UserID, &w.Name, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, err
+		}
+		lists = append(lists, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range lists {
+		if lists[i].Symbols, err = symbolsOf(db, lists[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return lists, nil
+}
+
+func Get(db *sql.DB, userID, id int64) (*Watchlist, error) {
+	w := &Watchlist{}
+	err := db.QueryRow(
+		"SELECT id, user_id, name, created_at, updated_at FROM watchlists WHERE id = ? AND user_id = ?", id, userID,
+	).Scan(&w.ID, &w.UserID, &w.Name, &w.CreatedAt, &w.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if w.Symbols, err = symbolsOf(db, w.ID); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func Rename(db *sql.DB, userID, id int64, name string) (*Watchlist, error) {
+	res, err := db.Exec("UPDATE watchlists SET name = ?, updated_at = ? WHERE id = ? AND user_id = ?", strings.TrimSpace(name), time.Now().UTC(), id, userID)
+	if isDuplicate(err) {
+		return nil, ErrNameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		// MySQL reports 0 rows for a rename to the current name as well
+		if _, err := Get(db, userID, id); err != nil {
+			return nil, err
+		}
+	}
+	return Get(db, userID, id)
+}
+
+func Delete(db *sql.DB, userID, id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM watchlists WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.Exec("DELETE FROM watchlist_symbols WHERE watchlist_id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func AddSymbol(db *sql.DB, userID, id int64, symbol string) (*Watchlist, error) {
+	symbol, err := normalizeSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+	w, err := Get(db, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(w.Symbols) >= maxSymbols {
+		return nil, ErrTooManySymbols
+	}
+
+	now := time.Now().UTC()
+	if _, err := db.Exec("INSERT IGNORE INTO watchlist_symbols (watchlist_id, symbol, added_at) VALUES (?, ?, ?)", id, symbol, now); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("UPDATE watchlists SET updated_at = ? WHERE id = ?", now, id); err != nil {
+		return nil, err
+	}
+	return Get(db, userID, id)
+}
+
+func RemoveSymbol(db *sql.DB, userID, id int64, symbol string) (*Watchlist, error) {
+	if _, err := Get(db, userID, id); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if _, err := db.Exec("DELETE FROM watchlist_symbols WHERE watchlist_id = ? AND symbol = ?", id, strings.ToUpper(strings.TrimSpace(symbol))); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("UPDATE watchlists SET updated_at = ? WHERE id = ?", now, id); err != nil {
+		return nil, err
+	}
+	return Get(db, userID, id)
+}
+
+func symbolsOf(db *sql.DB, id int64) ([]string, error) {
+	rows, err := db.Query("SELECT symbol FROM watchlist_symbols WHERE watchlist_id = ? ORDER BY added_at, symbol", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	symbols := []string{}
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			return nil, err
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, rows.Err()
+}
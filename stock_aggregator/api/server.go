@@ -1,50 +1,77 @@
 package api
 
 import (
-	"fmt"
-	"strconv"
 	"sync"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/database"
+	"github.com/rohanchavan1918/kse-common/health"
+	"github.com/rohanchavan1918/kse-common/kafkaadmin"
+	"github.com/rohanchavan1918/kse-common/lifecycle"
+	"github.com/rohanchavan1918/kse-common/metrics"
+	"github.com/rohanchavan1918/kse-common/utils"
 	"github.com/rohanchavan1918/stock_aggregator/conf"
 	"github.com/rohanchavan1918/stock_aggregator/stocks"
-	"github.com/rohanchavan1918/stock_aggregator/utils"
 )
 
 func RunServer(config *conf.Config) {
-	r := gin.Default()
+	// Requests are logged by the logging middleware, as JSON
+	r := gin.New()
+	// Client IPs come from X-Forwarded-For only behind the configured proxies
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	r.Use(gin.Recovery())
 	SetupRoutes(r)
-	dbConn := conf.GetDBConnection(&config.DB)
-	err := dbConn.Ping()
+	dbConn, err := database.Open(&config.DB)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer dbConn.Close()
+	err = dbConn.Ping()
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
 
 	// Once DB Connection is validated, add it to the global connections
 	conf.AppConnections.DB = dbConn
+	metrics.TrackDB(dbConn, config.ServiceName)
+	health.Ready("db", health.DB(dbConn))
+
+	if err := stocks.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+
+	// Create or fix the topic first when provision.ensure_on_startup is set
+	kafkaConfig, topics := config.KafkaSettings()
+	if err := kafkaadmin.EnsureOnStartup(kafkaConfig, topics); err != nil {
+		utils.AlertAndPanic(err)
+	}
 
 	// Check for Kafka connections
-	writer, err := conf.AppConfig.KafkaConfig.GetProducer()
+	writer, err := conf.AppConfig().KafkaConfig.GetProducer(conf.AppConfig().KafkaConfig.Topic)
 	if err != nil {
 		utils.AlertAndPanic(err)
 	}
 
 	conf.AppConnections.KafkaWriter = writer
+	health.Ready("kafka", health.Kafka(kafkaConfig))
+	health.Ready("kafka_topics", health.KafkaTopics(kafkaConfig, topics...))
+	health.WatchConsumer(kafkaConfig, config.KafkaConfig.GroupID, config.KafkaConfig.Topic)
+	defer writer.Close()
 	var wg sync.WaitGroup
 
-	utils.LogInfo("Starting KafkaStockReaderWorker goroutines")
-	// Spawn KafkaStockReaderWorker goroutines
-	for i := 0; i < 5; i++ {
-		wg.Add(1)
-		go stocks.KafkaStockReaderWorker(stocks.StockChannel, &wg)
-	}
-
 	utils.LogInfo("Starting ConsumeFromKafka goroutines")
-	// Spawn ConsumeFromKafka goroutines
+	// Spawn ConsumeFromKafka goroutines, each saves the prices it reads
 	for i := 0; i < 5; i++ {
-		go stocks.ConsumeFromKafka(stocks.StockChannel, &wg)
+		wg.Add(1)
+		health.Go("stocks.consumer", func() { stocks.ConsumeFromKafka(lifecycle.Context(), &wg) })
 	}
 
-	defer close(stocks.StockChannel)
-	defer wg.Wait()
+	// Apply live settings from the config file without a restart
+	lifecycle.WatchConfig(&conf.Running, nil)
 
-	port := fmt.Sprintf(":%s", strconv.Itoa(int(conf.AppConfig.Port)))
-	r.Run(port)
+	if err := lifecycle.Serve(r, config.Port); err != nil {
+		utils.LogError("Server stopped : %s", err)
+	}
 }
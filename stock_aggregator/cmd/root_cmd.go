@@ -3,6 +3,9 @@ package cmd
 import (
 	"log"
 
+	commonconf "github.com/rohanchavan1918/kse-common/config"
+	"github.com/rohanchavan1918/kse-common/kafkaadmin"
+	"github.com/rohanchavan1918/kse-common/lifecycle"
 	"github.com/rohanchavan1918/stock_aggregator/api"
 	"github.com/rohanchavan1918/stock_aggregator/conf"
 	"github.com/spf13/cobra"
@@ -16,6 +19,8 @@ var rootCmd = cobra.Command{
 // RootCommand will setup and return the root command
 func RootCommand() *cobra.Command {
 	rootCmd.PersistentFlags().StringP("config", "c", "", "the config file to use")
+	rootCmd.AddCommand(commonconf.Command(&conf.Config{}))
+	rootCmd.AddCommand(kafkaadmin.Command(&conf.Config{}))
 	return &rootCmd
 }
 
@@ -25,12 +30,11 @@ func run(cmd *cobra.Command, args []string) {
 		log.Fatal("Failed to load config: " + err.Error())
 	}
 
-	logger, err := conf.ConfigureLogging(&config.LogConfig)
+	logger, err := lifecycle.Setup(&config.Base)
 	if err != nil {
 		log.Fatal("Failed to configure logging: " + err.Error())
 	}
 
-	conf.AppConnections.Logger = logger
-	logger.Infof("Starting with config: %+v", config)
+	logger.Infof("Starting with config: %+v", commonconf.Redact(config))
 	api.RunServer(config)
 }
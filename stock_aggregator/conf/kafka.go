@@ -1,59 +1,15 @@
 package conf
 
-import (
-	"errors"
-	"fmt"
-
-	"github.com/segmentio/kafka-go"
-)
+import commonconf "github.com/rohanchavan1918/kse-common/config"
 
 type KafkaConfig struct {
-	Host  string `viper:"string" validate:"required" mapstructure:"kafka_host"`
-	Port  int64  `viper:"string" validate:"required" mapstructure:"kafka_port"`
-	Topic string `viper:"string" validate:"required" mapstructure:"topic"`
-}
-
-func (c *KafkaConfig) getKafkaHost() string {
-	// Get a kafka producer from the config
-	if c.Host == "" || c.Port == 0 || c.Topic == "" {
-		return ""
-	}
-	return fmt.Sprintf("%s:%d", c.Host, c.Port)
-}
-
-func (c *KafkaConfig) GetProducer() (*kafka.Writer, error) {
-	// Get a kafka producer from the config
+	commonconf.Kafka `mapstructure:",squash"`
 
-	kafkaHost := c.getKafkaHost()
-	if kafkaHost == "" {
-		err := errors.New("Kafka host, port or topic cannot be empty")
-		return nil, err
-	}
-	w := kafka.NewWriter(kafka.WriterConfig{
-		Brokers: []string{kafkaHost},
-		Topic:   c.Topic,
-	})
-	return w, nil
+	Topic string `viper:"string" validate:"required" mapstructure:"topic"`
 }
 
-func (c *KafkaConfig) GetConsumer() (*kafka.Reader, error) {
-
-	kafkaHost := c.getKafkaHost()
-	if kafkaHost == "" {
-		err := errors.New("Kafka host, port or topic cannot be empty")
-		return nil, err
-	}
-
-	consumer := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{kafkaHost},
-		Topic:   c.Topic,
-	})
-
-	if consumer != nil {
-		return consumer, nil
-	} else {
-		err := errors.New("Failed to create kafka consumer")
-		return nil, err
-	}
-
+// KafkaSettings returns the Kafka connection and the topic the service uses,
+// for the topics command and startup provisioning
+func (c *Config) KafkaSettings() (*commonconf.Kafka, []string) {
+	return &c.KafkaConfig.Kafka, []string{c.KafkaConfig.Topic}
 }
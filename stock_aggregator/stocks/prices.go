@@ -0,0 +1,71 @@
+package stocks
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// The latest price of every stock and its daily OHLC bars. Ticks can be
+// handled out of order by the workers, so every update checks the tick time
+// and an older tick never overwrites a newer price.
+var schemas = []string{
+	`CREATE TABLE IF NOT EXISTS stock_prices (
+		symbol VARCHAR(32) PRIMARY KEY,
+		price DECIMAL(24, 8) NOT NULL,
+		updated_at DATETIME(6) NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS stock_daily_prices (
+		symbol VARCHAR(32) NOT NULL,
+		day DATE NOT NULL,
+		open DECIMAL(24, 8) NOT NULL,
+		high DECIMAL(24, 8) NOT NULL,
+		low DECIMAL(24, 8) NOT NULL,
+		close DECIMAL(24, 8) NOT NULL,
+		opened_at DATETIME(6) NOT NULL,
+		closed_at DATETIME(6) NOT NULL,
+		PRIMARY KEY (symbol, day)
+	)`,
+}
+
+func EnsureSchema(db *sql.DB) error {
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SavePrice records a tick as the stock's latest price and folds it into
+// the bar of its day
+func SavePrice(db *sql.DB, s *Stock) error {
+	symbol := strings.ToUpper(strings.TrimSpace(s.Name))
+	at := s.Time.UTC()
+
+	_, err := db.Exec(
+		`INSERT INTO stock_prices (symbol, price, updated_at) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			price = IF(VALUES(updated_at) >= updated_at, VALUES(price), price),
+			updated_at = GREATEST(updated_at, VALUES(updated_at))`,
+		symbol, s.Price, at,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Assignments run left to right, so open and close are decided before
+	// their timestamps move
+	_, err = db.Exec(
+		`INSERT INTO stock_daily_prices (symbol, day, open, high, low, close, opened_at, closed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			open = IF(VALUES(opened_at) < opened_at, VALUES(open), open),
+			opened_at = LEAST(opened_at, VALUES(opened_at)),
+			high = GREATEST(high, VALUES(high)),
+			low = LEAST(low, VALUES(low)),
+			close = IF(VALUES(closed_at) >= closed_at, VALUES(close), close),
+			closed_at = GREATEST(closed_at, VALUES(closed_at))`,
+		symbol, at.Format("2006-01-02"), s.Price, s.Price, s.Price, s.Price, at, at,
+	)
+	return err
+}
@@ -4,33 +4,52 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"math"
 	"sync"
+	"time"
 
+	"github.com/rohanchavan1918/kse-common/consumer"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/rohanchavan1918/kse-common/utils"
 	"github.com/rohanchavan1918/stock_aggregator/conf"
-	"github.com/rohanchavan1918/stock_aggregator/utils"
 	"github.com/segmentio/kafka-go"
 )
 
 type Stock struct {
 	// Stock model
-	ID    int64   `json:"id"`
-	Name  string  `json:"name"`
-	Price float64 `json:"price"`
+	ID    int64     `json:"id"`
+	Name  string    `json:"name"`
+	Price float64   `json:"price"`
+	Time  time.Time `json:"time"`
+
+	// Trace the stock is part of
+	ctx context.Context
+}
+
+// Context returns the context the stock is traced with
+func (s *Stock) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
 }
 
-var StockChannel = make(chan Stock, 1)
+// WithContext sets the context the stock is traced with
+func (s *Stock) WithContext(ctx context.Context) {
+	s.ctx = ctx
+}
 
 func KafkaStockWriterWorker(stockChannel <-chan Stock, wg *sync.WaitGroup) {
 	// Worker to write stock to kafka
 	defer wg.Done()
 	for {
 		stock := <-stockChannel
-		utils.LogInfo("Adding stock to kafka : %v", stock)
+		logger := logging.FromContext(stock.Context()).WithField(logging.FieldSymbol, stock.Name)
+		logger.WithField("price", stock.Price).Info("Adding stock to kafka")
 		err := AddToKafka(&stock)
 		if err != nil {
-			utils.LogInfo("Failed to add stock to kafka : %s", err)
+			logger.WithError(err).Error("Failed to add stock to kafka")
 		}
 	}
 }
@@ -73,12 +92,15 @@ func AddToKafka(stock *Stock) error {
 		Value: []byte(price),
 	}
 
-	w, err := conf.AppConfig.KafkaConfig.GetProducer()
-	if err != nil {
-		return err
+	// The writer made at startup is shared, one per message would leak
+	// connections
+	w := conf.AppConnections.KafkaWriter
+	if w == nil {
+		return errors.New("Kafka writer is not set up")
 	}
 
-	err = w.WriteMessages(context.Background(), km)
+	ctx, span := tracing.StartProducer(stock.Context(), w.Topic, &km)
+	err = tracing.End(span, w.WriteMessages(ctx, km))
 	if err != nil {
 		return err
 	}
@@ -86,50 +108,40 @@ func AddToKafka(stock *Stock) error {
 	return nil
 }
 
-func ConsumeFromKafka(channel chan Stock, wg *sync.WaitGroup) {
+func ConsumeFromKafka(ctx context.Context, wg *sync.WaitGroup) {
 	// Create a new Kafka consumer
 	defer wg.Done()
-	consumer, err := conf.AppConfig.KafkaConfig.GetConsumer()
+	reader, err := conf.AppConfig().KafkaConfig.GetConsumer(conf.AppConfig().KafkaConfig.Topic, conf.AppConfig().KafkaConfig.GroupID)
 
 	if err != nil {
-		log.Printf("Error while creating consumer: %v", err)
 		utils.AlertAndPanic(err)
 		return
 	}
-
-	// Continuously poll for new messages
-	for {
-		msg, err := consumer.ReadMessage(context.Background())
-		if err != nil {
-			log.Printf("Error while reading message: %v", err)
-			continue
-		}
-
-		// Add the message value to the channel
-		fmt.Println("Message received: ", string(msg.Value))
+	defer reader.Close()
+
+	// Poll for new messages until shutdown, read errors are retried with
+	// backoff. The price is saved before the offset is committed, so a tick
+	// that fails to save is retried instead of lost.
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		logger := logging.ForMessage(ctx, msg).WithField(logging.FieldSymbol, string(msg.Key))
+		logger.WithField("price", string(msg.Value)).Debug("Stock received")
 		float64_val, err := utils.StringToFloat64(string(msg.Value))
 		if err != nil {
-			log.Printf("Error while converting message value to float64: %v", err)
-			utils.AlertAndPanic(err)
+			logger.WithError(err).Error("Skipping stock with a price that is not a number")
+			return nil
 		}
 		stock := Stock{
 			Name:  string(msg.Key),
 			Price: float64_val,
+			Time:  msg.Time,
 		}
-		channel <- stock
-	}
-}
-
-func KafkaStockReaderWorker(stockChannel <-chan Stock, wg *sync.WaitGroup) {
-	// Worker to write stock to kafka
-	defer wg.Done()
-	for {
-		stock := <-stockChannel
-		utils.LogInfo("Added stock to DB : %v", stock)
+		stock.WithContext(ctx)
 
-		// err := AddToKafka(&stock)
-		// if err != nil {
-		// 	utils.LogInfo("Failed to add stock to kafka : %s", err)
-		// }
-	}
+		_, span := tracing.Start(ctx, "SavePrice")
+		if err := tracing.End(span, SavePrice(conf.AppConnections.DB, &stock)); err != nil {
+			return err
+		}
+		logger.WithField("price", stock.Price).Info("Added stock to DB")
+		return nil
+	})
 }
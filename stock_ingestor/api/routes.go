@@ -2,10 +2,27 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/access"
+	"github.com/rohanchavan1918/kse-common/health"
+	"github.com/rohanchavan1918/kse-common/lifecycle"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/metrics"
+	"github.com/rohanchavan1918/kse-common/tracing"
 	v1 "github.com/rohanchavan1918/stock_ingestor/api/v1"
 )
 
 func SetupRoutes(r *gin.Engine) {
+	metrics.Register(r)
+	// Probes are neither logged nor traced, they come every few seconds
+	health.Register(r)
+	r.Use(logging.Middleware())
+	r.Use(tracing.Middleware())
+
 	api := r.Group("/api")
 	v1.SetupRoutes(api)
+
+	// Operators only, with an access token granting the admin role
+	admin := r.Group("/admin", access.Require(access.RoleAdmin))
+	admin.GET("/config/reloads", gin.WrapF(lifecycle.ReloadsHandler))
+	admin.POST("/config/reloads", gin.WrapF(lifecycle.ReloadsHandler))
 }
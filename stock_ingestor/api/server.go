@@ -1,45 +1,76 @@
 package api
 
 import (
-	"fmt"
-	"strconv"
-	"sync"
-
 	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/database"
+	"github.com/rohanchavan1918/kse-common/health"
+	"github.com/rohanchavan1918/kse-common/kafkaadmin"
+	"github.com/rohanchavan1918/kse-common/lifecycle"
+	"github.com/rohanchavan1918/kse-common/metrics"
+	"github.com/rohanchavan1918/kse-common/utils"
 	"github.com/rohanchavan1918/stock_ingestor/conf"
 	"github.com/rohanchavan1918/stock_ingestor/stocks"
-	"github.com/rohanchavan1918/stock_ingestor/utils"
 )
 
 func RunServer(config *conf.Config) {
-	r := gin.Default()
+	// Requests are logged by the logging middleware, as JSON
+	r := gin.New()
+	// Client IPs come from X-Forwarded-For only behind the configured proxies
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	r.Use(gin.Recovery())
 	SetupRoutes(r)
-	dbConn := conf.GetDBConnection(&config.DB)
-	err := dbConn.Ping()
+	dbConn, err := database.Open(&config.DB)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer dbConn.Close()
+	err = dbConn.Ping()
 	if err != nil {
 		utils.AlertAndPanic(err)
 	}
 
 	// Once DB Connection is validated, add it to the global connections
 	conf.AppConnections.DB = dbConn
+	metrics.TrackDB(dbConn, config.ServiceName)
+	health.Ready("db", health.DB(dbConn))
+	metrics.TrackQueue("stock_channel",
+		func() int { return len(stocks.StockChannel) },
+		func() int { return cap(stocks.StockChannel) })
+
+	// Create or fix the topic first when provision.ensure_on_startup is set
+	kafkaConfig, topics := config.KafkaSettings()
+	if err := kafkaadmin.EnsureOnStartup(kafkaConfig, topics); err != nil {
+		utils.AlertAndPanic(err)
+	}
 
 	// Check for Kafka connections
-	writer, err := conf.AppConfig.KafkaConfig.GetProducer()
+	writer, err := conf.AppConfig().KafkaConfig.GetProducer(conf.AppConfig().KafkaConfig.Topic)
 	if err != nil {
 		utils.AlertAndPanic(err)
 	}
 
 	conf.AppConnections.KafkaWriter = writer
-	var wg sync.WaitGroup
+	health.Ready("kafka", health.Kafka(kafkaConfig))
+	health.Ready("kafka_topics", health.KafkaTopics(kafkaConfig, topics...))
+	defer writer.Close()
+
+	// Spawn KafkaStockWriterWorker goroutines, the pool follows the
+	// workers setting when the config is reloaded
+	pool := stocks.NewWorkerPool(stocks.StockChannel)
+	pool.Resize(conf.AppConfig().WorkerCount())
+	lifecycle.WatchConfig(&conf.Running, func() error {
+		pool.Resize(conf.AppConfig().WorkerCount())
+		return nil
+	})
 
-	// Spawn KafkaStockWriterWorker goroutines
-	for i := 0; i < 5; i++ {
-		wg.Add(1)
-		go stocks.KafkaStockWriterWorker(stocks.StockChannel, &wg)
+	if err := lifecycle.Serve(r, config.Port); err != nil {
+		utils.LogError("Server stopped : %s", err)
 	}
-	defer close(stocks.StockChannel)
-	defer wg.Wait()
 
-	port := fmt.Sprintf(":%s", strconv.Itoa(int(conf.AppConfig.Port)))
-	r.Run(port)
+	// No handler can queue a stock any more, let the workers drain the
+	// channel before the writer is closed
+	close(stocks.StockChannel)
+	pool.Wait()
 }
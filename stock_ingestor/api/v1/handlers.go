@@ -4,13 +4,14 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/health"
+	"github.com/rohanchavan1918/kse-common/tracing"
 	"github.com/rohanchavan1918/stock_ingestor/stocks"
 )
 
+// Healthcheck answers like /livez, it is kept for callers of the old path
 func Healthcheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"message": "OK",
-	})
+	health.LiveHandler()(c)
 }
 
 func AddStock(c *gin.Context) {
@@ -41,6 +42,9 @@ func AddStock(c *gin.Context) {
 	// 	return
 	// }
 
+	// The request is answered before the stock is written to kafka, keep
+	// the trace but not the request's cancellation
+	stock.WithContext(tracing.Detach(c.Request.Context()))
 	stocks.StockChannel <- stock
 
 	c.JSON(http.StatusCreated, gin.H{
@@ -2,59 +2,55 @@ package conf
 
 import (
 	"database/sql"
-	"strings"
+	"sync/atomic"
 
+	commonconf "github.com/rohanchavan1918/kse-common/config"
 	"github.com/segmentio/kafka-go"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Port        int64         `viper:"int"`
-	ServiceName string        `viper:"string" mapstructure:"service_name"`
-	DB          DB            `mapstructure:"db"`
-	Redis       Redis         `mapstructure:"redis"`
-	Fluent      Fluent        `mapstructure:"fluent"`
-	LogConfig   LoggingConfig `mapstructure:"log_config"`
-	SlackUrl    string        `mapstructure:"slack_url"`
-	KafkaConfig KafkaConfig   `mapstructure:"kafka"`
+	commonconf.Base `mapstructure:",squash"`
+
+	KafkaConfig KafkaConfig `mapstructure:"kafka"`
+
+	// Goroutines writing ingested stocks to kafka, 5 when left out
+	Workers int `viper:"int" validate:"gte=0" reload:"live" mapstructure:"workers"`
+}
+
+// WorkerCount returns the configured number of kafka writers
+func (c *Config) WorkerCount() int {
+	if c.Workers > 0 {
+		return c.Workers
+	}
+	return 5
 }
 
 type appConnections struct {
-	Logger      *logrus.Entry
 	KafkaWriter *kafka.Writer
 	DB          *sql.DB
 }
 
 var AppConnections appConnections
 
-var AppConfig Config
-
-func LoadConfig(cmd *cobra.Command) (*Config, error) {
-	err := viper.BindPFlags(cmd.Flags())
-	config := Config{}
-	if err != nil {
-		return nil, err
-	}
-
-	// viper.SetEnvPrefix("")
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-	viper.AutomaticEnv()
+// Running holds the running *Config. Reloads replace it with a new one
+// rather than change it, so it can be read without locking.
+var Running atomic.Value
 
-	if configFile, _ := cmd.Flags().GetString("config"); configFile != "" {
-		viper.SetConfigFile(configFile)
-	} else {
-		viper.SetConfigFile("./config/config.json")
+// AppConfig returns the running config, treat it as read only
+func AppConfig() *Config {
+	if config, ok := Running.Load().(*Config); ok {
+		return config
 	}
+	return &Config{}
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, err
-	}
-	if err := viper.Unmarshal(&config); err != nil {
+func LoadConfig(cmd *cobra.Command) (*Config, error) {
+	config := Config{}
+	if err := commonconf.Load(cmd, &config); err != nil {
 		return nil, err
 	}
-	AppConfig = config
+	Running.Store(&config)
 
 	return &config, nil
 }
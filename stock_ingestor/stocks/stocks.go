@@ -7,8 +7,9 @@ import (
 	"math"
 	"sync"
 
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
 	"github.com/rohanchavan1918/stock_ingestor/conf"
-	"github.com/rohanchavan1918/stock_ingestor/utils"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -17,23 +18,87 @@ type Stock struct {
 	ID    int64   `json:"id"`
 	Name  string  `json:"name"`
 	Price float64 `json:"price"`
+
+	// Trace the stock is part of, it follows the stock through StockChannel
+	ctx context.Context
+}
+
+// Context returns the context the stock is traced with
+func (s *Stock) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// WithContext sets the context the stock is traced with
+func (s *Stock) WithContext(ctx context.Context) {
+	s.ctx = ctx
 }
 
 var StockChannel = make(chan Stock)
 
-func KafkaStockWriterWorker(stockChannel <-chan Stock, wg *sync.WaitGroup) {
-	// Worker to write stock to kafka
+func KafkaStockWriterWorker(stockChannel <-chan Stock, stop <-chan struct{}, wg *sync.WaitGroup) {
+	// Worker to write stock to kafka, until the channel is closed or it is
+	// told to stop
 	defer wg.Done()
 	for {
-		stock := <-stockChannel
-		utils.LogInfo("Adding stock to kafka : %v", stock)
-		err := AddToKafka(&stock)
-		if err != nil {
-			utils.LogInfo("Failed to add stock to kafka : %s", err)
+		select {
+		case stock, ok := <-stockChannel:
+			if !ok {
+				return
+			}
+			logger := logging.FromContext(stock.Context()).WithField(logging.FieldSymbol, stock.Name)
+			logger.WithField("price", stock.Price).Info("Adding stock to kafka")
+			err := AddToKafka(&stock)
+			if err != nil {
+				logger.WithError(err).Error("Failed to add stock to kafka")
+			}
+		case <-stop:
+			return
 		}
 	}
 }
 
+// WorkerPool runs KafkaStockWriterWorker goroutines and can be resized
+// while they run
+type WorkerPool struct {
+	stockChannel <-chan Stock
+	mu           sync.Mutex
+	stops        []chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewWorkerPool returns a pool reading from stockChannel, with no workers
+// until it is resized
+func NewWorkerPool(stockChannel <-chan Stock) *WorkerPool {
+	return &WorkerPool{stockChannel: stockChannel}
+}
+
+// Resize starts or stops workers until n are running. A stopped worker
+// finishes the stock it is writing first.
+func (p *WorkerPool) Resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.stops) < n {
+		stop := make(chan struct{})
+		p.stops = append(p.stops, stop)
+		p.wg.Add(1)
+		go KafkaStockWriterWorker(p.stockChannel, stop, &p.wg)
+	}
+	for len(p.stops) > n {
+		last := len(p.stops) - 1
+		close(p.stops[last])
+		p.stops = p.stops[:last]
+	}
+}
+
+// Wait blocks until every worker returned, after the stock channel was
+// closed
+func (p *WorkerPool) Wait() {
+	p.wg.Wait()
+}
+
 func (s *Stock) Validate() error {
 	// validate stock to database
 	if s.Name == "" {
@@ -72,12 +137,15 @@ func AddToKafka(stock *Stock) error {
 		Value: []byte(price),
 	}
 
-	w, err := conf.AppConfig.KafkaConfig.GetProducer()
-	if err != nil {
-		return err
+	// The writer made at startup is shared, one per message would leak
+	// connections
+	w := conf.AppConnections.KafkaWriter
+	if w == nil {
+		return errors.New("Kafka writer is not set up")
 	}
 
-	err = w.WriteMessages(context.Background(), km)
+	ctx, span := tracing.StartProducer(stock.Context(), w.Topic, &km)
+	err = tracing.End(span, w.WriteMessages(ctx, km))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,41 @@
+package activity
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/consumer"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/segmentio/kafka-go"
+)
+
+// Consume validates and stores activity events until ctx is done. Invalid
+// events end up in activity_rejects.
+func Consume(ctx context.Context, db *sql.DB, reader *kafka.Reader) {
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		var e Event
+		err := json.Unmarshal(msg.Value, &e)
+		if err == nil {
+			e.ReceivedAt = time.Now().UTC()
+			err = e.Validate()
+		}
+		if err != nil {
+			_, span := tracing.Start(ctx, "activity.Reject")
+			if err := tracing.End(span, Reject(db, msg.Value, err.Error())); err != nil {
+				logging.ForMessage(ctx, msg).WithError(err).Error("Failed to store rejected activity event")
+			}
+			return nil
+		}
+
+		// Events stored before are skipped, so a retry cannot count one twice
+		_, span := tracing.Start(ctx, "activity.Record")
+		if err := tracing.End(span, Record(db, &e)); err != nil {
+			return fmt.Errorf("cannot record activity event %s : %w", e.EventID, err)
+		}
+		return nil
+	})
+}
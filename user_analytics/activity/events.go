@@ -0,0 +1,93 @@
+package activity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rohanchavan1918/user_analytics/conf"
+)
+
+// Event types platform_apis emits, anything else is rejected
+var knownTypes = map[string]bool{
+	"signup":                   true,
+	"login":                    true,
+	"logout":                   true,
+	"order_placed":             true,
+	"order_cancel_requested":   true,
+	"order_replace_requested":  true,
+	"watchlist_created":        true,
+	"watchlist_renamed":        true,
+	"watchlist_deleted":        true,
+	"watchlist_symbol_added":   true,
+	"watchlist_symbol_removed": true,
+	"page_view":                true,
+	"deposit_completed":        true,
+	"withdrawal_completed":     true,
+	"trade_executed":           true,
+}
+
+// IsKnownType reports whether platform_apis emits events of the type
+func IsKnownType(eventType string) bool {
+	return knownTypes[eventType]
+}
+
+// Event is one user action as published on the activity topic. SessionID
+// is assigned here, it is not part of the message.
+type Event struct {
+	EventID       string                 `json:"event_id"`
+	Type          string                 `json:"type"`
+	UserID        int64                  `json:"user_id"`
+	SessionID     string                 `json:"session_id"`
+	OccurredAt    time.Time              `json:"occurred_at"`
+	ReceivedAt    time.Time              `json:"received_at"`
+	Source        string                 `json:"source"`
+	AuthSessionID string                 `json:"auth_session_id,omitempty"`
+	IP            string                 `json:"ip,omitempty"`
+	UserAgent     string                 `json:"user_agent,omitempty"`
+	Properties    map[string]interface{} `json:"properties"`
+}
+
+// Validate checks an event decoded from the topic
+func (e *Event) Validate() error {
+	if e.EventID == "" || len(e.EventID) > 64 {
+		return errors.New("event_id must be 1 to 64 characters long")
+	}
+	if !knownTypes[e.Type] {
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+	if e.UserID <= 0 {
+		return errors.New("user_id must be positive")
+	}
+	if e.Source != "server" && e.Source != "client" {
+		return errors.New("source must be server or client")
+	}
+	if e.OccurredAt.IsZero() {
+		return errors.New("occurred_at is missing")
+	}
+
+	skew := conf.AppConfig().Activity.MaxFutureSkew
+	if skew == 0 {
+		skew = 5 * time.Minute
+	}
+	if e.OccurredAt.After(e.ReceivedAt.Add(skew)) {
+		return errors.New("occurred_at is in the future")
+	}
+
+	maxBytes := conf.AppConfig().Activity.MaxPropsBytes
+	if maxBytes == 0 {
+		maxBytes = 8192
+	}
+	props, err := json.Marshal(e.Properties)
+	if err != nil {
+		return err
+	}
+	if len(props) > maxBytes {
+		return fmt.Errorf("properties are larger than %d bytes", maxBytes)
+	}
+	if len(e.UserAgent) > 512 {
+		e.UserAgent = e.UserAgent[:512]
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package activity
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/user_analytics/conf"
+)
+
+// Session is a run of a user's events without a gap longer than the
+// session timeout
+type Session struct {
+	ID          string    `json:"id"`
+	UserID      int64     `json:"user_id"`
+	StartedAt   time.Time `json:"started_at"`
+	LastEventAt time.Time `json:"last_event_at"`
+	EventCount  int64     `json:"event_count"`
+	DurationSec float64   `json:"duration_seconds"`
+}
+
+var schemas = []string{
+	`CREATE TABLE IF NOT EXISTS activity_events (
+		event_id VARCHAR(64) PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		session_id VARCHAR(64) NOT NULL,
+		type VARCHAR(32) NOT NULL,
+		source VARCHAR(8) NOT NULL,
+		occurred_at DATETIME(6) NOT NULL,
+		received_at DATETIME(6) NOT NULL,
+		auth_session_id VARCHAR(64) NOT NULL DEFAULT '',
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		user_agent VARCHAR(512) NOT NULL DEFAULT '',
+		properties JSON NOT NULL,
+		INDEX idx_activity_user (user_id, occurred_at),
+		INDEX idx_activity_type (type, occurred_at),
+		INDEX idx_activity_session (session_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS activity_sessions (
+		id VARCHAR(64) PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		started_at DATETIME(6) NOT NULL,
+		last_event_at DATETIME(6) NOT NULL,
+		event_count BIGINT NOT NULL,
+		INDEX idx_sessions_user (user_id, last_event_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS activity_rejects (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		raw MEDIUMTEXT NOT NULL,
+		reason VARCHAR(255) NOT NULL,
+		received_at DATETIME(6) NOT NULL
+	)`,
+}
+
+func EnsureSchema(db *sql.DB) error {
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sessionTimeout() time.Duration {
+	if timeout := conf.AppConfig().Activity.SessionTimeout; timeout > 0 {
+		return timeout
+	}
+	return 30 * time.Minute
+}
+
+// Record stores a valid event and assigns it to a session. The event joins
+// the session it falls within the timeout of, stretching it as needed, or
+// starts a new one. Events already stored are skipped, so redelivered
+// messages do not count twice.
+func Record(db *sql.DB, e *Event) error {
+	props, err := json.Marshal(e.Properties)
+	if err != nil {
+		return err
+	}
+	if e.Properties == nil {
+		props = []byte("{}")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow("SELECT 1 FROM activity_events WHERE event_id = ?", e.EventID).Scan(&exists)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	timeout := sessionTimeout()
+	s := Session{}
+	err = tx.QueryRow(
+		`SELECT id, started_at, last_event_at FROM activity_sessions
+		WHERE user_id = ? AND started_at <= ? AND last_event_at >= ? ORDER BY last_event_at DESC LIMIT 1 FOR UPDATE`,
+		e.UserID, e.OccurredAt.Add(timeout), e.OccurredAt.Add(-timeout),
+	).Scan(&s.ID, &s.StartedAt, &s.LastEventAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		s.ID = utils.NewID()
+		_, err = tx.Exec(
+			"INSERT INTO activity_sessions (id, user_id, started_at, last_event_at, event_count) VALUES (?, ?, ?, ?, 1)",
+			s.ID, e.UserID, e.OccurredAt, e.OccurredAt,
+		)
+	case err == nil:
+		// Late events can land before the start of the session
+		_, err = tx.Exec(
+			`UPDATE activity_sessions SET started_at = LEAST(started_at, ?), last_event_at = GREATEST(last_event_at, ?),
+			event_count = event_count + 1 WHERE id = ?`,
+			e.OccurredAt, e.OccurredAt, s.ID,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.SessionID = s.ID
+	_, err = tx.Exec(
+		`INSERT INTO activity_events (event_id, user_id, session_id, type, source, occurred_at, received_at, auth_session_id, ip, user_agent, properties)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.EventID, e.UserID, e.SessionID, e.Type, e.Source, e.OccurredAt.UTC(), e.ReceivedAt.UTC(), e.AuthSessionID, e.IP, e.UserAgent, props,
+	)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		// Stored by a concurrent delivery, the rollback undoes the session
+		// change
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reject keeps an event that failed validation around for inspection
+func Reject(db *sql.DB, raw []byte, reason string) error {
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	_, err := db.Exec("INSERT INTO activity_rejects (raw, reason, received_at) VALUES (?, ?, ?)", string(raw), reason, time.Now().UTC())
+	return err
+}
+
+// TimelineFilter narrows down a user's timeline, zero values are ignored
+type TimelineFilter struct {
+	Types     []string
+	SessionID string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
+
+// Timeline returns a page of the user's events, newest first
+func Timeline(db *sql.DB, userID int64, filter TimelineFilter) ([]Event, error) {
+	where := []string{"user_id = ?"}
+	args := []interface{}{userID}
+	if len(filter.Types) > 0 {
+		where = append(where, "type IN (?"+strings.Repeat(", ?", len(filter.Types)-1)+")")
+		for _, t := range filter.Types {
+			args = append(args, t)
+		}
+	}
+	if filter.SessionID != "" {
+		where = append(where, "session_id = ?")
+		args = append(args, filter.SessionID)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "occurred_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "occurred_at < ?")
+		args = append(args, filter.To)
+	}
+
+	rows, err := db.Query(
+		`SELECT event_id, user_id, session_id, type, source, occurred_at, received_at, auth_session_id, ip, user_agent, properties
+		FROM activity_events WHERE `+strings.Join(where, " AND ")+" ORDER BY occurred_at DESC, event_id LIMIT ? OFFSET ?",
+		append(args, filter.Limit, filter.Offset)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		var props []byte
+		err := rows.Scan(&e.EventID, &e.UserID, &e.SessionID, &e.Type, &e.Source, &e.OccurredAt, &e.ReceivedAt,
+			&e.AuthSessionID, &e.IP, &e.UserAgent, &props)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(props, &e.Properties); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Sessions returns a page of the user's sessions, newest first
+func Sessions(db *sql.DB, userID int64, from, to time.Time, limit, offset int) ([]Session, error) {
+	where := "user_id = ?"
+	args := []interface{}{userID}
+	if !from.IsZero() {
+		where += " AND last_event_at >= ?"
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		where += " AND started_at < ?"
+		args = append(args, to)
+	}
+
+	rows, err := db.Query(
+		"SELECT id, user_id, started_at, last_event_at, event_count FROM activity_sessions WHERE "+where+" ORDER BY started_at DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.StartedAt, &s.LastEventAt, &s.EventCount); err != nil {
+			return nil, err
+		}
+		s.DurationSec = s.LastEventAt.Sub(s.StartedAt).Seconds()
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
@@ -1,22 +1,137 @@
 package api
 
 import (
-	"fmt"
-	"strconv"
-
 	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/database"
+	"github.com/rohanchavan1918/kse-common/health"
+	"github.com/rohanchavan1918/kse-common/kafkaadmin"
+	"github.com/rohanchavan1918/kse-common/lifecycle"
+	"github.com/rohanchavan1918/kse-common/metrics"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/user_analytics/activity"
 	"github.com/rohanchavan1918/user_analytics/conf"
-	"github.com/rohanchavan1918/user_analytics/utils"
+	"github.com/rohanchavan1918/user_analytics/reports"
+	"github.com/rohanchavan1918/user_analytics/surveillance"
+	"github.com/rohanchavan1918/user_analytics/traders"
 )
 
 func RunServer(config *conf.Config) {
-	r := gin.Default()
+	// Requests are logged by the logging middleware, as JSON
+	r := gin.New()
+	// Client IPs come from X-Forwarded-For only behind the configured proxies
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	r.Use(gin.Recovery())
 	SetupRoutes(r)
-	dbConn := conf.GetDBConnection(&config.DB)
-	err := dbConn.Ping()
+	dbConn, err := database.Open(&config.DB)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer dbConn.Close()
+	err = dbConn.Ping()
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+
+	// Once DB Connection is validated, add it to the global connections
+	conf.AppConnections.DB = dbConn
+	metrics.TrackDB(dbConn, config.ServiceName)
+	health.Ready("db", health.DB(dbConn))
+	kafkaConfig, topicNames := config.KafkaSettings()
+	topics := config.KafkaConfig.Topics
+	// Create or fix the topics first when provision.ensure_on_startup is set
+	if err := kafkaadmin.EnsureOnStartup(kafkaConfig, topicNames); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	health.Ready("kafka", health.Kafka(kafkaConfig))
+	health.Ready("kafka_topics", health.KafkaTopics(kafkaConfig, topicNames...))
+
+	if err := activity.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	if err := traders.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	if err := surveillance.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+	if err := reports.EnsureSchema(dbConn); err != nil {
+		utils.AlertAndPanic(err)
+	}
+
+	// platform_apis publishes what users do, events are stored per user
+	// and grouped into sessions
+	activityReader, err := config.KafkaConfig.GetConsumer(config.KafkaConfig.Topics.Activity, config.KafkaConfig.GroupID)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer activityReader.Close()
+	health.WatchConsumer(kafkaConfig, config.KafkaConfig.GroupID, topics.Activity)
+	health.Go("activity.consumer", func() { activity.Consume(lifecycle.Context(), dbConn, activityReader) })
+
+	// Every trade feeds the metrics and leaderboards of both traders
+	tradesReader, err := config.KafkaConfig.GetConsumer(config.KafkaConfig.Topics.Trades, config.KafkaConfig.GroupID+"-traders")
 	if err != nil {
 		utils.AlertAndPanic(err)
 	}
-	port := fmt.Sprintf(":%s", strconv.Itoa(int(conf.AppConfig.Port)))
-	r.Run(port)
+	defer tradesReader.Close()
+	health.WatchConsumer(kafkaConfig, config.KafkaConfig.GroupID+"-traders", topics.Trades)
+	health.Go("traders.trades", func() { traders.ConsumeTrades(lifecycle.Context(), dbConn, tradesReader) })
+
+	// Surveillance watches orders and trades for market abuse and opens
+	// cases for compliance to review
+	monitor := surveillance.NewMonitor(dbConn)
+	surveillanceGroup := config.KafkaConfig.GroupID + "-surveillance"
+	commandReader, err := config.KafkaConfig.GetConsumer(config.KafkaConfig.Topics.OrderCommands, surveillanceGroup)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer commandReader.Close()
+	health.WatchConsumer(kafkaConfig, surveillanceGroup, topics.OrderCommands)
+	health.Go("surveillance.order_commands", func() { surveillance.ConsumeOrderCommands(lifecycle.Context(), monitor, commandReader) })
+
+	reportReader, err := config.KafkaConfig.GetConsumer(config.KafkaConfig.Topics.ExecutionReports, surveillanceGroup)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer reportReader.Close()
+	health.WatchConsumer(kafkaConfig, surveillanceGroup, topics.ExecutionReports)
+	health.Go("surveillance.execution_reports", func() { surveillance.ConsumeExecutionReports(lifecycle.Context(), monitor, reportReader) })
+
+	surveillanceTradesReader, err := config.KafkaConfig.GetConsumer(config.KafkaConfig.Topics.Trades, surveillanceGroup)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer surveillanceTradesReader.Close()
+	health.WatchConsumer(kafkaConfig, surveillanceGroup, topics.Trades)
+	health.Go("surveillance.trades", func() { surveillance.ConsumeTrades(lifecycle.Context(), monitor, surveillanceTradesReader) })
+	health.Go("surveillance.monitor", func() { monitor.Run() })
+
+	// End of day files for finance, built from trades kept for the purpose
+	// and the shared ledger
+	reportTradesReader, err := config.KafkaConfig.GetConsumer(config.KafkaConfig.Topics.Trades, config.KafkaConfig.GroupID+"-reports")
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	defer reportTradesReader.Close()
+	health.WatchConsumer(kafkaConfig, config.KafkaConfig.GroupID+"-reports", topics.Trades)
+	health.Go("reports.trades", func() { reports.ConsumeTrades(lifecycle.Context(), dbConn, reportTradesReader) })
+
+	reportStore, err := reports.NewStore(config.Reports.Storage)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	reports.DefaultScheduler, err = reports.NewScheduler(dbConn, reportStore, config.Reports.Storage.Prefix, config.Reports.Schedules)
+	if err != nil {
+		utils.AlertAndPanic(err)
+	}
+	reports.DefaultScheduler.Start()
+
+	// Apply live settings from the config file without a restart
+	lifecycle.WatchConfig(&conf.Running, nil)
+
+	if err := lifecycle.Serve(r, config.Port); err != nil {
+		utils.LogError("Server stopped : %s", err)
+	}
 }
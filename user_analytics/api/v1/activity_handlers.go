@@ -0,0 +1,132 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/user_analytics/activity"
+	"github.com/rohanchavan1918/user_analytics/conf"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// pageParams parses limit and offset, replying 400 when they are invalid
+func pageParams(c *gin.Context) (int, int, bool) {
+	limit, offset := defaultPageSize, 0
+	var err error
+	if raw := c.Query("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 || limit > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxPageSize)})
+			return 0, 0, false
+		}
+	}
+	if raw := c.Query("offset"); raw != "" {
+		if offset, err = strconv.Atoi(raw); err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative number"})
+			return 0, 0, false
+		}
+	}
+	return limit, offset, true
+}
+
+// timeRange parses from and to as RFC3339 timestamps, replying 400 when they
+// are invalid
+func timeRange(c *gin.Context) (time.Time, time.Time, bool) {
+	var from, to time.Time
+	var err error
+	if raw := c.Query("from"); raw != "" {
+		if from, err = time.Parse(time.RFC3339, raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC3339 timestamp"})
+			return from, to, false
+		}
+	}
+	if raw := c.Query("to"); raw != "" {
+		if to, err = time.Parse(time.RFC3339, raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC3339 timestamp"})
+			return from, to, false
+		}
+	}
+	return from, to, true
+}
+
+func userIDParam(c *gin.Context) (int64, bool) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be a positive number"})
+		return 0, false
+	}
+	return userID, true
+}
+
+func UserTimeline(c *gin.Context) {
+	// Filters: type (comma separated), session_id, from and to (RFC3339),
+	// paginated with limit and offset
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	from, to, ok := timeRange(c)
+	if !ok {
+		return
+	}
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	filter := activity.TimelineFilter{SessionID: c.Query("session_id"), From: from, To: to, Limit: limit, Offset: offset}
+	if types := c.Query("type"); types != "" {
+		filter.Types = strings.Split(strings.ToLower(types), ",")
+	}
+	events, err := activity.Timeline(conf.AppConnections.DB, userID, filter)
+	if err != nil {
+		utils.LogError("Failed to load timeline : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load timeline.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func UserSessions(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	from, to, ok := timeRange(c)
+	if !ok {
+		return
+	}
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := activity.Sessions(conf.AppConnections.DB, userID, from, to, limit, offset)
+	if err != nil {
+		utils.LogError("Failed to load sessions : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load sessions.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
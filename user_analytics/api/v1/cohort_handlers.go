@@ -0,0 +1,211 @@
+package v1
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/user_analytics/cohorts"
+	"github.com/rohanchavan1918/user_analytics/conf"
+)
+
+// analysisRange is timeRange defaulting to the last 30 days
+func analysisRange(c *gin.Context) (time.Time, time.Time, bool) {
+	from, to, ok := timeRange(c)
+	if !ok {
+		return from, to, false
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -30)
+	}
+	return from, to, true
+}
+
+func splitTypes(raw string) []string {
+	types := []string{}
+	for _, t := range strings.Split(strings.ToLower(raw), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+func wantsCSV(c *gin.Context) bool {
+	return strings.EqualFold(c.Query("format"), "csv")
+}
+
+func writeCSV(c *gin.Context, filename string, records [][]string) {
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	if err := w.WriteAll(records); err != nil {
+		utils.LogError("Failed to write %s : %s", filename, err)
+	}
+}
+
+func formatOptional(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func cohortError(c *gin.Context, err error, action string) {
+	if errors.Is(err, cohorts.ErrFunnelNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, cohorts.ErrInvalidGranularity) || errors.Is(err, cohorts.ErrInvalidRange) ||
+		errors.Is(err, cohorts.ErrInvalidSteps) || errors.Is(err, cohorts.ErrUnknownEventType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	utils.LogError("Failed to %s : %s", action, err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "Failed to " + action + ".",
+	})
+}
+
+func CohortRetention(c *gin.Context) {
+	// granularity is day (default) or week, from and to (RFC3339) bound the
+	// signups, periods defaults to 30 days or 12 weeks, active_types (comma
+	// separated) overrides the configured ones, format=csv downloads it
+	from, to, ok := analysisRange(c)
+	if !ok {
+		return
+	}
+	granularity := strings.ToLower(c.DefaultQuery("granularity", cohorts.GranularityDay))
+	periods := 30
+	if granularity == cohorts.GranularityWeek {
+		periods = 12
+	}
+	if raw := c.Query("periods"); raw != "" {
+		var err error
+		if periods, err = strconv.Atoi(raw); err != nil || periods < 1 || periods > cohorts.MaxPeriods() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "periods must be between 1 and " + strconv.Itoa(cohorts.MaxPeriods())})
+			return
+		}
+	}
+	activeTypes := conf.AppConfig().Cohorts.ActiveTypes
+	if raw, ok := c.GetQuery("active_types"); ok {
+		activeTypes = splitTypes(raw)
+	}
+
+	matrix, err := cohorts.RetentionMatrix(conf.AppConnections.DB, granularity, from, to, periods, activeTypes, time.Now().UTC())
+	if err != nil {
+		cohortError(c, err, "build retention matrix")
+		return
+	}
+	if !wantsCSV(c) {
+		c.JSON(http.StatusOK, matrix)
+		return
+	}
+
+	header := []string{"cohort", "size"}
+	for p := 0; p < periods; p++ {
+		header = append(header, fmt.Sprintf("retained_%d", p))
+	}
+	for p := 0; p < periods; p++ {
+		header = append(header, fmt.Sprintf("rate_%d", p))
+	}
+	records := [][]string{header}
+	for _, cohort := range matrix.Cohorts {
+		record := []string{cohort.Start, strconv.FormatInt(cohort.Size, 10)}
+		for _, retained := range cohort.Retained {
+			if retained == nil {
+				record = append(record, "")
+			} else {
+				record = append(record, strconv.FormatInt(*retained, 10))
+			}
+		}
+		for _, rate := range cohort.Rates {
+			record = append(record, formatOptional(rate))
+		}
+		records = append(records, record)
+	}
+	writeCSV(c, "retention_"+granularity+".csv", records)
+}
+
+func ListFunnels(c *gin.Context) {
+	type funnel struct {
+		Name          string   `json:"name"`
+		Steps         []string `json:"steps"`
+		WindowSeconds float64  `json:"window_seconds"`
+	}
+	funnels := []funnel{}
+	for name, definition := range cohorts.Definitions() {
+		funnels = append(funnels, funnel{Name: name, Steps: definition.Steps, WindowSeconds: definition.Window.Seconds()})
+	}
+	c.JSON(http.StatusOK, gin.H{"funnels": funnels})
+}
+
+func RunFunnel(c *gin.Context) {
+	// Runs a configured funnel, or the steps (comma separated) and window
+	// given in the query when the name is custom. from and to (RFC3339)
+	// bound entering the funnel, granularity (day or week) adds a breakdown
+	// by when users entered, format=csv downloads it.
+	from, to, ok := analysisRange(c)
+	if !ok {
+		return
+	}
+	name := strings.ToLower(c.Param("name"))
+
+	var definition conf.FunnelConfig
+	if name == "custom" {
+		definition.Steps = splitTypes(c.Query("steps"))
+		if raw := c.Query("window"); raw != "" {
+			window, err := time.ParseDuration(raw)
+			if err != nil || window <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "window must be a positive duration such as 168h"})
+				return
+			}
+			definition.Window = window
+		}
+	} else {
+		var err error
+		if definition, err = cohorts.Definition(name); err != nil {
+			cohortError(c, err, "run funnel")
+			return
+		}
+	}
+
+	granularity := strings.ToLower(c.Query("granularity"))
+	funnel, err := cohorts.RunFunnel(conf.AppConnections.DB, name, definition.Steps, definition.Window, from, to, granularity)
+	if err != nil {
+		cohortError(c, err, "run funnel")
+		return
+	}
+	if !wantsCSV(c) {
+		c.JSON(http.StatusOK, funnel)
+		return
+	}
+
+	header := []string{"cohort"}
+	for i, step := range funnel.Steps {
+		prefix := fmt.Sprintf("%d_%s", i+1, step.Type)
+		header = append(header, prefix+"_users", prefix+"_conversion", prefix+"_median_seconds")
+	}
+	row := func(cohort string, steps []cohorts.Step) []string {
+		record := []string{cohort}
+		for _, step := range steps {
+			record = append(record, strconv.FormatInt(step.Users, 10), formatOptional(step.ConversionFromStart), formatOptional(step.MedianSecondsFromPrevious))
+		}
+		return record
+	}
+	records := [][]string{header, row("all", funnel.Steps)}
+	for _, cohort := range funnel.Cohorts {
+		records = append(records, row(cohort.Start, cohort.Steps))
+	}
+	writeCSV(c, "funnel_"+name+".csv", records)
+}
@@ -1,13 +1,11 @@
 package v1
 
 import (
-	"net/http"
-
 	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/health"
 )
 
+// Healthcheck answers like /livez, it is kept for callers of the old path
 func Healthcheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"message": "OK",
-	})
+	health.LiveHandler()(c)
 }
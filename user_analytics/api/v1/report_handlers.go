@@ -0,0 +1,73 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/user_analytics/conf"
+	"github.com/rohanchavan1918/user_analytics/reports"
+)
+
+type reportRunRequest struct {
+	Day   string `json:"day" binding:"required"`
+	Force bool   `json:"force"`
+}
+
+func ListReportSchedules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"schedules": reports.DefaultScheduler.Schedules()})
+}
+
+func ListReportRuns(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	runs, total, err := reports.ListRuns(conf.AppConnections.DB, c.Query("schedule"), limit, offset)
+	if err != nil {
+		utils.LogError("Failed to load report runs : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load report runs.",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"runs":   runs,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func RunReport(c *gin.Context) {
+	// Produces a schedule's report for a past day out of schedule, force
+	// produces it again when it already was
+	var req reportRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	day, err := time.Parse("2006-01-02", req.Day)
+	if err != nil || !day.Before(time.Now().UTC().Truncate(24*time.Hour)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "day must be a past day such as 2006-01-02"})
+		return
+	}
+
+	run, err := reports.DefaultScheduler.Trigger(c.Param("name"), day, req.Force)
+	switch {
+	case errors.Is(err, reports.ErrScheduleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, reports.ErrAlreadyRun), errors.Is(err, reports.ErrRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		utils.LogError("Failed to start report %s : %s", c.Param("name"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to start report.",
+		})
+	default:
+		c.JSON(http.StatusAccepted, run)
+	}
+}
@@ -2,9 +2,34 @@ package v1
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/access"
+	"github.com/rohanchavan1918/user_analytics/auth"
 )
 
 func SetupRoutes(r *gin.RouterGroup) {
 	v1Group := r.Group("/v1")
 	v1Group.GET("/healthcheck", Healthcheck)
+
+	v1Group.GET("/users/:user_id/timeline", auth.RequireUser("user_id", access.RoleAdmin), UserTimeline)
+	v1Group.GET("/users/:user_id/sessions", auth.RequireUser("user_id", access.RoleAdmin), UserSessions)
+
+	v1Group.GET("/traders/:user_id/metrics", auth.RequireUser("user_id", access.RoleAdmin), TraderMetrics)
+	v1Group.GET("/traders/:user_id/privacy", auth.RequireUser("user_id", access.RoleAdmin), GetTraderPrivacy)
+	v1Group.PUT("/traders/:user_id/privacy", auth.RequireUser("user_id", access.RoleAdmin), SetTraderPrivacy)
+	v1Group.GET("/leaderboards/:period", Leaderboard)
+
+	v1Group.GET("/cohorts/retention", CohortRetention)
+	v1Group.GET("/funnels", ListFunnels)
+	v1Group.GET("/funnels/:name", RunFunnel)
+
+	v1Group.GET("/reports/schedules", ListReportSchedules)
+	v1Group.POST("/reports/schedules/:name/runs", access.Require(access.RoleAdmin), RunReport)
+	v1Group.GET("/reports/runs", ListReportRuns)
+
+	v1Group.GET("/surveillance/cases", access.Require(access.RoleCompliance), ListCases)
+	v1Group.GET("/surveillance/cases/:case_id", access.Require(access.RoleCompliance), GetCase)
+	v1Group.PATCH("/surveillance/cases/:case_id", access.Require(access.RoleCompliance), UpdateCaseStatus)
+	v1Group.GET("/surveillance/links", access.Require(access.RoleCompliance), ListAccountLinks)
+	v1Group.POST("/surveillance/links", access.Require(access.RoleCompliance), LinkAccounts)
+	v1Group.DELETE("/surveillance/links/:user_id_a/:user_id_b", access.Require(access.RoleCompliance), UnlinkAccounts)
 }
@@ -0,0 +1,154 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/user_analytics/conf"
+	"github.com/rohanchavan1918/user_analytics/surveillance"
+)
+
+type caseStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+	Note   string `json:"note"`
+}
+
+type linkRequest struct {
+	UserIDA int64  `json:"user_id_a" binding:"required"`
+	UserIDB int64  `json:"user_id_b" binding:"required"`
+	Reason  string `json:"reason" binding:"required"`
+}
+
+func surveillanceError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, surveillance.ErrNotFound), errors.Is(err, surveillance.ErrLinkNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, surveillance.ErrCaseClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, surveillance.ErrInvalidStatus), errors.Is(err, surveillance.ErrSelfLink), errors.Is(err, surveillance.ErrInvalidReason):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		utils.LogError("Failed to %s : %s", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to " + action + ".",
+		})
+	}
+}
+
+func ListCases(c *gin.Context) {
+	// Filters: type, status, symbol, user_id, from and to (RFC3339, on when
+	// the case was opened), paginated with limit and offset
+	from, to, ok := timeRange(c)
+	if !ok {
+		return
+	}
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	filter := surveillance.Filter{
+		Type:   strings.ToLower(c.Query("type")),
+		Status: strings.ToLower(c.Query("status")),
+		Symbol: strings.ToUpper(c.Query("symbol")),
+		From:   from,
+		To:     to,
+		Limit:  limit,
+		Offset: offset,
+	}
+	if raw := c.Query("user_id"); raw != "" {
+		userID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || userID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be a positive number"})
+			return
+		}
+		filter.UserID = userID
+	}
+
+	cases, total, err := surveillance.List(conf.AppConnections.DB, filter)
+	if err != nil {
+		surveillanceError(c, err, "load cases")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"cases":  cases,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func GetCase(c *gin.Context) {
+	found, evidence, err := surveillance.Get(conf.AppConnections.DB, c.Param("case_id"))
+	if err != nil {
+		surveillanceError(c, err, "load case")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"case":     found,
+		"evidence": evidence,
+	})
+}
+
+func UpdateCaseStatus(c *gin.Context) {
+	var req caseStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := surveillance.SetStatus(conf.AppConnections.DB, c.Param("case_id"), strings.ToLower(req.Status), req.Note)
+	if err != nil {
+		surveillanceError(c, err, "update case")
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+func ListAccountLinks(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be a positive number"})
+		return
+	}
+
+	links, err := surveillance.ListLinks(conf.AppConnections.DB, userID)
+	if err != nil {
+		surveillanceError(c, err, "load account links")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"links": links})
+}
+
+func LinkAccounts(c *gin.Context) {
+	var req linkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	link, err := surveillance.LinkAccounts(conf.AppConnections.DB, req.UserIDA, req.UserIDB, req.Reason)
+	if err != nil {
+		surveillanceError(c, err, "link accounts")
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+func UnlinkAccounts(c *gin.Context) {
+	a, errA := strconv.ParseInt(c.Param("user_id_a"), 10, 64)
+	b, errB := strconv.ParseInt(c.Param("user_id_b"), 10, 64)
+	if errA != nil || errB != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User IDs must be numbers"})
+		return
+	}
+
+	if err := surveillance.UnlinkAccounts(conf.AppConnections.DB, a, b); err != nil {
+		surveillanceError(c, err, "unlink accounts")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
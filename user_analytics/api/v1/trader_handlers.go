@@ -0,0 +1,126 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/user_analytics/conf"
+	"github.com/rohanchavan1918/user_analytics/traders"
+)
+
+type privacyRequest struct {
+	LeaderboardOptOut bool   `json:"leaderboard_opt_out"`
+	DisplayName       string `json:"display_name"`
+}
+
+func TraderMetrics(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	metrics, err := traders.UserMetrics(conf.AppConnections.DB, userID, time.Now())
+	if err != nil {
+		utils.LogError("Failed to load trader metrics : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load trader metrics.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userID,
+		"windows": metrics,
+	})
+}
+
+func Leaderboard(c *gin.Context) {
+	// metric defaults to realized_pnl, date (YYYY-MM-DD) picks a past day or
+	// week and defaults to today
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	metric := c.DefaultQuery("metric", "realized_pnl")
+	day := time.Now()
+	if raw := c.Query("date"); raw != "" {
+		var err error
+		if day, err = time.Parse("2006-01-02", raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must look like 2006-01-02"})
+			return
+		}
+	}
+
+	entries, total, err := traders.Leaderboard(conf.AppConnections.DB, c.Param("period"), metric, day, limit, offset)
+	if errors.Is(err, traders.ErrInvalidPeriod) || errors.Is(err, traders.ErrInvalidRanking) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		utils.LogError("Failed to load leaderboard : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load leaderboard.",
+		})
+		return
+	}
+
+	response := gin.H{
+		"period":  c.Param("period"),
+		"metric":  metric,
+		"entries": entries,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	}
+	if from, to, _ := traders.PeriodBounds(c.Param("period"), day); !from.IsZero() {
+		response["from"] = from.Format("2006-01-02")
+		response["to"] = to.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func GetTraderPrivacy(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	privacy, err := traders.GetPrivacy(conf.AppConnections.DB, userID)
+	if err != nil {
+		utils.LogError("Failed to load privacy settings : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load privacy settings.",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, privacy)
+}
+
+func SetTraderPrivacy(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	var req privacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	privacy, err := traders.SetPrivacy(conf.AppConnections.DB, userID, req.LeaderboardOptOut, req.DisplayName)
+	if errors.Is(err, traders.ErrInvalidDisplayName) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		utils.LogError("Failed to save privacy settings : %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to save privacy settings.",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, privacy)
+}
@@ -0,0 +1,121 @@
+// Package auth checks the access tokens platform_apis gives users, so
+// users can reach their own data here with the token they already have
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rohanchavan1918/kse-common/access"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/user_analytics/conf"
+)
+
+const userContextKey = "auth.user_id"
+
+var ErrInvalidToken = errors.New("Invalid or expired token")
+
+// Claims carried by the access tokens of platform_apis
+type Claims struct {
+	UserID    int64  `json:"uid"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// ParseAccessToken verifies a token the way platform_apis does
+func ParseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return []byte(conf.AppConfig().Auth.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if issuer := conf.AppConfig().Auth.Issuer; issuer != "" && !claims.VerifyIssuer(issuer, true) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// sessionActive reports whether the user logged out of the session the token
+// belongs to. Sessions are kept by platform_apis in the shared database.
+var sessionActive = func(db *sql.DB, sessionID string) (bool, error) {
+	var revokedAt sql.NullTime
+	err := db.QueryRow("SELECT revoked_at FROM auth_sessions WHERE id = ?", sessionID).Scan(&revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !revokedAt.Valid, nil
+}
+
+// RequireUser only lets through the user named by the param, authenticated
+// with their platform access token, and staff with an access token granting
+// one of roles
+func RequireUser(param string, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if access.Allowed(c, roles...) {
+			c.Next()
+			return
+		}
+
+		header := c.GetHeader("Authorization")
+		tokenString := strings.TrimPrefix(header, "Bearer ")
+		if header == "" || tokenString == header {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Missing bearer token",
+			})
+			return
+		}
+
+		claims, err := ParseAccessToken(tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		active, err := sessionActive(conf.AppConnections.DB, claims.SessionID)
+		if err != nil {
+			utils.LogError("Failed to look up session %s : %s", claims.SessionID, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to authenticate request",
+			})
+			return
+		}
+		if !active {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": ErrInvalidToken.Error(),
+			})
+			return
+		}
+
+		userID, err := strconv.ParseInt(c.Param(param), 10, 64)
+		if err != nil || userID != claims.UserID {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "You can only access your own data",
+			})
+			return
+		}
+
+		c.Set(userContextKey, claims.UserID)
+		c.Next()
+	}
+}
+
+// CurrentUserID returns the user let in by RequireUser, 0 for staff
+func CurrentUserID(c *gin.Context) int64 {
+	return c.GetInt64(userContextKey)
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rohanchavan1918/kse-common/access"
+	commonconf "github.com/rohanchavan1918/kse-common/config"
+	"github.com/rohanchavan1918/user_analytics/conf"
+)
+
+func signToken(t *testing.T, secret, issuer string, userID int64, sessionID string, expires time.Time) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	})
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestRequireUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	conf.Running.Store(&conf.Config{Auth: conf.AuthConfig{JWTSecret: "test-secret", Issuer: "kse-platform-api"}})
+	defer conf.Running.Store(&conf.Config{})
+	access.Configure(&commonconf.Access{Tokens: []commonconf.AccessToken{
+		{Name: "ops", Token: "admin-token-admin-token-admin-token", Roles: []string{access.RoleAdmin}},
+		{Name: "review", Token: "compliance-token-compliance-token", Roles: []string{access.RoleCompliance}},
+	}})
+	defer access.Configure(&commonconf.Access{})
+
+	activeSessions := map[string]bool{"s-1": true}
+	defer func(original func(*sql.DB, string) (bool, error)) { sessionActive = original }(sessionActive)
+	sessionActive = func(_ *sql.DB, sessionID string) (bool, error) {
+		return activeSessions[sessionID], nil
+	}
+
+	r := gin.New()
+	r.PUT("/traders/:user_id/privacy", RequireUser("user_id", access.RoleAdmin), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": CurrentUserID(c), "staff": access.Staff(c)})
+	})
+
+	hour := time.Now().Add(time.Hour)
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		status        int
+	}{
+		{"no token", "/traders/7/privacy", "", http.StatusUnauthorized},
+		{"not a bearer token", "/traders/7/privacy", signToken(t, "test-secret", "kse-platform-api", 7, "s-1", hour), http.StatusUnauthorized},
+		{"own settings", "/traders/7/privacy", "Bearer " + signToken(t, "test-secret", "kse-platform-api", 7, "s-1", hour), http.StatusOK},
+		{"someone else's settings", "/traders/8/privacy", "Bearer " + signToken(t, "test-secret", "kse-platform-api", 7, "s-1", hour), http.StatusForbidden},
+		{"bad user id", "/traders/me/privacy", "Bearer " + signToken(t, "test-secret", "kse-platform-api", 7, "s-1", hour), http.StatusForbidden},
+		{"wrong secret", "/traders/7/privacy", "Bearer " + signToken(t, "other-secret", "kse-platform-api", 7, "s-1", hour), http.StatusUnauthorized},
+		{"wrong issuer", "/traders/7/privacy", "Bearer " + signToken(t, "test-secret", "someone", 7, "s-1", hour), http.StatusUnauthorized},
+		{"expired", "/traders/7/privacy", "Bearer " + signToken(t, "test-secret", "kse-platform-api", 7, "s-1", time.Now().Add(-time.Minute)), http.StatusUnauthorized},
+		{"logged out", "/traders/7/privacy", "Bearer " + signToken(t, "test-secret", "kse-platform-api", 7, "s-2", hour), http.StatusUnauthorized},
+		{"admin", "/traders/8/privacy", "Bearer admin-token-admin-token-admin-token", http.StatusOK},
+		{"other staff role", "/traders/8/privacy", "Bearer compliance-token-compliance-token", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
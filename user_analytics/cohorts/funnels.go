@@ -0,0 +1,212 @@
+package cohorts
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rohanchavan1918/user_analytics/conf"
+)
+
+const (
+	defaultFunnelWindow = 30 * 24 * time.Hour
+	maxFunnelSteps      = 10
+)
+
+var (
+	ErrFunnelNotFound = errors.New("Funnel not found")
+	ErrInvalidSteps   = errors.New("A funnel needs 2 to 10 steps")
+)
+
+// Step is how far users got in a funnel. Conversions are nil when nobody
+// reached the step before.
+type Step struct {
+	Type                      string   `json:"type"`
+	Users                     int64    `json:"users"`
+	ConversionFromStart       *float64 `json:"conversion_from_start"`
+	ConversionFromPrevious    *float64 `json:"conversion_from_previous"`
+	MedianSecondsFromPrevious *float64 `json:"median_seconds_from_previous"`
+}
+
+// FunnelCohort is the funnel of the users who entered it in one period
+type FunnelCohort struct {
+	Start string `json:"cohort"`
+	Steps []Step `json:"steps"`
+}
+
+type Funnel struct {
+	Name          string         `json:"name"`
+	Steps         []Step         `json:"steps"`
+	WindowSeconds float64        `json:"window_seconds"`
+	Granularity   string         `json:"granularity,omitempty"`
+	Cohorts       []FunnelCohort `json:"cohorts,omitempty"`
+}
+
+// Definition returns the steps and window of a configured funnel
+func Definition(name string) (conf.FunnelConfig, error) {
+	funnel, ok := conf.AppConfig().Cohorts.Funnels[strings.ToLower(name)]
+	if !ok {
+		return funnel, ErrFunnelNotFound
+	}
+	return funnel, nil
+}
+
+// Definitions returns every configured funnel by name
+func Definitions() map[string]conf.FunnelConfig {
+	funnels := conf.AppConfig().Cohorts.Funnels
+	if funnels == nil {
+		return map[string]conf.FunnelConfig{}
+	}
+	return funnels
+}
+
+// tally counts the users that reached each step and how long each step took
+type tally struct {
+	users   []int64
+	seconds [][]float64
+}
+
+func newTally(steps int) *tally {
+	return &tally{users: make([]int64, steps), seconds: make([][]float64, steps)}
+}
+
+func (t *tally) add(reached []time.Time) {
+	for i, at := range reached {
+		t.users[i]++
+		if i > 0 {
+			t.seconds[i] = append(t.seconds[i], at.Sub(reached[i-1]).Seconds())
+		}
+	}
+}
+
+func (t *tally) steps(types []string) []Step {
+	steps := make([]Step, len(types))
+	for i, eventType := range types {
+		steps[i] = Step{Type: eventType, Users: t.users[i]}
+		if i == 0 {
+			continue
+		}
+		if t.users[0] > 0 {
+			fromStart := float64(t.users[i]) / float64(t.users[0])
+			steps[i].ConversionFromStart = &fromStart
+		}
+		if t.users[i-1] > 0 {
+			fromPrevious := float64(t.users[i]) / float64(t.users[i-1])
+			steps[i].ConversionFromPrevious = &fromPrevious
+		}
+		if len(t.seconds[i]) > 0 {
+			sort.Float64s(t.seconds[i])
+			median := t.seconds[i][len(t.seconds[i])/2]
+			if len(t.seconds[i])%2 == 0 {
+				median = (median + t.seconds[i][len(t.seconds[i])/2-1]) / 2
+			}
+			steps[i].MedianSecondsFromPrevious = &median
+		}
+	}
+	return steps
+}
+
+// RunFunnel follows the users whose first event of the first step falls
+// between from and to through the remaining steps, in order and within
+// window of entering. With a granularity the funnel is also broken down by
+// the period users entered it.
+func RunFunnel(db *sql.DB, name string, types []string, window time.Duration, from, to time.Time, granularity string) (*Funnel, error) {
+	if len(types) < 2 || len(types) > maxFunnelSteps {
+		return nil, ErrInvalidSteps
+	}
+	if err := ValidateTypes(types); err != nil {
+		return nil, err
+	}
+	if granularity != "" && granularity != GranularityDay && granularity != GranularityWeek {
+		return nil, ErrInvalidGranularity
+	}
+	if !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+	if window <= 0 {
+		window = defaultFunnelWindow
+	}
+
+	distinct := map[string]bool{}
+	args := []interface{}{}
+	for _, t := range types {
+		if !distinct[t] {
+			distinct[t] = true
+			args = append(args, t)
+		}
+	}
+	args = append(args, from, to.Add(window), types[0], from, to)
+	rows, err := db.Query(
+		`SELECT user_id, type, occurred_at FROM activity_events
+		WHERE type IN (?`+strings.Repeat(", ?", len(distinct)-1)+`) AND occurred_at >= ? AND occurred_at < ?
+		AND user_id IN (SELECT user_id FROM activity_events WHERE type = ? AND occurred_at >= ? AND occurred_at < ?)
+		ORDER BY user_id, occurred_at, event_id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overall := newTally(len(types))
+	byCohort := map[string]*tally{}
+	var current int64
+	var reached []time.Time
+	flush := func() {
+		if len(reached) == 0 {
+			return
+		}
+		overall.add(reached)
+		if granularity != "" {
+			start := PeriodStart(granularity, reached[0]).Format("2006-01-02")
+			if byCohort[start] == nil {
+				byCohort[start] = newTally(len(types))
+			}
+			byCohort[start].add(reached)
+		}
+	}
+
+	for rows.Next() {
+		var userID int64
+		var eventType string
+		var at time.Time
+		if err := rows.Scan(&userID, &eventType, &at); err != nil {
+			return nil, err
+		}
+		if userID != current {
+			flush()
+			current, reached = userID, nil
+		}
+
+		switch {
+		case len(reached) == 0:
+			if eventType == types[0] && !at.Before(from) && at.Before(to) {
+				reached = append(reached, at)
+			}
+		case len(reached) < len(types):
+			if eventType == types[len(reached)] && at.Sub(reached[0]) <= window {
+				reached = append(reached, at)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	funnel := &Funnel{Name: name, Steps: overall.steps(types), WindowSeconds: window.Seconds(), Granularity: granularity}
+	if granularity != "" {
+		funnel.Cohorts = []FunnelCohort{}
+		starts := []string{}
+		for start := range byCohort {
+			starts = append(starts, start)
+		}
+		sort.Strings(starts)
+		for _, start := range starts {
+			funnel.Cohorts = append(funnel.Cohorts, FunnelCohort{Start: start, Steps: byCohort[start].steps(types)})
+		}
+	}
+	return funnel, nil
+}
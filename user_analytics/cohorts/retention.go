@@ -0,0 +1,175 @@
+package cohorts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rohanchavan1918/user_analytics/activity"
+	"github.com/rohanchavan1918/user_analytics/conf"
+)
+
+// Cohorts group users by the day or the week (starting on Monday) they
+// signed up, in UTC
+const (
+	GranularityDay  = "day"
+	GranularityWeek = "week"
+)
+
+var (
+	ErrInvalidGranularity = errors.New("granularity must be day or week")
+	ErrInvalidRange       = errors.New("from must be before to")
+	ErrUnknownEventType   = errors.New("unknown event type")
+)
+
+// signups is every user's first signup event
+const signups = `SELECT user_id, MIN(occurred_at) AS signed_up_at FROM activity_events WHERE type = 'signup'
+	GROUP BY user_id HAVING signed_up_at >= ? AND signed_up_at < ?`
+
+// Cohort is one row of a retention matrix. Retained and Rates have an entry
+// per period since signup, nil for periods that have not started yet.
+type Cohort struct {
+	Start    string     `json:"cohort"`
+	Size     int64      `json:"size"`
+	Retained []*int64   `json:"retained"`
+	Rates    []*float64 `json:"rates"`
+}
+
+type Retention struct {
+	Granularity string   `json:"granularity"`
+	Periods     int      `json:"periods"`
+	ActiveTypes []string `json:"active_types"`
+	Cohorts     []Cohort `json:"cohorts"`
+}
+
+// MaxPeriods is the most periods a matrix can have
+func MaxPeriods() int {
+	if limit := conf.AppConfig().Cohorts.MaxPeriods; limit > 0 {
+		return limit
+	}
+	return 90
+}
+
+// PeriodStart truncates t to the start of its day or week
+func PeriodStart(granularity string, t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if granularity == GranularityWeek {
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+func periodLength(granularity string) int {
+	if granularity == GranularityWeek {
+		return 7
+	}
+	return 1
+}
+
+// SQL for the start of the period a timestamp column falls in, and the
+// number of periods between two of them
+func periodExpr(granularity, column string) string {
+	if granularity == GranularityWeek {
+		return fmt.Sprintf("DATE_SUB(DATE(%s), INTERVAL WEEKDAY(%s) DAY)", column, column)
+	}
+	return fmt.Sprintf("DATE(%s)", column)
+}
+
+// ValidateTypes checks that every event type is one platform_apis emits
+func ValidateTypes(types []string) error {
+	for _, t := range types {
+		if !activity.IsKnownType(t) {
+			return fmt.Errorf("%w %q", ErrUnknownEventType, t)
+		}
+	}
+	return nil
+}
+
+// RetentionMatrix builds the retention of the users who signed up between
+// from and to. A user is retained in a period when they had an event of the
+// active types in it, any event when activeTypes is empty. Period 0 is the
+// signup period itself.
+func RetentionMatrix(db *sql.DB, granularity string, from, to time.Time, periods int, activeTypes []string, now time.Time) (*Retention, error) {
+	if granularity != GranularityDay && granularity != GranularityWeek {
+		return nil, ErrInvalidGranularity
+	}
+	if err := ValidateTypes(activeTypes); err != nil {
+		return nil, err
+	}
+	from = PeriodStart(granularity, from)
+	if !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+
+	cohortOf := periodExpr(granularity, "s.signed_up_at")
+	rows, err := db.Query("SELECT "+cohortOf+" AS cohort, COUNT(*) FROM ("+signups+") s GROUP BY cohort ORDER BY cohort", from, to)
+	if err != nil {
+		return nil, err
+	}
+	matrix := &Retention{Granularity: granularity, Periods: periods, ActiveTypes: activeTypes, Cohorts: []Cohort{}}
+	index := map[string]int{}
+	for rows.Next() {
+		var start time.Time
+		var size int64
+		if err := rows.Scan(&start, &size); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c := Cohort{Start: start.Format("2006-01-02"), Size: size, Retained: make([]*int64, periods), Rates: make([]*float64, periods)}
+		// Periods that have started can be reported, even if as zero
+		for p := 0; p < periods; p++ {
+			if start.AddDate(0, 0, p*periodLength(granularity)).After(now) {
+				break
+			}
+			retained, rate := int64(0), 0.0
+			c.Retained[p], c.Rates[p] = &retained, &rate
+		}
+		index[c.Start] = len(matrix.Cohorts)
+		matrix.Cohorts = append(matrix.Cohorts, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	activeFilter := ""
+	args := []interface{}{from, to}
+	if len(activeTypes) > 0 {
+		activeFilter = " AND e.type IN (?" + strings.Repeat(", ?", len(activeTypes)-1) + ")"
+		for _, t := range activeTypes {
+			args = append(args, t)
+		}
+	}
+	args = append(args, periods)
+	period := fmt.Sprintf("FLOOR(DATEDIFF(%s, %s) / %d)", periodExpr(granularity, "e.occurred_at"), cohortOf, periodLength(granularity))
+
+	rows, err = db.Query(
+		"SELECT "+cohortOf+" AS cohort, "+period+" AS period, COUNT(DISTINCT s.user_id) FROM ("+signups+") s "+
+			"JOIN activity_events e ON e.user_id = s.user_id AND e.occurred_at >= s.signed_up_at"+activeFilter+
+			" GROUP BY cohort, period HAVING period < ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var start time.Time
+		var p int
+		var retained int64
+		if err := rows.Scan(&start, &p, &retained); err != nil {
+			return nil, err
+		}
+		i, ok := index[start.Format("2006-01-02")]
+		if !ok || p < 0 || p >= periods {
+			continue
+		}
+		c := &matrix.Cohorts[i]
+		rate := float64(retained) / float64(c.Size)
+		c.Retained[p], c.Rates[p] = &retained, &rate
+	}
+	return matrix, rows.Err()
+}
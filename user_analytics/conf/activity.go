@@ -0,0 +1,11 @@
+package conf
+
+import "time"
+
+// ActivityConfig specifies how activity events are validated and grouped
+// into sessions
+type ActivityConfig struct {
+	SessionTimeout time.Duration `viper:"string" validate:"gte=0" mapstructure:"session_timeout"`
+	MaxFutureSkew  time.Duration `viper:"string" validate:"gte=0" mapstructure:"max_future_skew"`
+	MaxPropsBytes  int           `viper:"int" validate:"gte=0" mapstructure:"max_properties_bytes"`
+}
@@ -0,0 +1,8 @@
+package conf
+
+// AuthConfig checks the access tokens platform_apis gives users, it has to
+// match the auth settings of platform_apis
+type AuthConfig struct {
+	JWTSecret string `viper:"string" validate:"required" secret:"true" mapstructure:"jwt_secret"`
+	Issuer    string `viper:"string" mapstructure:"issuer"`
+}
@@ -0,0 +1,20 @@
+package conf
+
+import "time"
+
+// FunnelConfig is an ordered list of activity event types. A user converts
+// to a step by doing it after the previous one, within window of entering
+// the funnel.
+type FunnelConfig struct {
+	Steps  []string      `validate:"min=2,max=10" mapstructure:"steps"`
+	Window time.Duration `viper:"string" validate:"gt=0" mapstructure:"window"`
+}
+
+// CohortsConfig specifies how retention is measured and which funnels can
+// be queried by name
+type CohortsConfig struct {
+	// Event types that count as coming back, empty counts every event
+	ActiveTypes []string                `mapstructure:"active_types"`
+	MaxPeriods  int                     `viper:"int" validate:"gte=0" mapstructure:"max_periods"`
+	Funnels     map[string]FunnelConfig `validate:"dive" mapstructure:"funnels"`
+}
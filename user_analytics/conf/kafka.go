@@ -0,0 +1,25 @@
+package conf
+
+import commonconf "github.com/rohanchavan1918/kse-common/config"
+
+type KafkaConfig struct {
+	commonconf.Kafka `mapstructure:",squash"`
+
+	Topics KafkaTopics `mapstructure:"topics"`
+}
+
+// KafkaTopics names every topic user_analytics consumes from
+type KafkaTopics struct {
+	Activity string `viper:"string" validate:"required" mapstructure:"activity"`
+	Trades   string `viper:"string" validate:"required" mapstructure:"trades"`
+
+	OrderCommands    string `viper:"string" validate:"required" mapstructure:"order_commands"`
+	ExecutionReports string `viper:"string" validate:"required" mapstructure:"execution_reports"`
+}
+
+// KafkaSettings returns the Kafka connection and the topics the service
+// uses, for the topics command and startup provisioning
+func (c *Config) KafkaSettings() (*commonconf.Kafka, []string) {
+	topics := c.KafkaConfig.Topics
+	return &c.KafkaConfig.Kafka, []string{topics.Activity, topics.Trades, topics.OrderCommands, topics.ExecutionReports}
+}
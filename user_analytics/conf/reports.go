@@ -0,0 +1,68 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ReportSchedule produces a report on a cron schedule. Cron expressions
+// have five fields and are evaluated in UTC.
+type ReportSchedule struct {
+	Name    string   `viper:"string" validate:"required" mapstructure:"name"`
+	Report  string   `viper:"string" validate:"required" mapstructure:"report"`
+	Cron    string   `viper:"string" validate:"required" mapstructure:"cron"`
+	Formats []string `validate:"dive,oneof=csv parquet" mapstructure:"formats"`
+}
+
+// S3Storage is any S3 compatible object store
+type S3Storage struct {
+	Endpoint  string `viper:"string" mapstructure:"endpoint"`
+	Region    string `viper:"string" mapstructure:"region"`
+	Bucket    string `viper:"string" mapstructure:"bucket"`
+	AccessKey string `viper:"string" secret:"true" mapstructure:"access_key"`
+	SecretKey string `viper:"string" secret:"true" mapstructure:"secret_key"`
+	UseSSL    bool   `viper:"bool" mapstructure:"use_ssl"`
+}
+
+// ReportStorage is where report files go, a local directory or S3
+type ReportStorage struct {
+	Type      string    `viper:"string" validate:"omitempty,oneof=local s3" mapstructure:"type"`
+	Directory string    `viper:"string" mapstructure:"directory"`
+	Prefix    string    `viper:"string" mapstructure:"prefix"`
+	S3        S3Storage `mapstructure:"s3"`
+}
+
+type ReportsConfig struct {
+	Storage   ReportStorage    `mapstructure:"storage"`
+	Schedules []ReportSchedule `validate:"dive" mapstructure:"schedules"`
+}
+
+func (s *ReportSchedule) Validate() error {
+	if s.Cron == "" {
+		return nil
+	}
+	if _, err := cron.ParseStandard(s.Cron); err != nil {
+		return fmt.Errorf("cron %q is not a valid five field expression", s.Cron)
+	}
+	return nil
+}
+
+func (s *ReportStorage) Validate() error {
+	if s.Type == "s3" && (s.S3.Endpoint == "" || s.S3.Bucket == "") {
+		return errors.New("s3 storage needs s3.endpoint and s3.bucket")
+	}
+	return nil
+}
+
+func (c *ReportsConfig) Validate() error {
+	seen := map[string]bool{}
+	for _, schedule := range c.Schedules {
+		if schedule.Name != "" && seen[schedule.Name] {
+			return fmt.Errorf("schedule name %q is used more than once", schedule.Name)
+		}
+		seen[schedule.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package conf
+
+import "time"
+
+// SurveillanceConfig holds the thresholds of the market abuse detectors.
+// Zero values fall back to the defaults of the surveillance package.
+type SurveillanceConfig struct {
+	// Accounts that used the same IP address within this window are related
+	IPLinkLookback time.Duration `viper:"string" validate:"gte=0" reload:"live" mapstructure:"ip_link_lookback"`
+
+	// Cancelled orders at least this large, this close to the last trade
+	// price, gone this quickly and filled no more than this are spoof
+	// candidates
+	LargeOrderNotional float64       `viper:"float64" validate:"gte=0" reload:"live" mapstructure:"large_order_notional"`
+	NearTouchBps       float64       `viper:"float64" validate:"gte=0" reload:"live" mapstructure:"near_touch_bps"`
+	MaxOrderLifetime   time.Duration `viper:"string" validate:"gte=0" reload:"live" mapstructure:"max_order_lifetime"`
+	MaxFillRatio       float64       `viper:"float64" validate:"gte=0,lte=1" reload:"live" mapstructure:"max_fill_ratio"`
+
+	// Spoof candidates on this many price levels within the window are layering
+	LayeringLevels int           `viper:"int" validate:"gte=0" reload:"live" mapstructure:"layering_levels"`
+	LayeringWindow time.Duration `viper:"string" validate:"gte=0" reload:"live" mapstructure:"layering_window"`
+
+	// More order messages than this within the window on one symbol is quote
+	// stuffing
+	QuoteStuffingMessages int           `viper:"int" validate:"gte=0" reload:"live" mapstructure:"quote_stuffing_messages"`
+	QuoteStuffingWindow   time.Duration `viper:"string" validate:"gte=0" reload:"live" mapstructure:"quote_stuffing_window"`
+
+	// A rise of PumpRisePct within PumpWindow on PumpVolumeMultiple times
+	// the usual volume, followed by a fall of DumpFallPct from the peak
+	PumpWindow          time.Duration `viper:"string" validate:"gte=0" reload:"live" mapstructure:"pump_window"`
+	PumpRisePct         float64       `viper:"float64" validate:"gte=0" reload:"live" mapstructure:"pump_rise_pct"`
+	DumpFallPct         float64       `viper:"float64" validate:"gte=0" reload:"live" mapstructure:"dump_fall_pct"`
+	PumpVolumeMultiple  float64       `viper:"float64" validate:"gte=0" reload:"live" mapstructure:"pump_volume_multiple"`
+	PumpBaselineWindows int           `viper:"int" validate:"gte=0" reload:"live" mapstructure:"pump_baseline_windows"`
+	ScanInterval        time.Duration `viper:"string" validate:"gte=0" mapstructure:"scan_interval"`
+}
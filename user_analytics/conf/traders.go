@@ -0,0 +1,7 @@
+package conf
+
+// TradersConfig specifies how trader metrics are ranked
+type TradersConfig struct {
+	// Round trips a trader needs in the period to be ranked by win rate
+	MinRoundTrips int `viper:"int" validate:"gte=0" reload:"live" mapstructure:"min_round_trips"`
+}
@@ -0,0 +1,298 @@
+package reports
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/consumer"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/rohanchavan1918/user_analytics/traders"
+	"github.com/segmentio/kafka-go"
+)
+
+// Reports that can be scheduled, each covers one UTC day
+const (
+	ReportTradeBlotter      = "trade_blotter"
+	ReportAccountStatements = "account_statements"
+	ReportMarketSummary     = "market_summary"
+)
+
+var builders = map[string]func(db *sql.DB, from, to time.Time) (*table, error){
+	ReportTradeBlotter:      tradeBlotter,
+	ReportAccountStatements: accountStatements,
+	ReportMarketSummary:     marketSummary,
+}
+
+// IsKnownReport reports whether name is a report that can be produced
+func IsKnownReport(name string) bool {
+	_, ok := builders[name]
+	return ok
+}
+
+// report_trades keeps every trade as published, the blotter and the market
+// summary are built from it
+const tradesSchema = `CREATE TABLE IF NOT EXISTS report_trades (
+	trade_id VARCHAR(64) PRIMARY KEY,
+	symbol VARCHAR(32) NOT NULL,
+	price DECIMAL(24, 8) NOT NULL,
+	quantity DECIMAL(24, 8) NOT NULL,
+	buy_order_id VARCHAR(64) NOT NULL,
+	sell_order_id VARCHAR(64) NOT NULL,
+	buy_user_id BIGINT NOT NULL,
+	sell_user_id BIGINT NOT NULL,
+	maker_side VARCHAR(8) NOT NULL,
+	maker_fee DECIMAL(24, 8) NOT NULL,
+	taker_fee DECIMAL(24, 8) NOT NULL,
+	executed_at DATETIME(6) NOT NULL,
+	INDEX idx_report_trades_executed (executed_at)
+)`
+
+// ConsumeTrades stores trades for the reports until ctx is done
+func ConsumeTrades(ctx context.Context, db *sql.DB, reader *kafka.Reader) {
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		logger := logging.ForMessage(ctx, msg)
+
+		var t traders.Trade
+		if err := json.Unmarshal(msg.Value, &t); err != nil {
+			logger.WithError(err).Error("Skipping malformed trade")
+			return nil
+		}
+		if t.TradeID == "" {
+			logger.Error("Skipping trade without id")
+			return nil
+		}
+		if t.ExecutedAt.IsZero() {
+			t.ExecutedAt = msg.Time
+		}
+		_, span := tracing.Start(ctx, "INSERT report_trades")
+		_, err := db.Exec(
+			`INSERT IGNORE INTO report_trades (trade_id, symbol, price, quantity, buy_order_id, sell_order_id, buy_user_id, sell_user_id,
+			maker_side, maker_fee, taker_fee, executed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			t.TradeID, t.Symbol, t.Price, t.Quantity, t.BuyOrderID, t.SellOrderID, t.BuyUserID, t.SellUserID,
+			t.MakerSide, t.Fees.MakerFee.Amount, t.Fees.TakerFee.Amount, t.ExecutedAt,
+		)
+		if tracing.End(span, err) != nil {
+			return fmt.Errorf("cannot store trade %s for reports : %w", t.TradeID, err)
+		}
+		return nil
+	})
+}
+
+// tradeBlotter lists every trade of the day in execution order
+func tradeBlotter(db *sql.DB, from, to time.Time) (*table, error) {
+	rows, err := db.Query(
+		`SELECT trade_id, executed_at, symbol, price, quantity, buy_order_id, buy_user_id, sell_order_id, sell_user_id,
+		maker_side, maker_fee, taker_fee FROM report_trades WHERE executed_at >= ? AND executed_at < ? ORDER BY executed_at, trade_id`,
+		from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	t := &table{columns: []column{
+		{"trade_id", kindString}, {"executed_at", kindTime}, {"symbol", kindString}, {"price", kindFloat},
+		{"quantity", kindFloat}, {"notional", kindFloat}, {"buy_order_id", kindString}, {"buy_user_id", kindInt},
+		{"sell_order_id", kindString}, {"sell_user_id", kindInt}, {"maker_side", kindString},
+		{"maker_fee", kindFloat}, {"taker_fee", kindFloat},
+	}}
+	for rows.Next() {
+		var tradeID, symbol, buyOrderID, sellOrderID, makerSide string
+		var executedAt time.Time
+		var price, quantity, makerFee, takerFee float64
+		var buyUserID, sellUserID int64
+		err := rows.Scan(&tradeID, &executedAt, &symbol, &price, &quantity, &buyOrderID, &buyUserID, &sellOrderID, &sellUserID,
+			&makerSide, &makerFee, &takerFee)
+		if err != nil {
+			return nil, err
+		}
+		t.add(tradeID, executedAt, symbol, price, quantity, price*quantity, buyOrderID, buyUserID, sellOrderID, sellUserID,
+			makerSide, makerFee, takerFee)
+	}
+	return t, rows.Err()
+}
+
+type statement struct {
+	userID   int64
+	asset    string
+	opening  float64
+	byKind   map[string]float64
+	entries  int64
+	hasMoved bool
+}
+
+// Kinds of ledger postings broken out on statements, anything else is other
+var statementKinds = []string{"deposit", "withdrawal", "trade", "fee", "rebate"}
+
+// accountStatements shows how the cash of every user with a balance or a
+// posting that day moved, from the ledger both services post to
+func accountStatements(db *sql.DB, from, to time.Time) (*table, error) {
+	rows, err := db.Query(
+		`SELECT account_id, asset, kind, SUM(CASE WHEN created_at < ? THEN amount ELSE 0 END),
+		SUM(CASE WHEN created_at >= ? THEN amount ELSE 0 END), SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END)
+		FROM ledger_entries WHERE account_id REGEXP '^user:[0-9]+$' AND created_at < ?
+		GROUP BY account_id, asset, kind`,
+		from, from, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statements := map[string]*statement{}
+	for rows.Next() {
+		var account, asset, kind string
+		var before, during float64
+		var entries int64
+		if err := rows.Scan(&account, &asset, &kind, &before, &during, &entries); err != nil {
+			return nil, err
+		}
+		userID, err := strconv.ParseInt(strings.TrimPrefix(account, "user:"), 10, 64)
+		if err != nil {
+			continue
+		}
+		key := account + "/" + asset
+		s := statements[key]
+		if s == nil {
+			s = &statement{userID: userID, asset: asset, byKind: map[string]float64{}}
+			statements[key] = s
+		}
+		s.opening += before
+		s.byKind[kind] += during
+		s.entries += entries
+		s.hasMoved = s.hasMoved || entries > 0
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for key, s := range statements {
+		if s.hasMoved || s.opening != 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := statements[keys[i]], statements[keys[j]]
+		if a.userID != b.userID {
+			return a.userID < b.userID
+		}
+		return a.asset < b.asset
+	})
+
+	t := &table{columns: []column{{"user_id", kindInt}, {"asset", kindString}, {"opening_balance", kindFloat}}}
+	for _, kind := range statementKinds {
+		t.columns = append(t.columns, column{kind + "s", kindFloat})
+	}
+	t.columns = append(t.columns, column{"other", kindFloat}, column{"closing_balance", kindFloat}, column{"entries", kindInt})
+	for _, key := range keys {
+		s := statements[key]
+		row := []interface{}{s.userID, s.asset, s.opening}
+		closing, other := s.opening, 0.0
+		known := map[string]bool{}
+		for _, kind := range statementKinds {
+			known[kind] = true
+			row = append(row, s.byKind[kind])
+		}
+		for kind, amount := range s.byKind {
+			closing += amount
+			if !known[kind] {
+				other += amount
+			}
+		}
+		t.add(append(row, other, closing, s.entries)...)
+	}
+	return t, nil
+}
+
+type symbolSummary struct {
+	open, high, low, close                float64
+	hasBar                                bool
+	trades                                int64
+	volume, notional, tradeHigh, tradeLow float64
+}
+
+// marketSummary has a line per symbol that traded or was quoted that day,
+// with the day's bar from the ingested prices and the exchange's own trading
+func marketSummary(db *sql.DB, from, to time.Time) (*table, error) {
+	summaries := map[string]*symbolSummary{}
+	get := func(symbol string) *symbolSummary {
+		if summaries[symbol] == nil {
+			summaries[symbol] = &symbolSummary{}
+		}
+		return summaries[symbol]
+	}
+
+	rows, err := db.Query("SELECT symbol, open, high, low, close FROM stock_daily_prices WHERE day = ?", from.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var symbol string
+		var open, high, low, close float64
+		if err := rows.Scan(&symbol, &open, &high, &low, &close); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s := get(symbol)
+		s.open, s.high, s.low, s.close, s.hasBar = open, high, low, close, true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(
+		`SELECT symbol, COUNT(*), SUM(quantity), SUM(price * quantity), MAX(price), MIN(price)
+		FROM report_trades WHERE executed_at >= ? AND executed_at < ? GROUP BY symbol`,
+		from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var symbol string
+		var trades int64
+		var volume, notional, high, low float64
+		if err := rows.Scan(&symbol, &trades, &volume, &notional, &high, &low); err != nil {
+			return nil, err
+		}
+		s := get(symbol)
+		s.trades, s.volume, s.notional, s.tradeHigh, s.tradeLow = trades, volume, notional, high, low
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	symbols := []string{}
+	for symbol := range summaries {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	t := &table{columns: []column{
+		{"symbol", kindString}, {"open", kindFloat}, {"high", kindFloat}, {"low", kindFloat}, {"close", kindFloat},
+		{"change_pct", kindFloat}, {"trades", kindInt}, {"volume", kindFloat}, {"notional", kindFloat}, {"vwap", kindFloat},
+		{"trade_high", kindFloat}, {"trade_low", kindFloat},
+	}}
+	for _, symbol := range symbols {
+		s := summaries[symbol]
+		var change, vwap float64
+		if s.hasBar && s.open != 0 {
+			change = (s.close - s.open) / s.open * 100
+		}
+		if s.volume != 0 {
+			vwap = s.notional / s.volume
+		}
+		t.add(symbol, s.open, s.high, s.low, s.close, change, s.trades, s.volume, s.notional, vwap, s.tradeHigh, s.tradeLow)
+	}
+	return t, nil
+}
@@ -0,0 +1,179 @@
+package reports
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/rohanchavan1918/kse-common/utils"
+)
+
+// Run statuses
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Runs still marked running after this long are assumed to have died with
+// their instance and can be taken over
+const staleRunAfter = time.Hour
+
+var (
+	ErrAlreadyRun       = errors.New("The report was already produced for that day, force it to produce it again")
+	ErrRunning          = errors.New("The report is being produced for that day")
+	ErrScheduleNotFound = errors.New("Report schedule not found")
+)
+
+// Run is one production of a scheduled report for a day
+type Run struct {
+	ID          string     `json:"id"`
+	Schedule    string     `json:"schedule"`
+	Report      string     `json:"report"`
+	Day         string     `json:"day"`
+	Status      string     `json:"status"`
+	ManifestKey string     `json:"manifest_key"`
+	Error       string     `json:"error"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
+
+var schemas = []string{
+	tradesSchema,
+	`CREATE TABLE IF NOT EXISTS report_runs (
+		id VARCHAR(64) PRIMARY KEY,
+		schedule VARCHAR(64) NOT NULL,
+		report VARCHAR(32) NOT NULL,
+		day DATE NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		manifest_key VARCHAR(512) NOT NULL DEFAULT '',
+		error TEXT NOT NULL,
+		started_at DATETIME(6) NOT NULL,
+		finished_at DATETIME(6) NULL,
+		UNIQUE KEY uq_report_runs_day (schedule, day),
+		INDEX idx_report_runs_started (started_at)
+	)`,
+}
+
+func EnsureSchema(db *sql.DB) error {
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const selectRun = "SELECT id, schedule, report, day, status, manifest_key, error, started_at, finished_at FROM report_runs"
+
+// claim marks the schedule's report for day as being produced by this
+// instance. Every instance runs the same schedules, the first to claim a
+// day produces it. Failed and stale runs can be claimed again, finished
+// ones only when forced.
+func claim(db *sql.DB, schedule, report string, day time.Time, force bool) (*Run, error) {
+	now := time.Now().UTC()
+	run := &Run{ID: utils.NewID(), Schedule: schedule, Report: report, Day: day.Format("2006-01-02"), Status: StatusRunning, StartedAt: now}
+	_, err := db.Exec(
+		"INSERT INTO report_runs (id, schedule, report, day, status, error, started_at) VALUES (?, ?, ?, ?, ?, '', ?)",
+		run.ID, run.Schedule, run.Report, run.Day, run.Status, run.StartedAt,
+	)
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+		if err != nil {
+			return nil, err
+		}
+		return run, nil
+	}
+
+	previous, err := scanRun(db.QueryRow(selectRun+" WHERE schedule = ? AND day = ?", schedule, run.Day))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case previous.Status == StatusRunning && now.Sub(previous.StartedAt) < staleRunAfter:
+		return nil, ErrRunning
+	case previous.Status == StatusSucceeded && !force:
+		return nil, ErrAlreadyRun
+	}
+
+	// Whoever changes the previous run first takes it over
+	res, err := db.Exec(
+		"UPDATE report_runs SET status = ?, report = ?, manifest_key = '', error = '', started_at = ?, finished_at = NULL WHERE id = ? AND status = ? AND started_at = ?",
+		StatusRunning, report, now, previous.ID, previous.Status, previous.StartedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrRunning
+	}
+	run.ID = previous.ID
+	return run, nil
+}
+
+func finish(db *sql.DB, run *Run, manifestKey string, runErr error) error {
+	now := time.Now().UTC()
+	run.Status, run.ManifestKey, run.FinishedAt = StatusSucceeded, manifestKey, &now
+	if runErr != nil {
+		run.Status, run.Error = StatusFailed, runErr.Error()
+	}
+	_, err := db.Exec(
+		"UPDATE report_runs SET status = ?, manifest_key = ?, error = ?, finished_at = ? WHERE id = ?",
+		run.Status, run.ManifestKey, run.Error, now, run.ID,
+	)
+	return err
+}
+
+// ListRuns returns a page of runs, newest first, optionally of one schedule,
+// and the number of runs matching
+func ListRuns(db *sql.DB, schedule string, limit, offset int) ([]Run, int, error) {
+	clause, args := "", []interface{}{}
+	if schedule != "" {
+		clause, args = " WHERE schedule = ?", append(args, schedule)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM report_runs"+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(selectRun+clause+" ORDER BY started_at DESC, id LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	runs := []Run{}
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, total, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRun(row scanner) (*Run, error) {
+	run := &Run{}
+	var day time.Time
+	var finishedAt sql.NullTime
+	err := row.Scan(&run.ID, &run.Schedule, &run.Report, &day, &run.Status, &run.ManifestKey, &run.Error, &run.StartedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+	run.Day = day.Format("2006-01-02")
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	return run, nil
+}
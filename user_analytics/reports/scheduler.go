@@ -0,0 +1,204 @@
+package reports
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/user_analytics/conf"
+)
+
+// Formats reports can be written in
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+var contentTypes = map[string]string{
+	FormatCSV:     "text/csv",
+	FormatParquet: "application/vnd.apache.parquet",
+}
+
+// Uploading a day's files should never take this long
+const generateTimeout = 30 * time.Minute
+
+// ManifestFile describes one file of a run
+type ManifestFile struct {
+	Key    string `json:"key"`
+	Format string `json:"format"`
+	Rows   int    `json:"rows"`
+	Bytes  int    `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest is written last, once every file of a run is in place, so its
+// presence means the run is complete
+type Manifest struct {
+	Schedule    string         `json:"schedule"`
+	Report      string         `json:"report"`
+	Day         string         `json:"day"`
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Files       []ManifestFile `json:"files"`
+}
+
+// Scheduler produces the configured reports on their cron schedules
+type Scheduler struct {
+	db        *sql.DB
+	store     Store
+	prefix    string
+	cron      *cron.Cron
+	schedules map[string]conf.ReportSchedule
+}
+
+var DefaultScheduler *Scheduler
+
+// NewScheduler checks the schedules and registers them, nothing runs
+// before Start
+func NewScheduler(db *sql.DB, store Store, prefix string, schedules []conf.ReportSchedule) (*Scheduler, error) {
+	s := &Scheduler{
+		db:        db,
+		store:     store,
+		prefix:    strings.Trim(prefix, "/"),
+		cron:      cron.New(cron.WithLocation(time.UTC)),
+		schedules: map[string]conf.ReportSchedule{},
+	}
+	for _, schedule := range schedules {
+		if schedule.Name == "" || s.schedules[schedule.Name].Name != "" {
+			return nil, fmt.Errorf("Report schedules need unique names, got %q", schedule.Name)
+		}
+		if !IsKnownReport(schedule.Report) {
+			return nil, fmt.Errorf("Schedule %s has an unknown report %q", schedule.Name, schedule.Report)
+		}
+		if len(schedule.Formats) == 0 {
+			schedule.Formats = []string{FormatCSV}
+		}
+		for _, format := range schedule.Formats {
+			if contentTypes[format] == "" {
+				return nil, fmt.Errorf("Schedule %s has an unknown format %q", schedule.Name, format)
+			}
+		}
+
+		schedule := schedule
+		_, err := s.cron.AddFunc(schedule.Cron, func() {
+			// End of day files cover the day before the run
+			day := time.Now().UTC().AddDate(0, 0, -1)
+			if _, err := s.Trigger(schedule.Name, day, false); err != nil && !errors.Is(err, ErrAlreadyRun) && !errors.Is(err, ErrRunning) {
+				utils.LogError("Failed to start report %s for %s : %s", schedule.Name, day.Format("2006-01-02"), err)
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Schedule %s has an invalid cron expression : %s", schedule.Name, err)
+		}
+		s.schedules[schedule.Name] = schedule
+	}
+	return s, nil
+}
+
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Schedules returns the configured schedules
+func (s *Scheduler) Schedules() []conf.ReportSchedule {
+	schedules := []conf.ReportSchedule{}
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, schedule)
+	}
+	return schedules
+}
+
+// Trigger claims the schedule's run for day and produces it in the
+// background. The returned run is still running.
+func (s *Scheduler) Trigger(name string, day time.Time, force bool) (*Run, error) {
+	schedule, ok := s.schedules[name]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	day = day.UTC()
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+
+	run, err := claim(s.db, schedule.Name, schedule.Report, from, force)
+	if err != nil {
+		return nil, err
+	}
+	go func(run Run) {
+		manifestKey, err := s.generate(schedule, from)
+		if err != nil {
+			utils.LogError("Report %s for %s failed : %s", schedule.Name, run.Day, err)
+		} else {
+			utils.LogInfo("Report %s for %s is at %s", schedule.Name, run.Day, s.store.Location(manifestKey))
+		}
+		if err := finish(s.db, &run, manifestKey, err); err != nil {
+			utils.LogError("Failed to record the end of report run %s : %s", run.ID, err)
+		}
+	}(*run)
+	return run, nil
+}
+
+// generate writes the report in every format of the schedule, then the
+// checksums and the manifest, and returns the manifest's key
+func (s *Scheduler) generate(schedule conf.ReportSchedule, from time.Time) (string, error) {
+	to := from.AddDate(0, 0, 1)
+	day := from.Format("2006-01-02")
+	t, err := builders[schedule.Report](s.db, from, to)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), generateTimeout)
+	defer cancel()
+
+	dir := path.Join(s.prefix, schedule.Name, day)
+	manifest := Manifest{Schedule: schedule.Name, Report: schedule.Report, Day: day, From: from, To: to, Files: []ManifestFile{}}
+	sums := []string{}
+	for _, format := range schedule.Formats {
+		var data []byte
+		switch format {
+		case FormatCSV:
+			data, err = encodeCSV(t)
+		case FormatParquet:
+			data, err = encodeParquet(t)
+		}
+		if err != nil {
+			return "", fmt.Errorf("encoding %s : %w", format, err)
+		}
+
+		name := fmt.Sprintf("%s_%s.%s", schedule.Report, day, format)
+		key := path.Join(dir, name)
+		if err := s.store.Put(ctx, key, data, contentTypes[format]); err != nil {
+			return "", fmt.Errorf("writing %s : %w", key, err)
+		}
+		sum := sha256.Sum256(data)
+		checksum := hex.EncodeToString(sum[:])
+		manifest.Files = append(manifest.Files, ManifestFile{Key: key, Format: format, Rows: len(t.rows), Bytes: len(data), SHA256: checksum})
+		// Same layout as sha256sum, so the directory can be checked with it
+		sums = append(sums, checksum+"  "+name)
+	}
+
+	sumsKey := path.Join(dir, "SHA256SUMS")
+	if err := s.store.Put(ctx, sumsKey, []byte(strings.Join(sums, "\n")+"\n"), "text/plain"); err != nil {
+		return "", fmt.Errorf("writing %s : %w", sumsKey, err)
+	}
+
+	manifest.GeneratedAt = time.Now().UTC()
+	payload, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	manifestKey := path.Join(dir, "manifest.json")
+	if err := s.store.Put(ctx, manifestKey, payload, "application/json"); err != nil {
+		return "", fmt.Errorf("writing %s : %w", manifestKey, err)
+	}
+	return manifestKey, nil
+}
@@ -0,0 +1,127 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rohanchavan1918/user_analytics/conf"
+)
+
+// Store is where report files are written to. Keys are slash separated
+// paths relative to the store's root.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Location is where a key ends up, for the manifest and the logs
+	Location(key string) string
+}
+
+// NewStore builds the store configured for reports
+func NewStore(c conf.ReportStorage) (Store, error) {
+	switch c.Type {
+	case "local", "":
+		if c.Directory == "" {
+			return nil, errors.New("Reports need a storage directory")
+		}
+		return &LocalStore{Directory: c.Directory}, nil
+	case "s3":
+		return NewS3Store(c.S3)
+	}
+	return nil, fmt.Errorf("Unknown report storage %q", c.Type)
+}
+
+// LocalStore writes files under a directory. Files are written next to
+// their final name and renamed, so readers never see half a file.
+type LocalStore struct {
+	Directory string
+}
+
+func (s *LocalStore) Location(key string) string {
+	return filepath.Join(s.Directory, filepath.FromSlash(key))
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	target := s.Location(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// S3Store writes objects to a bucket of any S3 compatible store, MinIO
+// included
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3Store(c conf.S3Storage) (*S3Store, error) {
+	if c.Endpoint == "" || c.Bucket == "" {
+		return nil, errors.New("S3 report storage needs an endpoint and a bucket")
+	}
+	// Without keys the client falls back to the usual AWS environment
+	// variables
+	creds := credentials.NewEnvAWS()
+	if c.AccessKey != "" {
+		creds = credentials.NewStaticV4(c.AccessKey, c.SecretKey, "")
+	}
+	client, err := minio.New(strings.TrimPrefix(strings.TrimPrefix(c.Endpoint, "https://"), "http://"), &minio.Options{
+		Creds:  creds,
+		Secure: c.UseSSL,
+		Region: c.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A fresh local stand-in starts without buckets
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, c.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, c.Bucket, minio.MakeBucketOptions{Region: c.Region}); err != nil {
+			return nil, err
+		}
+	}
+	return &S3Store{client: client, bucket: c.Bucket}, nil
+}
+
+func (s *S3Store) Location(key string) string {
+	return "s3://" + path.Join(s.bucket, key)
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
@@ -0,0 +1,167 @@
+package reports
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rohanchavan1918/user_analytics/conf"
+)
+
+// fakeS3 keeps the objects of one bucket in memory, enough of the S3 API
+// for S3Store
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if parts[0] != f.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case (len(parts) == 1 || parts[1] == "") && r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case len(parts) == 2 && r.Method == http.MethodPut:
+		data, err := readBody(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[parts[1]] = data
+		f.types[parts[1]] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// readBody undoes the signed chunks minio-go streams uploads in over plain
+// HTTP
+func readBody(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	body := bufio.NewReader(r.Body)
+	data := []byte{}
+	for {
+		header, err := body.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(strings.SplitN(strings.TrimSpace(header), ";", 2)[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(body, chunk); err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	fake := &fakeS3{bucket: "kse-reports", objects: map[string][]byte{}, types: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		storage  conf.ReportStorage
+		location string
+		read     func(key string) ([]byte, string)
+	}{
+		{
+			name:     "local",
+			storage:  conf.ReportStorage{Type: "local", Directory: dir},
+			location: filepath.Join(dir, "trade_blotter", "2024-03-14", "trade_blotter.csv"),
+			read: func(key string) ([]byte, string) {
+				data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(key)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return data, "text/csv"
+			},
+		},
+		{
+			name: "s3",
+			storage: conf.ReportStorage{Type: "s3", S3: conf.S3Storage{
+				Endpoint:  server.URL,
+				Region:    "us-east-1",
+				Bucket:    "kse-reports",
+				AccessKey: "access",
+				SecretKey: "secret",
+			}},
+			location: "s3://kse-reports/trade_blotter/2024-03-14/trade_blotter.csv",
+			read: func(key string) ([]byte, string) {
+				fake.mu.Lock()
+				defer fake.mu.Unlock()
+				return fake.objects[key], fake.types[key]
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewStore(tt.storage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key := "trade_blotter/2024-03-14/trade_blotter.csv"
+			if location := store.Location(key); location != tt.location {
+				t.Errorf("location is %s, want %s", location, tt.location)
+			}
+
+			// A second put replaces the first
+			for _, content := range []string{"trade_id,symbol\n1,AAPL\n", "trade_id,symbol\n1,AAPL\n2,MSFT\n"} {
+				if err := store.Put(context.Background(), key, []byte(content), "text/csv"); err != nil {
+					t.Fatal(err)
+				}
+				data, contentType := tt.read(key)
+				if string(data) != content || contentType != "text/csv" {
+					t.Errorf("read back %q as %s, want %q as text/csv", data, contentType, content)
+				}
+			}
+		})
+	}
+
+	// Nothing but the report is left behind in the directory
+	entries, err := os.ReadDir(filepath.Join(dir, "trade_blotter", "2024-03-14"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d files, want only the report", len(entries))
+	}
+}
+
+func TestNewStoreRejects(t *testing.T) {
+	for _, storage := range []conf.ReportStorage{
+		{Type: "local"},
+		{Type: "s3", S3: conf.S3Storage{Bucket: "kse-reports"}},
+		{Type: "ftp", Directory: "/tmp"},
+	} {
+		if _, err := NewStore(storage); err == nil {
+			t.Errorf("store %+v was built", storage)
+		}
+	}
+}
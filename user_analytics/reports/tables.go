@@ -0,0 +1,106 @@
+package reports
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Column kinds and how they are written to Parquet
+const (
+	kindString = "string"
+	kindInt    = "int"
+	kindFloat  = "float"
+	kindTime   = "time"
+)
+
+var parquetTypes = map[string]string{
+	kindString: "type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY",
+	kindInt:    "type=INT64",
+	kindFloat:  "type=DOUBLE",
+	kindTime:   "type=INT64, convertedtype=TIMESTAMP_MICROS",
+}
+
+type column struct {
+	name string
+	kind string
+}
+
+// table is a report before it is encoded. Every row has a value per column,
+// of the Go type of its kind: string, int64, float64 or time.Time.
+type table struct {
+	columns []column
+	rows    [][]interface{}
+}
+
+func (t *table) add(row ...interface{}) {
+	t.rows = append(t.rows, row)
+}
+
+func encodeCSV(t *table) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		header[i] = c.name
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	record := make([]string, len(t.columns))
+	for _, row := range t.rows {
+		for i, value := range row {
+			switch v := value.(type) {
+			case string:
+				record[i] = v
+			case int64:
+				record[i] = strconv.FormatInt(v, 10)
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			case time.Time:
+				record[i] = v.UTC().Format(time.RFC3339Nano)
+			default:
+				return nil, fmt.Errorf("column %s has an unsupported value %T", t.columns[i].name, value)
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func encodeParquet(t *table) ([]byte, error) {
+	md := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		md[i] = fmt.Sprintf("name=%s, %s", c.name, parquetTypes[c.kind])
+	}
+
+	var buf bytes.Buffer
+	pw, err := writer.NewCSVWriterFromWriter(md, &buf, 1)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range t.rows {
+		values := make([]interface{}, len(row))
+		for i, value := range row {
+			if at, ok := value.(time.Time); ok {
+				value = at.UnixMicro()
+			}
+			values[i] = value
+		}
+		if err := pw.Write(values); err != nil {
+			return nil, err
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,408 @@
+package surveillance
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/utils"
+)
+
+// Case types, one per detector
+const (
+	TypeWashTrade     = "wash_trade"
+	TypeRelatedTrade  = "related_account_trade"
+	TypeSpoofing      = "spoofing"
+	TypeLayering      = "layering"
+	TypeQuoteStuffing = "quote_stuffing"
+	TypePumpAndDump   = "pump_and_dump"
+)
+
+// Case statuses. Dismissed and escalated cases are closed, a new detection
+// of the same pattern opens a new case.
+const (
+	StatusOpen          = "open"
+	StatusInvestigating = "investigating"
+	StatusDismissed     = "dismissed"
+	StatusEscalated     = "escalated"
+)
+
+var validStatuses = map[string]bool{StatusOpen: true, StatusInvestigating: true, StatusDismissed: true, StatusEscalated: true}
+
+var (
+	ErrNotFound      = errors.New("Case not found")
+	ErrInvalidStatus = errors.New("Status must be open, investigating, dismissed or escalated")
+	ErrCaseClosed    = errors.New("Case is already closed")
+)
+
+type Case struct {
+	ID            string     `json:"id"`
+	Type          string     `json:"type"`
+	Status        string     `json:"status"`
+	Symbol        string     `json:"symbol"`
+	Subject       string     `json:"subject"`
+	Summary       string     `json:"summary"`
+	UserIDs       []int64    `json:"user_ids"`
+	EvidenceCount int64      `json:"evidence_count"`
+	Note          string     `json:"note"`
+	OpenedAt      time.Time  `json:"opened_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	ClosedAt      *time.Time `json:"closed_at"`
+}
+
+// Evidence is one observation backing a case. Ref identifies what was
+// observed, a trade or an order, so redelivered messages are stored once.
+type Evidence struct {
+	Kind       string          `json:"kind"`
+	Ref        string          `json:"ref"`
+	Data       json.RawMessage `json:"data"`
+	ObservedAt time.Time       `json:"observed_at"`
+}
+
+var schemas = []string{
+	`CREATE TABLE IF NOT EXISTS surveillance_cases (
+		id VARCHAR(64) PRIMARY KEY,
+		type VARCHAR(32) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		symbol VARCHAR(32) NOT NULL DEFAULT '',
+		subject VARCHAR(191) NOT NULL,
+		summary VARCHAR(512) NOT NULL,
+		evidence_count BIGINT NOT NULL DEFAULT 0,
+		note TEXT NOT NULL,
+		open_key VARCHAR(255) NULL,
+		opened_at DATETIME(6) NOT NULL,
+		updated_at DATETIME(6) NOT NULL,
+		closed_at DATETIME(6) NULL,
+		UNIQUE KEY uq_surveillance_cases_open (open_key),
+		INDEX idx_surveillance_cases_type (type, opened_at),
+		INDEX idx_surveillance_cases_status (status, opened_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS surveillance_case_users (
+		case_id VARCHAR(64) NOT NULL,
+		user_id BIGINT NOT NULL,
+		PRIMARY KEY (case_id, user_id),
+		INDEX idx_surveillance_case_users_user (user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS surveillance_evidence (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		case_id VARCHAR(64) NOT NULL,
+		kind VARCHAR(32) NOT NULL,
+		ref VARCHAR(128) NOT NULL,
+		data JSON NOT NULL,
+		observed_at DATETIME(6) NOT NULL,
+		UNIQUE KEY uq_surveillance_evidence_ref (case_id, kind, ref)
+	)`,
+	`CREATE TABLE IF NOT EXISTS surveillance_orders (
+		order_id VARCHAR(64) PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		symbol VARCHAR(32) NOT NULL,
+		side VARCHAR(8) NOT NULL,
+		price DECIMAL(24, 8) NOT NULL,
+		quantity DECIMAL(24, 8) NOT NULL,
+		filled_quantity DECIMAL(24, 8) NOT NULL DEFAULT 0,
+		reference_price DECIMAL(24, 8) NOT NULL DEFAULT 0,
+		status VARCHAR(24) NOT NULL,
+		spoof_candidate BOOLEAN NOT NULL DEFAULT FALSE,
+		judged BOOLEAN NOT NULL DEFAULT FALSE,
+		placed_at DATETIME(6) NOT NULL,
+		closed_at DATETIME(6) NULL,
+		INDEX idx_surveillance_orders_candidates (user_id, symbol, side, spoof_candidate, closed_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS surveillance_trades (
+		trade_id VARCHAR(64) PRIMARY KEY,
+		symbol VARCHAR(32) NOT NULL,
+		price DECIMAL(24, 8) NOT NULL,
+		quantity DECIMAL(24, 8) NOT NULL,
+		buy_user_id BIGINT NOT NULL,
+		sell_user_id BIGINT NOT NULL,
+		executed_at DATETIME(6) NOT NULL,
+		judged BOOLEAN NOT NULL DEFAULT FALSE,
+		INDEX idx_surveillance_trades_symbol (symbol, executed_at),
+		INDEX idx_surveillance_trades_buyer (buy_user_id, executed_at),
+		INDEX idx_surveillance_trades_seller (sell_user_id, executed_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS surveillance_account_links (
+		user_id_a BIGINT NOT NULL,
+		user_id_b BIGINT NOT NULL,
+		reason VARCHAR(255) NOT NULL,
+		created_at DATETIME(6) NOT NULL,
+		PRIMARY KEY (user_id_a, user_id_b)
+	)`,
+}
+
+func EnsureSchema(db *sql.DB) error {
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detection is what a detector reports. Detections with the same type and
+// subject add to the case that is still open for them instead of opening
+// another one.
+type detection struct {
+	Type     string
+	Symbol   string
+	Subject  string
+	Summary  string
+	UserIDs  []int64
+	Evidence []Evidence
+}
+
+func newEvidence(kind, ref string, observedAt time.Time, data interface{}) Evidence {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		payload = []byte("null")
+	}
+	return Evidence{Kind: kind, Ref: ref, Data: payload, ObservedAt: observedAt.UTC()}
+}
+
+// record opens or extends the case of a detection and stores its evidence
+func record(db *sql.DB, d detection) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	openKey := d.Type + ":" + d.Subject
+	// Concurrent detections race on the open key, the loser joins the case
+	// the winner opened
+	res, err := tx.Exec(
+		`INSERT IGNORE INTO surveillance_cases (id, type, status, symbol, subject, summary, note, open_key, opened_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, '', ?, ?, ?)`,
+		utils.NewID(), d.Type, StatusOpen, d.Symbol, d.Subject, d.Summary, openKey, now, now,
+	)
+	if err != nil {
+		return err
+	}
+	opened, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	var caseID string
+	if err := tx.QueryRow("SELECT id FROM surveillance_cases WHERE open_key = ? FOR UPDATE", openKey).Scan(&caseID); err != nil {
+		return err
+	}
+
+	for _, userID := range d.UserIDs {
+		if _, err := tx.Exec("INSERT IGNORE INTO surveillance_case_users (case_id, user_id) VALUES (?, ?)", caseID, userID); err != nil {
+			return err
+		}
+	}
+
+	var added int64
+	for _, e := range d.Evidence {
+		res, err := tx.Exec(
+			"INSERT IGNORE INTO surveillance_evidence (case_id, kind, ref, data, observed_at) VALUES (?, ?, ?, ?, ?)",
+			caseID, e.Kind, e.Ref, []byte(e.Data), e.ObservedAt,
+		)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		added += affected
+	}
+	if added == 0 && opened == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(
+		"UPDATE surveillance_cases SET evidence_count = evidence_count + ?, summary = ?, updated_at = ? WHERE id = ?",
+		added, d.Summary, now, caseID,
+	)
+	if err != nil {
+		return err
+	}
+	if opened > 0 {
+		utils.LogInfo("Opened %s case %s for %s", d.Type, caseID, d.Subject)
+	}
+	return tx.Commit()
+}
+
+// Filter narrows down cases, zero values are ignored
+type Filter struct {
+	Type   string
+	Status string
+	Symbol string
+	UserID int64
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+const selectCase = `SELECT c.id, c.type, c.status, c.symbol, c.subject, c.summary, c.evidence_count, c.note,
+	c.opened_at, c.updated_at, c.closed_at FROM surveillance_cases c`
+
+// List returns a page of cases, newest first, and the number of cases
+// matching the filter
+func List(db *sql.DB, filter Filter) ([]Case, int, error) {
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+	if filter.Type != "" {
+		where = append(where, "c.type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.Status != "" {
+		where = append(where, "c.status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Symbol != "" {
+		where = append(where, "c.symbol = ?")
+		args = append(args, filter.Symbol)
+	}
+	if filter.UserID != 0 {
+		where = append(where, "c.id IN (SELECT case_id FROM surveillance_case_users WHERE user_id = ?)")
+		args = append(args, filter.UserID)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "c.opened_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "c.opened_at < ?")
+		args = append(args, filter.To)
+	}
+	clause := " WHERE " + strings.Join(where, " AND ")
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM surveillance_cases c"+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(selectCase+clause+" ORDER BY c.opened_at DESC, c.id LIMIT ? OFFSET ?", append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	cases := []Case{}
+	for rows.Next() {
+		c, err := scanCase(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		cases = append(cases, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	for i := range cases {
+		if cases[i].UserIDs, err = caseUsers(db, cases[i].ID); err != nil {
+			return nil, 0, err
+		}
+	}
+	return cases, total, nil
+}
+
+// Get returns a case with all of its evidence, oldest first
+func Get(db *sql.DB, id string) (*Case, []Evidence, error) {
+	c, err := scanCase(db.QueryRow(selectCase+" WHERE c.id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.UserIDs, err = caseUsers(db, c.ID); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := db.Query("SELECT kind, ref, data, observed_at FROM surveillance_evidence WHERE case_id = ? ORDER BY observed_at, id", id)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	evidence := []Evidence{}
+	for rows.Next() {
+		var e Evidence
+		var data []byte
+		if err := rows.Scan(&e.Kind, &e.Ref, &data, &e.ObservedAt); err != nil {
+			return nil, nil, err
+		}
+		e.Data = json.RawMessage(data)
+		evidence = append(evidence, e)
+	}
+	return c, evidence, rows.Err()
+}
+
+// SetStatus moves a case along its review. Dismissing or escalating closes
+// it for good.
+func SetStatus(db *sql.DB, id, status, note string) (*Case, error) {
+	if !validStatuses[status] {
+		return nil, ErrInvalidStatus
+	}
+	now := time.Now().UTC()
+	var closedAt interface{}
+	openKey := "open_key"
+	if status == StatusDismissed || status == StatusEscalated {
+		closedAt, openKey = now, "NULL"
+	}
+
+	res, err := db.Exec(
+		"UPDATE surveillance_cases SET status = ?, note = ?, updated_at = ?, closed_at = ?, open_key = "+openKey+" WHERE id = ? AND closed_at IS NULL",
+		status, strings.TrimSpace(note), now, closedAt, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		if _, _, err := Get(db, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrCaseClosed
+	}
+	c, _, err := Get(db, id)
+	return c, err
+}
+
+func caseUsers(db *sql.DB, caseID string) ([]int64, error) {
+	rows, err := db.Query("SELECT user_id FROM surveillance_case_users WHERE case_id = ? ORDER BY user_id", caseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := []int64{}
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCase(row scanner) (*Case, error) {
+	c := &Case{}
+	var closedAt sql.NullTime
+	err := row.Scan(&c.ID, &c.Type, &c.Status, &c.Symbol, &c.Subject, &c.Summary, &c.EvidenceCount, &c.Note,
+		&c.OpenedAt, &c.UpdatedAt, &closedAt)
+	if err != nil {
+		return nil, err
+	}
+	if closedAt.Valid {
+		c.ClosedAt = &closedAt.Time
+	}
+	return c, nil
+}
@@ -0,0 +1,90 @@
+package surveillance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rohanchavan1918/kse-common/consumer"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/rohanchavan1918/user_analytics/traders"
+	"github.com/segmentio/kafka-go"
+)
+
+// ConsumeOrderCommands feeds order commands to the monitor until ctx is
+// done
+func ConsumeOrderCommands(ctx context.Context, m *Monitor, reader *kafka.Reader) {
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		logger := logging.ForMessage(ctx, msg)
+
+		var cmd Command
+		if err := json.Unmarshal(msg.Value, &cmd); err != nil {
+			logger.WithError(err).Error("Skipping malformed order command")
+			return nil
+		}
+		if cmd.OrderID == "" {
+			logger.Error("Skipping order command without order id")
+			return nil
+		}
+		if cmd.SentAt.IsZero() {
+			cmd.SentAt = msg.Time
+		}
+		_, span := tracing.Start(ctx, "surveillance.OnCommand")
+		if err := tracing.End(span, m.OnCommand(cmd)); err != nil {
+			return fmt.Errorf("cannot watch %s command for order %s : %w", cmd.Type, cmd.OrderID, err)
+		}
+		return nil
+	})
+}
+
+// ConsumeExecutionReports feeds execution reports to the monitor until ctx
+// is done
+func ConsumeExecutionReports(ctx context.Context, m *Monitor, reader *kafka.Reader) {
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		logger := logging.ForMessage(ctx, msg)
+
+		var report ExecutionReport
+		if err := json.Unmarshal(msg.Value, &report); err != nil {
+			logger.WithError(err).Error("Skipping malformed execution report")
+			return nil
+		}
+		if report.OrderID == "" {
+			logger.Error("Skipping execution report without order id")
+			return nil
+		}
+		if report.Timestamp.IsZero() {
+			report.Timestamp = msg.Time
+		}
+		_, span := tracing.Start(ctx, "surveillance.OnReport")
+		if err := tracing.End(span, m.OnReport(report)); err != nil {
+			return fmt.Errorf("cannot watch execution report for order %s : %w", report.OrderID, err)
+		}
+		return nil
+	})
+}
+
+// ConsumeTrades feeds trades to the monitor until ctx is done
+func ConsumeTrades(ctx context.Context, m *Monitor, reader *kafka.Reader) {
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		logger := logging.ForMessage(ctx, msg)
+
+		var trade traders.Trade
+		if err := json.Unmarshal(msg.Value, &trade); err != nil {
+			logger.WithError(err).Error("Skipping malformed trade")
+			return nil
+		}
+		if trade.TradeID == "" {
+			logger.Error("Skipping trade without id")
+			return nil
+		}
+		if trade.ExecutedAt.IsZero() {
+			trade.ExecutedAt = msg.Time
+		}
+		_, span := tracing.Start(ctx, "surveillance.OnTrade")
+		if err := tracing.End(span, m.OnTrade(trade)); err != nil {
+			return fmt.Errorf("cannot watch trade %s : %w", trade.TradeID, err)
+		}
+		return nil
+	})
+}
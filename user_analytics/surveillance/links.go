@@ -0,0 +1,122 @@
+package surveillance
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSelfLink      = errors.New("An account cannot be linked to itself")
+	ErrLinkNotFound  = errors.New("Accounts are not linked")
+	ErrInvalidReason = errors.New("Reason cannot be empty or longer than 255 characters")
+)
+
+// Link is a relationship compliance knows of between two accounts, such as
+// a shared owner or household
+type Link struct {
+	UserIDA   int64     `json:"user_id_a"`
+	UserIDB   int64     `json:"user_id_b"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Links are stored once per pair, lower user ID first
+func pair(a, b int64) (int64, int64) {
+	if a > b {
+		return b, a
+	}
+	return a, b
+}
+
+// LinkAccounts records that two accounts are related, replacing the reason
+// of an existing link
+func LinkAccounts(db *sql.DB, a, b int64, reason string) (*Link, error) {
+	if a == b {
+		return nil, ErrSelfLink
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > 255 {
+		return nil, ErrInvalidReason
+	}
+	a, b = pair(a, b)
+	link := &Link{UserIDA: a, UserIDB: b, Reason: reason, CreatedAt: time.Now().UTC()}
+	_, err := db.Exec(
+		`INSERT INTO surveillance_account_links (user_id_a, user_id_b, reason, created_at) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE reason = VALUES(reason)`,
+		link.UserIDA, link.UserIDB, link.Reason, link.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// UnlinkAccounts removes a recorded relationship
+func UnlinkAccounts(db *sql.DB, a, b int64) error {
+	a, b = pair(a, b)
+	res, err := db.Exec("DELETE FROM surveillance_account_links WHERE user_id_a = ? AND user_id_b = ?", a, b)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrLinkNotFound
+	}
+	return nil
+}
+
+// ListLinks returns the recorded relationships of the user
+func ListLinks(db *sql.DB, userID int64) ([]Link, error) {
+	rows, err := db.Query(
+		"SELECT user_id_a, user_id_b, reason, created_at FROM surveillance_account_links WHERE user_id_a = ? OR user_id_b = ? ORDER BY created_at",
+		userID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []Link{}
+	for rows.Next() {
+		var l Link
+		if err := rows.Scan(&l.UserIDA, &l.UserIDB, &l.Reason, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// relation explains why two accounts are related, empty when they are not.
+// Recorded links come first, otherwise accounts that were used from the same
+// IP address since lookback are related.
+func relation(db *sql.DB, a, b int64, since time.Time) (string, error) {
+	a, b = pair(a, b)
+	var reason string
+	err := db.QueryRow("SELECT reason FROM surveillance_account_links WHERE user_id_a = ? AND user_id_b = ?", a, b).Scan(&reason)
+	if err == nil {
+		return reason, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	var ip string
+	err = db.QueryRow(
+		`SELECT x.ip FROM activity_events x JOIN activity_events y ON y.ip = x.ip
+		WHERE x.user_id = ? AND y.user_id = ? AND x.ip <> '' AND x.occurred_at >= ? AND y.occurred_at >= ? LIMIT 1`,
+		a, b, since, since,
+	).Scan(&ip)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return "shared IP address " + ip, nil
+}
@@ -0,0 +1,666 @@
+package surveillance
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/utils"
+	"github.com/rohanchavan1918/user_analytics/conf"
+	"github.com/rohanchavan1918/user_analytics/traders"
+)
+
+// How long a pair of accounts is remembered as related or not before the
+// database is asked again
+const relationTTL = 10 * time.Minute
+
+// Order command types and terminal statuses published by platform_apis and
+// the order processor
+const (
+	commandNew     = "new"
+	commandReplace = "replace"
+
+	statusCancelled = "cancelled"
+)
+
+var terminalStatuses = map[string]bool{statusCancelled: true, "filled": true, "rejected": true, "expired": true}
+
+// Command is an order command published by platform_apis
+type Command struct {
+	Type     string    `json:"type"`
+	OrderID  string    `json:"order_id"`
+	UserID   int64     `json:"user_id"`
+	Symbol   string    `json:"symbol"`
+	Side     string    `json:"side"`
+	Price    float64   `json:"price"`
+	Quantity float64   `json:"quantity"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// ExecutionReport carries the state of an order after the order processor
+// handled it
+type ExecutionReport struct {
+	OrderID        string    `json:"order_id"`
+	UserID         int64     `json:"user_id"`
+	Status         string    `json:"status"`
+	FilledQuantity float64   `json:"filled_quantity"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+type message struct {
+	at          time.Time
+	commandType string
+	orderID     string
+}
+
+type relationEntry struct {
+	reason  string
+	expires time.Time
+}
+
+// Monitor runs the detectors. Order message rates and the last trade price
+// of every symbol are kept in memory, everything a case is built from is in
+// the database.
+type Monitor struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	prices    map[string]float64
+	messages  map[string][]message
+	relations map[[2]int64]relationEntry
+}
+
+func NewMonitor(db *sql.DB) *Monitor {
+	return &Monitor{
+		db:        db,
+		prices:    map[string]float64{},
+		messages:  map[string][]message{},
+		relations: map[[2]int64]relationEntry{},
+	}
+}
+
+// settings returns the configured thresholds with defaults for those left out
+func settings() conf.SurveillanceConfig {
+	s := conf.AppConfig().Surveillance
+	if s.IPLinkLookback <= 0 {
+		s.IPLinkLookback = 30 * 24 * time.Hour
+	}
+	if s.LargeOrderNotional <= 0 {
+		s.LargeOrderNotional = 100000
+	}
+	if s.NearTouchBps <= 0 {
+		s.NearTouchBps = 50
+	}
+	if s.MaxOrderLifetime <= 0 {
+		s.MaxOrderLifetime = 30 * time.Second
+	}
+	if s.MaxFillRatio <= 0 {
+		s.MaxFillRatio = 0.1
+	}
+	if s.LayeringLevels <= 0 {
+		s.LayeringLevels = 3
+	}
+	if s.LayeringWindow <= 0 {
+		s.LayeringWindow = time.Minute
+	}
+	if s.QuoteStuffingMessages <= 0 {
+		s.QuoteStuffingMessages = 50
+	}
+	if s.QuoteStuffingWindow <= 0 {
+		s.QuoteStuffingWindow = time.Second
+	}
+	if s.PumpWindow <= 0 {
+		s.PumpWindow = time.Hour
+	}
+	if s.PumpRisePct <= 0 {
+		s.PumpRisePct = 20
+	}
+	if s.DumpFallPct <= 0 {
+		s.DumpFallPct = 10
+	}
+	if s.PumpVolumeMultiple <= 0 {
+		s.PumpVolumeMultiple = 5
+	}
+	if s.PumpBaselineWindows <= 0 {
+		s.PumpBaselineWindows = 24
+	}
+	if s.ScanInterval <= 0 {
+		s.ScanInterval = time.Minute
+	}
+	return s
+}
+
+// lastPrice is the price of the latest trade of the symbol, the stand in
+// for the touch as order books are not published. Zero when the symbol has
+// not traded yet.
+func (m *Monitor) lastPrice(symbol string) float64 {
+	m.mu.Lock()
+	price, ok := m.prices[symbol]
+	m.mu.Unlock()
+	if ok {
+		return price
+	}
+
+	err := m.db.QueryRow("SELECT price FROM surveillance_trades WHERE symbol = ? ORDER BY executed_at DESC LIMIT 1", symbol).Scan(&price)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		utils.LogError("Failed to load the last price of %s : %s", symbol, err)
+		return 0
+	}
+	m.mu.Lock()
+	if _, ok := m.prices[symbol]; !ok {
+		m.prices[symbol] = price
+	}
+	m.mu.Unlock()
+	return price
+}
+
+// OnCommand tracks order messages for quote stuffing and remembers new and
+// replaced orders so their cancellation can be judged
+func (m *Monitor) OnCommand(cmd Command) error {
+	s := settings()
+	if err := m.countMessage(cmd, s); err != nil {
+		return err
+	}
+
+	switch cmd.Type {
+	case commandNew:
+		_, err := m.db.Exec(
+			`INSERT IGNORE INTO surveillance_orders (order_id, user_id, symbol, side, price, quantity, reference_price, status, placed_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, 'new', ?)`,
+			cmd.OrderID, cmd.UserID, cmd.Symbol, cmd.Side, cmd.Price, cmd.Quantity, m.lastPrice(cmd.Symbol), cmd.SentAt,
+		)
+		return err
+	case commandReplace:
+		// A replaced order is judged by where it was last moved to
+		_, err := m.db.Exec(
+			"UPDATE surveillance_orders SET price = ?, quantity = ?, reference_price = ? WHERE order_id = ? AND closed_at IS NULL",
+			cmd.Price, cmd.Quantity, m.lastPrice(cmd.Symbol), cmd.OrderID,
+		)
+		return err
+	}
+	return nil
+}
+
+// countMessage reports quote stuffing once a user sends more order messages
+// on a symbol than allowed within the window. The burst is reported once,
+// counting starts over afterwards.
+func (m *Monitor) countMessage(cmd Command, s conf.SurveillanceConfig) error {
+	key := fmt.Sprintf("%d:%s", cmd.UserID, cmd.Symbol)
+	cutoff := cmd.SentAt.Add(-s.QuoteStuffingWindow)
+
+	// A retried command is counted once
+	current := message{at: cmd.SentAt, commandType: cmd.Type, orderID: cmd.OrderID}
+	m.mu.Lock()
+	kept := m.messages[key][:0]
+	seen := false
+	for _, msg := range m.messages[key] {
+		if msg.at.After(cutoff) {
+			kept = append(kept, msg)
+			seen = seen || msg == current
+		}
+	}
+	if !seen {
+		kept = append(kept, current)
+	}
+	m.messages[key] = kept
+	kept = append([]message(nil), kept...)
+	m.mu.Unlock()
+	if len(kept) <= s.QuoteStuffingMessages {
+		return nil
+	}
+
+	counts := map[string]int{}
+	for _, msg := range kept {
+		counts[msg.commandType]++
+	}
+	first := kept[0].at
+	err := record(m.db, detection{
+		Type:    TypeQuoteStuffing,
+		Symbol:  cmd.Symbol,
+		Subject: key,
+		Summary: fmt.Sprintf("User %d sent %d order messages on %s within %s", cmd.UserID, len(kept), cmd.Symbol, cmd.SentAt.Sub(first)),
+		UserIDs: []int64{cmd.UserID},
+		Evidence: []Evidence{newEvidence("message_burst", fmt.Sprint(first.UnixNano()), cmd.SentAt, map[string]interface{}{
+			"messages":       len(kept),
+			"by_type":        counts,
+			"first_at":       first,
+			"last_at":        cmd.SentAt,
+			"window_seconds": s.QuoteStuffingWindow.Seconds(),
+		})},
+	})
+	if err != nil {
+		// The burst stays counted so the retry reports it
+		return err
+	}
+	m.mu.Lock()
+	delete(m.messages, key)
+	m.mu.Unlock()
+	return nil
+}
+
+// OnReport keeps the fill state of tracked orders and judges the ones that
+// get cancelled
+func (m *Monitor) OnReport(r ExecutionReport) error {
+	if !terminalStatuses[r.Status] {
+		_, err := m.db.Exec(
+			"UPDATE surveillance_orders SET status = ?, filled_quantity = ? WHERE order_id = ? AND closed_at IS NULL",
+			r.Status, r.FilledQuantity, r.OrderID,
+		)
+		return err
+	}
+
+	_, err := m.db.Exec(
+		"UPDATE surveillance_orders SET status = ?, filled_quantity = ?, closed_at = ? WHERE order_id = ? AND closed_at IS NULL",
+		r.Status, r.FilledQuantity, r.Timestamp, r.OrderID,
+	)
+	if err != nil || r.Status != statusCancelled {
+		return err
+	}
+
+	// A cancel stays unjudged until judging it went through, so a retried
+	// report judges it again rather than losing the evidence
+	var judged bool
+	err = m.db.QueryRow("SELECT judged FROM surveillance_orders WHERE order_id = ? AND status = ?", r.OrderID, statusCancelled).Scan(&judged)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Placed before surveillance started or closed otherwise
+		return nil
+	}
+	if err != nil || judged {
+		return err
+	}
+	if err := m.judgeCancel(r.OrderID); err != nil {
+		return err
+	}
+	_, err = m.db.Exec("UPDATE surveillance_orders SET judged = TRUE WHERE order_id = ?", r.OrderID)
+	return err
+}
+
+type trackedOrder struct {
+	ID             string    `json:"order_id"`
+	UserID         int64     `json:"user_id"`
+	Symbol         string    `json:"symbol"`
+	Side           string    `json:"side"`
+	Price          float64   `json:"price"`
+	Quantity       float64   `json:"quantity"`
+	FilledQuantity float64   `json:"filled_quantity"`
+	ReferencePrice float64   `json:"reference_price"`
+	PlacedAt       time.Time `json:"placed_at"`
+	ClosedAt       time.Time `json:"cancelled_at"`
+}
+
+const selectOrder = `SELECT order_id, user_id, symbol, side, price, quantity, filled_quantity, reference_price, placed_at, closed_at
+	FROM surveillance_orders`
+
+func scanOrder(row scanner) (*trackedOrder, error) {
+	o := &trackedOrder{}
+	err := row.Scan(&o.ID, &o.UserID, &o.Symbol, &o.Side, &o.Price, &o.Quantity, &o.FilledQuantity, &o.ReferencePrice, &o.PlacedAt, &o.ClosedAt)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// judgeCancel flags large orders near the touch that were pulled quickly
+// and barely filled. Such an order is spoofing when its owner traded on the
+// other side while it rested, and layering when it was one of several on
+// different price levels pulled within a short time.
+func (m *Monitor) judgeCancel(orderID string) error {
+	s := settings()
+	o, err := scanOrder(m.db.QueryRow(selectOrder+" WHERE order_id = ?", orderID))
+	if err != nil {
+		return err
+	}
+
+	if o.Price*o.Quantity < s.LargeOrderNotional || o.ReferencePrice <= 0 || o.Quantity <= 0 {
+		return nil
+	}
+	if math.Abs(o.Price-o.ReferencePrice)/o.ReferencePrice*10000 > s.NearTouchBps {
+		return nil
+	}
+	if o.ClosedAt.Sub(o.PlacedAt) > s.MaxOrderLifetime || o.FilledQuantity/o.Quantity > s.MaxFillRatio {
+		return nil
+	}
+	if _, err := m.db.Exec("UPDATE surveillance_orders SET spoof_candidate = TRUE WHERE order_id = ?", o.ID); err != nil {
+		return err
+	}
+	orderEvidence := newEvidence("cancelled_order", o.ID, o.ClosedAt, o)
+
+	// Trades are consumed from another topic, fills that are not in yet when
+	// the cancel is judged are missed
+	opposite := "sell_user_id"
+	if o.Side == "sell" {
+		opposite = "buy_user_id"
+	}
+	rows, err := m.db.Query(
+		"SELECT trade_id, price, quantity, executed_at FROM surveillance_trades WHERE symbol = ? AND "+opposite+" = ? AND executed_at BETWEEN ? AND ?",
+		o.Symbol, o.UserID, o.PlacedAt, o.ClosedAt,
+	)
+	if err != nil {
+		return err
+	}
+	fills := []Evidence{}
+	for rows.Next() {
+		var tradeID string
+		var price, quantity float64
+		var executedAt time.Time
+		if err := rows.Scan(&tradeID, &price, &quantity, &executedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		fills = append(fills, newEvidence("opposite_fill", tradeID, executedAt, map[string]interface{}{
+			"trade_id": tradeID, "order_id": o.ID, "price": price, "quantity": quantity, "executed_at": executedAt,
+		}))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(fills) > 0 {
+		err := record(m.db, detection{
+			Type:     TypeSpoofing,
+			Symbol:   o.Symbol,
+			Subject:  fmt.Sprintf("%d:%s", o.UserID, o.Symbol),
+			Summary:  fmt.Sprintf("User %d traded on the other side while a large %s order on %s rested, then cancelled it", o.UserID, o.Side, o.Symbol),
+			UserIDs:  []int64{o.UserID},
+			Evidence: append([]Evidence{orderEvidence}, fills...),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	rows, err = m.db.Query(
+		selectOrder+" WHERE user_id = ? AND symbol = ? AND side = ? AND spoof_candidate = TRUE AND closed_at BETWEEN ? AND ?",
+		o.UserID, o.Symbol, o.Side, o.ClosedAt.Add(-s.LayeringWindow), o.ClosedAt,
+	)
+	if err != nil {
+		return err
+	}
+	layers := []Evidence{}
+	levels := map[float64]bool{}
+	for rows.Next() {
+		layer, err := scanOrder(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		levels[layer.Price] = true
+		layers = append(layers, newEvidence("cancelled_order", layer.ID, layer.ClosedAt, layer))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(levels) < s.LayeringLevels {
+		return nil
+	}
+	return record(m.db, detection{
+		Type:     TypeLayering,
+		Symbol:   o.Symbol,
+		Subject:  fmt.Sprintf("%d:%s:%s", o.UserID, o.Symbol, o.Side),
+		Summary:  fmt.Sprintf("User %d pulled large %s orders on %d price levels of %s within %s", o.UserID, o.Side, len(levels), o.Symbol, s.LayeringWindow),
+		UserIDs:  []int64{o.UserID},
+		Evidence: layers,
+	})
+}
+
+// OnTrade stores the trade for the other detectors and flags trades between
+// the same or related accounts
+func (m *Monitor) OnTrade(t traders.Trade) error {
+	_, err := m.db.Exec(
+		`INSERT IGNORE INTO surveillance_trades (trade_id, symbol, price, quantity, buy_user_id, sell_user_id, executed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.TradeID, t.Symbol, t.Price, t.Quantity, t.BuyUserID, t.SellUserID, t.ExecutedAt,
+	)
+	if err != nil {
+		return err
+	}
+	// Redelivered trades are judged once, trades whose judging failed
+	// are judged again
+	var judged bool
+	if err := m.db.QueryRow("SELECT judged FROM surveillance_trades WHERE trade_id = ?", t.TradeID).Scan(&judged); err != nil || judged {
+		return err
+	}
+
+	m.mu.Lock()
+	m.prices[t.Symbol] = t.Price
+	m.mu.Unlock()
+
+	if err := m.judgeTrade(t); err != nil {
+		return err
+	}
+	_, err = m.db.Exec("UPDATE surveillance_trades SET judged = TRUE WHERE trade_id = ?", t.TradeID)
+	return err
+}
+
+func (m *Monitor) judgeTrade(t traders.Trade) error {
+	evidence := newEvidence("trade", t.TradeID, t.ExecutedAt, t)
+	if t.BuyUserID == t.SellUserID {
+		return record(m.db, detection{
+			Type:     TypeWashTrade,
+			Symbol:   t.Symbol,
+			Subject:  fmt.Sprintf("%d:%s", t.BuyUserID, t.Symbol),
+			Summary:  fmt.Sprintf("User %d traded %s with themselves", t.BuyUserID, t.Symbol),
+			UserIDs:  []int64{t.BuyUserID},
+			Evidence: []Evidence{evidence},
+		})
+	}
+
+	reason, err := m.relation(t.BuyUserID, t.SellUserID, t.ExecutedAt)
+	if err != nil || reason == "" {
+		return err
+	}
+	a, b := pair(t.BuyUserID, t.SellUserID)
+	return record(m.db, detection{
+		Type:     TypeRelatedTrade,
+		Symbol:   t.Symbol,
+		Subject:  fmt.Sprintf("%d:%d:%s", a, b, t.Symbol),
+		Summary:  fmt.Sprintf("Related users %d and %d traded %s with each other (%s)", a, b, t.Symbol, reason),
+		UserIDs:  []int64{a, b},
+		Evidence: []Evidence{evidence},
+	})
+}
+
+func (m *Monitor) relation(a, b int64, at time.Time) (string, error) {
+	a, b = pair(a, b)
+	key := [2]int64{a, b}
+	now := time.Now()
+
+	m.mu.Lock()
+	entry, ok := m.relations[key]
+	m.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.reason, nil
+	}
+
+	reason, err := relation(m.db, a, b, at.Add(-settings().IPLinkLookback))
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	m.relations[key] = relationEntry{reason: reason, expires: now.Add(relationTTL)}
+	for k, e := range m.relations {
+		if now.After(e.expires) {
+			delete(m.relations, k)
+		}
+	}
+	m.mu.Unlock()
+	return reason, nil
+}
+
+// Run scans for pump and dump signatures every scan interval, it never
+// returns
+func (m *Monitor) Run() {
+	ticker := time.NewTicker(settings().ScanInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if err := m.ScanPumps(now.UTC()); err != nil {
+			utils.LogError("Failed to scan for pump and dumps : %s", err)
+		}
+	}
+}
+
+type windowTrade struct {
+	tradeID    string
+	price      float64
+	quantity   float64
+	buyUserID  int64
+	sellUserID int64
+	executedAt time.Time
+}
+
+// ScanPumps looks at the last pump window of every traded symbol. A sharp
+// rise on unusual volume followed by a fall from the peak is reported along
+// with the accounts that bought before the peak and sold into it.
+func (m *Monitor) ScanPumps(now time.Time) error {
+	s := settings()
+	rows, err := m.db.Query("SELECT DISTINCT symbol FROM surveillance_trades WHERE executed_at >= ?", now.Add(-s.PumpWindow))
+	if err != nil {
+		return err
+	}
+	symbols := []string{}
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			rows.Close()
+			return err
+		}
+		symbols = append(symbols, symbol)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, symbol := range symbols {
+		if err := m.scanPump(symbol, now, s); err != nil {
+			utils.LogError("Failed to scan %s for pump and dumps : %s", symbol, err)
+		}
+	}
+	return nil
+}
+
+func (m *Monitor) scanPump(symbol string, now time.Time, s conf.SurveillanceConfig) error {
+	from := now.Add(-s.PumpWindow)
+	rows, err := m.db.Query(
+		"SELECT trade_id, price, quantity, buy_user_id, sell_user_id, executed_at FROM surveillance_trades WHERE symbol = ? AND executed_at >= ? ORDER BY executed_at, trade_id",
+		symbol, from,
+	)
+	if err != nil {
+		return err
+	}
+	trades := []windowTrade{}
+	for rows.Next() {
+		var t windowTrade
+		if err := rows.Scan(&t.tradeID, &t.price, &t.quantity, &t.buyUserID, &t.sellUserID, &t.executedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		trades = append(trades, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(trades) < 3 {
+		return err
+	}
+
+	start, last := trades[0].price, trades[len(trades)-1].price
+	peak := trades[0]
+	var volume float64
+	for _, t := range trades {
+		volume += t.quantity
+		if t.price > peak.price {
+			peak = t
+		}
+	}
+	rise := (peak.price - start) / start * 100
+	fall := (peak.price - last) / peak.price * 100
+	if rise < s.PumpRisePct || fall < s.DumpFallPct {
+		return nil
+	}
+
+	var baseline sql.NullFloat64
+	err = m.db.QueryRow(
+		"SELECT SUM(quantity) FROM surveillance_trades WHERE symbol = ? AND executed_at >= ? AND executed_at < ?",
+		symbol, from.Add(-time.Duration(s.PumpBaselineWindows)*s.PumpWindow), from,
+	).Scan(&baseline)
+	if err != nil {
+		return err
+	}
+	// Without history there is no telling unusual volume from a new listing
+	usual := baseline.Float64 / float64(s.PumpBaselineWindows)
+	if usual <= 0 || volume < usual*s.PumpVolumeMultiple {
+		return nil
+	}
+
+	// Who bought on the way up and sold after the peak
+	type position struct {
+		bought, boughtNotional, sold, soldNotional float64
+	}
+	positions := map[int64]*position{}
+	get := func(userID int64) *position {
+		if positions[userID] == nil {
+			positions[userID] = &position{}
+		}
+		return positions[userID]
+	}
+	for _, t := range trades {
+		if !t.executedAt.After(peak.executedAt) {
+			p := get(t.buyUserID)
+			p.bought += t.quantity
+			p.boughtNotional += t.quantity * t.price
+		} else {
+			p := get(t.sellUserID)
+			p.sold += t.quantity
+			p.soldNotional += t.quantity * t.price
+		}
+	}
+	userIDs := []int64{}
+	for userID, p := range positions {
+		if p.bought > 0 && p.sold > 0 {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		return positions[userIDs[i]].soldNotional > positions[userIDs[j]].soldNotional
+	})
+	if len(userIDs) > 10 {
+		userIDs = userIDs[:10]
+	}
+
+	ref := fmt.Sprint(peak.executedAt.UnixNano())
+	evidence := []Evidence{newEvidence("price_move", ref, now, map[string]interface{}{
+		"window_start":    from,
+		"start_price":     start,
+		"peak_price":      peak.price,
+		"peak_trade_id":   peak.tradeID,
+		"peak_at":         peak.executedAt,
+		"last_price":      last,
+		"rise_pct":        rise,
+		"fall_pct":        fall,
+		"volume":          volume,
+		"baseline_volume": usual,
+	})}
+	for _, userID := range userIDs {
+		p := positions[userID]
+		evidence = append(evidence, newEvidence("beneficiary", fmt.Sprintf("%d:%s", userID, ref), now, map[string]interface{}{
+			"user_id":            userID,
+			"bought_before_peak": p.bought,
+			"avg_buy_price":      p.boughtNotional / p.bought,
+			"sold_after_peak":    p.sold,
+			"avg_sell_price":     p.soldNotional / p.sold,
+		}))
+	}
+
+	return record(m.db, detection{
+		Type:     TypePumpAndDump,
+		Symbol:   symbol,
+		Subject:  symbol,
+		Summary:  fmt.Sprintf("%s rose %.1f%% on %.1fx its usual volume, then fell %.1f%% from the peak", symbol, rise, volume/usual, fall),
+		UserIDs:  userIDs,
+		Evidence: evidence,
+	})
+}
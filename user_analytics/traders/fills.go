@@ -0,0 +1,200 @@
+package traders
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Quantities closer to zero than this are treated as nothing left
+const epsilon = 1e-9
+
+var schemas = []string{
+	`CREATE TABLE IF NOT EXISTS trader_fills (
+		trade_id VARCHAR(64) NOT NULL,
+		side VARCHAR(8) NOT NULL,
+		user_id BIGINT NOT NULL,
+		applied_at DATETIME(6) NOT NULL,
+		PRIMARY KEY (trade_id, side)
+	)`,
+	`CREATE TABLE IF NOT EXISTS trader_lots (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		symbol VARCHAR(32) NOT NULL,
+		direction TINYINT NOT NULL,
+		quantity DECIMAL(24, 8) NOT NULL,
+		price DECIMAL(24, 8) NOT NULL,
+		opened_at DATETIME(6) NOT NULL,
+		INDEX idx_trader_lots_user (user_id, symbol, opened_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS trader_round_trips (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		symbol VARCHAR(32) NOT NULL,
+		direction TINYINT NOT NULL,
+		quantity DECIMAL(24, 8) NOT NULL,
+		entry_price DECIMAL(24, 8) NOT NULL,
+		exit_price DECIMAL(24, 8) NOT NULL,
+		pnl DECIMAL(24, 8) NOT NULL,
+		opened_at DATETIME(6) NOT NULL,
+		closed_at DATETIME(6) NOT NULL,
+		INDEX idx_trader_round_trips_user (user_id, closed_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS trader_daily_stats (
+		user_id BIGINT NOT NULL,
+		day DATE NOT NULL,
+		volume DECIMAL(24, 8) NOT NULL DEFAULT 0,
+		trades BIGINT NOT NULL DEFAULT 0,
+		fees DECIMAL(24, 8) NOT NULL DEFAULT 0,
+		realized_pnl DECIMAL(24, 8) NOT NULL DEFAULT 0,
+		round_trips BIGINT NOT NULL DEFAULT 0,
+		wins BIGINT NOT NULL DEFAULT 0,
+		holding_seconds DOUBLE NOT NULL DEFAULT 0,
+		PRIMARY KEY (user_id, day),
+		INDEX idx_trader_daily_stats_day (day)
+	)`,
+	`CREATE TABLE IF NOT EXISTS trader_privacy (
+		user_id BIGINT PRIMARY KEY,
+		leaderboard_opt_out BOOLEAN NOT NULL DEFAULT FALSE,
+		display_name VARCHAR(64) NOT NULL DEFAULT '',
+		updated_at DATETIME(6) NOT NULL
+	)`,
+}
+
+func EnsureSchema(db *sql.DB) error {
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type lot struct {
+	id        int64
+	direction int
+	quantity  float64
+	price     float64
+	openedAt  time.Time
+}
+
+type roundTrip struct {
+	direction  int
+	quantity   float64
+	entryPrice float64
+	pnl        float64
+	openedAt   time.Time
+}
+
+// ApplyFill matches a fill against the user's open lots of the symbol first
+// in first out. Every closed lot, or part of one, is a round trip with its
+// own P&L and holding period, whatever is left of the fill opens a new lot.
+// Every fill is applied once, redelivered trades are ignored.
+func ApplyFill(db *sql.DB, f Fill) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO trader_fills (trade_id, side, user_id, applied_at) VALUES (?, ?, ?, ?)", f.TradeID, f.Side, f.UserID, time.Now().UTC())
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(
+		"SELECT id, direction, quantity, price, opened_at FROM trader_lots WHERE user_id = ? AND symbol = ? ORDER BY opened_at, id FOR UPDATE",
+		f.UserID, f.Symbol,
+	)
+	if err != nil {
+		return err
+	}
+	lots := []lot{}
+	for rows.Next() {
+		var l lot
+		if err := rows.Scan(&l.id, &l.direction, &l.quantity, &l.price, &l.openedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	direction := 1
+	if f.Side == "sell" {
+		direction = -1
+	}
+	remaining := f.Quantity
+	trips := []roundTrip{}
+	for _, l := range lots {
+		if remaining < epsilon || l.direction == direction {
+			break
+		}
+		closed := math.Min(remaining, l.quantity)
+		trips = append(trips, roundTrip{
+			direction:  l.direction,
+			quantity:   closed,
+			entryPrice: l.price,
+			pnl:        closed * (f.Price - l.price) * float64(l.direction),
+			openedAt:   l.openedAt,
+		})
+		remaining -= closed
+		if l.quantity-closed < epsilon {
+			_, err = tx.Exec("DELETE FROM trader_lots WHERE id = ?", l.id)
+		} else {
+			_, err = tx.Exec("UPDATE trader_lots SET quantity = ? WHERE id = ?", l.quantity-closed, l.id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if remaining >= epsilon {
+		_, err := tx.Exec(
+			"INSERT INTO trader_lots (user_id, symbol, direction, quantity, price, opened_at) VALUES (?, ?, ?, ?, ?, ?)",
+			f.UserID, f.Symbol, direction, remaining, f.Price, f.ExecutedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	realized, wins, holding := -f.Fee, 0, 0.0
+	for _, trip := range trips {
+		_, err := tx.Exec(
+			`INSERT INTO trader_round_trips (user_id, symbol, direction, quantity, entry_price, exit_price, pnl, opened_at, closed_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			f.UserID, f.Symbol, trip.direction, trip.quantity, trip.entryPrice, f.Price, trip.pnl, trip.openedAt, f.ExecutedAt,
+		)
+		if err != nil {
+			return err
+		}
+		realized += trip.pnl
+		if trip.pnl > 0 {
+			wins++
+		}
+		holding += f.ExecutedAt.Sub(trip.openedAt).Seconds()
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO trader_daily_stats (user_id, day, volume, trades, fees, realized_pnl, round_trips, wins, holding_seconds)
+		VALUES (?, ?, ?, 1, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE volume = volume + VALUES(volume), trades = trades + 1, fees = fees + VALUES(fees),
+		realized_pnl = realized_pnl + VALUES(realized_pnl), round_trips = round_trips + VALUES(round_trips),
+		wins = wins + VALUES(wins), holding_seconds = holding_seconds + VALUES(holding_seconds)`,
+		f.UserID, f.ExecutedAt.UTC().Format("2006-01-02"), f.Quantity*f.Price, f.Fee, realized, len(trips), wins, holding,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
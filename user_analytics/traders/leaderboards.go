@@ -0,0 +1,162 @@
+package traders
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rohanchavan1918/user_analytics/conf"
+)
+
+// Leaderboard periods, in UTC
+const (
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodAllTime = "all_time"
+)
+
+// Metrics traders can be ranked by, mapped to the expression they sort on
+var rankings = map[string]string{
+	"realized_pnl": "SUM(s.realized_pnl)",
+	"volume":       "SUM(s.volume)",
+	"trades":       "SUM(s.trades)",
+	"win_rate":     "SUM(s.wins) / SUM(s.round_trips)",
+}
+
+var (
+	ErrInvalidPeriod      = errors.New("Period must be daily, weekly or all_time")
+	ErrInvalidRanking     = errors.New("Metric must be realized_pnl, volume, trades or win_rate")
+	ErrInvalidDisplayName = errors.New("display_name cannot be longer than 64 characters")
+)
+
+type Entry struct {
+	Rank        int      `json:"rank"`
+	UserID      int64    `json:"user_id"`
+	DisplayName string   `json:"display_name"`
+	Volume      float64  `json:"volume"`
+	Trades      int64    `json:"trades"`
+	RealizedPnL float64  `json:"realized_pnl"`
+	RoundTrips  int64    `json:"round_trips"`
+	WinRate     *float64 `json:"win_rate"`
+}
+
+// PeriodBounds returns the first day of the period containing day and the
+// day after it ends, both zero for all_time
+func PeriodBounds(period string, day time.Time) (time.Time, time.Time, error) {
+	day = startOfDay(day)
+	switch period {
+	case PeriodDaily:
+		return day, day.AddDate(0, 0, 1), nil
+	case PeriodWeekly:
+		// Weeks start on Monday
+		monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return monday, monday.AddDate(0, 0, 7), nil
+	case PeriodAllTime:
+		return time.Time{}, time.Time{}, nil
+	}
+	return time.Time{}, time.Time{}, ErrInvalidPeriod
+}
+
+// Leaderboard ranks the traders of the period containing day by metric and
+// returns a page of it along with the number of ranked traders. Traders who
+// opted out are left out, win rates only rank traders with enough round
+// trips to mean something.
+func Leaderboard(db *sql.DB, period, metric string, day time.Time, limit, offset int) ([]Entry, int, error) {
+	order, ok := rankings[metric]
+	if !ok {
+		return nil, 0, ErrInvalidRanking
+	}
+	from, to, err := PeriodBounds(period, day)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := []string{"(p.leaderboard_opt_out IS NULL OR p.leaderboard_opt_out = FALSE)"}
+	args := []interface{}{}
+	if !from.IsZero() {
+		where = append(where, "s.day >= ? AND s.day < ?")
+		args = append(args, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+	minRoundTrips := 0
+	if metric == "win_rate" {
+		minRoundTrips = conf.AppConfig().Traders.MinRoundTrips
+		if minRoundTrips < 1 {
+			minRoundTrips = 1
+		}
+	}
+	args = append(args, minRoundTrips)
+
+	grouped := `SELECT s.user_id, COALESCE(MAX(p.display_name), ''), SUM(s.volume), SUM(s.trades), SUM(s.realized_pnl),
+		SUM(s.round_trips), SUM(s.wins)
+		FROM trader_daily_stats s LEFT JOIN trader_privacy p ON p.user_id = s.user_id
+		WHERE ` + strings.Join(where, " AND ") + `
+		GROUP BY s.user_id HAVING SUM(s.round_trips) >= ?`
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM ("+grouped+") ranked", args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(grouped+" ORDER BY "+order+" DESC, s.user_id LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		var wins int64
+		if err := rows.Scan(&e.UserID, &e.DisplayName, &e.Volume, &e.Trades, &e.RealizedPnL, &e.RoundTrips, &wins); err != nil {
+			return nil, 0, err
+		}
+		e.Rank = offset + len(entries) + 1
+		if e.RoundTrips > 0 {
+			winRate := float64(wins) / float64(e.RoundTrips)
+			e.WinRate = &winRate
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+// Privacy is what a trader chose to share on leaderboards
+type Privacy struct {
+	UserID            int64     `json:"user_id"`
+	LeaderboardOptOut bool      `json:"leaderboard_opt_out"`
+	DisplayName       string    `json:"display_name"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// GetPrivacy returns the user's settings, traders who never changed them are
+// listed without a display name
+func GetPrivacy(db *sql.DB, userID int64) (*Privacy, error) {
+	p := &Privacy{UserID: userID}
+	err := db.QueryRow(
+		"SELECT leaderboard_opt_out, display_name, updated_at FROM trader_privacy WHERE user_id = ?", userID,
+	).Scan(&p.LeaderboardOptOut, &p.DisplayName, &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, nil
+	}
+	return p, err
+}
+
+// SetPrivacy replaces the user's settings
+func SetPrivacy(db *sql.DB, userID int64, optOut bool, displayName string) (*Privacy, error) {
+	displayName = strings.TrimSpace(displayName)
+	if utf8.RuneCountInString(displayName) > 64 {
+		return nil, ErrInvalidDisplayName
+	}
+	p := &Privacy{UserID: userID, LeaderboardOptOut: optOut, DisplayName: displayName, UpdatedAt: time.Now().UTC()}
+	_, err := db.Exec(
+		`INSERT INTO trader_privacy (user_id, leaderboard_opt_out, display_name, updated_at) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE leaderboard_opt_out = VALUES(leaderboard_opt_out), display_name = VALUES(display_name), updated_at = VALUES(updated_at)`,
+		p.UserID, p.LeaderboardOptOut, p.DisplayName, p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,142 @@
+package traders
+
+import (
+	"database/sql"
+	"math"
+	"time"
+)
+
+// Sharpe ratios are annualized with the number of trading days in a year
+const tradingDays = 252
+
+// Windows are the rolling windows metrics are reported for, in days counting
+// today. Zero means everything since the first trade.
+var Windows = []struct {
+	Name string
+	Days int
+}{
+	{"1d", 1},
+	{"7d", 7},
+	{"30d", 30},
+	{"90d", 90},
+	{"all", 0},
+}
+
+// Metrics summarizes a trader's activity over a window. Ratios are nil when
+// there is nothing to compute them from.
+type Metrics struct {
+	Window            string     `json:"window"`
+	From              *time.Time `json:"from"`
+	Volume            float64    `json:"volume"`
+	Trades            int64      `json:"trades"`
+	Fees              float64    `json:"fees"`
+	RealizedPnL       float64    `json:"realized_pnl"`
+	RoundTrips        int64      `json:"round_trips"`
+	WinRate           *float64   `json:"win_rate"`
+	AvgHoldingSeconds *float64   `json:"avg_holding_seconds"`
+	SharpeRatio       *float64   `json:"sharpe_ratio"`
+	ActiveDays        int        `json:"active_days"`
+}
+
+type dailyStats struct {
+	day            time.Time
+	volume         float64
+	trades         int64
+	fees           float64
+	realizedPnL    float64
+	roundTrips     int64
+	wins           int64
+	holdingSeconds float64
+}
+
+// UserMetrics computes the user's metrics over every window in Windows
+func UserMetrics(db *sql.DB, userID int64, now time.Time) ([]Metrics, error) {
+	rows, err := db.Query(
+		`SELECT day, volume, trades, fees, realized_pnl, round_trips, wins, holding_seconds
+		FROM trader_daily_stats WHERE user_id = ? ORDER BY day`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []dailyStats{}
+	for rows.Next() {
+		var d dailyStats
+		if err := rows.Scan(&d.day, &d.volume, &d.trades, &d.fees, &d.realizedPnL, &d.roundTrips, &d.wins, &d.holdingSeconds); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	today := startOfDay(now)
+	metrics := []Metrics{}
+	for _, window := range Windows {
+		m := Metrics{Window: window.Name}
+		var from time.Time
+		if window.Days > 0 {
+			from = today.AddDate(0, 0, 1-window.Days)
+			m.From = &from
+		}
+
+		var wins int64
+		var holding float64
+		pnls := []float64{}
+		for _, d := range days {
+			if d.day.Before(from) {
+				continue
+			}
+			m.Volume += d.volume
+			m.Trades += d.trades
+			m.Fees += d.fees
+			m.RealizedPnL += d.realizedPnL
+			m.RoundTrips += d.roundTrips
+			wins += d.wins
+			holding += d.holdingSeconds
+			pnls = append(pnls, d.realizedPnL)
+		}
+		m.ActiveDays = len(pnls)
+		if m.RoundTrips > 0 {
+			winRate := float64(wins) / float64(m.RoundTrips)
+			avgHolding := holding / float64(m.RoundTrips)
+			m.WinRate, m.AvgHoldingSeconds = &winRate, &avgHolding
+		}
+		m.SharpeRatio = sharpe(pnls)
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// sharpe is the annualized mean over the standard deviation of the daily
+// realized P&L of the days the trader traded. Without a capital base it is
+// only comparable between traders, not to the usual return based ratio.
+func sharpe(pnls []float64) *float64 {
+	if len(pnls) < 2 {
+		return nil
+	}
+	var mean float64
+	for _, pnl := range pnls {
+		mean += pnl
+	}
+	mean /= float64(len(pnls))
+
+	var variance float64
+	for _, pnl := range pnls {
+		variance += (pnl - mean) * (pnl - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(pnls)-1))
+	if stddev == 0 {
+		return nil
+	}
+	ratio := mean / stddev * math.Sqrt(tradingDays)
+	return &ratio
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
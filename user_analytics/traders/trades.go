@@ -0,0 +1,93 @@
+package traders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rohanchavan1918/kse-common/consumer"
+	"github.com/rohanchavan1918/kse-common/logging"
+	"github.com/rohanchavan1918/kse-common/tracing"
+	"github.com/segmentio/kafka-go"
+)
+
+// tradeFee is one side's charge, rebates are negative
+type tradeFee struct {
+	Amount float64 `json:"amount"`
+}
+
+// Trade is published by the order processor for every match
+type Trade struct {
+	TradeID     string  `json:"trade_id"`
+	Symbol      string  `json:"symbol"`
+	Price       float64 `json:"price"`
+	Quantity    float64 `json:"quantity"`
+	BuyOrderID  string  `json:"buy_order_id"`
+	SellOrderID string  `json:"sell_order_id"`
+	BuyUserID   int64   `json:"buy_user_id"`
+	SellUserID  int64   `json:"sell_user_id"`
+	MakerSide   string  `json:"maker_side"`
+	Fees        struct {
+		MakerFee tradeFee `json:"maker_fee"`
+		TakerFee tradeFee `json:"taker_fee"`
+	} `json:"fees"`
+	ExecutedAt time.Time `json:"executed_at"`
+}
+
+// Fill is one user's side of a trade
+type Fill struct {
+	TradeID    string
+	UserID     int64
+	Symbol     string
+	Side       string
+	Price      float64
+	Quantity   float64
+	Fee        float64
+	ExecutedAt time.Time
+}
+
+// Fills splits a trade into the buyer's and the seller's fill
+func (t *Trade) Fills() (Fill, Fill) {
+	buy := Fill{TradeID: t.TradeID, UserID: t.BuyUserID, Symbol: t.Symbol, Side: "buy", Price: t.Price, Quantity: t.Quantity, ExecutedAt: t.ExecutedAt}
+	sell := Fill{TradeID: t.TradeID, UserID: t.SellUserID, Symbol: t.Symbol, Side: "sell", Price: t.Price, Quantity: t.Quantity, ExecutedAt: t.ExecutedAt}
+	if t.MakerSide == "buy" {
+		buy.Fee, sell.Fee = t.Fees.MakerFee.Amount, t.Fees.TakerFee.Amount
+	} else {
+		buy.Fee, sell.Fee = t.Fees.TakerFee.Amount, t.Fees.MakerFee.Amount
+	}
+	return buy, sell
+}
+
+// ConsumeTrades books both sides of every trade into the traders' metrics
+// until ctx is done. A trade is retried until both sides are recorded.
+func ConsumeTrades(ctx context.Context, db *sql.DB, reader *kafka.Reader) {
+	consumer.Run(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		logger := logging.ForMessage(ctx, msg)
+
+		var trade Trade
+		if err := json.Unmarshal(msg.Value, &trade); err != nil {
+			logger.WithError(err).Error("Skipping malformed trade")
+			return nil
+		}
+		if trade.TradeID == "" || trade.Quantity <= 0 {
+			logger.WithField("trade_id", trade.TradeID).Error("Skipping trade without id or quantity")
+			return nil
+		}
+		if trade.ExecutedAt.IsZero() {
+			trade.ExecutedAt = msg.Time
+		}
+
+		buy, sell := trade.Fills()
+		for _, fill := range []Fill{buy, sell} {
+			// ApplyFill skips fills it already applied, so retrying the
+			// whole trade is safe
+			_, span := tracing.Start(ctx, "traders.ApplyFill")
+			if err := tracing.End(span, ApplyFill(db, fill)); err != nil {
+				return fmt.Errorf("cannot record trade %s for user %d : %w", fill.TradeID, fill.UserID, err)
+			}
+		}
+		return nil
+	})
+}